@@ -24,6 +24,8 @@ type E810Opts struct {
 	DpllSettings        map[string]uint64            `json:"settings"`
 	PhaseOffsetPins     map[string]map[string]string `json:"phaseOffsetPins"`
 	InputDelays         []InputPhaseDelays           `json:"interconnections"`
+	InputPriorities     map[string][]string          `json:"inputPriorities"` // DPLL input pin labels by descending priority, per device
+	DpllModes           map[string]string            `json:"dpllModes"`       // DPLL working mode, manual or automatic, per device
 }
 
 type E810UblxCmds struct {
@@ -178,6 +180,18 @@ func OnPTPConfigChangeE810(data *interface{}, nodeProfile *ptpv1.PtpProfile) err
 					(*nodeProfile).PtpSettings[k] = strconv.FormatUint(v, 10)
 				}
 			}
+			for device, labels := range e810Opts.InputPriorities {
+				key := fmt.Sprintf("%s[%s]", dpll.PinPrioritiesStr, device)
+				if _, ok := (*nodeProfile).PtpSettings[key]; !ok {
+					(*nodeProfile).PtpSettings[key] = strings.Join(labels, ",")
+				}
+			}
+			for device, mode := range e810Opts.DpllModes {
+				key := fmt.Sprintf("%s[%s]", dpll.DpllModeStr, device)
+				if _, ok := (*nodeProfile).PtpSettings[key]; !ok {
+					(*nodeProfile).PtpSettings[key] = mode
+				}
+			}
 			for iface, properties := range e810Opts.PhaseOffsetPins {
 				ifaceFound := false
 				for dev := range e810Opts.DevicePins {
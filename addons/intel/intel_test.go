@@ -1,9 +1,14 @@
 package intel
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+	"strconv"
 	"testing"
 
+	nl "github.com/openshift/linuxptp-daemon/pkg/dpll-netlink"
+	"github.com/openshift/linuxptp-daemon/pkg/dpll-netlink/dplltest"
 	ptpv1 "github.com/openshift/ptp-operator/api/v1"
 	"github.com/stretchr/testify/assert"
 	"sigs.k8s.io/yaml"
@@ -49,4 +54,54 @@ func Test_ProcessProfile(t *testing.T) {
 	assert.NoError(t, err)
 	err = OnPTPConfigChangeE810(nil, profile)
 	assert.NoError(t, err)
+	assert.Equal(t, "GNSS-1PPS,SMA1,C827_0-RCLKA", profile.PtpSettings["pinPriorities[ens7f0]"])
+	assert.Equal(t, "manual", profile.PtpSettings["dpllMode[ens7f0]"])
+}
+
+func Test_sendDelayCompensation(t *testing.T) {
+	profile, err := loadProfile("./testdata/profile-with-delays.yaml")
+	assert.NoError(t, err)
+	var e810Opts E810Opts
+	b, err := json.Marshal(profile.Plugins["e810"])
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(b, &e810Opts))
+
+	// every card has the EEC and PPS DPLL devices and the pins of an E810-XXVDA4T
+	sim := dplltest.New()
+	nl.SetDialer(sim.Dial)
+	defer nl.SetDialer(nil)
+	labels := []string{"GNSS-1PPS", "SMA1", "SMA2/U.FL2", "REF-SMA1"}
+	pinIds := map[string]uint32{}
+	for i, iface := range []string{"ens7f0", "ens4f0", "ens2f0"} {
+		clockId := uint64(0x507c6fffff1fb1b8 + i)
+		profile.PtpSettings[fmt.Sprintf("clockId[%s]", iface)] = strconv.FormatUint(clockId, 10)
+		for j, label := range labels {
+			id := uint32(i*len(labels) + j)
+			direction := uint32(nl.DPLL_PIN_DIRECTION_INPUT)
+			if label == "REF-SMA1" {
+				direction = nl.DPLL_PIN_DIRECTION_OUTPUT
+			}
+			sim.AddPin(nl.DoPinGetReply{Id: id, ClockId: clockId, BoardLabel: label,
+				ParentDevice: []nl.PinParentDevice{
+					{ParentId: uint32(2 * i), Direction: direction},
+					{ParentId: uint32(2*i + 1), Direction: direction},
+				}})
+			pinIds[iface+"/"+label] = id
+		}
+	}
+
+	comps, err := findDelayCompensation(e810Opts, profile)
+	assert.NoError(t, err)
+	assert.NoError(t, sendDelayCompensation(comps))
+	want := map[string]int32{
+		"ens7f0/SMA2/U.FL2": 920 + 9795,
+		"ens4f0/GNSS-1PPS":  6999,
+		"ens4f0/REF-SMA1":   1274,
+		"ens2f0/SMA2/U.FL2": 920 + 9795,
+		"ens2f0/REF-SMA1":   1274,
+	}
+	for name, id := range pinIds {
+		pin, _ := sim.Pin(id)
+		assert.Equal(t, want[name], pin.PhaseAdjust, name)
+	}
 }
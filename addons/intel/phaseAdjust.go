@@ -112,7 +112,10 @@ func sendDelayCompensation(comp *[]delayCompensation) error {
 			if err != nil {
 				return fmt.Errorf("failed to parse clock id %s: %v", dc.clockId, err)
 			}
-			if desiredClockId == pin.ClockId && strings.EqualFold(pin.BoardLabel, dc.pinLabel) {
+			// a pin is attached to the EEC and the PPS DPLL, the delay applies to the pin in the direction
+			// it is compensated for
+			if desiredClockId == pin.ClockId && strings.EqualFold(pin.BoardLabel, dc.pinLabel) &&
+				pinHasDirection(pin, dc.direction) {
 				err = conn.PinPhaseAdjust(dpll.PinPhaseAdjustRequest{Id: pin.Id, PhaseAdjust: dc.DelayPs})
 				if err != nil {
 					return fmt.Errorf("failed to send phase adjustment to %s clock id %d: %v",
@@ -126,6 +129,16 @@ func sendDelayCompensation(comp *[]delayCompensation) error {
 	return nil
 }
 
+// pinHasDirection ... true when the pin is an input or output, by name, towards one of its parent DPLL devices
+func pinHasDirection(pin *dpll.DoPinGetReply, direction string) bool {
+	for _, pd := range pin.ParentDevice {
+		if dpll.GetPinDirection(pd.Direction) == direction {
+			return true
+		}
+	}
+	return false
+}
+
 func findDelayCompensation(e810Opts E810Opts, nodeProfile *ptpv1.PtpProfile) (*[]delayCompensation, error) {
 	compensations := []delayCompensation{}
 	for _, card := range e810Opts.InputDelays {
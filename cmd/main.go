@@ -18,6 +18,8 @@ import (
 
 	"github.com/openshift/linuxptp-daemon/pkg/config"
 	"github.com/openshift/linuxptp-daemon/pkg/daemon"
+	"github.com/openshift/linuxptp-daemon/pkg/dpll"
+	"github.com/openshift/linuxptp-daemon/pkg/event"
 	"github.com/openshift/linuxptp-daemon/pkg/leap"
 	ptpv1 "github.com/openshift/ptp-operator/api/v1"
 	ptpclient "github.com/openshift/ptp-operator/pkg/client/clientset/versioned"
@@ -29,6 +31,13 @@ type cliParams struct {
 	updateInterval  int
 	profileDir      string
 	pmcPollInterval int
+	staleTimeout    int
+	staleAction     string
+	apiSocket       string
+	eventFormat     string
+	historySize     int
+	historyFile     string
+	holdoverModel   string
 }
 
 // Parse Command line flags
@@ -39,6 +48,20 @@ func flagInit(cp *cliParams) {
 		"profile to start linuxptp processes")
 	flag.IntVar(&cp.pmcPollInterval, "pmc-poll-interval", config.DefaultPmcPollInterval,
 		"Interval for periodical PMC poll")
+	flag.IntVar(&cp.staleTimeout, "stale-metrics-timeout", config.DefaultStaleMetricsTimeout,
+		"Time in seconds after which offset metrics that are no longer updated are considered stale, 0 disables")
+	flag.StringVar(&cp.staleAction, "stale-metrics-action", config.DefaultStaleMetricsAction,
+		"Action taken on stale offset metrics: faulty or delete")
+	flag.StringVar(&cp.apiSocket, "api-socket", config.DefaultAPISocketPath,
+		"Unix socket path for the read-only query API, empty disables")
+	flag.StringVar(&cp.eventFormat, "event-format", config.DefaultEventFormat,
+		"Format of the events written to the event socket: text, json (newline-delimited) or cloudevents")
+	flag.IntVar(&cp.historySize, "event-history-size", config.DefaultEventHistorySize,
+		"Number of state transitions, clock class changes, HA failovers and process status changes kept in the event history")
+	flag.StringVar(&cp.historyFile, "event-history-file", "",
+		"File the event history is kept in across restarts, empty keeps it in memory only")
+	flag.StringVar(&cp.holdoverModel, "holdover-model-dir", config.DefaultHoldoverModelDir,
+		"Directory the oscillator models learned for DPLL holdover are kept in across restarts, empty keeps them in memory only")
 }
 
 func main() {
@@ -49,6 +72,11 @@ func main() {
 	glog.Infof("resync period set to: %d [s]", cp.updateInterval)
 	glog.Infof("linuxptp profile path set to: %s", cp.profileDir)
 	glog.Infof("pmc poll interval set to: %d [s]", cp.pmcPollInterval)
+	glog.Infof("stale metrics timeout set to: %d [s], action: %s", cp.staleTimeout, cp.staleAction)
+	glog.Infof("query api socket set to: %s", cp.apiSocket)
+	glog.Infof("event format set to: %s", cp.eventFormat)
+	glog.Infof("event history size set to: %d, file: %s", cp.historySize, cp.historyFile)
+	glog.Infof("holdover model directory set to: %s", cp.holdoverModel)
 
 	cfg, err := config.GetKubeConfig()
 	if err != nil {
@@ -77,6 +105,17 @@ func main() {
 		return
 	}
 
+	if err = event.SetOutputFormat(event.EventFormat(cp.eventFormat), nodeName); err != nil {
+		glog.Error(err)
+		return
+	}
+	if err = event.ConfigureHistory(cp.historySize, cp.historyFile); err != nil {
+		glog.Errorf("failed to load event history, keeping it in memory only: %s", err)
+		_ = event.ConfigureHistory(cp.historySize, "")
+	}
+	defer event.EventHistory.Close()
+	dpll.SetModelDir(cp.holdoverModel)
+
 	// The name of NodePtpDevice CR for this node is equal to the node name
 	var stdoutToSocket = false
 	if val, ok := os.LookupEnv("LOGS_TO_SOCKET"); ok && val != "" {
@@ -118,7 +157,7 @@ func main() {
 	go lm.Run()
 
 	defer close(lm.Close)
-	go daemon.New(
+	dn := daemon.New(
 		nodeName,
 		daemon.PtpNamespace,
 		stdoutToSocket,
@@ -130,18 +169,30 @@ func main() {
 		&refreshNodePtpDevice,
 		closeProcessManager,
 		cp.pmcPollInterval,
-	).Run()
+	)
+	go dn.Run()
+
+	if cp.apiSocket != "" {
+		if err = os.MkdirAll(filepath.Dir(cp.apiSocket), 0755); err != nil {
+			glog.Errorf("failed to create query api socket directory: %v", err)
+		} else if apiServer, err := dn.StartAPIServer(cp.apiSocket); err != nil {
+			glog.Errorf("failed to start query api: %v", err)
+		} else {
+			defer apiServer.Close()
+		}
+	}
 
 	tickerPull := time.NewTicker(time.Second * time.Duration(cp.updateInterval))
 	defer tickerPull.Stop()
 
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
 	// by default metrics is hosted here,if LOGS_TO_SOCKET variable is set then metrics are disabled
 	if !stdoutToSocket { // if not sending metrics (log) out to a socket then host metrics here
 		daemon.StartMetricsServer("0.0.0.0:9091")
 	}
+	dn.StartStaleMetricsCollector(time.Duration(cp.staleTimeout)*time.Second, cp.staleAction, stopCh)
 
 	for {
 		select {
@@ -153,34 +204,53 @@ func main() {
 				refreshNodePtpDevice = false
 			}
 
-			nodeProfile := filepath.Join(cp.profileDir, nodeName)
-			if _, err := os.Stat(nodeProfile); err != nil {
-				if os.IsNotExist(err) {
-					glog.Infof("ptp profile doesn't exist for node: %v", nodeName)
-					continue
-				} else {
-					glog.Errorf("error stating node profile %v: %v", nodeName, err)
-					continue
-				}
-			}
-			nodeProfilesJson, err := os.ReadFile(nodeProfile)
-			if err != nil {
-				glog.Errorf("error reading node profile: %v", nodeProfile)
+			nodeProfilesJson, ok := readNodeProfile(cp.profileDir, nodeName)
+			if !ok {
 				continue
 			}
-
 			err = ptpConfUpdate.UpdateConfig(nodeProfilesJson)
 			if err != nil {
 				glog.Errorf("error updating the node configuration using the profiles loaded: %v", err)
 			}
 		case sig := <-sigCh:
-			glog.Info("signal received, shutting down", sig)
-			closeProcessManager <- true
-			return
+			switch sig {
+			case syscall.SIGHUP:
+				glog.Info("SIGHUP received, applying the ptp profile again")
+				if nodeProfilesJson, ok := readNodeProfile(cp.profileDir, nodeName); ok {
+					if err = ptpConfUpdate.ReloadConfig(nodeProfilesJson); err != nil {
+						glog.Errorf("error reloading the node configuration: %v", err)
+					}
+				}
+			case syscall.SIGUSR1:
+				dn.DumpState()
+			default:
+				glog.Info("signal received, shutting down", sig)
+				closeProcessManager <- true
+				return
+			}
 		}
 	}
 }
 
+// readNodeProfile ... profiles of the node written by the operator, false when there are none or they cannot be read
+func readNodeProfile(profileDir, nodeName string) ([]byte, bool) {
+	nodeProfile := filepath.Join(profileDir, nodeName)
+	if _, err := os.Stat(nodeProfile); err != nil {
+		if os.IsNotExist(err) {
+			glog.Infof("ptp profile doesn't exist for node: %v", nodeName)
+		} else {
+			glog.Errorf("error stating node profile %v: %v", nodeName, err)
+		}
+		return nil, false
+	}
+	nodeProfilesJson, err := os.ReadFile(nodeProfile)
+	if err != nil {
+		glog.Errorf("error reading node profile: %v", nodeProfile)
+		return nil, false
+	}
+	return nodeProfilesJson, true
+}
+
 type patchStringValue struct {
 	Op    string `json:"op"`
 	Path  string `json:"path"`
@@ -0,0 +1,484 @@
+// ptpctl queries the linuxptp daemon running on the node through its local query API.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/openshift/linuxptp-daemon/pkg/api"
+	"github.com/openshift/linuxptp-daemon/pkg/config"
+)
+
+const usage = `Usage: ptpctl [-socket path] [-o text|json] <command> [args]
+
+Commands:
+  status               GM clock tree and per config process state
+  processes            processes started by the daemon
+  config [name]        rendered configs, optionally filtered by config or profile name
+  events [-follow]     recent state transitions, -follow streams new ones
+  history [filters]    event history, filtered by -since 10m, -from/-to (RFC 3339), -process, -interface, -config
+  bundle [-file f] [filters]
+                       export a gzip compressed incident bundle of the filtered history
+  dpll [pins]          DPLL states, or the DPLL pins reported by the kernel
+  synce                synce4l devices and quality levels
+  unicast              unicast masters, grants and active master per port
+  leap                 leap file state
+  loglevel [-v n] [-packages dpll=4,event=2]
+                       daemon log verbosity, -v and -packages change it at runtime; -packages replaces the
+                       package levels, an empty list clears them
+  version              API version served by the daemon
+`
+
+type ctl struct {
+	client *api.Client
+	out    io.Writer
+	json   bool
+}
+
+func main() {
+	socket := flag.String("socket", config.DefaultAPISocketPath, "daemon query API socket")
+	output := flag.String("o", "text", "output format: text or json")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "unsupported output format %s\n", *output)
+		os.Exit(2)
+	}
+	c := &ctl{client: api.NewClient(*socket), out: os.Stdout, json: *output == "json"}
+	if err := c.run(flag.Arg(0), flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "ptpctl: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func (c *ctl) run(cmd string, args []string) error {
+	switch cmd {
+	case "status":
+		return c.status()
+	case "processes":
+		return c.processes()
+	case "config":
+		name := ""
+		if len(args) > 0 {
+			name = args[0]
+		}
+		return c.configs(name)
+	case "events":
+		fs := flag.NewFlagSet("events", flag.ContinueOnError)
+		follow := fs.Bool("follow", false, "stream state transitions")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		return c.events(*follow)
+	case "history", "bundle":
+		fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+		since := fs.Duration("since", 0, "only records of the last duration, e.g. 15m")
+		from := fs.String("from", "", "only records at or after this RFC 3339 time")
+		to := fs.String("to", "", "only records at or before this RFC 3339 time")
+		process := fs.String("process", "", "only records of this process")
+		iface := fs.String("interface", "", "only records of this interface")
+		cfgName := fs.String("config", "", "only records of this config")
+		file := fs.String("file", "", "bundle file, defaults to ptp-incident-<time>.json.gz")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		v := url.Values{"from": {*from}, "to": {*to}, "process": {*process}, "interface": {*iface}, "config": {*cfgName}}
+		if *since > 0 {
+			v.Set("since", since.String())
+		}
+		q, err := api.ParseHistoryQuery(v)
+		if err != nil {
+			return err
+		}
+		if cmd == "bundle" {
+			return c.bundle(q, *file)
+		}
+		return c.history(q)
+	case "dpll":
+		if len(args) > 0 && args[0] == "pins" {
+			return c.dpllPins()
+		}
+		return c.dpll()
+	case "synce":
+		return c.synce()
+	case "unicast":
+		return c.unicast()
+	case "leap":
+		return c.leap()
+	case "loglevel":
+		fs := flag.NewFlagSet("loglevel", flag.ContinueOnError)
+		v := fs.Int("v", 0, "verbosity of every package")
+		packages := fs.String("packages", "", "comma separated package=verbosity list, by directory name under pkg/")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		set := map[string]bool{}
+		fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		return c.logLevel(set["v"], *v, set["packages"], *packages)
+	case "version":
+		v, err := c.client.Version()
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return c.printJSON(v)
+		}
+		fmt.Fprintf(c.out, "node %s api %s\n", v.Node, v.Version)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q, run ptpctl -h for usage", cmd)
+	}
+}
+
+func (c *ctl) printJSON(v interface{}) error {
+	enc := json.NewEncoder(c.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (c *ctl) table(header ...string) *tabwriter.Writer {
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	return w
+}
+
+func (c *ctl) status() error {
+	s, err := c.client.Status()
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(s)
+	}
+	// the GM tree is only available on a grandmaster once every source reported its state
+	if tree, err := c.client.GMTree(); err == nil {
+		tree.Render(c.out)
+		fmt.Fprintln(c.out)
+	}
+	fmt.Fprintf(c.out, "node %s clock class %d\n", s.Node, s.ClockClass)
+	if len(s.ClockClasses) > 1 {
+		configs := make([]string, 0, len(s.ClockClasses))
+		for cfgName := range s.ClockClasses {
+			configs = append(configs, cfgName)
+		}
+		sort.Strings(configs)
+		for _, cfgName := range configs {
+			fmt.Fprintf(c.out, "  %s clock class %d\n", cfgName, s.ClockClasses[cfgName])
+		}
+	}
+	fmt.Fprintln(c.out)
+	w := c.table("CONFIG", "PROCESS", "INTERFACE", "STATE", "CLOCK TYPE", "SOURCE LOST", "LAST UPDATE", "VALUES")
+	for _, p := range s.Processes {
+		for _, d := range p.Details {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%v\t%s\t%s\n", p.ConfigName, p.Process, d.Interface, d.State,
+				d.ClockType, d.SourceLost, d.LastUpdate.Local().Format(time.RFC3339), formatValues(d.Values))
+		}
+	}
+	w.Flush()
+	if len(s.GMSyncState) > 0 {
+		fmt.Fprintln(c.out)
+		w = c.table("CONFIG", "INTERFACE", "GM STATE", "CLOCK CLASS", "CLOCK ACCURACY", "SOURCE LOST")
+		for _, g := range s.GMSyncState {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t0x%x\t%v\n", g.ConfigName, g.Interface, g.State, g.ClockClass, g.ClockAccuracy, g.SourceLost)
+		}
+		w.Flush()
+	}
+	return nil
+}
+
+func (c *ctl) processes() error {
+	ps, err := c.client.Processes()
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(ps)
+	}
+	w := c.table("PROCESS", "PROFILE", "CONFIG", "PID", "RUNNING", "INTERFACES", "DEPENDENT")
+	for _, p := range ps {
+		pid := "-"
+		if p.Pid != 0 {
+			pid = fmt.Sprint(p.Pid)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%v\t%s\t%s\n", p.Name, p.Profile, p.ConfigName, pid, p.Running,
+			strings.Join(p.Interfaces, ","), strings.Join(p.DependsOn, ","))
+	}
+	return w.Flush()
+}
+
+func (c *ctl) configs(name string) error {
+	cfgs, err := c.client.Configs(name)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(cfgs)
+	}
+	for _, cfg := range cfgs {
+		fmt.Fprintf(c.out, "# %s (profile %s, process %s) %s\n%s\n", cfg.Name, cfg.Profile, cfg.Process, cfg.Path, cfg.Content)
+	}
+	return nil
+}
+
+func (c *ctl) events(follow bool) error {
+	print := func(t api.StateTransition) {
+		if c.json {
+			_ = json.NewEncoder(c.out).Encode(t)
+			return
+		}
+		fmt.Fprintf(c.out, "%s %s %s %s %s -> %s\n", t.Time.Local().Format(time.RFC3339Nano), t.ConfigName,
+			t.Process, t.Interface, t.From, t.To)
+	}
+	if !follow {
+		ts, err := c.client.Events()
+		if err != nil {
+			return err
+		}
+		for _, t := range ts {
+			print(t)
+		}
+		return nil
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	return c.client.FollowEvents(ctx, print)
+}
+
+func (c *ctl) history(q api.HistoryQuery) error {
+	records, err := c.client.History(q)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(records)
+	}
+	w := c.table("TIME", "KIND", "CONFIG", "PROCESS", "INTERFACE", "STATE", "CLOCK CLASS", "SOURCE LOST", "VALUES")
+	for _, r := range records {
+		class := "-"
+		if r.ClockClass != nil {
+			class = fmt.Sprint(*r.ClockClass)
+		}
+		values := make(map[string]float64, len(r.Values))
+		for k, v := range r.Values {
+			if f, ok := v.(float64); ok {
+				values[k] = f
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%v\t%s\n", r.Time.Local().Format(time.RFC3339Nano), r.Kind, r.ConfigName,
+			r.Process, r.Interface, r.State, class, r.SourceLost, formatValues(values))
+	}
+	return w.Flush()
+}
+
+func (c *ctl) bundle(q api.HistoryQuery, file string) error {
+	if file == "" {
+		file = fmt.Sprintf("ptp-incident-%s.json.gz", time.Now().UTC().Format("20060102T150405Z"))
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err = c.client.Bundle(q, f); err != nil {
+		f.Close()
+		os.Remove(file)
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "incident bundle written to %s\n", file)
+	return nil
+}
+
+func (c *ctl) dpll() error {
+	ds, err := c.client.Dpll()
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(ds)
+	}
+	w := c.table("CONFIG", "INTERFACE", "CLOCK ID", "DEPENDS ON", "STATE", "FREQUENCY", "PHASE", "PHASE OFFSET", "IN SPEC", "HOLDOVER")
+	for _, d := range ds {
+		fmt.Fprintf(w, "%s\t%s\t0x%x\t%s\t%s\t%d\t%d\t%d\t%v\t%v\n", d.ConfigName, d.Interface, d.ClockID, d.DependsOn,
+			d.State, d.FrequencyStatus, d.PhaseStatus, d.PhaseOffset, d.InSpec, d.OnHoldover)
+	}
+	return w.Flush()
+}
+
+func (c *ctl) dpllPins() error {
+	pins, err := c.client.DpllPins()
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(pins)
+	}
+	sort.SliceStable(pins, func(i, j int) bool {
+		if pins[i].ClockId != pins[j].ClockId {
+			return pins[i].ClockId < pins[j].ClockId
+		}
+		return pins[i].Id < pins[j].Id
+	})
+	w := c.table("ID", "CLOCK ID", "BOARD LABEL", "PANEL LABEL", "TYPE", "PARENT", "DIRECTION", "PRIO", "STATE", "PHASE OFFSET", "FREQUENCY")
+	// one row per parent DPLL device and parent pin of the pin
+	for _, p := range pins {
+		for _, pd := range p.ParentDevice {
+			fmt.Fprintf(w, "%d\t0x%x\t%s\t%s\t%s\tdpll %d\t%s\t%d\t%s\t%d\t%d\n", p.Id, p.ClockId, p.BoardLabel, p.PanelLabel,
+				p.Type, pd.ParentId, pd.Direction, pd.Prio, pd.State, pd.PhaseOffset, p.Frequency)
+		}
+		for _, pp := range p.ParentPin {
+			fmt.Fprintf(w, "%d\t0x%x\t%s\t%s\t%s\tpin %d\t-\t-\t%s\t-\t%d\n", p.Id, p.ClockId, p.BoardLabel, p.PanelLabel,
+				p.Type, pp.ParentId, pp.State, p.Frequency)
+		}
+		if len(p.ParentDevice) == 0 && len(p.ParentPin) == 0 {
+			fmt.Fprintf(w, "%d\t0x%x\t%s\t%s\t%s\t-\t-\t-\t-\t-\t%d\n", p.Id, p.ClockId, p.BoardLabel, p.PanelLabel,
+				p.Type, p.Frequency)
+		}
+	}
+	return w.Flush()
+}
+
+func (c *ctl) synce() error {
+	ds, err := c.client.Synce()
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(ds)
+	}
+	w := c.table("CONFIG", "DEVICE", "CLOCK ID", "STATE", "INTERFACE", "SSM", "EXT SSM")
+	for _, d := range ds {
+		for _, iface := range d.Interfaces {
+			ssm, extSsm := "-", "-"
+			if ql, ok := d.QualityLevels[iface]; ok {
+				ssm, extSsm = fmt.Sprintf("0x%x", ql.SSM), fmt.Sprintf("0x%x", ql.ExtendedSSM)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", d.ConfigName, d.Name, d.ClockID, d.State, iface, ssm, extSsm)
+		}
+	}
+	return w.Flush()
+}
+
+func (c *ctl) unicast() error {
+	ports, err := c.client.Unicast()
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(ports)
+	}
+	w := c.table("CONFIG", "INTERFACE", "TABLE", "MASTERS", "ACTIVE MASTER", "GRANTS")
+	for _, p := range ports {
+		active := p.ActiveMaster
+		if active == "" {
+			active = "-"
+		}
+		grants := make([]string, 0, len(p.Grants))
+		for _, g := range p.Grants {
+			grants = append(grants, fmt.Sprintf("%s:%s", g.Message, g.Result))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", p.ConfigName, p.Interface, p.Table,
+			strings.Join(p.Masters, ","), active, strings.Join(grants, " "))
+	}
+	return w.Flush()
+}
+
+func (c *ctl) leap() error {
+	l, err := c.client.Leap()
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(l)
+	}
+	fmt.Fprintf(c.out, "UTC offset:  %d\nexpiration:  %s\nupdate time: %s\nhash:        %s\n", l.UtcOffset,
+		l.ExpirationTime, l.UpdateTime, l.Hash)
+	if len(l.Events) > 0 {
+		last := l.Events[len(l.Events)-1]
+		fmt.Fprintf(c.out, "last leap:   %s %d %s\n", last.LeapTime, last.LeapSec, last.Comment)
+	}
+	return nil
+}
+
+func (c *ctl) logLevel(setV bool, v int, setPackages bool, packages string) error {
+	l, err := c.client.LogLevel()
+	if err != nil {
+		return err
+	}
+	if setV || setPackages {
+		if setV {
+			l.V = v
+		}
+		if setPackages {
+			if l.Packages, err = parsePackageLevels(packages); err != nil {
+				return err
+			}
+		}
+		if l, err = c.client.SetLogLevel(l); err != nil {
+			return err
+		}
+	}
+	if c.json {
+		return c.printJSON(l)
+	}
+	fmt.Fprintf(c.out, "v %d\n", l.V)
+	names := make([]string, 0, len(l.Packages))
+	for p := range l.Packages {
+		names = append(names, p)
+	}
+	sort.Strings(names)
+	for _, p := range names {
+		fmt.Fprintf(c.out, "%s %d\n", p, l.Packages[p])
+	}
+	return nil
+}
+
+// parsePackageLevels ... package levels of a dpll=4,event=2 list
+func parsePackageLevels(s string) (map[string]int, error) {
+	levels := map[string]int{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		name, level, found := strings.Cut(item, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid package level %q, expected package=verbosity", item)
+		}
+		n, err := strconv.Atoi(level)
+		if err != nil {
+			return nil, fmt.Errorf("invalid verbosity of package %s: %q", name, level)
+		}
+		levels[strings.TrimSpace(name)] = n
+	}
+	return levels, nil
+}
+
+func formatValues(values map[string]float64) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, values[k]))
+	}
+	return strings.Join(parts, " ")
+}
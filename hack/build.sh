@@ -12,3 +12,4 @@ export GO15VENDOREXPERIMENT=1
 export GOBIN=${PWD}/bin
 export GOPATH=${PWD}/.gopath
 go build --mod=vendor "$@" -o bin/ptp ${REPO_PATH}/cmd
+go build --mod=vendor "$@" -o bin/ptpctl ${REPO_PATH}/cmd/ptpctl
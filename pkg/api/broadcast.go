@@ -0,0 +1,81 @@
+package api
+
+import (
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+const (
+	subscriberBufferSize = 64
+	recentTransitions    = 100
+)
+
+// Transitions fans out state transitions to the API subscribers
+var Transitions = NewBroadcaster(recentTransitions)
+
+// Broadcaster keeps the most recent state transitions and fans them out to subscribers
+type Broadcaster struct {
+	sync.Mutex
+	subscribers map[int]chan StateTransition
+	nextID      int
+	recent      []StateTransition
+	size        int
+}
+
+// NewBroadcaster creates a broadcaster keeping the last size transitions
+func NewBroadcaster(size int) *Broadcaster {
+	return &Broadcaster{
+		subscribers: map[int]chan StateTransition{},
+		size:        size,
+	}
+}
+
+// PublishTransition publishes a state transition to every API subscriber
+func PublishTransition(t StateTransition) {
+	Transitions.Publish(t)
+}
+
+// Publish records the transition and sends it to every subscriber without blocking
+func (b *Broadcaster) Publish(t StateTransition) {
+	b.Lock()
+	defer b.Unlock()
+	b.recent = append(b.recent, t)
+	if len(b.recent) > b.size {
+		b.recent = b.recent[len(b.recent)-b.size:]
+	}
+	for id, ch := range b.subscribers {
+		select {
+		case ch <- t:
+		default:
+			glog.Warningf("api subscriber %d is too slow, dropping %s transition", id, t.Process)
+		}
+	}
+}
+
+// Recent returns a copy of the last recorded transitions, oldest first
+func (b *Broadcaster) Recent() []StateTransition {
+	b.Lock()
+	defer b.Unlock()
+	out := make([]StateTransition, len(b.recent))
+	copy(out, b.recent)
+	return out
+}
+
+// Subscribe returns a channel receiving every new transition and a function to cancel the subscription
+func (b *Broadcaster) Subscribe() (<-chan StateTransition, func()) {
+	b.Lock()
+	defer b.Unlock()
+	id := b.nextID
+	b.nextID++
+	ch := make(chan StateTransition, subscriberBufferSize)
+	b.subscribers[id] = ch
+	return ch, func() {
+		b.Lock()
+		defer b.Unlock()
+		if _, ok := b.subscribers[id]; ok {
+			delete(b.subscribers, id)
+			close(ch)
+		}
+	}
+}
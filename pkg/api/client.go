@@ -0,0 +1,203 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/openshift/linuxptp-daemon/pkg/debug"
+)
+
+// Client queries the API over the daemon unix socket
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// NewClient creates a client connecting to the API served on socketPath
+func NewClient(socketPath string) *Client {
+	return &Client{
+		baseURL: "http://localhost",
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// NewClientForURL creates a client for an API served over TCP, used by unit tests
+func NewClientForURL(baseURL string) *Client {
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), http: http.DefaultClient}
+}
+
+// Version returns the API version of the daemon
+func (c *Client) Version() (v VersionInfo, err error) {
+	err = c.get(context.Background(), "/api/version", &v)
+	return
+}
+
+// Status returns the event handler state
+func (c *Client) Status() (s Status, err error) {
+	err = c.get(context.Background(), "/status", &s)
+	return
+}
+
+// GMTree returns the GM clock tree
+func (c *Client) GMTree() (n debug.Node, err error) {
+	err = c.get(context.Background(), "/gmtree", &n)
+	return
+}
+
+// Processes returns the processes started by the daemon
+func (c *Client) Processes() (p []Process, err error) {
+	err = c.get(context.Background(), "/processes", &p)
+	return
+}
+
+// Configs returns the rendered configs, all of them when name is empty
+func (c *Client) Configs(name string) (cfg []Config, err error) {
+	path := "/configs"
+	if name != "" {
+		path += "/" + url.PathEscape(name)
+	}
+	err = c.get(context.Background(), path, &cfg)
+	return
+}
+
+// Synce returns the synce4l devices
+func (c *Client) Synce() (d []SynceDevice, err error) {
+	err = c.get(context.Background(), "/synce", &d)
+	return
+}
+
+// Dpll returns the DPLL states
+func (c *Client) Dpll() (d []Dpll, err error) {
+	err = c.get(context.Background(), "/dpll", &d)
+	return
+}
+
+// DpllPins returns the DPLL pins
+func (c *Client) DpllPins() (p []DpllPin, err error) {
+	err = c.get(context.Background(), "/dpll/pins", &p)
+	return
+}
+
+// Unicast returns the unicast state of the ports using a master table
+func (c *Client) Unicast() (u []UnicastPort, err error) {
+	err = c.get(context.Background(), "/unicast", &u)
+	return
+}
+
+// Leap returns the leap file state
+func (c *Client) Leap() (l Leap, err error) {
+	err = c.get(context.Background(), "/leap", &l)
+	return
+}
+
+// Events returns the most recent state transitions
+func (c *Client) Events() (t []StateTransition, err error) {
+	err = c.get(context.Background(), "/events", &t)
+	return
+}
+
+// History returns the event history records selected by q
+func (c *Client) History(q HistoryQuery) (r []HistoryRecord, err error) {
+	err = c.get(context.Background(), "/history?"+q.Values().Encode(), &r)
+	return
+}
+
+// Bundle writes the gzip compressed incident bundle of the history selected by q to w
+func (c *Client) Bundle(q HistoryQuery, w io.Writer) error {
+	resp, err := c.do(context.Background(), "/history/bundle?"+q.Values().Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// LogLevel returns the glog verbosity of the daemon
+func (c *Client) LogLevel() (l LogLevel, err error) {
+	err = c.get(context.Background(), "/loglevel", &l)
+	return
+}
+
+// SetLogLevel sets the glog verbosity of the daemon and returns the verbosity applied
+func (c *Client) SetLogLevel(l LogLevel) (applied LogLevel, err error) {
+	body, err := json.Marshal(l)
+	if err != nil {
+		return applied, err
+	}
+	resp, err := c.request(context.Background(), http.MethodPut, "/loglevel", bytes.NewReader(body))
+	if err != nil {
+		return applied, err
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(&applied)
+	return
+}
+
+// FollowEvents calls fn for every state transition until ctx is done or the daemon closes the stream
+func (c *Client) FollowEvents(ctx context.Context, fn func(StateTransition)) error {
+	resp, err := c.do(ctx, "/events?follow=true")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var t StateTransition
+		if err = dec.Decode(&t); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		fn(t)
+	}
+}
+
+func (c *Client) get(ctx context.Context, path string, v interface{}) error {
+	resp, err := c.do(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *Client) do(ctx context.Context, path string) (*http.Response, error) {
+	return c.request(ctx, http.MethodGet, path, nil)
+}
+
+func (c *Client) request(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	if !strings.HasPrefix(path, "/api/") {
+		path = "/api/" + Version + path
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,67 @@
+package api_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openshift/linuxptp-daemon/pkg/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	ts := httptest.NewServer(api.NewServer("", "node1", &fakeProvider{leapRunning: true}).Handler())
+	defer ts.Close()
+	c := api.NewClientForURL(ts.URL)
+
+	v, err := c.Version()
+	assert.NoError(t, err)
+	assert.Equal(t, "node1", v.Node)
+
+	cfgs, err := c.Configs("ptp4l.1.config")
+	assert.NoError(t, err)
+	assert.Len(t, cfgs, 1)
+	assert.Equal(t, "slave", cfgs[0].Profile)
+
+	l, err := c.Leap()
+	assert.NoError(t, err)
+	assert.Equal(t, 37, l.UtcOffset)
+
+	ports, err := c.Unicast()
+	assert.NoError(t, err)
+	assert.Len(t, ports, 1)
+	assert.Equal(t, "507c6f.fffe.1fb1b8", ports[0].ActiveMaster)
+	assert.Equal(t, "granted", ports[0].Grants[0].Result)
+
+	_, err = c.DpllPins()
+	assert.ErrorContains(t, err, "dpll netlink is not available")
+
+	_, err = c.Configs("unknown")
+	assert.ErrorContains(t, err, "404")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	received := make(chan api.StateTransition, 1)
+	go func() {
+		assert.NoError(t, c.FollowEvents(ctx, func(st api.StateTransition) {
+			select {
+			case received <- st:
+			default:
+			}
+		}))
+	}()
+	// publish until the follower has subscribed
+	for done := false; !done; {
+		api.PublishTransition(api.StateTransition{Process: "ts2phc", From: "s0", To: "s2"})
+		select {
+		case st := <-received:
+			assert.Equal(t, "s2", st.To)
+			cancel()
+			done = true
+		case <-time.After(50 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("no event received")
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+var (
+	// packageNameRegEx ... directory name of a package of the daemon under pkg/
+	packageNameRegEx = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+	logLevel = struct {
+		sync.Mutex
+		packages map[string]int
+	}{packages: map[string]int{}}
+)
+
+// LogLevel is the glog verbosity of the daemon: V applies to every package, Packages overrides it per package
+// under pkg/, by directory name
+type LogLevel struct {
+	V        int            `json:"v"`
+	Packages map[string]int `json:"packages,omitempty"`
+}
+
+// CurrentLogLevel returns the verbosity set with -v and the package levels set through the API
+func CurrentLogLevel() LogLevel {
+	l := LogLevel{}
+	if f := flag.Lookup("v"); f != nil {
+		l.V, _ = strconv.Atoi(f.Value.String())
+	}
+	logLevel.Lock()
+	defer logLevel.Unlock()
+	if len(logLevel.packages) > 0 {
+		l.Packages = make(map[string]int, len(logLevel.packages))
+		for p, v := range logLevel.packages {
+			l.Packages[p] = v
+		}
+	}
+	return l
+}
+
+// SetLogLevel sets the verbosity of every package and replaces the package levels, which are applied as glog
+// -vmodule patterns matching the source files of each package
+func SetLogLevel(l LogLevel) error {
+	if l.V < 0 {
+		return fmt.Errorf("invalid verbosity %d", l.V)
+	}
+	patterns := make([]string, 0, len(l.Packages))
+	for p, v := range l.Packages {
+		if !packageNameRegEx.MatchString(p) {
+			return fmt.Errorf("invalid package name %q", p)
+		}
+		if v < 0 {
+			return fmt.Errorf("invalid verbosity %d of package %s", v, p)
+		}
+		patterns = append(patterns, fmt.Sprintf("%spkg/%s/*=%d", sourceRoot(), p, v))
+	}
+	sort.Strings(patterns)
+	logLevel.Lock()
+	defer logLevel.Unlock()
+	if err := flag.Set("v", strconv.Itoa(l.V)); err != nil {
+		return err
+	}
+	if err := flag.Set("vmodule", strings.Join(patterns, ",")); err != nil {
+		return err
+	}
+	logLevel.packages = map[string]int{}
+	for p, v := range l.Packages {
+		logLevel.packages[p] = v
+	}
+	glog.Infof("log verbosity set to %d, packages %v", l.V, l.Packages)
+	return nil
+}
+
+// sourceRoot is the path of the module in the file names glog matches -vmodule patterns against,
+// as compiled into this binary
+func sourceRoot() string {
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		return ""
+	}
+	return strings.TrimSuffix(file, "pkg/api/loglevel.go")
+}
@@ -0,0 +1,321 @@
+package api
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/openshift/linuxptp-daemon/pkg/debug"
+)
+
+// Provider gives read access to the daemon state exposed by the API
+type Provider interface {
+	Status() Status
+	Processes() []Process
+	Configs() []Config
+	Synce() []SynceDevice
+	Dpll() []Dpll
+	DpllPins() ([]DpllPin, error)
+	Unicast() []UnicastPort
+	Leap() (Leap, bool)
+	History(q HistoryQuery) []HistoryRecord
+}
+
+// Server serves the query API as HTTP over a unix socket, the log verbosity is the only state it changes
+//
+//	GET /api/version                 api version and node name
+//	GET /api/v1/status               event handler data and GM sync state per config
+//	GET /api/v1/gmtree               GM clock tree, available once GM states are known
+//	GET /api/v1/processes            processes started by the daemon
+//	GET /api/v1/configs[/<name>]     rendered configuration files
+//	GET /api/v1/synce                synce4l devices and quality levels
+//	GET /api/v1/dpll                 DPLL states
+//	GET /api/v1/dpll/pins            DPLL pins of the netlink monitor model
+//	GET /api/v1/unicast              unicast masters, grants and active master of the ports using a master table
+//	GET /api/v1/leap                 leap file state
+//	GET /api/v1/events[?follow=true] recent state transitions, or a live newline-delimited JSON stream
+//	GET /api/v1/history              event history, filtered by from, to, since, process, interface and config
+//	GET /api/v1/history/bundle       gzip compressed incident bundle of the filtered history and the daemon state
+//	GET /api/v1/loglevel             glog verbosity, globally and per package
+//	PUT /api/v1/loglevel             set the glog verbosity, the body is a LogLevel
+type Server struct {
+	socketPath string
+	node       string
+	provider   Provider
+	server     *http.Server
+	listener   net.Listener
+}
+
+// NewServer creates a query API server listening on socketPath
+func NewServer(socketPath, node string, provider Provider) *Server {
+	s := &Server{
+		socketPath: socketPath,
+		node:       node,
+		provider:   provider,
+	}
+	s.server = &http.Server{Handler: s.Handler()}
+	return s
+}
+
+// Start listens on the unix socket and serves requests in the background
+func (s *Server) Start() error {
+	if err := os.Remove(s.socketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale api socket %s: %w", s.socketPath, err)
+	}
+	l, err := net.Listen("unix", s.socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on api socket %s: %w", s.socketPath, err)
+	}
+	s.listener = l
+	glog.Infof("serving query api %s on %s", Version, s.socketPath)
+	go func() {
+		if err := s.server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			glog.Errorf("query api server stopped: %s", err)
+		}
+	}()
+	return nil
+}
+
+// Close stops the server and removes the socket
+func (s *Server) Close() error {
+	err := s.server.Close()
+	os.Remove(s.socketPath)
+	return err
+}
+
+// Handler returns the http handler of the API, used by Start and by unit tests
+func (s *Server) Handler() http.Handler {
+	prefix := "/api/" + Version
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/version", s.readOnly(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, VersionInfo{Version: Version, Node: s.node})
+	}))
+	mux.HandleFunc(prefix+"/status", s.readOnly(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.provider.Status())
+	}))
+	mux.HandleFunc(prefix+"/gmtree", s.readOnly(func(w http.ResponseWriter, r *http.Request) {
+		tree, ok := debug.GMTree()
+		if !ok {
+			http.Error(w, "GM tree is not available", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, tree)
+	}))
+	mux.HandleFunc(prefix+"/processes", s.readOnly(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.provider.Processes())
+	}))
+	mux.HandleFunc(prefix+"/configs", s.readOnly(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.provider.Configs())
+	}))
+	mux.HandleFunc(prefix+"/configs/", s.readOnly(s.config))
+	mux.HandleFunc(prefix+"/synce", s.readOnly(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.provider.Synce())
+	}))
+	mux.HandleFunc(prefix+"/dpll", s.readOnly(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.provider.Dpll())
+	}))
+	mux.HandleFunc(prefix+"/dpll/pins", s.readOnly(func(w http.ResponseWriter, r *http.Request) {
+		pins, err := s.provider.DpllPins()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, pins)
+	}))
+	mux.HandleFunc(prefix+"/unicast", s.readOnly(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.provider.Unicast())
+	}))
+	mux.HandleFunc(prefix+"/leap", s.readOnly(func(w http.ResponseWriter, r *http.Request) {
+		leap, ok := s.provider.Leap()
+		if !ok {
+			http.Error(w, "leap manager is not running", http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, leap)
+	}))
+	mux.HandleFunc(prefix+"/events", s.readOnly(s.events))
+	mux.HandleFunc(prefix+"/history", s.readOnly(func(w http.ResponseWriter, r *http.Request) {
+		q, err := ParseHistoryQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, s.provider.History(q))
+	}))
+	mux.HandleFunc(prefix+"/history/bundle", s.readOnly(s.bundle))
+	mux.HandleFunc(prefix+"/loglevel", s.logLevel)
+	return mux
+}
+
+// config returns a single rendered config matched either by config file name or by profile name
+func (s *Server) config(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/"+Version+"/configs/")
+	var matched []Config
+	for _, c := range s.provider.Configs() {
+		if c.Name == name || c.Profile == name {
+			matched = append(matched, c)
+		}
+	}
+	if len(matched) == 0 {
+		http.Error(w, fmt.Sprintf("config %s not found", name), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, matched)
+}
+
+func (s *Server) events(w http.ResponseWriter, r *http.Request) {
+	follow, _ := strconv.ParseBool(r.URL.Query().Get("follow"))
+	if !follow {
+		writeJSON(w, Transitions.Recent())
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	ch, cancel := Transitions.Subscribe()
+	defer cancel()
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case t, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := enc.Encode(t); err != nil {
+				glog.Infof("api event subscriber left: %s", err)
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// bundle writes the incident bundle of the queried time range
+func (s *Server) bundle(w http.ResponseWriter, r *http.Request) {
+	q, err := ParseHistoryQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	b := IncidentBundle{
+		Version:   Version,
+		Node:      s.node,
+		Generated: now,
+		Query:     q,
+		Records:   s.provider.History(q),
+		Status:    s.provider.Status(),
+		Processes: s.provider.Processes(),
+		Configs:   s.provider.Configs(),
+		Dpll:      s.provider.Dpll(),
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("ptp-incident-%s-%s.json.gz", s.node, now.UTC().Format("20060102T150405Z"))))
+	gz := gzip.NewWriter(w)
+	defer gz.Close()
+	if err = json.NewEncoder(gz).Encode(b); err != nil {
+		glog.Errorf("failed to encode incident bundle: %s", err)
+	}
+}
+
+// logLevel returns or sets the glog verbosity
+func (s *Server) logLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var l LogLevel
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&l); err != nil {
+			http.Error(w, fmt.Sprintf("invalid log level: %s", err), http.StatusBadRequest)
+			return
+		}
+		if err := SetLogLevel(l); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPut)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, CurrentLogLevel())
+}
+
+// ParseHistoryQuery reads the history filter from the from, to (RFC 3339), since (duration before now),
+// process, interface and config parameters
+func ParseHistoryQuery(v url.Values) (q HistoryQuery, err error) {
+	q.Process, q.Interface, q.ConfigName = v.Get("process"), v.Get("interface"), v.Get("config")
+	if s := v.Get("from"); s != "" {
+		if q.From, err = time.Parse(time.RFC3339, s); err != nil {
+			return q, fmt.Errorf("invalid from time: %w", err)
+		}
+	}
+	if s := v.Get("to"); s != "" {
+		if q.To, err = time.Parse(time.RFC3339, s); err != nil {
+			return q, fmt.Errorf("invalid to time: %w", err)
+		}
+	}
+	if s := v.Get("since"); s != "" {
+		var d time.Duration
+		if d, err = time.ParseDuration(s); err != nil {
+			return q, fmt.Errorf("invalid since duration: %w", err)
+		}
+		q.From = time.Now().Add(-d)
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From) {
+		return q, fmt.Errorf("to %s is before from %s", q.To.Format(time.RFC3339), q.From.Format(time.RFC3339))
+	}
+	return q, nil
+}
+
+// Values encodes the query as URL parameters, the inverse of ParseHistoryQuery
+func (q HistoryQuery) Values() url.Values {
+	v := url.Values{}
+	if !q.From.IsZero() {
+		v.Set("from", q.From.Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		v.Set("to", q.To.Format(time.RFC3339))
+	}
+	for k, s := range map[string]string{"process": q.Process, "interface": q.Interface, "config": q.ConfigName} {
+		if s != "" {
+			v.Set(k, s)
+		}
+	}
+	return v
+}
+
+func (s *Server) readOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "the query api is read-only", http.StatusMethodNotAllowed)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		glog.Errorf("failed to encode api response: %s", err)
+	}
+}
@@ -0,0 +1,212 @@
+package api_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/openshift/linuxptp-daemon/pkg/api"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProvider struct {
+	leapRunning bool
+}
+
+func (f *fakeProvider) Status() api.Status {
+	return api.Status{Node: "node1", ClockClass: 6}
+}
+
+func (f *fakeProvider) Processes() []api.Process {
+	return []api.Process{{Name: "ptp4l", Profile: "gm", ConfigName: "ptp4l.0.config", Running: true}}
+}
+
+func (f *fakeProvider) Configs() []api.Config {
+	return []api.Config{
+		{Name: "ptp4l.0.config", Profile: "gm", Process: "ptp4l", Content: "[global]\n"},
+		{Name: "ts2phc.0.config", Profile: "gm", Process: "ts2phc", Content: "[global]\n"},
+		{Name: "ptp4l.1.config", Profile: "slave", Process: "ptp4l", Content: "[global]\n"},
+	}
+}
+
+func (f *fakeProvider) Synce() []api.SynceDevice {
+	return []api.SynceDevice{}
+}
+
+func (f *fakeProvider) Dpll() []api.Dpll {
+	return []api.Dpll{{Interface: "ens1f0", ClockID: 1, State: "s2"}}
+}
+
+func (f *fakeProvider) DpllPins() ([]api.DpllPin, error) {
+	return nil, errors.New("dpll netlink is not available")
+}
+
+func (f *fakeProvider) Unicast() []api.UnicastPort {
+	return []api.UnicastPort{{ConfigName: "ptp4l.1.config", Interface: "ens1f0", Table: 1, Masters: []string{"UDPv4 10.0.0.1"},
+		ActiveMaster: "507c6f.fffe.1fb1b8", Grants: []api.UnicastGrant{{Message: "Announce", Result: "granted", Duration: 300}}}}
+}
+
+func (f *fakeProvider) Leap() (api.Leap, bool) {
+	return api.Leap{UtcOffset: 37}, f.leapRunning
+}
+
+func (f *fakeProvider) History(q api.HistoryQuery) []api.HistoryRecord {
+	records := []api.HistoryRecord{}
+	for _, r := range []api.HistoryRecord{
+		{Time: time.Unix(1700000000, 0), Kind: "gm_state", Process: "GM", Interface: "ens1f0", State: "s2"},
+		{Time: time.Unix(1700000060, 0), Kind: "state", Process: "gnss", Interface: "ens1f0", State: "s0", SourceLost: true},
+		{Time: time.Unix(1700000120, 0), Kind: "gm_state", Process: "GM", Interface: "ens1f0", State: "s1"},
+	} {
+		if (q.From.IsZero() || !r.Time.Before(q.From)) && (q.To.IsZero() || !r.Time.After(q.To)) &&
+			(q.Process == "" || q.Process == r.Process) {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+func TestServer_Handler(t *testing.T) {
+	ts := httptest.NewServer(api.NewServer("", "node1", &fakeProvider{}).Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		path   string
+		method string
+		code   int
+	}{
+		{"/api/version", http.MethodGet, http.StatusOK},
+		{"/api/v1/status", http.MethodGet, http.StatusOK},
+		{"/api/v1/processes", http.MethodGet, http.StatusOK},
+		{"/api/v1/configs/gm", http.MethodGet, http.StatusOK},
+		{"/api/v1/configs/unknown", http.MethodGet, http.StatusNotFound},
+		{"/api/v1/dpll", http.MethodGet, http.StatusOK},
+		{"/api/v1/unicast", http.MethodGet, http.StatusOK},
+		{"/api/v1/leap", http.MethodGet, http.StatusServiceUnavailable},
+		{"/api/v1/status", http.MethodPost, http.StatusMethodNotAllowed},
+	}
+	for _, tc := range tests {
+		req, _ := http.NewRequest(tc.method, ts.URL+tc.path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.code, resp.StatusCode, "%s %s", tc.method, tc.path)
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(ts.URL + "/api/v1/configs/gm")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	var configs []api.Config
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&configs))
+	assert.Len(t, configs, 2)
+
+	resp, err = http.Get(ts.URL + "/api/version")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	var v api.VersionInfo
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&v))
+	assert.Equal(t, api.VersionInfo{Version: api.Version, Node: "node1"}, v)
+}
+
+func TestServer_EventsFollow(t *testing.T) {
+	ts := httptest.NewServer(api.NewServer("", "node1", &fakeProvider{}).Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/v1/events?follow=true")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+	published := api.StateTransition{Time: time.Now().UTC(), ConfigName: "ts2phc.0.config",
+		Process: "dpll", Interface: "ens1f0", From: "s0", To: "s2"}
+	// the subscriber is registered once the headers are flushed
+	api.PublishTransition(published)
+
+	var got api.StateTransition
+	assert.NoError(t, json.NewDecoder(bufio.NewReader(resp.Body)).Decode(&got))
+	assert.Equal(t, published.To, got.To)
+	assert.Equal(t, published.Interface, got.Interface)
+	assert.Contains(t, api.Transitions.Recent(), got)
+}
+
+func TestServer_History(t *testing.T) {
+	ts := httptest.NewServer(api.NewServer("", "node1", &fakeProvider{}).Handler())
+	defer ts.Close()
+	c := api.NewClientForURL(ts.URL)
+
+	records, err := c.History(api.HistoryQuery{From: time.Unix(1700000030, 0), To: time.Unix(1700000120, 0), Process: "GM"})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "s1", records[0].State)
+	}
+
+	resp, err := http.Get(ts.URL + "/api/v1/history?from=yesterday")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	var buf bytes.Buffer
+	assert.NoError(t, c.Bundle(api.HistoryQuery{Process: "gnss"}, &buf))
+	gz, err := gzip.NewReader(&buf)
+	assert.NoError(t, err)
+	var bundle api.IncidentBundle
+	assert.NoError(t, json.NewDecoder(gz).Decode(&bundle))
+	assert.Equal(t, "node1", bundle.Node)
+	assert.Equal(t, "gnss", bundle.Query.Process)
+	assert.Len(t, bundle.Records, 1)
+	assert.Len(t, bundle.Configs, 3)
+	assert.Equal(t, uint8(6), bundle.Status.ClockClass)
+}
+
+func TestParseHistoryQuery(t *testing.T) {
+	q, err := api.ParseHistoryQuery(url.Values{"since": {"5m"}, "interface": {"ens1f0"}})
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(-5*time.Minute), q.From, time.Second)
+	assert.Equal(t, "ens1f0", q.Interface)
+
+	_, err = api.ParseHistoryQuery(url.Values{"from": {"2024-01-01T02:15:00Z"}, "to": {"2024-01-01T02:10:00Z"}})
+	assert.Error(t, err)
+
+	want := api.HistoryQuery{From: time.Date(2024, 1, 1, 2, 10, 0, 0, time.UTC), To: time.Date(2024, 1, 1, 2, 15, 0, 0, time.UTC), ConfigName: "ts2phc.0.config"}
+	q, err = api.ParseHistoryQuery(want.Values())
+	assert.NoError(t, err)
+	assert.True(t, want.From.Equal(q.From) && want.To.Equal(q.To))
+	assert.Equal(t, want.ConfigName, q.ConfigName)
+}
+
+func TestServer_LogLevel(t *testing.T) {
+	ts := httptest.NewServer(api.NewServer("", "node1", &fakeProvider{}).Handler())
+	defer ts.Close()
+	defer func() { _ = api.SetLogLevel(api.LogLevel{}) }()
+	c := api.NewClientForURL(ts.URL)
+
+	l, err := c.SetLogLevel(api.LogLevel{V: 1, Packages: map[string]int{"api": 4}})
+	assert.NoError(t, err)
+	assert.Equal(t, api.LogLevel{V: 1, Packages: map[string]int{"api": 4}}, l)
+	// the package level applies to the source files of the package, this test among them
+	assert.True(t, bool(glog.V(4)))
+	assert.False(t, bool(glog.V(5)))
+	l, err = c.LogLevel()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, l.Packages["api"])
+
+	_, err = c.SetLogLevel(api.LogLevel{V: 2})
+	assert.NoError(t, err)
+	assert.True(t, bool(glog.V(2)))
+	assert.False(t, bool(glog.V(3)), "the package levels are replaced")
+
+	_, err = c.SetLogLevel(api.LogLevel{Packages: map[string]int{"../dpll": 4}})
+	assert.Error(t, err)
+	_, err = c.SetLogLevel(api.LogLevel{V: -1})
+	assert.Error(t, err)
+	l, err = c.LogLevel()
+	assert.NoError(t, err)
+	assert.Equal(t, api.LogLevel{V: 2}, l, "invalid levels are not applied")
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"time"
+
+	nl "github.com/openshift/linuxptp-daemon/pkg/dpll-netlink"
+)
+
+// Version is the version of the query API. It is part of every path, e.g. /api/v1/status.
+// Fields may be added within a version; renaming or removing a field requires a new version.
+const Version = "v1"
+
+// VersionInfo is returned by /api/version
+type VersionInfo struct {
+	Version string `json:"version"`
+	Node    string `json:"node"`
+}
+
+// Status is returned by /api/v1/status. It contains the event handler view of every config
+// and the grandmaster state computed for it.
+type Status struct {
+	Node       string    `json:"node"`
+	Time       time.Time `json:"time"`
+	ClockClass uint8     `json:"clockClass"`
+	// ClockClasses is the clock class applied to each config, ClockClass is the best of them
+	ClockClasses map[string]uint8 `json:"clockClasses,omitempty"`
+	Processes    []ProcessData    `json:"processes"`
+	GMSyncState  []GMSyncState    `json:"gmSyncState"`
+}
+
+// ProcessData is the last known state of a process for a config, with the per interface details
+type ProcessData struct {
+	ConfigName string          `json:"configName"`
+	Process    string          `json:"process"`
+	State      string          `json:"state"`
+	Details    []ProcessDetail `json:"details"`
+}
+
+// ProcessDetail is the last known state of an interface of a process
+type ProcessDetail struct {
+	Interface    string             `json:"interface"`
+	State        string             `json:"state"`
+	ClockType    string             `json:"clockType"`
+	SignalSource string             `json:"signalSource,omitempty"`
+	SourceLost   bool               `json:"sourceLost"`
+	LastUpdate   time.Time          `json:"lastUpdate"`
+	Values       map[string]float64 `json:"values,omitempty"`
+}
+
+// GMSyncState is the grandmaster state computed for a config
+type GMSyncState struct {
+	ConfigName    string `json:"configName"`
+	Interface     string `json:"interface"`
+	State         string `json:"state"`
+	ClockClass    uint8  `json:"clockClass"`
+	ClockAccuracy uint8  `json:"clockAccuracy"`
+	SourceLost    bool   `json:"sourceLost"`
+}
+
+// Process is a linuxptp process started by the daemon, returned by /api/v1/processes
+type Process struct {
+	Name       string   `json:"name"`
+	Profile    string   `json:"profile"`
+	ConfigName string   `json:"configName"`
+	ClockType  string   `json:"clockType,omitempty"`
+	Cmd        string   `json:"cmd"`
+	Pid        int      `json:"pid,omitempty"`
+	Running    bool     `json:"running"`
+	Interfaces []string `json:"interfaces,omitempty"`
+	DependsOn  []string `json:"dependentProcesses,omitempty"`
+}
+
+// Config is a rendered configuration file, returned by /api/v1/configs
+type Config struct {
+	Name    string `json:"name"`
+	Profile string `json:"profile"`
+	Process string `json:"process"`
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// SynceDevice is a synce4l device with its interfaces, returned by /api/v1/synce
+type SynceDevice struct {
+	ConfigName     string                  `json:"configName"`
+	Name           string                  `json:"name"`
+	ClockID        string                  `json:"clockId,omitempty"`
+	NetworkOption  int                     `json:"networkOption"`
+	ExtendedTLV    int                     `json:"extendedTlv"`
+	ExternalSource string                  `json:"externalSource,omitempty"`
+	Interfaces     []string                `json:"interfaces"`
+	State          string                  `json:"state"`
+	QualityLevels  map[string]QualityLevel `json:"qualityLevels,omitempty"`
+}
+
+// QualityLevel is the last quality level received on an interface
+type QualityLevel struct {
+	SSM         uint8 `json:"ssm"`
+	ExtendedSSM uint8 `json:"extendedSsm"`
+}
+
+// Dpll is the state of a DPLL monitored by the daemon, returned by /api/v1/dpll
+type Dpll struct {
+	ConfigName      string `json:"configName"`
+	Interface       string `json:"interface"`
+	ClockID         uint64 `json:"clockId"`
+	DependsOn       string `json:"dependsOn"`
+	State           string `json:"state"`
+	PhaseStatus     int64  `json:"phaseStatus"`
+	FrequencyStatus int64  `json:"frequencyStatus"`
+	PhaseOffset     int64  `json:"phaseOffset"`
+	InSpec          bool   `json:"inSpec"`
+	SourceLost      bool   `json:"sourceLost"`
+	OnHoldover      bool   `json:"onHoldover"`
+}
+
+// UnicastPort is a ptp4l port using a unicast master table, returned by /api/v1/unicast
+type UnicastPort struct {
+	ConfigName string `json:"configName"`
+	Interface  string `json:"interface"`
+	Table      int    `json:"table"`
+	// Masters are the "<transport> <address>" entries of the table, in table order
+	Masters []string `json:"masters"`
+	// ActiveMaster is the clock identity of the master selected as best master, empty when none
+	ActiveMaster string         `json:"activeMaster,omitempty"`
+	Grants       []UnicastGrant `json:"grants,omitempty"`
+}
+
+// UnicastGrant is the last unicast negotiation result of a port for a message type
+type UnicastGrant struct {
+	Message string `json:"message"`
+	// Result is granted, denied or expired once the granted duration has passed without renewal
+	Result   string    `json:"result"`
+	Duration int64     `json:"duration"`
+	Time     time.Time `json:"time"`
+}
+
+// DpllPin is a DPLL pin as reported by the kernel, returned by /api/v1/dpll/pins
+type DpllPin = nl.DoPinGetReplyHR
+
+// Leap is the leap second file state, returned by /api/v1/leap
+type Leap struct {
+	UtcOffset      int         `json:"utcOffset"`
+	ExpirationTime string      `json:"expirationTime"`
+	UpdateTime     string      `json:"updateTime"`
+	Hash           string      `json:"hash"`
+	Events         []LeapEvent `json:"events"`
+}
+
+// LeapEvent is a leap second entry of the leap file
+type LeapEvent struct {
+	LeapTime string `json:"leapTime"`
+	LeapSec  int    `json:"leapSec"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// StateTransition is streamed by /api/v1/events?follow=true every time a process, an interface
+// or the grandmaster changes state
+type StateTransition struct {
+	Time       time.Time              `json:"time"`
+	ConfigName string                 `json:"configName"`
+	Process    string                 `json:"process"`
+	Interface  string                 `json:"interface,omitempty"`
+	From       string                 `json:"from"`
+	To         string                 `json:"to"`
+	Trigger    string                 `json:"trigger,omitempty"`
+	Values     map[string]interface{} `json:"values,omitempty"`
+}
+
+// HistoryQuery selects event history records, zero values match everything
+type HistoryQuery struct {
+	From       time.Time `json:"from,omitempty"`
+	To         time.Time `json:"to,omitempty"`
+	Process    string    `json:"process,omitempty"`
+	Interface  string    `json:"interface,omitempty"`
+	ConfigName string    `json:"configName,omitempty"`
+}
+
+// HistoryRecord is a state transition, clock class change, HA failover or process status change
+// kept in the event history, returned by /api/v1/history
+type HistoryRecord struct {
+	Time       time.Time              `json:"time"`
+	Kind       string                 `json:"kind"`
+	ConfigName string                 `json:"configName,omitempty"`
+	Process    string                 `json:"process"`
+	Interface  string                 `json:"interface,omitempty"`
+	State      string                 `json:"state,omitempty"`
+	ClockClass *uint8                 `json:"clockClass,omitempty"`
+	SourceLost bool                   `json:"sourceLost"`
+	OutOfSpec  bool                   `json:"outOfSpec"`
+	Values     map[string]interface{} `json:"values,omitempty"`
+}
+
+// IncidentBundle is returned gzip compressed by /api/v1/history/bundle. It holds the history records
+// of the queried time range together with the daemon state at the time of the export.
+type IncidentBundle struct {
+	Version   string          `json:"version"`
+	Node      string          `json:"node"`
+	Generated time.Time       `json:"generated"`
+	Query     HistoryQuery    `json:"query"`
+	Records   []HistoryRecord `json:"records"`
+	Status    Status          `json:"status"`
+	Processes []Process       `json:"processes"`
+	Configs   []Config        `json:"configs"`
+	Dpll      []Dpll          `json:"dpll"`
+}
@@ -18,6 +18,17 @@ const (
 	DefaultProfilePath     = "/etc/linuxptp"
 	DefaultLeapConfigPath  = "/etc/leap"
 	DefaultPmcPollInterval = 60
+	// DefaultStaleMetricsTimeout is the time in seconds after which an offset series that is no longer updated is considered stale
+	DefaultStaleMetricsTimeout = 60
+	DefaultStaleMetricsAction  = "faulty"
+	// DefaultEventFormat is the format of the events written to the event socket: text, json or cloudevents
+	DefaultEventFormat = "text"
+	// DefaultAPISocketPath is the unix socket serving the read-only query API
+	DefaultAPISocketPath = "/var/run/linuxptp-daemon/api.sock"
+	// DefaultHoldoverModelDir is the directory the learned DPLL oscillator models are kept in across restarts
+	DefaultHoldoverModelDir = "/var/run/linuxptp-daemon/holdover"
+	// DefaultEventHistorySize is the number of records kept in the event history
+	DefaultEventHistorySize = event.DefaultHistorySize
 )
 
 type IFaces []Iface
@@ -0,0 +1,240 @@
+package daemon
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/openshift/linuxptp-daemon/pkg/api"
+	"github.com/openshift/linuxptp-daemon/pkg/dpll"
+	nl "github.com/openshift/linuxptp-daemon/pkg/dpll-netlink"
+	"github.com/openshift/linuxptp-daemon/pkg/event"
+	"github.com/openshift/linuxptp-daemon/pkg/leap"
+)
+
+// apiProvider exposes the daemon state to the query API
+type apiProvider struct {
+	dn *Daemon
+}
+
+// StartAPIServer starts the read-only query API on the given unix socket
+func (dn *Daemon) StartAPIServer(socketPath string) (*api.Server, error) {
+	s := api.NewServer(socketPath, dn.nodeName, &apiProvider{dn: dn})
+	if err := s.Start(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// forEachProcess calls fn for each current process, holding the process list so that none is stopped meanwhile
+func (pm *ProcessManager) forEachProcess(fn func(p *ptpProcess)) {
+	pm.processLock.RLock()
+	defer pm.processLock.RUnlock()
+	for _, p := range pm.process {
+		if p != nil {
+			fn(p)
+		}
+	}
+}
+
+// Status ... current event handler state
+func (a *apiProvider) Status() api.Status {
+	return a.dn.processManager.ptpEventHandler.Snapshot()
+}
+
+// Processes ... processes started for the applied profiles
+func (a *apiProvider) Processes() []api.Process {
+	processes := []api.Process{}
+	a.dn.processManager.forEachProcess(func(p *ptpProcess) {
+		ap := api.Process{
+			Name:       p.name,
+			ConfigName: p.configName,
+			ClockType:  string(p.clockType),
+		}
+		if p.nodeProfile.Name != nil {
+			ap.Profile = *p.nodeProfile.Name
+		}
+		p.execMutex.Lock()
+		if p.cmd != nil {
+			ap.Cmd = strings.Join(p.cmd.Args, " ")
+			if p.cmd.Process != nil {
+				ap.Pid = p.cmd.Process.Pid
+				ap.Running = !p.stopped && p.cmd.ProcessState == nil
+			}
+		}
+		p.execMutex.Unlock()
+		for _, iface := range p.ifaces {
+			ap.Interfaces = append(ap.Interfaces, iface.Name)
+		}
+		for _, d := range p.depProcess {
+			if d != nil {
+				ap.DependsOn = append(ap.DependsOn, d.Name())
+			}
+		}
+		processes = append(processes, ap)
+	})
+	return processes
+}
+
+// Configs ... configuration files rendered for the applied profiles
+func (a *apiProvider) Configs() []api.Config {
+	configs := []api.Config{}
+	a.dn.processManager.forEachProcess(func(p *ptpProcess) {
+		c := api.Config{
+			Name:    p.configName,
+			Process: p.name,
+			Path:    p.ptp4lConfigPath,
+			Content: p.renderedConfig,
+		}
+		if p.nodeProfile.Name != nil {
+			c.Profile = *p.nodeProfile.Name
+		}
+		configs = append(configs, c)
+	})
+	return configs
+}
+
+// Synce ... synce4l devices and their last known quality levels
+func (a *apiProvider) Synce() []api.SynceDevice {
+	devices := []api.SynceDevice{}
+	a.dn.processManager.forEachProcess(func(p *ptpProcess) {
+		if p.name != syncEProcessName || p.syncERelations == nil {
+			return
+		}
+		p.syncERelations.Lock()
+		for _, d := range p.syncERelations.Devices {
+			sd := api.SynceDevice{
+				ConfigName:     p.configName,
+				Name:           d.Name,
+				ClockID:        d.ClockId,
+				NetworkOption:  d.NetworkOption,
+				ExtendedTLV:    d.ExtendedTlv,
+				ExternalSource: d.ExternalSource,
+				Interfaces:     append([]string{}, d.Ifaces...),
+				State:          string(d.LastClockState),
+				QualityLevels:  map[string]api.QualityLevel{},
+			}
+			for iface, ql := range d.LastQLState {
+				if ql != nil {
+					sd.QualityLevels[iface] = api.QualityLevel{SSM: ql.SSM, ExtendedSSM: ql.ExtendedSSM}
+				}
+			}
+			devices = append(devices, sd)
+		}
+		p.syncERelations.Unlock()
+	})
+	return devices
+}
+
+// Dpll ... DPLL state for each monitored clock
+func (a *apiProvider) Dpll() []api.Dpll {
+	dplls := []api.Dpll{}
+	a.dn.processManager.forEachProcess(func(p *ptpProcess) {
+		for _, d := range p.depProcess {
+			dc, ok := d.(*dpll.DpllConfig)
+			if !ok || dc == nil {
+				continue
+			}
+			var dependsOn []string
+			for _, s := range dc.DependsOn() {
+				dependsOn = append(dependsOn, string(s))
+			}
+			dplls = append(dplls, api.Dpll{
+				ConfigName:      p.configName,
+				Interface:       dc.Iface(),
+				ClockID:         dc.ClockId(),
+				DependsOn:       strings.Join(dependsOn, ","),
+				State:           string(dc.State()),
+				PhaseStatus:     dc.PhaseStatus(),
+				FrequencyStatus: dc.FrequencyStatus(),
+				PhaseOffset:     dc.PhaseOffset(),
+				InSpec:          dc.InSpec(),
+				SourceLost:      dc.SourceLost(),
+				OnHoldover:      dc.OnHoldover(),
+			})
+		}
+	})
+	sort.SliceStable(dplls, func(i, j int) bool {
+		return dplls[i].ConfigName < dplls[j].ConfigName
+	})
+	return dplls
+}
+
+// Unicast ... unicast state of the ports using a unicast master table
+func (a *apiProvider) Unicast() []api.UnicastPort {
+	ports := []api.UnicastPort{}
+	now := time.Now()
+	a.dn.processManager.forEachProcess(func(p *ptpProcess) {
+		ports = append(ports, p.unicastPorts(now)...)
+	})
+	return ports
+}
+
+// Leap ... leap file state, false when the leap manager is not running
+func (a *apiProvider) Leap() (api.Leap, bool) {
+	lm := leap.Manager()
+	if lm == nil {
+		glog.V(4).Info("query api: leap manager is not running")
+		return api.Leap{}, false
+	}
+	lf := lm.GetLeapFile()
+	l := api.Leap{
+		UtcOffset:      lm.UtcOffset(),
+		ExpirationTime: lf.ExpirationTime,
+		UpdateTime:     lf.UpdateTime,
+		Hash:           lf.Hash,
+		Events:         []api.LeapEvent{},
+	}
+	for _, e := range lf.LeapEvents {
+		l.Events = append(l.Events, api.LeapEvent{LeapTime: e.LeapTime, LeapSec: e.LeapSec, Comment: e.Comment})
+	}
+	return l, true
+}
+
+// DpllPins ... DPLL pins of the model kept by the shared DPLL netlink monitor
+func (a *apiProvider) DpllPins() ([]api.DpllPin, error) {
+	replies := dpll.SharedMonitor().Pins()
+	pins := make([]api.DpllPin, 0, len(replies))
+	for _, r := range replies {
+		pins = append(pins, nl.GetPinHR(r))
+	}
+	return pins, nil
+}
+
+// DumpState ... log the processes, event handler data, DPLL, SyncE and leap file state and the log verbosity
+func (dn *Daemon) DumpState() {
+	a := &apiProvider{dn: dn}
+	state := map[string]interface{}{
+		"processes": a.Processes(),
+		"status":    a.Status(),
+		"dpll":      a.Dpll(),
+		"synce":     a.Synce(),
+		"unicast":   a.Unicast(),
+		"loglevel":  api.CurrentLogLevel(),
+	}
+	if l, ok := a.Leap(); ok {
+		state["leap"] = l
+	}
+	names := make([]string, 0, len(state))
+	for name := range state {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	glog.Info("state dump start")
+	for _, name := range names {
+		b, err := json.Marshal(state[name])
+		if err != nil {
+			glog.Errorf("state dump %s: %s", name, err)
+			continue
+		}
+		glog.Infof("state dump %s: %s", name, b)
+	}
+	glog.Info("state dump end")
+}
+
+// History ... event history records selected by the query
+func (a *apiProvider) History(q api.HistoryQuery) []api.HistoryRecord {
+	return event.QueryHistory(q)
+}
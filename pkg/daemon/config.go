@@ -36,6 +36,7 @@ type ptp4lConfSection struct {
 
 type ptp4lConf struct {
 	sections         []ptp4lConfSection
+	unicastTables    []unicastMasterTable // [unicast_master_table] sections, rendered after the port sections
 	mapping          []string
 	profile_name     string
 	clock_type       event.ClockType
@@ -91,6 +92,17 @@ func (l *LinuxPTPConfUpdate) UpdateConfig(nodeProfilesJson []byte) error {
 	return fmt.Errorf("unable to load profile config")
 }
 
+// ReloadConfig ... apply the node profiles again even when they did not change
+func (l *LinuxPTPConfUpdate) ReloadConfig(nodeProfilesJson []byte) error {
+	applied := l.appliedNodeProfileJson
+	l.appliedNodeProfileJson = nil
+	if err := l.UpdateConfig(nodeProfilesJson); err != nil {
+		l.appliedNodeProfileJson = applied
+		return err
+	}
+	return nil
+}
+
 // Try to load the multiple policy config
 func tryToLoadConfig(nodeProfilesJson []byte) ([]ptpv1.PtpProfile, bool) {
 	ptpConfig := []ptpv1.PtpProfile{}
@@ -117,6 +129,7 @@ func tryToLoadOldConfig(nodeProfilesJson []byte) ([]ptpv1.PtpProfile, bool) {
 func (output *ptp4lConf) populatePtp4lConf(config *string) error {
 	var currentSectionName string
 	var currentSection ptp4lConfSection
+	var currentTable unicastMasterTable
 	output.sections = make([]ptp4lConfSection, 0)
 	globalIsDefined := false
 	hasSlaveConfigDefined := false
@@ -127,7 +140,9 @@ func (output *ptp4lConf) populatePtp4lConf(config *string) error {
 			if strings.HasPrefix(line, "#") {
 				continue
 			} else if strings.HasPrefix(line, "[") {
-				if currentSectionName != "" {
+				if currentSectionName == unicastMasterTableSection {
+					output.unicastTables = append(output.unicastTables, currentTable)
+				} else if currentSectionName != "" {
 					output.sections = append(output.sections, currentSection)
 				}
 				currentLine := strings.Split(line, "]")
@@ -141,6 +156,11 @@ func (output *ptp4lConf) populatePtp4lConf(config *string) error {
 					globalIsDefined = true
 				}
 				currentSection = ptp4lConfSection{options: map[string]string{}, sectionName: currentSectionName}
+				currentTable = unicastMasterTable{}
+			} else if currentSectionName == unicastMasterTableSection {
+				if err := currentTable.addLine(line); err != nil {
+					return err
+				}
 			} else if currentSectionName != "" {
 				split := strings.IndexByte(line, ' ')
 				if split > 0 {
@@ -156,7 +176,9 @@ func (output *ptp4lConf) populatePtp4lConf(config *string) error {
 				return errors.New("Config option not in section: " + line)
 			}
 		}
-		if currentSectionName != "" {
+		if currentSectionName == unicastMasterTableSection {
+			output.unicastTables = append(output.unicastTables, currentTable)
+		} else if currentSectionName != "" {
 			output.sections = append(output.sections, currentSection)
 		}
 	}
@@ -314,5 +336,8 @@ func (conf *ptp4lConf) renderPtp4lConf() (configOut string, ifaces config.IFaces
 			configOut = fmt.Sprintf("%s\n%s %s", configOut, k, v)
 		}
 	}
+	for _, table := range conf.unicastTables {
+		configOut = fmt.Sprintf("%s\n%s", configOut, table.render())
+	}
 	return configOut, ifaces
 }
@@ -20,6 +20,7 @@ import (
 	"github.com/openshift/linuxptp-daemon/pkg/config"
 
 	"github.com/openshift/linuxptp-daemon/pkg/dpll"
+	nl "github.com/openshift/linuxptp-daemon/pkg/dpll-netlink"
 	"github.com/openshift/linuxptp-daemon/pkg/leap"
 
 	"github.com/openshift/linuxptp-daemon/pkg/event"
@@ -47,6 +48,8 @@ const (
 	HAInDomainIndicator             = "as domain source clock"
 	HAOutOfDomainIndicator          = "as out-of-domain source"
 	MessageTagSuffixSeperator       = ":"
+	eventPolicySetting              = "eventPolicy"         // YAML emit policies of the event sources, by source
+	eventPolicyDefaultsSetting      = "eventPolicyDefaults" // "true" applies the default emit policies
 )
 
 var (
@@ -61,6 +64,8 @@ var (
 // Processes in ProcessManager will be started
 // or stopped simultaneously.
 type ProcessManager struct {
+	// processLock guards the process slice against readers outside the daemon loop
+	processLock     sync.RWMutex
 	process         []*ptpProcess
 	eventChannel    chan event.EventChannel
 	ptpEventHandler *event.EventHandler
@@ -154,6 +159,10 @@ type ptpProcess struct {
 	haProfile         map[string][]string // stores list of interface name for each profile
 	syncERelations    *synce.Relations
 	c                 *net.Conn
+	renderedConfig    string
+	tbc               *tbcHoldover  // T-BC holdover, set for ptp4l of a BC
+	unicast           *unicastState // unicast grants and active master, set for ptp4l using unicast master tables
+	gptp              *gptpState    // gPTP port datasets, set for ptp4l of an IEEE 802.1AS config
 }
 
 func (p *ptpProcess) Stopped() bool {
@@ -186,6 +195,8 @@ type Daemon struct {
 	processManager *ProcessManager
 
 	hwconfigs *[]ptpv1.HwConfig
+	// hwconfigLock serializes hwconfig updates of the profile and of the DPLL monitors
+	hwconfigLock sync.Mutex
 
 	refreshNodePtpDevice *bool
 
@@ -294,7 +305,12 @@ func (dn *Daemon) SetProcessManager(p *ProcessManager) {
 
 func (dn *Daemon) applyNodePTPProfiles() error {
 	glog.Infof("in applyNodePTPProfiles")
-	for _, p := range dn.processManager.process {
+	// the processes are dropped from the process manager before they are stopped, the query API no longer reads them
+	dn.processManager.processLock.Lock()
+	processes := dn.processManager.process
+	dn.processManager.process = nil
+	dn.processManager.processLock.Unlock()
+	for _, p := range processes {
 		if p != nil {
 			glog.Infof("stopping process.... %s", p.name)
 			p.cmdStop()
@@ -316,20 +332,15 @@ func (dn *Daemon) applyNodePTPProfiles() error {
 		}
 	}
 
-	// All process should have been stopped,
-	// clear process in process manager.
-	// Assigning processManager.process to nil releases
-	// the underlying slice to the garbage
-	// collector (assuming there are no other
-	// references).
-	dn.processManager.process = nil
-
 	// TODO:
 	// compare nodeProfile with previous config,
 	// only apply when nodeProfile changes
 
 	//clear hwconfig before updating
+	dn.hwconfigLock.Lock()
 	*dn.hwconfigs = []ptpv1.HwConfig{}
+	dn.hwconfigLock.Unlock()
+	resetDpllMetrics()
 
 	glog.Infof("updating NodePTPProfiles to:")
 	runID := 0
@@ -386,7 +397,9 @@ func (dn *Daemon) applyNodePTPProfiles() error {
 			dn.pluginManager.AfterRunPTPCommand(&p.nodeProfile, p.name)
 		}
 	}
+	dn.hwconfigLock.Lock()
 	dn.pluginManager.PopulateHwConfig(dn.hwconfigs)
+	dn.hwconfigLock.Unlock()
 	*dn.refreshNodePtpDevice = true
 	return nil
 }
@@ -455,11 +468,30 @@ func (dn *Daemon) applyNodePtpProfile(runID int, nodeProfile *ptpv1.PtpProfile)
 	var configOpts *string
 	var messageTag string
 	var cmd *exec.Cmd
+	var tbc *tbcHoldover
 	var pProcess string
 	var haProfile map[string][]string
 
 	ptpHAEnabled := len(listHaProfiles(nodeProfile)) > 0
 
+	var emitPolicies map[string]event.EmitPolicy
+	if v := strings.TrimSpace(nodeProfile.PtpSettings[eventPolicySetting]); v != "" {
+		if emitPolicies, err = event.ParseEmitPolicies(v); err != nil {
+			printNodeProfile(nodeProfile)
+			return fmt.Errorf("invalid %s: %w", eventPolicySetting, err)
+		}
+	}
+	if v, ok := nodeProfile.PtpSettings[eventPolicyDefaultsSetting]; ok {
+		defaults, err := strconv.ParseBool(v)
+		if err != nil {
+			printNodeProfile(nodeProfile)
+			return fmt.Errorf("invalid %s %q", eventPolicyDefaultsSetting, v)
+		}
+		if defaults {
+			emitPolicies = event.WithDefaultEmitPolicies(emitPolicies)
+		}
+	}
+
 	for _, p := range ptpProcesses {
 		pProcess = p
 		switch pProcess {
@@ -529,8 +561,10 @@ func (dn *Daemon) applyNodePtpProfile(runID int, nodeProfile *ptpv1.PtpProfile)
 			glog.Infof("configOpts empty, skipping: %s", pProcess)
 			continue
 		}
+		dn.processManager.ptpEventHandler.SetEmitPolicies(configFile, emitPolicies)
 
 		output := &ptp4lConf{}
+		var gptp *gptpState
 		err = output.populatePtp4lConf(configInput)
 		if err != nil {
 			printNodeProfile(nodeProfile)
@@ -566,6 +600,29 @@ func (dn *Daemon) applyNodePtpProfile(runID int, nodeProfile *ptpv1.PtpProfile)
 			}
 		}
 
+		if pProcess == ptp4lProcessName {
+			if err = output.addUnicastMasters(nodeProfile.PtpSettings); err != nil {
+				printNodeProfile(nodeProfile)
+				return err
+			}
+			telecomProfile, profileErr := output.telecomProfile(nodeProfile)
+			if profileErr != nil {
+				printNodeProfile(nodeProfile)
+				return profileErr
+			}
+			dn.processManager.ptpEventHandler.SetTelecomProfile(configFile, telecomProfile)
+			if gptp, err = output.newGPTPState(nodeProfile.PtpSettings); err != nil {
+				printNodeProfile(nodeProfile)
+				return err
+			}
+			if gptp != nil {
+				glog.Infof("%s is an IEEE 802.1AS gPTP config", configFile)
+				for _, w := range output.gptpWarnings(nodeProfile.PtpSettings) {
+					glog.Warningf("%s: %s", configFile, w)
+				}
+			}
+		}
+
 		// This adds the flags needed for monitor
 		addFlagsForMonitor(p, configOpts, output, dn.stdoutToSocket)
 		var configOutput string
@@ -608,6 +665,25 @@ func (dn *Daemon) applyNodePtpProfile(runID int, nodeProfile *ptpv1.PtpProfile)
 			ptpClockThreshold: getPTPThreshold(nodeProfile),
 			haProfile:         haProfile,
 			syncERelations:    relations,
+			renderedConfig:    configOutput,
+		}
+		if pProcess == ptp4lProcessName {
+			dprocess.unicast = output.newUnicastState()
+			dprocess.gptp = gptp
+		}
+		if pProcess == ptp4lProcessName {
+			// the DPLLs of the profile report on its ts2phc config
+			tbcConfig := ""
+			if clockType == event.BC {
+				tbcConfig = dn.tbcConfig(nodeProfile.Name, configFile)
+				tbc = newTBCHoldover(tbcConfig, nodeProfile)
+				dprocess.tbc = tbc
+			}
+			dn.processManager.ptpEventHandler.SetBCConfig(fmt.Sprintf("ts2phc.%d.config", runID), tbcConfig)
+		}
+		if pProcess == phc2sysProcessName {
+			// the holdover status of phc2sys drives the T-BC state too
+			dprocess.tbc = tbc
 		}
 
 		// TODO HARDWARE PLUGIN for e810
@@ -704,6 +780,21 @@ func (dn *Daemon) applyNodePtpProfile(runID int, nodeProfile *ptpv1.PtpProfile)
 					dpllDaemon := dpll.NewDpll(clockId, localMaxHoldoverOffSet, localHoldoverTimeout,
 						maxInSpecOffset, iface.Name, eventSource, dpll.NONE, dn.GetPhaseOffsetPinFilter(nodeProfile))
 					glog.Infof("depending on %s", dpllDaemon.DependsOn())
+					if v, ok := nodeProfile.PtpSettings[fmt.Sprintf("%s[%s]", dpll.PinPrioritiesStr, iface.Name)]; ok {
+						dpllDaemon.SetPinPriorities(dpll.ParsePinPriorities(v))
+						glog.Infof("dpll %s input pin priorities %s", iface.Name, v)
+					}
+					if v, ok := nodeProfile.PtpSettings[fmt.Sprintf("%s[%s]", dpll.DpllModeStr, iface.Name)]; ok {
+						if mode, valid := nl.ModeFromString(v); valid {
+							dpllDaemon.SetMode(mode)
+							glog.Infof("dpll %s mode %s", iface.Name, v)
+						} else {
+							glog.Errorf("dpll %s: invalid mode %q, expected manual or automatic", iface.Name, v)
+						}
+					}
+					dpllDaemon.SetModeChangeHandler(func() { dn.dpllModeChanged(dpllDaemon) })
+					dpllDaemon.SetReportHandler(dpllReportMetrics(dpllDaemon))
+					dpllDaemon.SetRemoveHandler(dpllRemoveMetrics(dpllDaemon))
 					dpllDaemon.CmdInit()
 					dprocess.depProcess = append(dprocess.depProcess, dpllDaemon)
 				}
@@ -717,12 +808,35 @@ func (dn *Daemon) applyNodePtpProfile(runID int, nodeProfile *ptpv1.PtpProfile)
 		}
 
 		printNodeProfile(nodeProfile)
+		dn.processManager.processLock.Lock()
 		dn.processManager.process = append(dn.processManager.process, &dprocess)
+		dn.processManager.processLock.Unlock()
 
 	}
 	return nil
 }
 
+// dpllModeChanged ... list the modes of the DPLL devices of the interface in hwconfig
+func (dn *Daemon) dpllModeChanged(d *dpll.DpllConfig) {
+	modes := d.DeviceModes()
+	dn.hwconfigLock.Lock()
+	defer dn.hwconfigLock.Unlock()
+	prefix := d.Iface() + " "
+	hwconfigs := []ptpv1.HwConfig{}
+	for _, hw := range *dn.hwconfigs {
+		if hw.DeviceID != DPLL || !strings.HasPrefix(hw.Status, prefix) {
+			hwconfigs = append(hwconfigs, hw)
+		}
+	}
+	for _, m := range modes {
+		hwconfigs = append(hwconfigs, ptpv1.HwConfig{DeviceID: DPLL,
+			Status: fmt.Sprintf("%s%s dpll %d mode %s, supported modes %s", prefix, m.Type, m.Id,
+				nl.GetMode(m.Mode), nl.GetModes(m.ModeSupported))})
+	}
+	*dn.hwconfigs = hwconfigs
+	*dn.refreshNodePtpDevice = true
+}
+
 func (dn *Daemon) GetPhaseOffsetPinFilter(nodeProfile *ptpv1.PtpProfile) map[string]map[string]string {
 	phaseOffsetPinFilter := map[string]map[string]string{}
 	for k, v := range (*nodeProfile).PtpSettings {
@@ -774,13 +888,14 @@ func processStatus(c *net.Conn, processName, messageTag string, status int64) {
 		cfgName = strings.Split(cfgName, MessageTagSuffixSeperator)[0]
 	}
 	// ptp4l[5196819.100]: [ptp4l.0.config] PTP_PROCESS_STOPPED:0/1
-	deadProcessMsg := fmt.Sprintf("%s[%d]:[%s] PTP_PROCESS_STATUS:%d\n", processName, time.Now().Unix(), cfgName, status)
-	glog.Infof("%s\n", deadProcessMsg)
+	deadProcessMsg := event.NewProcessStatusRecord(processName, cfgName, status)
+	glog.Infof("%s\n", deadProcessMsg.Text())
+	event.EventHistory.Add(deadProcessMsg)
 	if c == nil {
 		UpdateProcessStatusMetrics(processName, cfgName, status)
 		return
 	}
-	_, err := (*c).Write([]byte(deadProcessMsg))
+	_, err := (*c).Write(deadProcessMsg.Bytes())
 	if err != nil {
 		glog.Errorf("Write error sending ptp4l/phc2sys process healths status%s:", err)
 	}
@@ -804,12 +919,13 @@ func (p *ptpProcess) updateClockClass(c *net.Conn) {
 					p.parentClockClass = clockClass
 					glog.Infof("clock change event identified")
 					//ptp4l[5196819.100]: [ptp4l.0.config] CLOCK_CLASS_CHANGE:248
-					clockClassOut := fmt.Sprintf("%s[%d]:[%s] CLOCK_CLASS_CHANGE %f\n", p.name, time.Now().Unix(), p.configName, clockClass)
-					fmt.Printf("%s", clockClassOut)
+					clockClassOut := event.NewClockClassRecord(p.name, p.configName, clockClass)
+					fmt.Printf("%s", clockClassOut.Text())
+					event.EventHistory.Add(clockClassOut)
 					if c == nil {
-						UpdateClockClassMetrics(clockClass) // no socket then update metrics
+						UpdateClockClassMetrics(p.configName, clockClass) // no socket then update metrics
 					} else {
-						_, err := (*c).Write([]byte(clockClassOut))
+						_, err := (*c).Write(clockClassOut.Bytes())
 						if err != nil {
 							glog.Errorf("failed to write class change event %s", err.Error())
 						}
@@ -843,6 +959,10 @@ func (p *ptpProcess) cmdRun(stdoutToSocket bool) {
 		glog.Infof("Failed parsing regex %s for %s: %d.  Defaulting to accept all", p.logFilterRegex, p.configName, regexErr)
 	}
 
+	if p.gptp != nil {
+		go p.pollGPTP()
+	}
+
 	for {
 		glog.Infof("Starting %s...", p.name)
 		glog.Infof("%s cmd: %+v", p.name, p.cmd)
@@ -870,6 +990,7 @@ func (p *ptpProcess) cmdRun(stdoutToSocket bool) {
 						if strings.Contains(output, ClockClassChangeIndicator) {
 							go p.updateClockClass(nil)
 						}
+						p.processUnicastOutput(nil, output)
 					} else if p.name == phc2sysProcessName && len(p.haProfile) > 0 {
 						p.announceHAFailOver(nil, output) // do not use go routine since order of execution is important here
 					}
@@ -916,10 +1037,11 @@ func (p *ptpProcess) cmdRun(stdoutToSocket bool) {
 						if strings.Contains(output, ClockClassChangeIndicator) {
 							go p.updateClockClass(p.c)
 						}
+						p.processUnicastOutput(p.c, output)
 					} else if p.name == phc2sysProcessName && len(p.haProfile) > 0 {
 						p.announceHAFailOver(p.c, output) // do not use go routine since order of execution is important here
 					}
-					_, err2 := (*p.c).Write([]byte(removeMessageSuffix(output)))
+					_, err2 := (*p.c).Write(p.outputRecord(removeMessageSuffix(output)))
 					if err2 != nil {
 						glog.Errorf("Write %s error %s:", output, err2)
 						goto connect
@@ -977,7 +1099,15 @@ func (p *ptpProcess) processPTPMetrics(output string) {
 		logEntry := synce.ParseLog(output)
 		p.ProcessSynceEvents(logEntry)
 	} else {
-		configName, source, ptpOffset, clockState, iface := extractMetrics(p.messageTag, p.name, p.ifaces, output)
+		configName, source, ptpOffset, clockState, iface, freq := extractMetrics(p.messageTag, p.name, p.ifaces, output)
+		if p.gptp != nil {
+			p.processGPTPOutput(output)
+		}
+		if p.tbc != nil && p.name == ptp4lProcessName {
+			if portId, role := extractPTP4lEventState(output); portId > 0 && portId <= len(p.ifaces) {
+				p.tbc.portRole(p.eventCh, p.ifaces[portId-1].Name, role)
+			}
+		}
 		if iface != "" { // for ptp4l/phc2sys this function only update metrics
 			var values map[event.ValueType]interface{}
 			ifaceName := masterOffsetIface.getByAlias(configName, iface).name
@@ -986,6 +1116,9 @@ func (p *ptpProcess) processPTPMetrics(output string) {
 				if eventSource == event.GNSS {
 					values = map[event.ValueType]interface{}{event.NMEA_STATUS: int64(1)}
 				}
+				if clockState == LOCKED {
+					p.dpllFrequencySample(ifaceName, freq)
+				}
 			}
 			// ts2phc has to be handled differently since it announce holdover state when gnss is lost
 			//TODO: verify how 1pps is handled when lost
@@ -997,14 +1130,54 @@ func (p *ptpProcess) processPTPMetrics(output string) {
 			case HOLDOVER:
 				state = event.PTP_HOLDOVER // consider s1 state as holdover,this passed to event to create metrics and events
 			}
+			if p.tbc != nil && p.name == phc2sysProcessName && iface == clockRealTime {
+				p.tbc.phc2sysState(p.eventCh, state)
+			}
+			if p.name == ts2phcProcessName && iface != clockRealTime {
+				p.dpllTs2phcState(ifaceName, state)
+			}
 			p.ProcessTs2PhcEvents(ptpOffset, source, ifaceName, state, values)
 		}
 	}
 }
 
+// dpllFrequencySample ... teach the oscillator model of the DPLL of iface the ts2phc frequency adjustment, which
+// compensates the oscillator frequency offset
+func (p *ptpProcess) dpllFrequencySample(iface string, freq float64) {
+	for _, d := range p.depProcess {
+		if dc, ok := d.(*dpll.DpllConfig); ok && dc != nil && dc.Iface() == iface {
+			dc.FrequencySample(dpll.FrequencySourceTs2phc, -freq)
+		}
+	}
+}
+
+// dpllTs2phcState ... feed the DPLL of iface the ts2phc state of its extts events, the 1PPS loss signal of a PPS
+// fed DPLL
+func (p *ptpProcess) dpllTs2phcState(iface string, state event.PTPState) {
+	for _, d := range p.depProcess {
+		if dc, ok := d.(*dpll.DpllConfig); ok && dc != nil && dc.Iface() == iface {
+			dc.Ts2phcState(state)
+		}
+	}
+}
+
 // cmdStop stops ptpProcess launched by cmdRun
 func (p *ptpProcess) cmdStop() {
 	glog.Infof("stopping %s...", p.name)
+	if p.tbc != nil && p.name == ptp4lProcessName {
+		p.tbc.stop()
+	}
+	if p.gptp != nil {
+		p.gptp.stop()
+	}
+	if p.name == syncEProcessName && p.syncERelations != nil {
+		// without synce4l the EEC lock and the QL are no longer known
+		for _, sDeviceConfig := range p.syncERelations.Devices {
+			if clockId, err := strconv.ParseUint(sDeviceConfig.ClockId, 10, 64); err == nil {
+				dpll.SetFrequencyTraceable(clockId, false)
+			}
+		}
+	}
 	if p.cmd == nil {
 		return
 	}
@@ -1066,8 +1239,7 @@ func (p *ptpProcess) ProcessTs2PhcEvents(ptpOffset float64, source string, iface
 		for k, v := range extraValue {
 			values[k] = v
 		}
-		select {
-		case p.eventCh <- event.EventChannel{
+		event.Deliver(fmt.Sprintf("%s/%s", event.TS2PHC, p.configName), p.eventCh, event.EventChannel{
 			ProcessName: event.TS2PHC,
 			State:       ptpState,
 			CfgName:     p.configName,
@@ -1082,9 +1254,7 @@ func (p *ptpProcess) ProcessTs2PhcEvents(ptpOffset float64, source string, iface
 				return false
 			}(),
 			Reset: false,
-		}:
-		default:
-		}
+		})
 
 	} else {
 		if iface != "" && iface != clockRealTime {
@@ -1136,6 +1306,14 @@ func listHaProfiles(nodeProfile *ptpv1.PtpProfile) (haProfiles []string) {
 	return
 }
 
+// outputRecord wraps a process output line in the configured event format
+func (p *ptpProcess) outputRecord(output string) []byte {
+	if event.GetOutputFormat() == event.TextFormat {
+		return []byte(output)
+	}
+	return event.NewLogRecord(p.name, p.configName, output).Bytes()
+}
+
 func (p *ptpProcess) announceHAFailOver(c *net.Conn, output string) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -1178,18 +1356,21 @@ func (p *ptpProcess) announceHAFailOver(c *net.Conn, output string) {
 		}
 	}
 	// log both active and inactive profiles
-	logString := []string{fmt.Sprintf("%s[%d]:[%s] ptp_ha_profile %s state %d\n", p.name, time.Now().Unix(), p.configName, currentProfile, activeState)}
+	logString := []event.Record{event.NewHAProfileRecord(p.name, p.configName, currentProfile, activeState)}
 	for _, inActive := range inActiveProfiles {
-		logString = append(logString, fmt.Sprintf("%s[%d]:[%s] ptp_ha_profile %s state %d\n", p.name, time.Now().Unix(), p.configName, inActive, 0))
+		logString = append(logString, event.NewHAProfileRecord(p.name, p.configName, inActive, 0))
+	}
+	for _, logProfile := range logString {
+		event.EventHistory.Add(logProfile)
 	}
 	if c == nil {
 		for _, logProfile := range logString {
-			fmt.Printf("%s", logProfile)
+			fmt.Printf("%s", logProfile.Text())
 		}
 		UpdatePTPHAMetrics(currentProfile, inActiveProfiles, activeState)
 	} else {
 		for _, logProfile := range logString {
-			_, err := (*c).Write([]byte(logProfile))
+			_, err := (*c).Write(logProfile.Bytes())
 			if err != nil {
 				glog.Errorf("failed to write class change event %s", err.Error())
 			}
@@ -1274,7 +1455,12 @@ func (p *ptpProcess) ProcessSynceEvents(logEntry synce.LogEntry) {
 
 	clockQuality := ""
 	iface := ""
+	if p.syncERelations == nil {
+		return
+	}
 
+	// the device states are also read by the query API
+	p.syncERelations.Lock()
 	// synce4l[627602.540]: [synce4l.0.config] LOCKED   0     synce1
 	if logEntry.State != nil && logEntry.Source != nil {
 		if sDeviceConfig := p.SyncEDeviceByInterface(*logEntry.Source); sDeviceConfig != nil {
@@ -1347,10 +1533,10 @@ func (p *ptpProcess) ProcessSynceEvents(logEntry synce.LogEntry) {
 			}
 		}
 	}
+	p.syncERelations.Unlock()
 	if len(extraValue) > 0 {
 		glog.Info(extraValue)
-		select {
-		case p.eventCh <- event.EventChannel{
+		event.Deliver(fmt.Sprintf("%s/%s", event.SYNCE, p.configName), p.eventCh, event.EventChannel{
 			ProcessName: event.SYNCE,
 			State:       state,
 			CfgName:     p.configName,
@@ -1364,12 +1550,29 @@ func (p *ptpProcess) ProcessSynceEvents(logEntry synce.LogEntry) {
 				return false
 			}(),
 			Reset: false,
-		}:
-		default:
-		}
+		})
+	}
+	if iface != "" {
+		p.updateFrequencyTraceable(p.SyncEDeviceByInterface(iface))
 	}
+}
 
+// updateFrequencyTraceable ... pass the SyncE traceability of the device to the DPLL of its clock
+func (p *ptpProcess) updateFrequencyTraceable(sDeviceConfig *synce.Config) {
+	if sDeviceConfig == nil || sDeviceConfig.ClockId == "" {
+		return
+	}
+	clockId, err := strconv.ParseUint(sDeviceConfig.ClockId, 10, 64)
+	if err != nil {
+		glog.Errorf("invalid clock id %s of syncE device %s: %s", sDeviceConfig.ClockId, sDeviceConfig.Name, err)
+		return
+	}
+	p.syncERelations.Lock()
+	traceable := sDeviceConfig.FrequencyTraceable()
+	p.syncERelations.Unlock()
+	dpll.SetFrequencyTraceable(clockId, traceable)
 }
+
 func (p *ptpProcess) SyncEDeviceByInterface(iface string) *synce.Config {
 	if p.syncERelations != nil {
 		for _, sConfig := range p.syncERelations.Devices {
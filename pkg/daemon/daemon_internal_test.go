@@ -4,12 +4,21 @@ package daemon
 
 import (
 	"os"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/bigkevmcd/go-configparser"
+	"github.com/openshift/linuxptp-daemon/pkg/config"
+	"github.com/openshift/linuxptp-daemon/pkg/event"
 	"github.com/openshift/linuxptp-daemon/pkg/leap"
+	"github.com/openshift/linuxptp-daemon/pkg/pmc"
+	"github.com/openshift/linuxptp-daemon/pkg/protocol"
+	"github.com/openshift/linuxptp-daemon/pkg/synce"
 	ptpv1 "github.com/openshift/ptp-operator/api/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"sigs.k8s.io/yaml"
 )
@@ -40,7 +49,16 @@ func applyProfileSyncE(t *testing.T, profile *ptpv1.PtpProfile) {
 
 	stopCh := make(<-chan struct{})
 	assert.NoError(t, leap.MockLeapFile())
-	defer close(leap.LeapMgr.Close)
+	lm := leap.LeapMgr
+	defer func() {
+		close(lm.Close)
+		// leap manager is a singleton, wait until it is dropped so the next profile gets a fresh one
+		select {
+		case <-lm.Done:
+		case <-time.After(time.Second):
+			t.Error("leap manager not stopped")
+		}
+	}()
 	dn := New(
 		"test-node-name",
 		"openshift-ptp",
@@ -98,3 +116,450 @@ func Test_applyProfile_synce(t *testing.T) {
 		clean(t)
 	}
 }
+
+func Test_collectStaleMetrics(t *testing.T) {
+	now := time.Now()
+	metricsLastUpdate = newSeriesTracker()
+	metricsLastUpdate.touch("ptp4l.0.config", master, ptp4lProcessName, "ens1fx", now.Add(-2*time.Minute))
+	metricsLastUpdate.touch("", phc, phc2sysProcessName, clockRealTime, now)
+	Offset.With(prometheus.Labels{"from": master, "process": ptp4lProcessName, "node": NodeName, "iface": "ens1fx"}).Set(5)
+
+	stale := collectStaleMetrics(now, time.Minute, StaleMetricsFaulty)
+	assert.Equal(t, []staleSeries{{seriesKey: seriesKey{from: master, process: ptp4lProcessName, iface: "ens1fx"},
+		cfgName: "ptp4l.0.config"}}, stale)
+	assert.Equal(t, float64(faultyOffset), testutil.ToFloat64(
+		Offset.With(prometheus.Labels{"from": master, "process": ptp4lProcessName, "node": NodeName, "iface": "ens1fx"})))
+	assert.Equal(t, float64(0), testutil.ToFloat64(
+		ClockState.With(prometheus.Labels{"process": ptp4lProcessName, "node": NodeName, "iface": "ens1fx"})))
+	// the stale series goes to the event handler as a FREERUN state
+	eventCh := make(chan event.EventChannel, 1)
+	deliverStaleMetrics(eventCh, stale)
+	select {
+	case ev := <-eventCh:
+		assert.Equal(t, event.PTP4l, ev.ProcessName)
+		assert.Equal(t, "ptp4l.0.config", ev.CfgName)
+		assert.Equal(t, "ens1fx", ev.IFace)
+		assert.Equal(t, event.PTP_FREERUN, ev.State)
+		assert.Equal(t, int64(faultyOffset), ev.Values[event.OFFSET])
+		assert.True(t, ev.WriteToLog)
+	case <-time.After(time.Second):
+		t.Fatal("stale series not delivered")
+	}
+	// already reported series are not reported twice
+	assert.Empty(t, metricsLastUpdate.expire(now, time.Minute, false))
+
+	// a fresh update clears the stale mark
+	metricsLastUpdate.touch("ptp4l.0.config", master, ptp4lProcessName, "ens1fx", now)
+	assert.Len(t, metricsLastUpdate.expire(now.Add(2*time.Minute), time.Minute, true), 2)
+	assert.Empty(t, metricsLastUpdate.series)
+}
+
+func Test_controllingProfile(t *testing.T) {
+	bcName, masterOnlyName, opts := "tbc", "tbc-master", "-2"
+	dn := &Daemon{ptpUpdate: &LinuxPTPConfUpdate{NodeProfiles: []ptpv1.PtpProfile{
+		{Name: &bcName, Ptp4lOpts: &opts},
+		{Name: &masterOnlyName, Ptp4lOpts: &opts, PtpSettings: map[string]string{controllingProfileSetting: bcName}},
+	}}}
+	// the T-BC announces on the master-only config controlled by the profile
+	assert.Equal(t, "ptp4l.1.config", dn.tbcConfig(&bcName, "ptp4l.0.config"))
+	dn.ptpUpdate.NodeProfiles = dn.ptpUpdate.NodeProfiles[:1]
+	assert.Equal(t, "ptp4l.0.config", dn.tbcConfig(&bcName, "ptp4l.0.config"))
+}
+
+func Test_tbcHoldover(t *testing.T) {
+	eventCh := make(chan event.EventChannel, 10)
+	tbc := &tbcHoldover{
+		cfgName:         "ptp4l.1.config",
+		state:           event.PTP_NOTSET,
+		phc2sys:         event.PTP_NOTSET,
+		inSpecTimeout:   50 * time.Millisecond,
+		holdoverTimeout: 100 * time.Millisecond,
+	}
+	next := func() event.EventChannel {
+		select {
+		case e := <-eventCh:
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("no T-BC event")
+		}
+		return event.EventChannel{}
+	}
+	// a port other than the slave port is ignored before a slave port is known
+	tbc.portRole(eventCh, "ens1f1", LISTENING)
+	tbc.portRole(eventCh, "ens1f0", SLAVE)
+	e := next()
+	assert.Equal(t, event.PTP_LOCKED, e.State)
+	assert.Equal(t, event.BC, e.ClockType)
+	assert.Equal(t, "ptp4l.1.config", e.CfgName)
+	assert.Equal(t, "ens1f0", e.IFace)
+
+	tbc.portRole(eventCh, "ens1f1", MASTER)
+	tbc.portRole(eventCh, "ens1f0", LISTENING)
+	e = next()
+	assert.Equal(t, event.PTP_HOLDOVER, e.State)
+	assert.False(t, e.OutOfSpec)
+	e = next()
+	assert.Equal(t, event.PTP_HOLDOVER, e.State)
+	assert.True(t, e.OutOfSpec)
+	e = next()
+	assert.Equal(t, event.PTP_FREERUN, e.State)
+
+	// the upstream is back, a running holdover timer is dropped
+	tbc.portRole(eventCh, "ens1f0", SLAVE)
+	assert.Equal(t, event.PTP_LOCKED, next().State)
+	tbc.portRole(eventCh, "ens1f0", FAULTY)
+	assert.Equal(t, event.PTP_HOLDOVER, next().State)
+	tbc.portRole(eventCh, "ens1f0", SLAVE)
+	assert.Equal(t, event.PTP_LOCKED, next().State)
+	time.Sleep(200 * time.Millisecond)
+	assert.Empty(t, eventCh)
+
+	// phc2sys starting unlocked is not in holdover, losing the lock it had is
+	tbc.phc2sysState(eventCh, event.PTP_FREERUN)
+	assert.Empty(t, eventCh)
+	tbc.phc2sysState(eventCh, event.PTP_LOCKED)
+	e = next()
+	assert.Equal(t, event.PHC2SYS, e.ProcessName)
+	assert.Equal(t, event.BC, e.ClockType)
+	assert.Equal(t, "ptp4l.1.config", e.CfgName)
+	assert.Equal(t, event.PTP_LOCKED, e.State)
+	tbc.phc2sysState(eventCh, event.PTP_LOCKED)
+	assert.Empty(t, eventCh)
+	tbc.phc2sysState(eventCh, event.PTP_FREERUN)
+	assert.Equal(t, event.PTP_HOLDOVER, next().State)
+	tbc.phc2sysState(eventCh, event.PTP_FREERUN)
+	assert.Empty(t, eventCh)
+	tbc.phc2sysState(eventCh, event.PTP_LOCKED)
+	assert.Equal(t, event.PTP_LOCKED, next().State)
+
+	tbc.stop()
+	assert.True(t, next().Reset)
+	// after a restart phc2sys has to lock before it can hold over
+	tbc.phc2sysState(eventCh, event.PTP_FREERUN)
+	assert.Empty(t, eventCh)
+}
+
+func Test_unicastMasterTable(t *testing.T) {
+	ptp4lConfig := `[global]
+domainNumber 44
+network_transport UDPv4
+logging_level 6
+[unicast_master_table]
+table_id 1
+logQueryInterval 2
+UDPv4 10.0.0.1
+UDPv4 10.0.0.2
+[ens1f0]
+masterOnly 0
+[ens1f1]
+masterOnly 1
+`
+	conf := &ptp4lConf{}
+	assert.NoError(t, conf.populatePtp4lConf(&ptp4lConfig))
+	assert.Len(t, conf.sections, 3, "the table is not a port section")
+	assert.Equal(t, []string{"UDPv4 10.0.0.1", "UDPv4 10.0.0.2"}, conf.unicastTables[0].masters)
+
+	profile := &ptpv1.PtpProfile{PtpSettings: map[string]string{
+		unicastMastersSetting: "tables:\n- logQueryInterval: 1\n  masters:\n  - address: 10.0.1.1\n  - address: 10.0.1.2\n    transport: UDPv4\n    priority: 1\n",
+		prtcSetting:           "PRTC-B",
+	}}
+	assert.NoError(t, conf.addUnicastMasters(profile.PtpSettings))
+	out, ifaces := conf.renderPtp4lConf()
+	assert.Len(t, ifaces, 2)
+	assert.Contains(t, out, "[unicast_master_table]\ntable_id 1\nlogQueryInterval 2\nUDPv4 10.0.0.1\nUDPv4 10.0.0.2")
+	assert.Contains(t, out, "[unicast_master_table]\ntable_id 2\nlogQueryInterval 1\nUDPv4 10.0.1.1\nUDPv4 10.0.1.2")
+	assert.Equal(t, " 2", conf.sections[1].options["unicast_master_table"])
+	assert.Equal(t, "7", conf.globalOption("logging_level"))
+	_, ok := conf.sections[2].options["unicast_master_table"]
+	assert.False(t, ok, "master only ports do not query masters")
+
+	telecom, err := conf.telecomProfile(profile)
+	assert.NoError(t, err)
+	assert.Equal(t, protocol.ProfileG8275_2, telecom.Name)
+	assert.Equal(t, protocol.PRTCB, telecom.PRTC)
+
+	for _, master := range []string{"address: 10.0.0", "{address: 10.0.0.1, transport: UDPv6}",
+		"{address: 10.0.0.1, transport: L2}", "{address: 10.0.0.1, transport: UDP}"} {
+		assert.Error(t, conf.addUnicastMasters(map[string]string{
+			unicastMastersSetting: "tables:\n- masters:\n  - " + master + "\n"}), master)
+	}
+	profile.PtpSettings[telecomProfileSetting] = protocol.ProfileG8275_1
+	_, err = conf.telecomProfile(profile)
+	assert.NoError(t, err)
+	profile.PtpSettings[aptsSetting] = "true"
+	_, err = conf.telecomProfile(profile)
+	assert.Error(t, err)
+}
+
+func Test_unicastMasters(t *testing.T) {
+	ptp4lConfig := `[global]
+network_transport UDPv6
+[ens1f0]
+masterOnly 0
+[ens1f1]
+masterOnly 0
+[ens1f2]
+masterOnly 1
+`
+	unicastMasters := `
+tables:
+- logQueryInterval: 2
+  ports: [ens1f0]
+  masters:
+  - address: 2001:db8::2
+    priority: 2
+  - address: 2001:db8::1
+    priority: 1
+- id: 5
+  ports: [ens1f1]
+  masters:
+  - address: 10.0.0.1
+    transport: UDPv4
+listenPorts: [ens1f2]
+`
+	conf := &ptp4lConf{}
+	assert.NoError(t, conf.populatePtp4lConf(&ptp4lConfig))
+	assert.NoError(t, conf.addUnicastMasters(map[string]string{unicastMastersSetting: unicastMasters}))
+	out, _ := conf.renderPtp4lConf()
+	assert.Contains(t, out, "[unicast_master_table]\ntable_id 1\nlogQueryInterval 2\nUDPv6 2001:db8::1\nUDPv6 2001:db8::2")
+	assert.Contains(t, out, "[unicast_master_table]\ntable_id 5\nUDPv4 10.0.0.1")
+	assert.Equal(t, " 1", conf.portSection("ens1f0").options["unicast_master_table"])
+	assert.Equal(t, " 5", conf.portSection("ens1f1").options["unicast_master_table"])
+	assert.Equal(t, " 1", conf.portSection("ens1f2").options["unicast_listen"])
+	assert.Equal(t, "7", conf.globalOption("logging_level"), "grants are logged at debug level")
+
+	invalid := map[string]string{
+		"unknown port":        "tables:\n- ports: [ens2f0]\n  masters:\n  - address: 2001:db8::1\n",
+		"master only port":    "tables:\n- ports: [ens1f2]\n  masters:\n  - address: 2001:db8::1\n",
+		"duplicate table id":  "tables:\n- id: 1\n  masters:\n  - address: 2001:db8::1\n- id: 1\n  masters:\n  - address: 2001:db8::2\n",
+		"duplicate master":    "tables:\n- masters:\n  - address: 2001:db8::1\n  - address: 2001:db8::1\n",
+		"no masters":          "tables:\n- ports: [ens1f0]\n",
+		"address mismatch":    "tables:\n- masters:\n  - address: 10.0.0.1\n",
+		"unknown field":       "tables:\n- master:\n  - address: 2001:db8::1\n",
+		"unknown listen port": "listenPorts: [ens2f0]\n",
+	}
+	for desc, spec := range invalid {
+		conf = &ptp4lConf{}
+		assert.NoError(t, conf.populatePtp4lConf(&ptp4lConfig))
+		assert.Error(t, conf.addUnicastMasters(map[string]string{unicastMastersSetting: spec}), desc)
+	}
+
+	// a profile without unicast settings is left as written, hand-written references are validated with the
+	// rendered tables
+	handWritten := ptp4lConfig + "[ens1f3]\nunicast_master_table 2\n"
+	conf = &ptp4lConf{}
+	assert.NoError(t, conf.populatePtp4lConf(&handWritten))
+	assert.NoError(t, conf.addUnicastMasters(map[string]string{}))
+	assert.Equal(t, "", conf.globalOption("logging_level"))
+	assert.ErrorContains(t, conf.addUnicastMasters(map[string]string{unicastMastersSetting: "listenPorts: [ens1f2]\n"}),
+		"unknown unicast master table 2")
+}
+
+func Test_unicastState(t *testing.T) {
+	ptp4lConfig := `[global]
+[unicast_master_table]
+table_id 1
+UDPv4 10.0.0.1
+UDPv4 10.0.0.2
+[ens1f0]
+unicast_master_table 1
+[ens1f1]
+masterOnly 1
+`
+	conf := &ptp4lConf{}
+	assert.NoError(t, conf.populatePtp4lConf(&ptp4lConfig))
+	assert.NoError(t, conf.addUnicastMasters(map[string]string{}))
+	assert.Equal(t, "", conf.globalOption("logging_level"))
+	p := &ptpProcess{name: ptp4lProcessName, configName: "ptp4l.3.config", ifaces: config.IFaces{{Name: "ens1f0"}, {Name: "ens1f1"}},
+		unicast: conf.newUnicastState()}
+	assert.NotNil(t, p.unicast)
+	for _, output := range []string{
+		"ptp4l[1000.1]: [ptp4l.3.config:6] port 1 (ens1f0): unicast Announce granted for 60 sec",
+		"ptp4l[1000.1]: [ptp4l.3.config:6] port 1 (ens1f0): unicast grant of Sync rejected",
+		"ptp4l[1000.2]: [ptp4l.3.config:6] port 1 (ens1f0): new foreign master 507c6f.fffe.1fb1b8-1",
+		"ptp4l[1000.2]: [ptp4l.3.config:6] port 1 (ens1f0): new foreign master 507c6f.fffe.1fb1b9-1",
+		"ptp4l[1000.3]: [ptp4l.3.config:6] selected best master clock 507c6f.fffe.1fb1b9",
+	} {
+		p.processUnicastOutput(nil, output)
+	}
+	now := time.Now()
+	ports := p.unicastPorts(now)
+	assert.Len(t, ports, 1)
+	assert.Equal(t, "ens1f0", ports[0].Interface)
+	assert.Equal(t, []string{"UDPv4 10.0.0.1", "UDPv4 10.0.0.2"}, ports[0].Masters)
+	assert.Equal(t, "507c6f.fffe.1fb1b9", ports[0].ActiveMaster)
+	assert.Len(t, ports[0].Grants, 2)
+	assert.Equal(t, "Announce", ports[0].Grants[0].Message)
+	assert.Equal(t, unicastGranted, ports[0].Grants[0].Result)
+	assert.Equal(t, unicastDenied, ports[0].Grants[1].Result)
+	assert.Equal(t, unicastExpired, p.unicastPorts(now.Add(2 * time.Minute))[0].Grants[0].Result)
+	labels := prometheus.Labels{"process": ptp4lProcessName, "node": NodeName, "config": "ptp4l.3.config", "iface": "ens1f0"}
+	assert.Equal(t, float64(1), testutil.ToFloat64(UnicastActiveMaster.With(prometheus.Labels{"process": ptp4lProcessName,
+		"node": NodeName, "config": "ptp4l.3.config", "iface": "ens1f0", "master": "507c6f.fffe.1fb1b9"})))
+	labels["message"] = "Sync"
+	assert.Equal(t, float64(0), testutil.ToFloat64(UnicastGrantStatus.With(labels)))
+
+	// the local clock is the best master again
+	p.processUnicastOutput(nil, "ptp4l[1000.4]: [ptp4l.3.config:6] selected local clock 507c6f.fffe.1fb1c0 as best master")
+	assert.Empty(t, p.unicastPorts(now)[0].ActiveMaster)
+}
+
+func Test_parseUnicastGrant(t *testing.T) {
+	tests := []struct {
+		output   string
+		ok       bool
+		portId   int
+		iface    string
+		message  string
+		result   string
+		duration int64
+	}{
+		{"ptp4l[1000.1]: [ptp4l.0.config:6] port 1 (ens1f0): unicast Announce granted for 300 sec", true, 1, "ens1f0", "Announce", unicastGranted, 300},
+		{"ptp4l[1000.1]: [ptp4l.0.config:6] port 2: unicast grant of Sync rejected", true, 2, "", "Sync", unicastDenied, 0},
+		{"ptp4l[1000.1]: [ptp4l.0.config:6] port 1 (ens1f0): unicast grant of Announce rejected", true, 1, "ens1f0", "Announce", unicastDenied, 0},
+		{"ptp4l[1000.1]: [ptp4l.0.config:6] port 1 (ens1f0): new foreign master", false, 0, "", "", "", 0},
+	}
+	for _, tt := range tests {
+		portId, iface, message, result, duration, ok := parseUnicastGrant(tt.output)
+		assert.Equal(t, tt.ok, ok, tt.output)
+		assert.Equal(t, tt.portId, portId, tt.output)
+		assert.Equal(t, tt.iface, iface, tt.output)
+		assert.Equal(t, tt.message, message, tt.output)
+		assert.Equal(t, tt.result, result, tt.output)
+		assert.Equal(t, tt.duration, duration, tt.output)
+	}
+
+	p := &ptpProcess{name: ptp4lProcessName, configName: "ptp4l.0.config", ifaces: config.IFaces{{Name: "ens1f0"}, {Name: "ens1f1"}}}
+	p.announceUnicastGrant(nil, "ptp4l[1000.1]: [ptp4l.0.config:6] port 2: unicast grant of Sync rejected")
+	assert.Equal(t, float64(1), testutil.ToFloat64(UnicastGrants.With(prometheus.Labels{"process": ptp4lProcessName, "node": NodeName,
+		"config": "ptp4l.0.config", "iface": "ens1f1", "message": "Sync", "result": unicastDenied})))
+	records := event.EventHistory.Query(event.HistoryFilter{ConfigName: "ptp4l.0.config", Interface: "ens1f1"})
+	assert.NotEmpty(t, records)
+	assert.Equal(t, event.UnicastGrantRecord, records[len(records)-1].Kind)
+}
+
+func Test_gptp(t *testing.T) {
+	ptp4lConfig := `[global]
+transportSpecific 0x1
+network_transport L2
+delay_mechanism P2P
+follow_up_info 1
+[ens1f0]
+[ens1f1]
+delay_mechanism E2E
+`
+	conf := &ptp4lConf{}
+	assert.NoError(t, conf.populatePtp4lConf(&ptp4lConfig))
+	assert.True(t, conf.isGPTP())
+	assert.Equal(t, []string{"port ens1f1 uses delay_mechanism E2E, gPTP requires P2P",
+		"telecomProfile G.8275.1 is set for a gPTP profile"},
+		conf.gptpWarnings(map[string]string{telecomProfileSetting: protocol.ProfileG8275_1}))
+	_, err := conf.newGPTPState(map[string]string{gptpPollIntervalSetting: "-1"})
+	assert.Error(t, err)
+	g, err := conf.newGPTPState(map[string]string{})
+	assert.NoError(t, err)
+	p := &ptpProcess{name: ptp4lProcessName, configName: "ptp4l.4.config", ifaces: config.IFaces{{Name: "ens1f0"}, {Name: "ens1f1"}}, gptp: g}
+
+	telecom := "[global]\ntransportSpecific 0\n[ens1f0]\n"
+	notGPTP := &ptp4lConf{}
+	assert.NoError(t, notGPTP.populatePtp4lConf(&telecom))
+	g, err = notGPTP.newGPTPState(map[string]string{})
+	assert.NoError(t, err)
+	assert.Nil(t, g)
+
+	// designated port states of the 802.1AS automotive profile
+	role := func(iface string) float64 {
+		return testutil.ToFloat64(InterfaceRole.With(prometheus.Labels{"process": ptp4lProcessName, "node": NodeName, "iface": iface}))
+	}
+	p.processGPTPOutput("ptp4l[1000.1]: [ptp4l.4.config:6] port 1 (ens1f0): INITIALIZING to SLAVE on INIT_COMPLETE")
+	p.processGPTPOutput("ptp4l[1000.1]: [ptp4l.4.config:6] port 2: INITIALIZING to MASTER on INIT_COMPLETE")
+	assert.Equal(t, float64(SLAVE), role("ens1f0"))
+	assert.Equal(t, float64(MASTER), role("ens1f1"))
+
+	defer func(f func(string, string, *regexp.Regexp) (string, []string, error)) { gptpPMC = f }(gptpPMC)
+	responses := map[string]string{
+		pmc.CmdGetPortDataSet: `
+	507c6f.fffe.1fb1b8-1 seq 0 RESPONSE MANAGEMENT PORT_DATA_SET
+		portIdentity            507c6f.fffe.1fb1b8-1
+		portState               SLAVE
+		logMinDelayReqInterval  0
+		peerMeanPathDelay       412
+		logAnnounceInterval     0
+	507c6f.fffe.1fb1b8-2 seq 0 RESPONSE MANAGEMENT PORT_DATA_SET
+		portIdentity            507c6f.fffe.1fb1b8-2
+		portState               DISABLED
+		logMinDelayReqInterval  0
+		peerMeanPathDelay       0
+		logAnnounceInterval     0`,
+		pmc.CmdGetPortDataSetNP: `
+	507c6f.fffe.1fb1b8-1 seq 1 RESPONSE MANAGEMENT PORT_DATA_SET_NP
+		neighborPropDelayThresh 800
+		asCapable               1
+	507c6f.fffe.1fb1b8-2 seq 1 RESPONSE MANAGEMENT PORT_DATA_SET_NP
+		neighborPropDelayThresh 800
+		asCapable               0`,
+		pmc.CmdGetTimeStatusNP: `
+	507c6f.fffe.1fb1b8-0 seq 2 RESPONSE MANAGEMENT TIME_STATUS_NP
+		master_offset              -3
+		ingress_time               1700000000000000000
+		cumulativeScaledRateOffset +0.000000015
+		scaledLastGmPhaseChange    0
+		gmTimeBaseIndicator        0
+		lastGmPhaseChange          0x0000'0000000000000000.0000
+		gmPresent                  true
+		gmIdentity                 001122.fffe.334455`,
+	}
+	gptpPMC = func(configFileName, cmdStr string, promptRE *regexp.Regexp) (string, []string, error) {
+		assert.Equal(t, "ptp4l.4.config", configFileName)
+		matches := promptRE.FindStringSubmatch(responses[cmdStr])
+		assert.NotNil(t, matches, cmdStr)
+		return responses[cmdStr], matches, nil
+	}
+	p.updateGPTP()
+
+	labels := prometheus.Labels{"process": ptp4lProcessName, "node": NodeName, "config": "ptp4l.4.config", "iface": "ens1f0"}
+	assert.Equal(t, float64(1), testutil.ToFloat64(GPTPAsCapable.With(labels)))
+	assert.Equal(t, float64(412), testutil.ToFloat64(GPTPNeighborPropDelay.With(labels)))
+	assert.Equal(t, float64(800), testutil.ToFloat64(GPTPNeighborPropDelayThresh.With(labels)))
+	labels["iface"] = "ens1f1"
+	assert.Equal(t, float64(0), testutil.ToFloat64(GPTPAsCapable.With(labels)))
+	assert.Equal(t, float64(FAULTY), role("ens1f1"), "a DISABLED port is FAULTY")
+	assert.Equal(t, float64(SLAVE), role("ens1f0"))
+	cfgLabels := prometheus.Labels{"process": ptp4lProcessName, "node": NodeName, "config": "ptp4l.4.config"}
+	assert.InDelta(t, 1.000000015, testutil.ToFloat64(GPTPRateRatio.With(cfgLabels)), 1e-12)
+	assert.Equal(t, float64(1), testutil.ToFloat64(GPTPGMPresent.With(cfgLabels)))
+
+	deleteMetrics(p.ifaces, nil, ptp4lProcessName, "ptp4l.4.config")
+	assert.Equal(t, 0, testutil.CollectAndCount(GPTPAsCapable))
+	assert.Equal(t, 0, testutil.CollectAndCount(GPTPRateRatio))
+}
+
+func Test_apiSynce(t *testing.T) {
+	relations := &synce.Relations{Devices: []*synce.Config{{Name: "synce1", Ifaces: []string{"ens7f0"}, ClockId: "1",
+		NetworkOption: synce.SYNCE_NETWORK_OPT_1, LastQLState: map[string]*synce.QualityLevelInfo{}}}}
+	p := &ptpProcess{name: syncEProcessName, configName: "synce4l.0.config", syncERelations: relations}
+	a := &apiProvider{dn: &Daemon{processManager: &ProcessManager{process: []*ptpProcess{p}}}}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			p.ProcessSynceEvents(synce.ParseLog("synce4l[627602.540]: [synce4l.0.config] EEC_LOCKED/EEC_LOCKED_HO_ACQ for ens7f0"))
+			p.ProcessSynceEvents(synce.ParseLog("synce4l[1225226.279]: [synce4l.0.config] tx_rebuild_tlv: attached new TLV, QL=0x1 on ens7f0"))
+		}
+	}()
+	// the query API reads the device states while synce4l reports them
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			a.Synce()
+		}
+	}
+	devices := a.Synce()
+	if assert.Len(t, devices, 1) {
+		assert.Equal(t, string(event.PTP_LOCKED), devices[0].State)
+		assert.Equal(t, byte(1), devices[0].QualityLevels["ens7f0"].SSM)
+	}
+}
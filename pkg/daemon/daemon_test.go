@@ -3,6 +3,7 @@ package daemon_test
 import (
 	"flag"
 	"fmt"
+	"math"
 	"os"
 	"strings"
 	"testing"
@@ -16,6 +17,8 @@ import (
 
 	"github.com/openshift/linuxptp-daemon/pkg/config"
 	"github.com/openshift/linuxptp-daemon/pkg/daemon"
+	"github.com/openshift/linuxptp-daemon/pkg/dpll"
+	nl "github.com/openshift/linuxptp-daemon/pkg/dpll-netlink"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
@@ -83,7 +86,7 @@ func (tc *TestCase) cleanupMetrics() {
 	daemon.FrequencyAdjustment.With(map[string]string{"from": tc.from, "process": tc.process, "node": tc.node, "iface": tc.iface}).Set(CLEANUP)
 	daemon.Delay.With(map[string]string{"from": tc.from, "process": tc.process, "node": tc.node, "iface": tc.iface}).Set(CLEANUP)
 	daemon.ClockState.With(map[string]string{"process": tc.process, "node": tc.node, "iface": tc.iface}).Set(CLEANUP)
-	daemon.ClockClassMetrics.With(map[string]string{"process": tc.process, "node": tc.node}).Set(CLEANUP)
+	daemon.ClockClassMetrics.With(map[string]string{"process": tc.process, "node": tc.node, "config": strings.Trim(tc.MessageTag, "[]")}).Set(CLEANUP)
 	daemon.InterfaceRole.With(map[string]string{"process": tc.process, "node": tc.node, "iface": tc.iface}).Set(CLEANUP)
 }
 
@@ -237,7 +240,11 @@ func TestMain(m *testing.M) {
 }
 func Test_ProcessPTPMetrics(t *testing.T) {
 	leap.MockLeapFile()
-	defer close(leap.LeapMgr.Close)
+	lm := leap.LeapMgr
+	defer func() {
+		close(lm.Close)
+		<-lm.Done
+	}()
 
 	assert := assert.New(t)
 	for _, tc := range testCases {
@@ -267,7 +274,7 @@ func Test_ProcessPTPMetrics(t *testing.T) {
 			assert.Equal(tc.expectedClockState, testutil.ToFloat64(clockState), "ClockState does not match\n%s", tc.String())
 		}
 		if tc.expectedClockClassMetrics != SKIP {
-			clockClassMetrics := daemon.ClockClassMetrics.With(map[string]string{"process": tc.process, "node": tc.node})
+			clockClassMetrics := daemon.ClockClassMetrics.With(map[string]string{"process": tc.process, "node": tc.node, "config": strings.Trim(tc.MessageTag, "[]")})
 			assert.Equal(tc.expectedClockClassMetrics, testutil.ToFloat64(clockClassMetrics), "ClockClassMetrics does not match\n%s", tc.String())
 		}
 		if tc.expectedInterfaceRole != SKIP {
@@ -463,4 +470,72 @@ func TestDaemon_ProcessSynceLogs(t *testing.T) {
 		assert.Equal(t, l.expectedState, relations.Devices[0].LastClockState, l.output)
 
 	}
+	assert.True(t, dpll.FrequencyTraceable(1), "EEC locked to a PRTC")
+	pm.RunSynceParser("synce4l[627602.540]: [synce4l.0.config] EEC_HOLDOVER for ens7f0")
+	assert.False(t, dpll.FrequencyTraceable(1), "EEC in holdover")
+}
+
+func TestLinuxPTPConfUpdate_ReloadConfig(t *testing.T) {
+	u := &daemon.LinuxPTPConfUpdate{UpdateCh: make(chan bool, 3)}
+	profiles := []byte(`[{"name":"gm","interface":"ens1f0"}]`)
+	assert.NoError(t, u.UpdateConfig(profiles))
+	assert.NoError(t, u.UpdateConfig(profiles))
+	assert.Len(t, u.UpdateCh, 1, "unchanged profiles are not applied again")
+
+	assert.NoError(t, u.ReloadConfig(profiles))
+	assert.Len(t, u.UpdateCh, 2, "a reload applies unchanged profiles")
+	assert.Equal(t, "gm", *u.NodeProfiles[0].Name)
+
+	assert.Error(t, u.ReloadConfig([]byte(`{`)))
+	assert.NoError(t, u.UpdateConfig(profiles))
+	assert.Len(t, u.UpdateCh, 2, "a failed reload keeps the applied profiles")
+}
+
+func TestUpdateDpllMetrics(t *testing.T) {
+	device := &nl.DoDeviceGetReply{Id: 1, ClockId: 0x507c6fffff1fb1b8, Type: 1, LockStatus: 3, Temp: 51500,
+		Mode: nl.DPLL_MODE_AUTOMATIC, ModeSupported: []uint32{nl.DPLL_MODE_AUTOMATIC}}
+	daemon.UpdateDpllDeviceMetrics("ens1f0", device)
+	labels := prometheus.Labels{"process": "dpll", "node": MYNODE, "iface": "ens1f0", "clock_id": "0x507c6fffff1fb1b8", "type": "pps"}
+	assert.Equal(t, 3.0, testutil.ToFloat64(daemon.DpllLockStatus.With(labels)))
+	assert.Equal(t, 51.5, testutil.ToFloat64(daemon.DpllTemperature.With(labels)))
+	assert.Equal(t, 2.0, testutil.ToFloat64(daemon.DpllMode.With(labels)))
+	labels["mode"] = "automatic"
+	assert.Equal(t, 1.0, testutil.ToFloat64(daemon.DpllModeSupported.With(labels)))
+
+	pin := &nl.DoPinGetReply{Id: 7, ClockId: 0x507c6fffff1fb1b8, PanelLabel: "SMA1", Frequency: 1,
+		FractionalFrequencyOffset: -2, PhaseAdjust: 7658,
+		ParentDevice: []nl.PinParentDevice{
+			{ParentId: 0, Direction: nl.DPLL_PIN_DIRECTION_INPUT, Prio: 3, State: nl.DPLL_PIN_STATE_SELECTABLE, PhaseOffset: math.MaxInt64},
+			{ParentId: 1, Direction: nl.DPLL_PIN_DIRECTION_INPUT, Prio: 1, State: nl.DPLL_PIN_STATE_CONNECTED, PhaseOffset: -12_000_000},
+		}}
+	parentType := func(id uint32) string { return map[uint32]string{0: "eec", 1: "pps"}[id] }
+	daemon.UpdateDpllPinMetrics("ens1f0", pin, parentType)
+	labels = prometheus.Labels{"process": "dpll", "node": MYNODE, "iface": "ens1f0", "clock_id": "0x507c6fffff1fb1b8", "pin": "SMA1"}
+	assert.Equal(t, 1.0, testutil.ToFloat64(daemon.DpllPinFrequency.With(labels)))
+	assert.Equal(t, -2.0, testutil.ToFloat64(daemon.DpllPinFFO.With(labels)))
+	assert.Equal(t, 7658.0, testutil.ToFloat64(daemon.DpllPinPhaseAdjust.With(labels)))
+	labels["parent"] = "pps"
+	assert.Equal(t, float64(nl.DPLL_PIN_STATE_CONNECTED), testutil.ToFloat64(daemon.DpllPinState.With(labels)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(daemon.DpllPinPriority.With(labels)))
+	assert.Equal(t, -12.0, testutil.ToFloat64(daemon.DpllPinPhaseOffset.With(labels)))
+	labels["parent"] = "eec"
+	assert.Equal(t, 3.0, testutil.ToFloat64(daemon.DpllPinPriority.With(labels)))
+	assert.False(t, daemon.DpllPinPhaseOffset.Delete(labels), "no phase offset measured towards the eec DPLL")
+
+	// a device without temperature does not export one
+	eec := &nl.DoDeviceGetReply{Id: 0, ClockId: 0x507c6fffff1fb1b8, Type: 2, LockStatus: 2}
+	daemon.UpdateDpllDeviceMetrics("ens1f0", eec)
+	labels = prometheus.Labels{"process": "dpll", "node": MYNODE, "iface": "ens1f0", "clock_id": "0x507c6fffff1fb1b8", "type": "eec"}
+	assert.Equal(t, 2.0, testutil.ToFloat64(daemon.DpllLockStatus.With(labels)))
+	assert.False(t, daemon.DpllTemperature.Delete(labels), "no temperature reported by the eec DPLL")
+
+	// the metrics of removed devices and pins are dropped, the other devices keep theirs
+	daemon.DeleteDpllDeviceMetrics("ens1f0", device)
+	daemon.DeleteDpllPinMetrics("ens1f0", pin)
+	assert.Equal(t, 1, testutil.CollectAndCount(daemon.DpllLockStatus))
+	for _, m := range []*prometheus.GaugeVec{daemon.DpllMode, daemon.DpllModeSupported, daemon.DpllTemperature,
+		daemon.DpllPinState, daemon.DpllPinPriority, daemon.DpllPinPhaseOffset, daemon.DpllPinFFO,
+		daemon.DpllPinFrequency, daemon.DpllPinPhaseAdjust} {
+		assert.Equal(t, 0, testutil.CollectAndCount(m))
+	}
 }
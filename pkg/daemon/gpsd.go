@@ -80,6 +80,11 @@ func (g *GPSD) MonitorProcess(p config.ProcessConfig) {
 	g.processConfig = p
 }
 
+// eventProducer ... name of the producer delivering the GNSS events
+func (g *GPSD) eventProducer() string {
+	return fmt.Sprintf("%s/%s", event.GNSS, g.processConfig.ConfigName)
+}
+
 func (g *GPSD) registerSubscriber() {
 	event.StateRegisterer.Register(g.subscriber)
 }
@@ -218,17 +223,13 @@ func (g *GPSD) MonitorGNSSEventsWithUblox() {
 	g.state = event.PTP_FREERUN
 	ticker := time.NewTicker(GNSSMONITOR_INTERVAL)
 	doneFn := func() {
-		select {
-		case g.processConfig.EventChannel <- event.EventChannel{
+		event.Deliver(g.eventProducer(), g.processConfig.EventChannel, event.EventChannel{
 			ProcessName: event.GNSS,
 			CfgName:     g.processConfig.ConfigName,
 			ClockType:   g.processConfig.ClockType,
 			Time:        time.Now().UnixMilli(),
 			Reset:       true,
-		}:
-		default:
-			glog.Error("failed to send gnss terminated event to eventHandler")
-		}
+		})
 		ticker.Stop()
 		return // exit
 	}
@@ -298,8 +299,7 @@ retry:
 					g.state = event.PTP_FREERUN
 					g.sourceLost = true
 				}
-				select {
-				case g.processConfig.EventChannel <- event.EventChannel{
+				event.Deliver(g.eventProducer(), g.processConfig.EventChannel, event.EventChannel{
 					ProcessName: event.GNSS,
 					State:       g.state,
 					CfgName:     g.processConfig.ConfigName,
@@ -313,10 +313,7 @@ retry:
 					SourceLost: g.sourceLost,
 					WriteToLog: true,
 					Reset:      false,
-				}:
-				default:
-					glog.Error("failed to send gnss terminated event to eventHandler")
-				}
+				})
 				if timeLs != nil {
 					select {
 					case leap.LeapMgr.UbloxLsInd <- *timeLs:
@@ -0,0 +1,276 @@
+package daemon
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/openshift/linuxptp-daemon/pkg/pmc"
+	"github.com/openshift/linuxptp-daemon/pkg/protocol"
+)
+
+const (
+	// gptpPollIntervalSetting ... ptpSettings key of the seconds between pmc queries of the gPTP datasets, 0 disables them
+	gptpPollIntervalSetting = "gptpPollInterval"
+	defaultGPTPPollInterval = 10 * time.Second
+)
+
+var (
+	// port 1 (ens1f0): INITIALIZING to SLAVE on INIT_COMPLETE
+	portStateChangeRegEx = regexp.MustCompile(`port (\d+)(?: \(([^)]+)\))?: (\w+) to (\w+) on (\w+)`)
+
+	// gptpPMC ... pmc query of the gPTP datasets
+	gptpPMC = pmc.RunPMCExp
+)
+
+// gptpPortState ... last gPTP datasets of a port
+type gptpPortState struct {
+	state             string
+	asCapable         bool
+	neighborPropDelay int64
+	polled            bool
+}
+
+// gptpState ... gPTP state of the ports of a ptp4l process, polled from its management datasets
+type gptpState struct {
+	sync.Mutex
+	pollInterval time.Duration
+	ports        map[string]*gptpPortState
+	gmPresent    bool
+	stopCh       chan struct{}
+	stopOnce     sync.Once
+}
+
+// isGPTP ... true for an IEEE 802.1AS config, which sets transportSpecific 1 globally or on a port
+func (conf *ptp4lConf) isGPTP() bool {
+	for _, section := range conf.sections {
+		if section.sectionName == "[nmea]" {
+			continue
+		}
+		if v, ok := section.options["transportSpecific"]; ok {
+			if ts, err := strconv.ParseUint(strings.TrimSpace(v), 0, 8); err == nil && ts == 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// portOption ... option of a port section, falling back to [global] and to the ptp4l default
+func (conf *ptp4lConf) portOption(section ptp4lConfSection, name, def string) string {
+	if v, ok := section.options[name]; ok {
+		return strings.TrimSpace(v)
+	}
+	if v := conf.globalOption(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// gptpWarnings ... settings of a gPTP config that do not follow IEEE 802.1AS
+func (conf *ptp4lConf) gptpWarnings(settings map[string]string) []string {
+	var warnings []string
+	for _, section := range conf.sections {
+		if !isPortSection(section) {
+			continue
+		}
+		port := strings.Trim(section.sectionName, "[]")
+		if transport := conf.portOption(section, "network_transport", "UDPv4"); transport != "L2" {
+			warnings = append(warnings, fmt.Sprintf("port %s uses network_transport %s, gPTP requires L2", port, transport))
+		}
+		if delay := conf.portOption(section, "delay_mechanism", "E2E"); delay != "P2P" {
+			warnings = append(warnings, fmt.Sprintf("port %s uses delay_mechanism %s, gPTP requires P2P", port, delay))
+		}
+		if id, _ := strconv.Atoi(strings.TrimSpace(section.options["unicast_master_table"])); id != 0 ||
+			strings.TrimSpace(section.options["unicast_listen"]) == "1" {
+			warnings = append(warnings, fmt.Sprintf("port %s uses unicast negotiation, gPTP is multicast only", port))
+		}
+	}
+	if conf.globalOption("follow_up_info") != "1" {
+		warnings = append(warnings, "follow_up_info is not set, gPTP sends the follow up information TLV")
+	}
+	if conf.globalOption("twoStepFlag") == "0" {
+		warnings = append(warnings, "twoStepFlag is 0, gPTP is a two-step protocol")
+	}
+	if comparison := conf.globalOption("dataset_comparison"); strings.HasPrefix(comparison, "G.8275") {
+		warnings = append(warnings, fmt.Sprintf("dataset_comparison %s is a telecom profile BMCA", comparison))
+	}
+	if name := settings[telecomProfileSetting]; name != "" {
+		warnings = append(warnings, fmt.Sprintf("%s %s is set for a gPTP profile", telecomProfileSetting, name))
+	}
+	return warnings
+}
+
+// newGPTPState ... gPTP state of the ports, nil for a config that is not gPTP
+func (conf *ptp4lConf) newGPTPState(settings map[string]string) (*gptpState, error) {
+	if !conf.isGPTP() {
+		return nil, nil
+	}
+	g := &gptpState{pollInterval: defaultGPTPPollInterval, ports: map[string]*gptpPortState{}, stopCh: make(chan struct{})}
+	if v, ok := settings[gptpPollIntervalSetting]; ok {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds < 0 {
+			return nil, fmt.Errorf("invalid %s %q", gptpPollIntervalSetting, v)
+		}
+		g.pollInterval = time.Duration(seconds) * time.Second
+	}
+	for _, section := range conf.sections {
+		if isPortSection(section) {
+			g.ports[strings.Trim(section.sectionName, "[]")] = &gptpPortState{}
+		}
+	}
+	return g, nil
+}
+
+// gptpPortRole ... InterfaceRole of a port state, false for the transient states that keep the current role
+func gptpPortRole(state string) (ptpPortRole, bool) {
+	switch state {
+	case "SLAVE":
+		return SLAVE, true
+	case "MASTER", "GRAND_MASTER":
+		return MASTER, true
+	case "PASSIVE", "PASSIVE_SLAVE":
+		return PASSIVE, true
+	case "FAULTY", "DISABLED":
+		return FAULTY, true
+	case "LISTENING":
+		return LISTENING, true
+	}
+	return UNKNOWN, false
+}
+
+// processGPTPOutput ... map the port state changes of a gPTP ptp4l to InterfaceRole. Besides the transitions
+// of the BMCA, gPTP ports with designated states go from INITIALIZING to SLAVE or MASTER and a port that is
+// not asCapable or whose link is down is DISABLED.
+func (p *ptpProcess) processGPTPOutput(output string) {
+	match := portStateChangeRegEx.FindStringSubmatch(output)
+	if match == nil {
+		return
+	}
+	if portId, _ := extractPTP4lEventState(output); portId > 0 {
+		return // already set by extractMetrics
+	}
+	role, ok := gptpPortRole(match[4])
+	if !ok {
+		return
+	}
+	portId, _ := strconv.Atoi(match[1])
+	iface := p.ifaceOf(portId, match[2])
+	if iface == "" {
+		return
+	}
+	p.gptp.Lock()
+	if port, found := p.gptp.ports[iface]; found {
+		port.state = match[4]
+	}
+	p.gptp.Unlock()
+	updateInterfaceRole(p.configName, p.name, iface, role)
+}
+
+// pollGPTP ... query the gPTP datasets of the ptp4l process until it is stopped
+func (p *ptpProcess) pollGPTP() {
+	if p.gptp.pollInterval == 0 {
+		return
+	}
+	ticker := time.NewTicker(p.gptp.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.gptp.stopCh:
+			return
+		case <-ticker.C:
+			p.updateGPTP()
+		}
+	}
+}
+
+// updateGPTP ... query PORT_DATA_SET, PORT_DATA_SET_NP and TIME_STATUS_NP and update the gPTP metrics
+func (p *ptpProcess) updateGPTP() {
+	ports := len(p.ifaces)
+	result, _, err := gptpPMC(p.configName, pmc.CmdGetPortDataSet, protocol.PortDataSetRegEx(ports))
+	if err != nil {
+		glog.Errorf("%s: failed to get PORT_DATA_SET: %s", p.configName, err)
+		return
+	}
+	p.applyPortDataSets(protocol.ParsePortDataSets(result))
+	if result, _, err = gptpPMC(p.configName, pmc.CmdGetPortDataSetNP, protocol.PortDataSetNPRegEx(ports)); err != nil {
+		glog.Errorf("%s: failed to get PORT_DATA_SET_NP: %s", p.configName, err)
+		return
+	}
+	p.applyPortDataSetsNP(protocol.ParsePortDataSetsNP(result))
+	if result, _, err = gptpPMC(p.configName, pmc.CmdGetTimeStatusNP, protocol.TimeStatusNPRegEx()); err != nil {
+		glog.Errorf("%s: failed to get TIME_STATUS_NP: %s", p.configName, err)
+		return
+	}
+	if ts, ok := protocol.ParseTimeStatusNP(result); ok {
+		p.applyTimeStatusNP(ts)
+	}
+}
+
+// applyPortDataSets ... port state and neighborPropDelay of the ports
+func (p *ptpProcess) applyPortDataSets(datasets []protocol.PortDataSet) {
+	for _, ds := range datasets {
+		iface := p.ifaceOf(ds.PortNumber, "")
+		p.gptp.Lock()
+		port, found := p.gptp.ports[iface]
+		changed := false
+		if found {
+			changed = port.state != ds.PortState
+			port.state = ds.PortState
+			port.neighborPropDelay = ds.PeerMeanPathDelay
+		}
+		p.gptp.Unlock()
+		if !changed {
+			continue
+		}
+		if role, ok := gptpPortRole(ds.PortState); ok {
+			updateInterfaceRole(p.configName, p.name, iface, role)
+		}
+	}
+}
+
+// applyPortDataSetsNP ... asCapable of the ports, reported with the neighborPropDelay of the last PORT_DATA_SET
+func (p *ptpProcess) applyPortDataSetsNP(datasets []protocol.PortDataSetNP) {
+	for _, ds := range datasets {
+		iface := p.ifaceOf(ds.PortNumber, "")
+		p.gptp.Lock()
+		port, found := p.gptp.ports[iface]
+		if !found {
+			p.gptp.Unlock()
+			continue
+		}
+		if port.asCapable != ds.AsCapable || !port.polled {
+			if ds.AsCapable {
+				glog.Infof("%s: port %s is asCapable, neighborPropDelay %dns", p.configName, iface, port.neighborPropDelay)
+			} else {
+				glog.Warningf("%s: port %s is not asCapable, neighborPropDelay %dns threshold %dns",
+					p.configName, iface, port.neighborPropDelay, ds.NeighborPropDelayThresh)
+			}
+		}
+		port.asCapable = ds.AsCapable
+		port.polled = true
+		neighborPropDelay := port.neighborPropDelay
+		p.gptp.Unlock()
+		UpdateGPTPPortMetrics(p.configName, iface, ds, neighborPropDelay)
+	}
+}
+
+// applyTimeStatusNP ... rate ratio to the grandmaster and gmPresent
+func (p *ptpProcess) applyTimeStatusNP(ts protocol.TimeStatusNP) {
+	p.gptp.Lock()
+	if p.gptp.gmPresent != ts.GMPresent {
+		glog.Infof("%s: gPTP gmPresent %t", p.configName, ts.GMPresent)
+	}
+	p.gptp.gmPresent = ts.GMPresent
+	p.gptp.Unlock()
+	UpdateGPTPTimeStatusMetrics(p.configName, ts)
+}
+
+// stop ... stop polling the gPTP datasets
+func (g *gptpState) stop() {
+	g.stopOnce.Do(func() { close(g.stopCh) })
+}
@@ -3,6 +3,7 @@ package daemon
 import (
 	"fmt"
 	"github.com/openshift/linuxptp-daemon/pkg/synce"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
@@ -13,6 +14,10 @@ import (
 	"github.com/prometheus/client_golang/prometheus/collectors"
 
 	"github.com/openshift/linuxptp-daemon/pkg/config"
+	"github.com/openshift/linuxptp-daemon/pkg/dpll"
+	nl "github.com/openshift/linuxptp-daemon/pkg/dpll-netlink"
+	"github.com/openshift/linuxptp-daemon/pkg/event"
+	"github.com/openshift/linuxptp-daemon/pkg/protocol"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	utilwait "k8s.io/apimachinery/pkg/util/wait"
 
@@ -139,7 +144,7 @@ var (
 			Subsystem: PTPSubsystem,
 			Name:      "clock_class",
 			Help:      "6 = Locked, 7 = PRC unlocked in-spec, 52/187 = PRC unlocked out-of-spec, 135 = T-BC holdover in-spec, 165 = T-BC holdover out-of-spec, 248 = Default, 255 = Slave Only Clock",
-		}, []string{"process", "node"})
+		}, []string{"process", "node", "config"})
 
 	// InterfaceRole metrics to show current interface role
 	InterfaceRole = prometheus.NewGaugeVec(
@@ -175,6 +180,168 @@ var (
 			Help:      "0 = INACTIVE 1 = ACTIVE",
 		}, []string{"process", "node", "profile"})
 
+	// UnicastGrants ... unicast negotiation grants and denials received by the ptp4l ports
+	UnicastGrants = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "unicast_grants_total",
+			Help:      "unicast negotiation grants per port and message type, result is granted or denied",
+		}, []string{"process", "node", "config", "iface", "message", "result"})
+
+	// UnicastGrantStatus ... last unicast grant result of a port per message type
+	UnicastGrantStatus = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "unicast_grant_status",
+			Help:      "0 = DENIED 1 = GRANTED, last unicast grant of the port for the message type",
+		}, []string{"process", "node", "config", "iface", "message"})
+
+	// UnicastActiveMaster ... unicast master selected as best master on a port
+	UnicastActiveMaster = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "unicast_active_master",
+			Help:      "1 for the clock identity of the unicast master the port is synchronized to",
+		}, []string{"process", "node", "config", "iface", "master"})
+
+	// GPTPAsCapable ... asCapable of the gPTP ports
+	GPTPAsCapable = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "gptp_as_capable",
+			Help:      "0 = NOT asCapable 1 = asCapable, the port exchanges gPTP messages with its neighbor",
+		}, []string{"process", "node", "config", "iface"})
+
+	// GPTPNeighborPropDelay ... neighborPropDelay measured by the gPTP ports
+	GPTPNeighborPropDelay = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "gptp_neighbor_prop_delay_ns",
+			Help:      "mean propagation delay to the neighbor of the port measured by the peer delay mechanism",
+		}, []string{"process", "node", "config", "iface"})
+
+	// GPTPNeighborPropDelayThresh ... neighborPropDelayThresh of the gPTP ports
+	GPTPNeighborPropDelayThresh = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "gptp_neighbor_prop_delay_thresh_ns",
+			Help:      "neighborPropDelay above which the port is not asCapable",
+		}, []string{"process", "node", "config", "iface"})
+
+	// GPTPRateRatio ... rate ratio of the grandmaster to the local clock
+	GPTPRateRatio = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "gptp_rate_ratio",
+			Help:      "ratio of the grandmaster frequency to the local clock frequency, 1 + cumulativeScaledRateOffset",
+		}, []string{"process", "node", "config"})
+
+	// GPTPGMPresent ... gmPresent of the gPTP time-aware system
+	GPTPGMPresent = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "gptp_gm_present",
+			Help:      "0 = no grandmaster 1 = a grandmaster is present in the gPTP domain",
+		}, []string{"process", "node", "config"})
+
+	// DpllMode ... working mode of a DPLL device
+	DpllMode = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "dpll_mode",
+			Help:      "1 = manual 2 = automatic, working mode of the eec or pps DPLL of the interface",
+		}, dpllDeviceLabels())
+
+	// DpllModeSupported ... working modes a DPLL device supports
+	DpllModeSupported = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "dpll_mode_supported",
+			Help:      "1 for every mode the eec or pps DPLL of the interface supports",
+		}, dpllDeviceLabels("mode"))
+
+	// DpllLockStatus ... lock status of a DPLL device
+	DpllLockStatus = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "dpll_lock_status",
+			Help:      "1 = unlocked 2 = locked 3 = locked, holdover acquired 4 = holdover, lock status of the eec or pps DPLL",
+		}, dpllDeviceLabels())
+
+	// DpllTemperature ... temperature of a DPLL device
+	DpllTemperature = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "dpll_temperature_celsius",
+			Help:      "temperature of the eec or pps DPLL in degrees Celsius",
+		}, dpllDeviceLabels())
+
+	// DpllPinState ... state of a pin towards a parent DPLL device
+	DpllPinState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "dpll_pin_state",
+			Help:      "1 = connected 2 = disconnected 3 = selectable, state of the pin towards its parent eec or pps DPLL",
+		}, dpllPinLabels("parent"))
+
+	// DpllPinPriority ... priority of an input pin towards a parent DPLL device
+	DpllPinPriority = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "dpll_pin_priority",
+			Help:      "priority of the input pin towards its parent eec or pps DPLL, 0 is the highest",
+		}, dpllPinLabels("parent"))
+
+	// DpllPinPhaseOffset ... phase offset of a pin measured by a parent DPLL device
+	DpllPinPhaseOffset = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "dpll_pin_phase_offset_ns",
+			Help:      "phase offset of the pin measured by its parent eec or pps DPLL in ns",
+		}, dpllPinLabels("parent"))
+
+	// DpllPinFFO ... fractional frequency offset of a pin
+	DpllPinFFO = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "dpll_pin_ffo_ppm",
+			Help:      "fractional frequency offset of the signal of the pin in ppm",
+		}, dpllPinLabels())
+
+	// DpllPinFrequency ... frequency of a pin
+	DpllPinFrequency = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "dpll_pin_frequency_hz",
+			Help:      "frequency of the signal of the pin in Hz",
+		}, dpllPinLabels())
+
+	// DpllPinPhaseAdjust ... phase adjustment of a pin
+	DpllPinPhaseAdjust = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "dpll_pin_phase_adjust_ps",
+			Help:      "phase adjustment of the pin in ps",
+		}, dpllPinLabels())
+
 	// SynceClockQL  metrics to show current synce Clock Qulity
 	SynceClockQL = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -209,8 +376,32 @@ func RegisterMetrics(nodeName string) {
 		prometheus.MustRegister(ProcessRestartCount)
 		prometheus.MustRegister(ClockClassMetrics)
 		prometheus.MustRegister(PTPHAMetrics)
+		prometheus.MustRegister(UnicastGrants)
+		prometheus.MustRegister(UnicastGrantStatus)
+		prometheus.MustRegister(UnicastActiveMaster)
+		prometheus.MustRegister(GPTPAsCapable)
+		prometheus.MustRegister(GPTPNeighborPropDelay)
+		prometheus.MustRegister(GPTPNeighborPropDelayThresh)
+		prometheus.MustRegister(GPTPRateRatio)
+		prometheus.MustRegister(GPTPGMPresent)
+		prometheus.MustRegister(DpllMode)
+		prometheus.MustRegister(DpllModeSupported)
+		prometheus.MustRegister(DpllLockStatus)
+		prometheus.MustRegister(DpllTemperature)
+		prometheus.MustRegister(DpllPinState)
+		prometheus.MustRegister(DpllPinPriority)
+		prometheus.MustRegister(DpllPinPhaseOffset)
+		prometheus.MustRegister(DpllPinFFO)
+		prometheus.MustRegister(DpllPinFrequency)
+		prometheus.MustRegister(DpllPinPhaseAdjust)
 		prometheus.MustRegister(SynceQLInfo)
 		prometheus.MustRegister(SynceClockQL)
+		prometheus.MustRegister(OffsetLastUpdate)
+		prometheus.MustRegister(StaleMetricsCount)
+		prometheus.MustRegister(event.EventsBlocked)
+		prometheus.MustRegister(event.EventsCoalesced)
+		prometheus.MustRegister(event.EventQueueDepth)
+		prometheus.MustRegister(event.EventsSuppressed)
 
 		// Including these stats kills performance when Prometheus polls with multiple targets
 		prometheus.Unregister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
@@ -237,8 +428,18 @@ func InitializeOffsetMaps() {
 	}
 }
 
-// updatePTPMetrics ...
-func updatePTPMetrics(from, process, iface string, ptpOffset, maxPtpOffset, frequencyAdjustment, delay float64) {
+// updatePTPMetrics ... update metrics and record the time of the update, configName is the config reporting the
+// series, empty to keep the one already known
+func updatePTPMetrics(configName, from, process, iface string, ptpOffset, maxPtpOffset, frequencyAdjustment, delay float64) {
+	now := time.Now()
+	setPTPMetrics(from, process, iface, ptpOffset, maxPtpOffset, frequencyAdjustment, delay)
+	metricsLastUpdate.touch(configName, from, process, iface, now)
+	OffsetLastUpdate.With(prometheus.Labels{"from": from,
+		"process": process, "node": NodeName, "iface": iface}).Set(float64(now.Unix()))
+}
+
+// setPTPMetrics ...
+func setPTPMetrics(from, process, iface string, ptpOffset, maxPtpOffset, frequencyAdjustment, delay float64) {
 	Offset.With(prometheus.Labels{"from": from,
 		"process": process, "node": NodeName, "iface": iface}).Set(ptpOffset)
 
@@ -253,7 +454,7 @@ func updatePTPMetrics(from, process, iface string, ptpOffset, maxPtpOffset, freq
 }
 
 // extractMetrics ...
-func extractMetrics(messageTag string, processName string, ifaces config.IFaces, output string) (configName, source string, offset float64, state string, iface string) {
+func extractMetrics(messageTag string, processName string, ifaces config.IFaces, output string) (configName, source string, offset float64, state string, iface string, freq float64) {
 	configName = strings.Replace(strings.Replace(messageTag, "]", "", 1), "[", "", 1)
 	if configName != "" {
 		configName = strings.Split(configName, MessageTagSuffixSeperator)[0] // remove any suffix added to the configName
@@ -263,9 +464,9 @@ func extractMetrics(messageTag string, processName string, ifaces config.IFaces,
 		ifaceName, ptpOffset, maxPtpOffset, frequencyAdjustment, delay := extractSummaryMetrics(configName, processName, output)
 		if ifaceName != "" {
 			if ifaceName == clockRealTime {
-				updatePTPMetrics(phc, processName, ifaceName, ptpOffset, maxPtpOffset, frequencyAdjustment, delay)
+				updatePTPMetrics(configName, phc, processName, ifaceName, ptpOffset, maxPtpOffset, frequencyAdjustment, delay)
 			} else {
-				updatePTPMetrics(master, processName, ifaceName, ptpOffset, maxPtpOffset, frequencyAdjustment, delay)
+				updatePTPMetrics(configName, master, processName, ifaceName, ptpOffset, maxPtpOffset, frequencyAdjustment, delay)
 				masterOffsetSource.set(configName, processName)
 			}
 		}
@@ -284,37 +485,43 @@ func extractMetrics(messageTag string, processName string, ifaces config.IFaces,
 			if offsetSource == master {
 				masterOffsetSource.set(configName, processName)
 			}
-			updatePTPMetrics(offsetSource, processName, ifaceName, ptpOffset, maxPtpOffset, frequencyAdjustment, delay)
+			updatePTPMetrics(configName, offsetSource, processName, ifaceName, ptpOffset, maxPtpOffset, frequencyAdjustment, delay)
 			updateClockStateMetrics(processName, ifaceName, clockstate)
 		}
 		source = processName
 		offset = ptpOffset
 		state = clockstate
 		iface = ifaceName
+		freq = frequencyAdjustment
 	}
 	if processName == ptp4lProcessName {
 		if portId, role := extractPTP4lEventState(output); portId > 0 {
 			if len(ifaces) >= portId-1 {
-				UpdateInterfaceRoleMetrics(processName, ifaces[portId-1].Name, role)
-				if role == SLAVE {
-					masterOffsetIface.set(configName, ifaces[portId-1].Name)
-					slaveIface.set(configName, ifaces[portId-1].Name)
-				} else if role == FAULTY {
-					if slaveIface.isFaulty(configName, ifaces[portId-1].Name) &&
-						masterOffsetSource.get(configName) == ptp4lProcessName {
-						updatePTPMetrics(master, processName, masterOffsetIface.get(configName).alias, faultyOffset, faultyOffset, 0, 0)
-						updatePTPMetrics(phc, phc2sysProcessName, clockRealTime, faultyOffset, faultyOffset, 0, 0)
-						updateClockStateMetrics(processName, masterOffsetIface.get(configName).alias, FREERUN)
-						masterOffsetIface.set(configName, "")
-						slaveIface.set(configName, "")
-					}
-				}
+				updateInterfaceRole(configName, processName, ifaces[portId-1].Name, role)
 			}
 		}
 	}
 	return
 }
 
+// updateInterfaceRole ... set the role of a ptp4l port and follow the slave port of the config
+func updateInterfaceRole(configName, processName, iface string, role ptpPortRole) {
+	UpdateInterfaceRoleMetrics(processName, iface, role)
+	if role == SLAVE {
+		masterOffsetIface.set(configName, iface)
+		slaveIface.set(configName, iface)
+	} else if role == FAULTY {
+		if slaveIface.isFaulty(configName, iface) &&
+			masterOffsetSource.get(configName) == ptp4lProcessName {
+			updatePTPMetrics(configName, master, processName, masterOffsetIface.get(configName).alias, faultyOffset, faultyOffset, 0, 0)
+			updatePTPMetrics("", phc, phc2sysProcessName, clockRealTime, faultyOffset, faultyOffset, 0, 0)
+			updateClockStateMetrics(processName, masterOffsetIface.get(configName).alias, FREERUN)
+			masterOffsetIface.set(configName, "")
+			slaveIface.set(configName, "")
+		}
+	}
+}
+
 func extractSummaryMetrics(configName, processName, output string) (iface string, ptpOffset, maxPtpOffset, frequencyAdjustment, delay float64) {
 
 	// phc2sys[5196755.139]: [ptp4l.0.config] ens5f0 rms 3152778 max 3152778 freq -6083928 +/-   0 delay  2791 +/-   0
@@ -524,10 +731,10 @@ func UpdateInterfaceRoleMetrics(process string, iface string, role ptpPortRole)
 		"process": process, "node": NodeName, "iface": iface}).Set(float64(role))
 }
 
-// UpdateClockClassMetrics ... update clock class metrics
-func UpdateClockClassMetrics(clockClass float64) {
+// UpdateClockClassMetrics ... update clock class metrics of a ptp4l config
+func UpdateClockClassMetrics(cfgName string, clockClass float64) {
 	ClockClassMetrics.With(prometheus.Labels{
-		"process": ptp4lProcessName, "node": NodeName}).Set(float64(clockClass))
+		"process": ptp4lProcessName, "node": NodeName, "config": cfgName}).Set(float64(clockClass))
 }
 
 func UpdateProcessStatusMetrics(process, cfgName string, status int64) {
@@ -549,6 +756,160 @@ func UpdatePTPHAMetrics(profile string, inActiveProfiles []string, state int64)
 	}
 }
 
+// UpdateUnicastGrantMetrics ... count a unicast grant or denial of a port and keep its last result
+func UpdateUnicastGrantMetrics(cfgName, iface, message, result string) {
+	UnicastGrants.With(prometheus.Labels{
+		"process": ptp4lProcessName, "node": NodeName, "config": cfgName, "iface": iface, "message": message, "result": result}).Inc()
+	status := 0.0
+	if result == unicastGranted {
+		status = 1
+	}
+	UnicastGrantStatus.With(prometheus.Labels{
+		"process": ptp4lProcessName, "node": NodeName, "config": cfgName, "iface": iface, "message": message}).Set(status)
+}
+
+// UpdateUnicastActiveMasterMetrics ... move the active master of a port, an empty master is none
+func UpdateUnicastActiveMasterMetrics(cfgName, iface, from, to string) {
+	if from != "" {
+		UnicastActiveMaster.Delete(prometheus.Labels{
+			"process": ptp4lProcessName, "node": NodeName, "config": cfgName, "iface": iface, "master": from})
+	}
+	if to != "" {
+		UnicastActiveMaster.With(prometheus.Labels{
+			"process": ptp4lProcessName, "node": NodeName, "config": cfgName, "iface": iface, "master": to}).Set(1)
+	}
+}
+
+// UpdateGPTPPortMetrics ... asCapable and neighborPropDelay of a gPTP port
+func UpdateGPTPPortMetrics(cfgName, iface string, ds protocol.PortDataSetNP, neighborPropDelay int64) {
+	labels := prometheus.Labels{"process": ptp4lProcessName, "node": NodeName, "config": cfgName, "iface": iface}
+	asCapable := 0.0
+	if ds.AsCapable {
+		asCapable = 1
+	}
+	GPTPAsCapable.With(labels).Set(asCapable)
+	GPTPNeighborPropDelayThresh.With(labels).Set(float64(ds.NeighborPropDelayThresh))
+	GPTPNeighborPropDelay.With(labels).Set(float64(neighborPropDelay))
+}
+
+// UpdateGPTPTimeStatusMetrics ... rate ratio and gmPresent of a gPTP config
+func UpdateGPTPTimeStatusMetrics(cfgName string, ts protocol.TimeStatusNP) {
+	labels := prometheus.Labels{"process": ptp4lProcessName, "node": NodeName, "config": cfgName}
+	GPTPRateRatio.With(labels).Set(ts.RateRatio())
+	gmPresent := 0.0
+	if ts.GMPresent {
+		gmPresent = 1
+	}
+	GPTPGMPresent.With(labels).Set(gmPresent)
+}
+
+// dpllDeviceLabels ... label names of the DPLL device metrics, followed by extra
+func dpllDeviceLabels(extra ...string) []string {
+	return append([]string{"process", "node", "iface", "clock_id", "type"}, extra...)
+}
+
+// dpllPinLabels ... label names of the DPLL pin metrics, followed by extra
+func dpllPinLabels(extra ...string) []string {
+	return append([]string{"process", "node", "iface", "clock_id", "pin"}, extra...)
+}
+
+// dpllDeviceMetricLabels ... label values of the metrics of a DPLL device of the interface
+func dpllDeviceMetricLabels(iface string, reply *nl.DoDeviceGetReply) prometheus.Labels {
+	return prometheus.Labels{"process": DPLL, "node": NodeName, "iface": iface,
+		"clock_id": fmt.Sprintf("0x%x", reply.ClockId), "type": nl.GetDpllType(reply.Type)}
+}
+
+// dpllPinMetricLabels ... label values of the metrics of a DPLL pin of the interface
+func dpllPinMetricLabels(iface string, pin *nl.DoPinGetReply) prometheus.Labels {
+	return prometheus.Labels{"process": DPLL, "node": NodeName, "iface": iface,
+		"clock_id": fmt.Sprintf("0x%x", pin.ClockId), "pin": dpll.PinLabel(pin)}
+}
+
+// UpdateDpllDeviceMetrics ... lock status, mode and temperature of a DPLL device of the interface, the temperature
+// only when the device reports one
+func UpdateDpllDeviceMetrics(iface string, reply *nl.DoDeviceGetReply) {
+	labels := dpllDeviceMetricLabels(iface, reply)
+	DpllLockStatus.With(labels).Set(float64(reply.LockStatus))
+	if reply.Temp != 0 {
+		DpllTemperature.With(labels).Set(float64(reply.Temp) / nl.DPLL_TEMP_DIVIDER)
+	}
+	if reply.Mode != 0 {
+		DpllMode.With(labels).Set(float64(reply.Mode))
+	}
+	for _, mode := range reply.ModeSupported {
+		labels["mode"] = nl.GetMode(mode)
+		DpllModeSupported.With(labels).Set(1)
+	}
+}
+
+// UpdateDpllPinMetrics ... state, priority and phase offset of a pin towards each parent DPLL device, named by
+// parentType, and its frequency, fractional frequency offset and phase adjustment
+func UpdateDpllPinMetrics(iface string, pin *nl.DoPinGetReply, parentType func(id uint32) string) {
+	labels := dpllPinMetricLabels(iface, pin)
+	DpllPinFFO.With(labels).Set(float64(pin.FractionalFrequencyOffset))
+	DpllPinFrequency.With(labels).Set(float64(pin.Frequency))
+	DpllPinPhaseAdjust.With(labels).Set(float64(pin.PhaseAdjust))
+	for _, pd := range pin.ParentDevice {
+		labels["parent"] = parentType(pd.ParentId)
+		DpllPinState.With(labels).Set(float64(pd.State))
+		if pd.Direction == nl.DPLL_PIN_DIRECTION_INPUT {
+			DpllPinPriority.With(labels).Set(float64(pd.Prio))
+		}
+		if pd.PhaseOffset != math.MaxInt64 {
+			DpllPinPhaseOffset.With(labels).Set(float64(pd.PhaseOffset) / nl.DPLL_PHASE_OFFSET_DIVIDER / 1000)
+		}
+	}
+}
+
+// DeleteDpllDeviceMetrics ... drop the metrics of a DPLL device of the interface removed by the driver
+func DeleteDpllDeviceMetrics(iface string, reply *nl.DoDeviceGetReply) {
+	labels := dpllDeviceMetricLabels(iface, reply)
+	for _, m := range []*prometheus.GaugeVec{DpllMode, DpllModeSupported, DpllLockStatus, DpllTemperature} {
+		m.DeletePartialMatch(labels)
+	}
+}
+
+// DeleteDpllPinMetrics ... drop the metrics of a DPLL pin of the interface removed by the driver
+func DeleteDpllPinMetrics(iface string, pin *nl.DoPinGetReply) {
+	labels := dpllPinMetricLabels(iface, pin)
+	for _, m := range []*prometheus.GaugeVec{DpllPinState, DpllPinPriority, DpllPinPhaseOffset, DpllPinFFO,
+		DpllPinFrequency, DpllPinPhaseAdjust} {
+		m.DeletePartialMatch(labels)
+	}
+}
+
+// dpllReportMetrics ... report handler exporting the devices and pins of the DPLL as metrics
+func dpllReportMetrics(d *dpll.DpllConfig) dpll.ReportHandler {
+	return func(devices []*nl.DoDeviceGetReply, pins []*nl.DoPinGetReply) {
+		for _, reply := range devices {
+			UpdateDpllDeviceMetrics(d.Iface(), reply)
+		}
+		for _, pin := range pins {
+			UpdateDpllPinMetrics(d.Iface(), pin, d.DeviceType)
+		}
+	}
+}
+
+// dpllRemoveMetrics ... remove handler dropping the metrics of the devices and pins removed from the DPLL
+func dpllRemoveMetrics(d *dpll.DpllConfig) dpll.ReportHandler {
+	return func(devices []*nl.DoDeviceGetReply, pins []*nl.DoPinGetReply) {
+		for _, reply := range devices {
+			DeleteDpllDeviceMetrics(d.Iface(), reply)
+		}
+		for _, pin := range pins {
+			DeleteDpllPinMetrics(d.Iface(), pin)
+		}
+	}
+}
+
+// resetDpllMetrics ... drop the DPLL metrics of the previous profiles
+func resetDpllMetrics() {
+	for _, m := range []*prometheus.GaugeVec{DpllMode, DpllModeSupported, DpllLockStatus, DpllTemperature,
+		DpllPinState, DpllPinPriority, DpllPinPhaseOffset, DpllPinFFO, DpllPinFrequency, DpllPinPhaseAdjust} {
+		m.Reset()
+	}
+}
+
 func UpdateSynceClockQlMetrics(process, cfgName string, iface string, network_option int, device string, value int) {
 	SynceClockQL.With(prometheus.Labels{
 		"process": process, "node": NodeName, "profile": cfgName, "network_option": strconv.Itoa(network_option), "iface": iface, "device": device}).Set(float64(value))
@@ -584,6 +945,20 @@ func deleteMetrics(ifaces config.IFaces, haProfiles map[string][]string, process
 		return
 	}
 	deleteProcessStatusMetrics(config, process)
+	if process == ptp4lProcessName {
+		ClockClassMetrics.Delete(prometheus.Labels{
+			"process": ptp4lProcessName, "node": NodeName, "config": config})
+		UnicastGrants.DeletePartialMatch(prometheus.Labels{
+			"process": ptp4lProcessName, "node": NodeName, "config": config})
+		UnicastGrantStatus.DeletePartialMatch(prometheus.Labels{
+			"process": ptp4lProcessName, "node": NodeName, "config": config})
+		UnicastActiveMaster.DeletePartialMatch(prometheus.Labels{
+			"process": ptp4lProcessName, "node": NodeName, "config": config})
+		for _, m := range []*prometheus.GaugeVec{GPTPAsCapable, GPTPNeighborPropDelay, GPTPNeighborPropDelayThresh, GPTPRateRatio, GPTPGMPresent} {
+			m.DeletePartialMatch(prometheus.Labels{
+				"process": ptp4lProcessName, "node": NodeName, "config": config})
+		}
+	}
 	for _, iface := range ifaces {
 		InterfaceRole.Delete(prometheus.Labels{
 			"process": ptp4lProcessName, "node": NodeName, "iface": iface.Name})
@@ -591,28 +966,14 @@ func deleteMetrics(ifaces config.IFaces, haProfiles map[string][]string, process
 	for _, iface := range masterOffsetIface.iface {
 		ClockState.Delete(prometheus.Labels{
 			"process": process, "node": NodeName, "iface": iface.alias})
-		Delay.Delete(prometheus.Labels{
-			"from": master, "process": process, "node": NodeName, "iface": iface.alias})
-		FrequencyAdjustment.Delete(prometheus.Labels{
-			"from": master, "process": process, "node": NodeName, "iface": iface.alias})
-		MaxOffset.Delete(prometheus.Labels{
-			"from": master, "process": process, "node": NodeName, "iface": iface.alias})
-		Offset.Delete(prometheus.Labels{
-			"from": master, "process": process, "node": NodeName, "iface": iface.alias})
+		deletePTPMetrics(master, process, iface.alias)
 	}
 }
 
 func deleteOsClockStateMetrics(profiles map[string][]string) {
 	ClockState.Delete(prometheus.Labels{
 		"process": phc2sysProcessName, "node": NodeName, "iface": clockRealTime})
-	Delay.Delete(prometheus.Labels{
-		"from": phc, "process": phc2sysProcessName, "node": NodeName, "iface": clockRealTime})
-	FrequencyAdjustment.Delete(prometheus.Labels{
-		"from": phc, "process": phc2sysProcessName, "node": NodeName, "iface": clockRealTime})
-	MaxOffset.Delete(prometheus.Labels{
-		"from": phc, "process": phc2sysProcessName, "node": NodeName, "iface": clockRealTime})
-	Offset.Delete(prometheus.Labels{
-		"from": phc, "process": phc2sysProcessName, "node": NodeName, "iface": clockRealTime})
+	deletePTPMetrics(phc, phc2sysProcessName, clockRealTime)
 	for profile := range profiles {
 		PTPHAMetrics.Delete(prometheus.Labels{
 			"process": phc2sysProcessName, "node": NodeName, "profile": profile})
@@ -662,7 +1023,8 @@ func extractPTP4lEventState(output string) (portId int, role ptpPortRole) {
 	} else if strings.Contains(output, "UNCALIBRATED to PASSIVE") || strings.Contains(output, "MASTER to PASSIVE") ||
 		strings.Contains(output, "SLAVE to PASSIVE") {
 		role = PASSIVE
-	} else if strings.Contains(output, "UNCALIBRATED to MASTER") || strings.Contains(output, "LISTENING to MASTER") {
+	} else if strings.Contains(output, "UNCALIBRATED to MASTER") || strings.Contains(output, "LISTENING to MASTER") ||
+		strings.Contains(output, "SLAVE to MASTER") {
 		role = MASTER
 	} else if strings.Contains(output, "FAULT_DETECTED") || strings.Contains(output, "SYNCHRONIZATION_FAULT") {
 		role = FAULTY
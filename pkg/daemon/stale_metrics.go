@@ -0,0 +1,209 @@
+package daemon
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/openshift/linuxptp-daemon/pkg/event"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// StaleMetricsFaulty marks a stale series as faulty (offset 999999, clock state FREERUN)
+	StaleMetricsFaulty = "faulty"
+	// StaleMetricsDelete removes a stale series from the registry
+	StaleMetricsDelete = "delete"
+)
+
+var (
+	// OffsetLastUpdate metrics to show the last time an offset series was reported by a process
+	OffsetLastUpdate = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "offset_last_update_timestamp_seconds",
+			Help:      "unix time of the last offset update reported by the process",
+		}, []string{"from", "process", "node", "iface"})
+
+	// StaleMetricsCount metrics to count series detected as stale
+	StaleMetricsCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "stale_metrics_count",
+			Help:      "number of times an offset series was not updated within the staleness timeout",
+		}, []string{"process", "node", "action"})
+
+	metricsLastUpdate = newSeriesTracker()
+)
+
+type seriesKey struct {
+	from    string
+	process string
+	iface   string
+}
+
+type seriesState struct {
+	cfgName    string
+	lastUpdate time.Time
+	stale      bool
+}
+
+// staleSeries ... series not updated within the timeout and the config reporting it
+type staleSeries struct {
+	seriesKey
+	cfgName string
+}
+
+// seriesTracker keeps the last seen time of every offset series
+type seriesTracker struct {
+	sync.Mutex
+	series map[seriesKey]*seriesState
+}
+
+func newSeriesTracker() *seriesTracker {
+	return &seriesTracker{
+		series: map[seriesKey]*seriesState{},
+	}
+}
+
+// touch records a fresh update for the series, an empty cfgName keeps the config already known
+func (s *seriesTracker) touch(cfgName, from, process, iface string, now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	key := seriesKey{from: from, process: process, iface: iface}
+	if st, ok := s.series[key]; ok {
+		if st.stale {
+			glog.Infof("%s %s offset for %s is being reported again", process, from, iface)
+		}
+		if cfgName != "" {
+			st.cfgName = cfgName
+		}
+		st.lastUpdate = now
+		st.stale = false
+		return
+	}
+	s.series[key] = &seriesState{cfgName: cfgName, lastUpdate: now}
+}
+
+// forget stops tracking the series; used when metrics are deleted on profile change
+func (s *seriesTracker) forget(from, process, iface string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.series, seriesKey{from: from, process: process, iface: iface})
+}
+
+// expire returns the series which were not updated within timeout and were not yet reported as stale.
+// When remove is true the expired series are no longer tracked.
+func (s *seriesTracker) expire(now time.Time, timeout time.Duration, remove bool) []staleSeries {
+	s.Lock()
+	defer s.Unlock()
+	var expired []staleSeries
+	for key, st := range s.series {
+		if st.stale || now.Sub(st.lastUpdate) < timeout {
+			continue
+		}
+		expired = append(expired, staleSeries{seriesKey: key, cfgName: st.cfgName})
+		if remove {
+			delete(s.series, key)
+		} else {
+			st.stale = true
+		}
+	}
+	return expired
+}
+
+// StartStaleMetricsCollector periodically looks for offset series that have not been updated
+// within timeout and either marks them as faulty or deletes them, so that a frozen offset
+// is never reported as a healthy clock. The stale series are also sent to the event handler as
+// FREERUN with the faulty offset, like any other state they are written to the event socket,
+// kept in the event history and replayed after a reconnect. Deleted series are only sent when
+// the metrics are hosted by the reader of the event socket.
+func (dn *Daemon) StartStaleMetricsCollector(timeout time.Duration, action string, stopCh <-chan struct{}) {
+	if timeout <= 0 {
+		glog.Info("stale metrics collection is disabled")
+		return
+	}
+	if action != StaleMetricsDelete {
+		action = StaleMetricsFaulty
+	}
+	interval := timeout / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	glog.Infof("stale metrics timeout set to %s, action %s", timeout, action)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case now := <-ticker.C:
+				stale := collectStaleMetrics(now, timeout, action)
+				if dn.stdoutToSocket || action != StaleMetricsDelete {
+					deliverStaleMetrics(dn.processManager.eventChannel, stale)
+				}
+			}
+		}
+	}()
+}
+
+// collectStaleMetrics applies the action to the series which went stale and returns them
+func collectStaleMetrics(now time.Time, timeout time.Duration, action string) []staleSeries {
+	stale := metricsLastUpdate.expire(now, timeout, action == StaleMetricsDelete)
+	for _, key := range stale {
+		glog.Warningf("%s %s offset for %s was not updated for %s, marking as %s", key.process, key.from, key.iface, timeout, action)
+		StaleMetricsCount.With(prometheus.Labels{
+			"process": key.process, "node": NodeName, "action": action}).Inc()
+		if action == StaleMetricsDelete {
+			deletePTPMetrics(key.from, key.process, key.iface)
+			ClockState.Delete(prometheus.Labels{
+				"process": key.process, "node": NodeName, "iface": key.iface})
+			continue
+		}
+		setPTPMetrics(key.from, key.process, key.iface, faultyOffset, faultyOffset, 0, 0)
+		updateClockStateMetrics(key.process, key.iface, FREERUN)
+	}
+	return stale
+}
+
+// deliverStaleMetrics sends the stale series to the event handler, on the producer queue of the process
+func deliverStaleMetrics(eventCh chan<- event.EventChannel, stale []staleSeries) {
+	for _, s := range stale {
+		ev := staleEvent(s)
+		event.Deliver(fmt.Sprintf("%s/%s", ev.ProcessName, ev.CfgName), eventCh, ev)
+	}
+}
+
+// staleEvent ... FREERUN event with the faulty offset of a stale series; ts2phc series are reported like the
+// events of the T-GM, on the interface name
+func staleEvent(s staleSeries) event.EventChannel {
+	ev := event.EventChannel{
+		ProcessName: event.EventSource(s.process),
+		State:       event.PTP_FREERUN,
+		CfgName:     s.cfgName,
+		IFace:       s.iface,
+		Values:      map[event.ValueType]interface{}{event.OFFSET: int64(faultyOffset)},
+		Time:        time.Now().UnixMilli(),
+		WriteToLog:  true,
+	}
+	if s.process == ts2phcProcessName {
+		ev.IFace = masterOffsetIface.getByAlias(s.cfgName, s.iface).name
+		ev.ClockType = event.GM
+	}
+	return ev
+}
+
+// deletePTPMetrics deletes offset, max offset, frequency adjustment, delay and last update series
+func deletePTPMetrics(from, process, iface string) {
+	labels := prometheus.Labels{"from": from, "process": process, "node": NodeName, "iface": iface}
+	Offset.Delete(labels)
+	MaxOffset.Delete(labels)
+	FrequencyAdjustment.Delete(labels)
+	Delay.Delete(labels)
+	OffsetLastUpdate.Delete(labels)
+	metricsLastUpdate.forget(from, process, iface)
+}
@@ -0,0 +1,183 @@
+package daemon
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/openshift/linuxptp-daemon/pkg/dpll"
+	"github.com/openshift/linuxptp-daemon/pkg/event"
+	ptpv1 "github.com/openshift/ptp-operator/api/v1"
+)
+
+// controllingProfileSetting ... ptpSettings key of a master-only profile naming the T-BC profile whose slave
+// port drives its clock class; without it the T-BC ptp4l announces its own clock class
+const controllingProfileSetting = "controllingProfile"
+
+// tbcHoldover ... follows the slave port of a T-BC ptp4l instance. The BC is LOCKED while a port is SLAVE,
+// HOLDOVER in spec when the slave port is lost, HOLDOVER out of spec after the in-spec timer and FREERUN
+// after the holdover timeout. The states are sent for the master-facing config, which announces the clock class.
+// The phc2sys of the profile is followed too, its holdover status is sent as a phc2sys event of the same config.
+type tbcHoldover struct {
+	sync.Mutex
+	cfgName         string
+	eventCh         chan<- event.EventChannel
+	slaveIface      string
+	state           event.PTPState
+	outOfSpec       bool
+	inSpecTimeout   time.Duration
+	holdoverTimeout time.Duration
+	timer           *time.Timer
+	generation      int            // timers of an earlier holdover are ignored
+	phc2sys         event.PTPState // PTP_LOCKED once phc2sys locked, PTP_HOLDOVER when it lost that lock
+}
+
+// newTBCHoldover ... holdover of a T-BC announcing on cfgName, with the timers of the DPLL holdover settings
+func newTBCHoldover(cfgName string, nodeProfile *ptpv1.PtpProfile) *tbcHoldover {
+	_, _, holdoverTimeout, inSpecTimer, _ := dpll.CalculateTimer(nodeProfile)
+	glog.Infof("T-BC holdover for %s: in spec for %ds, holdover timeout %ds", cfgName, inSpecTimer, holdoverTimeout)
+	return &tbcHoldover{
+		cfgName:         cfgName,
+		state:           event.PTP_NOTSET,
+		phc2sys:         event.PTP_NOTSET,
+		inSpecTimeout:   time.Duration(inSpecTimer) * time.Second,
+		holdoverTimeout: time.Duration(holdoverTimeout) * time.Second,
+	}
+}
+
+// controlledConfig ... ptp4l config of the master-only profile controlled by the named profile, empty when none
+func (dn *Daemon) controlledConfig(profileName *string) string {
+	if profileName == nil {
+		return ""
+	}
+	for runID, profile := range dn.ptpUpdate.NodeProfiles {
+		if profile.PtpSettings[controllingProfileSetting] == *profileName && profile.Ptp4lOpts != nil && *profile.Ptp4lOpts != "" {
+			return fmt.Sprintf("ptp4l.%d.config", runID)
+		}
+	}
+	return ""
+}
+
+// tbcConfig ... config announcing the clock class of the T-BC profile: the master-only ptp4l controlled by the
+// profile, if any, else its own ptp4l config
+func (dn *Daemon) tbcConfig(profileName *string, configFile string) string {
+	if controlled := dn.controlledConfig(profileName); controlled != "" {
+		return controlled
+	}
+	return configFile
+}
+
+// portRole ... update the BC state from a port role change of the T-BC ptp4l
+func (t *tbcHoldover) portRole(eventCh chan<- event.EventChannel, iface string, role ptpPortRole) {
+	t.Lock()
+	defer t.Unlock()
+	t.eventCh = eventCh
+	if role == SLAVE {
+		t.slaveIface = iface
+		if t.state != event.PTP_LOCKED {
+			t.stopTimer()
+			t.set(event.PTP_LOCKED, false)
+		}
+		return
+	}
+	if iface != t.slaveIface || t.state != event.PTP_LOCKED {
+		return
+	}
+	glog.Infof("T-BC %s lost slave port %s, holdover in spec for %s", t.cfgName, iface, t.inSpecTimeout)
+	t.set(event.PTP_HOLDOVER, false)
+	t.startTimer(t.inSpecTimeout)
+}
+
+// phc2sysState ... update the phc2sys holdover status from the clock state phc2sys reports. phc2sys starting
+// unlocked is not in holdover, it is once it loses the lock it had until it locks again.
+func (t *tbcHoldover) phc2sysState(eventCh chan<- event.EventChannel, state event.PTPState) {
+	t.Lock()
+	defer t.Unlock()
+	t.eventCh = eventCh
+	switch {
+	case state == event.PTP_LOCKED && t.phc2sys != event.PTP_LOCKED:
+		t.phc2sys = event.PTP_LOCKED
+	case state != event.PTP_LOCKED && t.phc2sys == event.PTP_LOCKED:
+		glog.Infof("T-BC %s phc2sys lost its lock, holdover", t.cfgName)
+		t.phc2sys = event.PTP_HOLDOVER
+	default:
+		return
+	}
+	event.Deliver(t.producer(), t.eventCh, event.EventChannel{
+		ProcessName: event.PHC2SYS,
+		ClockType:   event.BC,
+		CfgName:     t.cfgName,
+		State:       t.phc2sys,
+		Time:        time.Now().UnixMilli(),
+	})
+}
+
+// expire ... the in-spec timer moves the holdover out of spec, the holdover timeout to FREERUN
+func (t *tbcHoldover) expire(generation int) {
+	t.Lock()
+	defer t.Unlock()
+	if generation != t.generation || t.state != event.PTP_HOLDOVER {
+		return
+	}
+	if !t.outOfSpec && t.holdoverTimeout > t.inSpecTimeout {
+		t.set(event.PTP_HOLDOVER, true)
+		t.startTimer(t.holdoverTimeout - t.inSpecTimeout)
+		return
+	}
+	t.set(event.PTP_FREERUN, true)
+}
+
+func (t *tbcHoldover) startTimer(d time.Duration) {
+	t.generation++
+	generation := t.generation
+	t.timer = time.AfterFunc(d, func() { t.expire(generation) })
+}
+
+func (t *tbcHoldover) stopTimer() {
+	t.generation++
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+}
+
+// stop ... stop the holdover timer and reset the BC state of the config
+func (t *tbcHoldover) stop() {
+	t.Lock()
+	defer t.Unlock()
+	t.stopTimer()
+	if t.eventCh != nil && t.state != event.PTP_NOTSET {
+		event.Deliver(t.producer(), t.eventCh, event.EventChannel{
+			ProcessName: event.PTP4l,
+			ClockType:   event.BC,
+			CfgName:     t.cfgName,
+			Time:        time.Now().UnixMilli(),
+			Reset:       true,
+		})
+	}
+	t.state = event.PTP_NOTSET
+	t.phc2sys = event.PTP_NOTSET
+}
+
+func (t *tbcHoldover) set(state event.PTPState, outOfSpec bool) {
+	t.state = state
+	t.outOfSpec = outOfSpec
+	if t.eventCh == nil {
+		return
+	}
+	event.Deliver(t.producer(), t.eventCh, event.EventChannel{
+		ProcessName: event.PTP4l,
+		ClockType:   event.BC,
+		CfgName:     t.cfgName,
+		IFace:       t.slaveIface,
+		State:       state,
+		OutOfSpec:   outOfSpec,
+		SourceLost:  state != event.PTP_LOCKED,
+		Time:        time.Now().UnixMilli(),
+	})
+}
+
+func (t *tbcHoldover) producer() string {
+	return "tbc/" + t.cfgName
+}
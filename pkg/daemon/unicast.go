@@ -0,0 +1,555 @@
+package daemon
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/openshift/linuxptp-daemon/pkg/api"
+	"github.com/openshift/linuxptp-daemon/pkg/event"
+	"github.com/openshift/linuxptp-daemon/pkg/protocol"
+	ptpv1 "github.com/openshift/ptp-operator/api/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	unicastMasterTableSection = "[unicast_master_table]"
+
+	// ptpSettings keys of the telecom profile and of the unicast master tables rendered for the ptp4l config
+	telecomProfileSetting = "telecomProfile" // G.8275.1 or G.8275.2, detected from the ptp4l config when not set
+	prtcSetting           = "prtc"           // PRTC-A (default) or PRTC-B
+	aptsSetting           = "apts"           // true for assisted partial timing support
+	unicastMastersSetting = "unicastMasters" // YAML unicastSpec
+	unicastGranted        = "granted"
+	unicastDenied         = "denied"
+	unicastExpired        = "expired"
+	// unicastGrantLoggingLevel ... ptp4l logs the unicast grants at debug level, the denials at warning level
+	unicastGrantLoggingLevel = 7
+
+	// domain numbers of the G.8275.2 profile, T-REC-G.8275.2-202211-I section 6.2.1
+	g8275_2DomainMin = 44
+	g8275_2DomainMax = 63
+)
+
+var (
+	// port 1 (ens1f0): unicast Announce granted for 60 sec
+	unicastGrantedRegEx = regexp.MustCompile(`port (\d+)(?: \(([^)]+)\))?: unicast (\S+) granted for (\d+) sec`)
+	// port 1 (ens1f0): unicast grant of Announce rejected
+	unicastDeniedRegEx = regexp.MustCompile(`port (\d+)(?: \(([^)]+)\))?: unicast grant of (\S+) rejected`)
+	// port 1 (ens1f0): new foreign master 507c6f.fffe.1fb1b8-1
+	foreignMasterRegEx = regexp.MustCompile(`port (\d+)(?: \(([^)]+)\))?: new foreign master ([0-9a-f.]+)-\d+`)
+	// selected best master clock 507c6f.fffe.1fb1b8
+	bestMasterRegEx = regexp.MustCompile(`selected best master clock ([0-9a-f.]+)`)
+	// selected local clock 507c6f.fffe.1fb1b8 as best master
+	localBestMasterRegEx = regexp.MustCompile(`selected local clock [0-9a-f.]+ as best master`)
+)
+
+// unicastMasterSpec ... unicast master of a table, the transport defaults to the network_transport of the config
+type unicastMasterSpec struct {
+	Address   string `json:"address"`
+	Transport string `json:"transport,omitempty"`
+	Priority  int    `json:"priority,omitempty"` // masters are listed in ascending priority
+}
+
+// unicastTableSpec ... unicast master table and the ports using it; without ports the table is used on every
+// port that is not master only, without id the next free table id is used
+type unicastTableSpec struct {
+	ID               int                 `json:"id,omitempty"`
+	LogQueryInterval *int                `json:"logQueryInterval,omitempty"`
+	Ports            []string            `json:"ports,omitempty"`
+	Masters          []unicastMasterSpec `json:"masters"`
+}
+
+// unicastSpec ... unicast settings of a ptp4l profile, the YAML value of the unicastMasters ptpSettings
+//
+//	tables:
+//	- logQueryInterval: 2
+//	  ports: [ens1f0]
+//	  masters:
+//	  - address: 10.0.0.1
+//	    priority: 1
+//	  - address: 10.0.0.2
+//	    priority: 2
+//	listenPorts: [ens1f1]
+type unicastSpec struct {
+	Tables      []unicastTableSpec `json:"tables,omitempty"`
+	ListenPorts []string           `json:"listenPorts,omitempty"` // ports answering unicast negotiation requests
+}
+
+// unicastSpecOf ... unicast settings of the profile, nil when the profile has none
+func unicastSpecOf(settings map[string]string) (*unicastSpec, error) {
+	v := strings.TrimSpace(settings[unicastMastersSetting])
+	if v == "" {
+		return nil, nil
+	}
+	spec := &unicastSpec{}
+	if err := yaml.UnmarshalStrict([]byte(v), spec); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", unicastMastersSetting, err)
+	}
+	if len(spec.Tables) == 0 && len(spec.ListenPorts) == 0 {
+		return nil, nil
+	}
+	return spec, nil
+}
+
+// unicastMasterTable ... [unicast_master_table] section of a ptp4l config; the master lines repeat the
+// transport as option name, so the section is not kept in the options map of the port sections
+type unicastMasterTable struct {
+	id               int
+	logQueryInterval string
+	peerAddress      string
+	masters          []string // "<transport> <address>"
+}
+
+// addLine ... add a line of the section to the table
+func (t *unicastMasterTable) addLine(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	if len(fields) != 2 {
+		return fmt.Errorf("invalid unicast_master_table line: %s", line)
+	}
+	switch fields[0] {
+	case "table_id":
+		id, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return fmt.Errorf("invalid unicast_master_table table_id: %s", fields[1])
+		}
+		t.id = id
+	case "logQueryInterval":
+		t.logQueryInterval = fields[1]
+	case "peer_address":
+		t.peerAddress = fields[1]
+	default:
+		t.masters = append(t.masters, strings.Join(fields, " "))
+	}
+	return nil
+}
+
+func (t *unicastMasterTable) render() string {
+	out := fmt.Sprintf("%s\ntable_id %d", unicastMasterTableSection, t.id)
+	if t.logQueryInterval != "" {
+		out = fmt.Sprintf("%s\nlogQueryInterval %s", out, t.logQueryInterval)
+	}
+	if t.peerAddress != "" {
+		out = fmt.Sprintf("%s\npeer_address %s", out, t.peerAddress)
+	}
+	for _, m := range t.masters {
+		out = fmt.Sprintf("%s\n%s", out, m)
+	}
+	return out
+}
+
+// table ... unicast master table with the id, nil when there is none
+func (conf *ptp4lConf) table(id int) *unicastMasterTable {
+	for i := range conf.unicastTables {
+		if conf.unicastTables[i].id == id {
+			return &conf.unicastTables[i]
+		}
+	}
+	return nil
+}
+
+// globalOption ... option of the [global] section without the leading space, empty when not set
+func (conf *ptp4lConf) globalOption(name string) string {
+	for _, section := range conf.sections {
+		if section.sectionName == "[global]" {
+			return strings.TrimSpace(section.options[name])
+		}
+	}
+	return ""
+}
+
+// portSection ... section of the port, nil when the profile has no such port
+func (conf *ptp4lConf) portSection(port string) *ptp4lConfSection {
+	for i, section := range conf.sections {
+		if section.sectionName == fmt.Sprintf("[%s]", port) && port != "global" && port != "nmea" {
+			return &conf.sections[i]
+		}
+	}
+	return nil
+}
+
+// isPortSection ... true for the sections of the ptp4l ports
+func isPortSection(section ptp4lConfSection) bool {
+	return section.sectionName != "[global]" && section.sectionName != "[nmea]"
+}
+
+// isMasterOnly ... true for a port that never queries masters
+func (section ptp4lConfSection) isMasterOnly() bool {
+	return strings.TrimSpace(section.options["masterOnly"]) == "1" || strings.TrimSpace(section.options["serverOnly"]) == "1"
+}
+
+// unicastMaster ... "<transport> <address>" line of the master, an error when the address does not match the transport
+func unicastMaster(m unicastMasterSpec, transport string) (string, error) {
+	if m.Transport != "" {
+		transport = m.Transport
+	}
+	ip := net.ParseIP(m.Address)
+	switch transport {
+	case "UDPv4":
+		if ip == nil || ip.To4() == nil {
+			return "", fmt.Errorf("invalid UDPv4 address %q", m.Address)
+		}
+	case "UDPv6":
+		if ip == nil || ip.To4() != nil {
+			return "", fmt.Errorf("invalid UDPv6 address %q", m.Address)
+		}
+	case "L2":
+		if _, err := net.ParseMAC(m.Address); err != nil {
+			return "", fmt.Errorf("invalid L2 address %q", m.Address)
+		}
+	default:
+		return "", fmt.Errorf("unsupported unicast transport %q", transport)
+	}
+	return fmt.Sprintf("%s %s", transport, m.Address), nil
+}
+
+// addUnicastMasters ... render the unicast settings of the profile into master tables, port table references
+// and unicast_listen, and validate the result against the ports of the profile. A profile without unicast settings
+// is left as written.
+func (conf *ptp4lConf) addUnicastMasters(settings map[string]string) error {
+	spec, err := unicastSpecOf(settings)
+	if err != nil || spec == nil {
+		return err
+	}
+	transport := conf.globalOption("network_transport")
+	if transport == "" {
+		transport = "UDPv4"
+	}
+	for _, t := range spec.Tables {
+		if err = conf.addUnicastTable(t, transport); err != nil {
+			return err
+		}
+	}
+	if len(spec.Tables) > 0 {
+		conf.raiseLoggingLevel(unicastGrantLoggingLevel)
+	}
+	for _, port := range spec.ListenPorts {
+		section := conf.portSection(port)
+		if section == nil {
+			return fmt.Errorf("unicast listen port %s is not a port of the profile", port)
+		}
+		section.options["unicast_listen"] = " 1"
+	}
+	return conf.validateUnicast()
+}
+
+// raiseLoggingLevel ... set the logging_level of the [global] section to level when it is lower
+func (conf *ptp4lConf) raiseLoggingLevel(level int) {
+	for i, section := range conf.sections {
+		if section.sectionName != "[global]" {
+			continue
+		}
+		if current, err := strconv.Atoi(strings.TrimSpace(section.options["logging_level"])); err == nil && current >= level {
+			return
+		}
+		glog.Infof("ptp4l logging_level set to %d to report the unicast grants", level)
+		conf.sections[i].options["logging_level"] = fmt.Sprintf(" %d", level)
+		return
+	}
+}
+
+func (conf *ptp4lConf) addUnicastTable(spec unicastTableSpec, transport string) error {
+	table := unicastMasterTable{id: spec.ID}
+	if table.id == 0 {
+		table.id = 1
+		for _, t := range conf.unicastTables {
+			if t.id >= table.id {
+				table.id = t.id + 1
+			}
+		}
+	}
+	if spec.LogQueryInterval != nil {
+		table.logQueryInterval = strconv.Itoa(*spec.LogQueryInterval)
+	}
+	if len(spec.Masters) == 0 {
+		return fmt.Errorf("unicast master table %d has no masters", table.id)
+	}
+	masters := append([]unicastMasterSpec{}, spec.Masters...)
+	sort.SliceStable(masters, func(i, j int) bool { return masters[i].Priority < masters[j].Priority })
+	for _, m := range masters {
+		line, err := unicastMaster(m, transport)
+		if err != nil {
+			return fmt.Errorf("unicast master table %d: %w", table.id, err)
+		}
+		table.masters = append(table.masters, line)
+	}
+	conf.unicastTables = append(conf.unicastTables, table)
+
+	ref := fmt.Sprintf(" %d", table.id)
+	if len(spec.Ports) == 0 {
+		for i, section := range conf.sections {
+			if !isPortSection(section) || section.isMasterOnly() {
+				continue
+			}
+			if _, ok := section.options["unicast_master_table"]; !ok {
+				conf.sections[i].options["unicast_master_table"] = ref
+			}
+		}
+	}
+	for _, port := range spec.Ports {
+		section := conf.portSection(port)
+		if section == nil {
+			return fmt.Errorf("unicast master table %d: %s is not a port of the profile", table.id, port)
+		}
+		section.options["unicast_master_table"] = ref
+	}
+	glog.Infof("%s: unicast master table %d with %d masters", conf.profile_name, table.id, len(table.masters))
+	return nil
+}
+
+// validateUnicast ... table ids are unique, tables have masters and every port references an existing table
+// and queries masters; table 0 is the ptp4l default of no table
+func (conf *ptp4lConf) validateUnicast() error {
+	ids := map[int]bool{}
+	for _, t := range conf.unicastTables {
+		if t.id <= 0 {
+			return fmt.Errorf("invalid unicast master table id %d", t.id)
+		}
+		if ids[t.id] {
+			return fmt.Errorf("duplicate unicast master table id %d", t.id)
+		}
+		ids[t.id] = true
+		if len(t.masters) == 0 {
+			return fmt.Errorf("unicast master table %d has no masters", t.id)
+		}
+		seen := map[string]bool{}
+		for _, m := range t.masters {
+			if seen[m] {
+				return fmt.Errorf("unicast master table %d lists %s twice", t.id, m)
+			}
+			seen[m] = true
+		}
+	}
+	for _, section := range conf.sections {
+		ref, ok := section.options["unicast_master_table"]
+		if !ok || section.sectionName == "[nmea]" {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(ref))
+		if err == nil && id == 0 {
+			continue // the ptp4l default, no table
+		}
+		if err != nil || !ids[id] {
+			return fmt.Errorf("port %s references unknown unicast master table %s", section.sectionName, strings.TrimSpace(ref))
+		}
+		if section.isMasterOnly() {
+			return fmt.Errorf("master only port %s cannot use unicast master table %d", section.sectionName, id)
+		}
+	}
+	return nil
+}
+
+// telecomProfile ... telecom profile of the ptp4l config. Without a telecomProfile setting a domain number of
+// the G.8275.2 range over UDP is a G.8275.2 profile.
+func (conf *ptp4lConf) telecomProfile(nodeProfile *ptpv1.PtpProfile) (protocol.TelecomProfile, error) {
+	name := nodeProfile.PtpSettings[telecomProfileSetting]
+	if name == "" {
+		domain, err := strconv.Atoi(conf.globalOption("domainNumber"))
+		transport := conf.globalOption("network_transport")
+		if err == nil && domain >= g8275_2DomainMin && domain <= g8275_2DomainMax && (transport == "UDPv4" || transport == "UDPv6") {
+			name = protocol.ProfileG8275_2
+		}
+	}
+	apts := false
+	if v, ok := nodeProfile.PtpSettings[aptsSetting]; ok {
+		var err error
+		if apts, err = strconv.ParseBool(v); err != nil {
+			return protocol.TelecomProfile{}, fmt.Errorf("invalid %s %q", aptsSetting, v)
+		}
+	}
+	return protocol.ParseTelecomProfile(name, nodeProfile.PtpSettings[prtcSetting], apts)
+}
+
+// parseUnicastGrant ... port, message type, result and duration of a unicast grant line, false for any other line
+func parseUnicastGrant(output string) (portId int, iface, message, result string, duration int64, ok bool) {
+	if match := unicastGrantedRegEx.FindStringSubmatch(output); match != nil {
+		portId, _ = strconv.Atoi(match[1])
+		duration, _ = strconv.ParseInt(match[4], 10, 64)
+		return portId, match[2], match[3], unicastGranted, duration, true
+	}
+	if match := unicastDeniedRegEx.FindStringSubmatch(output); match != nil {
+		portId, _ = strconv.Atoi(match[1])
+		return portId, match[2], match[3], unicastDenied, 0, true
+	}
+	return 0, "", "", "", 0, false
+}
+
+// unicastGrant ... last grant or denial received for a message type
+type unicastGrant struct {
+	result   string
+	duration int64
+	time     time.Time
+}
+
+// unicastPortState ... unicast masters of a port, the grants it received and the foreign master selected as best master
+type unicastPortState struct {
+	table          int
+	masters        []string
+	foreignMasters []string // clock identities announced on the port
+	activeMaster   string
+	grants         map[string]unicastGrant
+}
+
+// unicastState ... unicast state of the ports of a ptp4l process, updated from its output
+type unicastState struct {
+	sync.Mutex
+	ports map[string]*unicastPortState
+}
+
+// newUnicastState ... unicast state of the ports using a master table, nil when no port does
+func (conf *ptp4lConf) newUnicastState() *unicastState {
+	u := &unicastState{ports: map[string]*unicastPortState{}}
+	for _, section := range conf.sections {
+		ref, ok := section.options["unicast_master_table"]
+		if !ok || !isPortSection(section) {
+			continue
+		}
+		id, _ := strconv.Atoi(strings.TrimSpace(ref))
+		if id == 0 {
+			continue
+		}
+		port := &unicastPortState{table: id, grants: map[string]unicastGrant{}}
+		if t := conf.table(id); t != nil {
+			port.masters = append(port.masters, t.masters...)
+		}
+		u.ports[strings.Trim(section.sectionName, "[]")] = port
+	}
+	if len(u.ports) == 0 {
+		return nil
+	}
+	return u
+}
+
+// port ... state of the port, nil for a port without master table
+func (u *unicastState) port(iface string) *unicastPortState {
+	if u == nil {
+		return nil
+	}
+	return u.ports[iface]
+}
+
+// ifaceOf ... interface of a ptp4l port, from the log line or from the port number
+func (p *ptpProcess) ifaceOf(portId int, iface string) string {
+	if iface == "" && portId > 0 && portId <= len(p.ifaces) {
+		iface = p.ifaces[portId-1].Name
+	}
+	return iface
+}
+
+// processUnicastOutput ... follow unicast grants and the selected master in the ptp4l output
+func (p *ptpProcess) processUnicastOutput(c *net.Conn, output string) {
+	switch {
+	case strings.Contains(output, "unicast"):
+		p.announceUnicastGrant(c, output)
+	case strings.Contains(output, "new foreign master"):
+		match := foreignMasterRegEx.FindStringSubmatch(output)
+		if match == nil || p.unicast == nil {
+			return
+		}
+		portId, _ := strconv.Atoi(match[1])
+		p.unicast.Lock()
+		defer p.unicast.Unlock()
+		if port := p.unicast.port(p.ifaceOf(portId, match[2])); port != nil {
+			for _, m := range port.foreignMasters {
+				if m == match[3] {
+					return
+				}
+			}
+			port.foreignMasters = append(port.foreignMasters, match[3])
+		}
+	case strings.Contains(output, "best master"):
+		if p.unicast == nil {
+			return
+		}
+		best := ""
+		if match := bestMasterRegEx.FindStringSubmatch(output); match != nil {
+			best = match[1]
+		} else if !localBestMasterRegEx.MatchString(output) {
+			return
+		}
+		p.unicast.Lock()
+		defer p.unicast.Unlock()
+		for iface, port := range p.unicast.ports {
+			active := ""
+			for _, m := range port.foreignMasters {
+				if m == best {
+					active = best
+				}
+			}
+			if active != port.activeMaster {
+				glog.Infof("%s: unicast active master of %s %q -> %q", p.configName, iface, port.activeMaster, active)
+				if c == nil {
+					UpdateUnicastActiveMasterMetrics(p.configName, iface, port.activeMaster, active)
+				}
+				port.activeMaster = active
+			}
+		}
+	}
+}
+
+// announceUnicastGrant ... report a unicast grant or denial of a ptp4l port as event and metric
+func (p *ptpProcess) announceUnicastGrant(c *net.Conn, output string) {
+	portId, iface, message, result, duration, ok := parseUnicastGrant(output)
+	if !ok {
+		return
+	}
+	iface = p.ifaceOf(portId, iface)
+	if result == unicastDenied {
+		glog.Warningf("%s: unicast %s denied on %s", p.configName, message, iface)
+	}
+	if p.unicast != nil {
+		p.unicast.Lock()
+		if port := p.unicast.port(iface); port != nil {
+			port.grants[message] = unicastGrant{result: result, duration: duration, time: time.Now()}
+		}
+		p.unicast.Unlock()
+	}
+	record := event.NewUnicastGrantRecord(p.configName, iface, message, result, duration)
+	event.EventHistory.Add(record)
+	if c == nil {
+		UpdateUnicastGrantMetrics(p.configName, iface, message, result)
+		return
+	}
+	if _, err := (*c).Write(record.Bytes()); err != nil {
+		glog.Errorf("failed to write unicast grant event %s", err.Error())
+	}
+}
+
+// unicastPorts ... unicast state of the ports for the query API
+func (p *ptpProcess) unicastPorts(now time.Time) []api.UnicastPort {
+	if p.unicast == nil {
+		return nil
+	}
+	p.unicast.Lock()
+	defer p.unicast.Unlock()
+	ports := make([]api.UnicastPort, 0, len(p.unicast.ports))
+	for iface, port := range p.unicast.ports {
+		up := api.UnicastPort{
+			ConfigName:   p.configName,
+			Interface:    iface,
+			Table:        port.table,
+			Masters:      append([]string{}, port.masters...),
+			ActiveMaster: port.activeMaster,
+		}
+		for message, g := range port.grants {
+			result := g.result
+			if result == unicastGranted && now.After(g.time.Add(time.Duration(g.duration)*time.Second)) {
+				result = unicastExpired
+			}
+			up.Grants = append(up.Grants, api.UnicastGrant{Message: message, Result: result, Duration: g.duration, Time: g.time})
+		}
+		sort.Slice(up.Grants, func(i, j int) bool { return up.Grants[i].Message < up.Grants[j].Message })
+		ports = append(ports, up)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Interface < ports[j].Interface })
+	return ports
+}
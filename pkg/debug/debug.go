@@ -2,7 +2,11 @@ package debug
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"sort"
 	"strings"
+	"sync"
 )
 
 const (
@@ -27,6 +31,7 @@ var (
 	state          = map[string]StateDB{}
 	requiredKeys   = []string{GmKey, GnssKey, OverallTs2phcKey, OverallDpllKey, ClockClassKey}
 	resetGM        bool
+	lock           sync.Mutex
 )
 
 // StateDB stores the state of the system
@@ -51,23 +56,30 @@ func getSate(s string) string {
 
 // Node represents each node's state and offset
 type Node struct {
-	name   string
-	state  interface{}
-	iface  string
-	offset interface{}
+	Name     string      `json:"name"`
+	State    interface{} `json:"state"`
+	Iface    string      `json:"iface,omitempty"`
+	Offset   interface{} `json:"offset,omitempty"`
+	Children []Node      `json:"children,omitempty"`
 }
 
 // UpdateGMState updates the state of the Grand Master Clock (GM) and prints the tree if necessary
 func UpdateGMState(s string) {
+	lock.Lock()
+	defer lock.Unlock()
 	if st, ok := state[GmKey]; !ok || st.State != s || resetGM {
 		state[GmKey] = StateDB{State: s}
 		resetGM = false
-		PrintTree()
+		if root, ok := gmTree(); ok {
+			root.Render(os.Stdout)
+		}
 	}
 }
 
 // UpdateTs2phcState updates the state of the TS2PHC and sets resetGM to true if necessary
 func UpdateTs2phcState(s string, offset interface{}, iface string) {
+	lock.Lock()
+	defer lock.Unlock()
 	key := Ts2phcKey + "-" + iface
 	if iface == OverallTs2phcKey {
 		key = iface
@@ -80,6 +92,8 @@ func UpdateTs2phcState(s string, offset interface{}, iface string) {
 
 // UpdateDPLLState updates the state of the DPLL and sets resetGM to true if necessary
 func UpdateDPLLState(s string, offset interface{}, iface string) {
+	lock.Lock()
+	defer lock.Unlock()
 	key := DpllKey + "-" + iface
 	if iface == OverallDpllKey {
 		key = iface
@@ -92,6 +106,8 @@ func UpdateDPLLState(s string, offset interface{}, iface string) {
 
 // UpdateGNSSState updates the state of the GNSS and sets resetGM to true if necessary
 func UpdateGNSSState(s string, offset interface{}) {
+	lock.Lock()
+	defer lock.Unlock()
 	if st, ok := state[GnssKey]; !ok || st.State.(string) != s {
 		state[GnssKey] = StateDB{State: s, Offset: offset}
 		resetGM = true
@@ -100,101 +116,96 @@ func UpdateGNSSState(s string, offset interface{}) {
 
 // UpdateClockClass updates the state of the Clock Class and sets resetGM to true if necessary
 func UpdateClockClass(ClassTo uint8) {
+	lock.Lock()
+	defer lock.Unlock()
 	if st, ok := state[ClockClassKey]; !ok || ClassTo != st.State.(uint8) {
 		state[ClockClassKey] = StateDB{State: ClassTo}
 		resetGM = true
 	}
 }
 
-// printTreeNode prints a tree node with its children
-func printTreeNode(parent Node, children []Node, indent string, isLast bool) {
-	// Print the parent node with the appropriate indent
-	connector := "├──"
-	if isLast {
-		connector = "└──"
-	}
-
-	fmt.Printf("%s%s %s (State:%v)\n", indent, connector, parent.name, parent.state)
-
-	// Print the children nodes with an increased indent
-	childIndent := indent + "    "
-	for i, child := range children {
-		isLastChild := i == len(children)-1
-		printTreeNode(child, nil, childIndent, isLastChild)
-		fmt.Printf("%s    └── State: %s Iface: %s  Offset %v\n", childIndent, child.state, child.iface, child.offset)
+// Render writes the node and its children as a tree
+func (n Node) Render(w io.Writer) {
+	fmt.Fprintf(w, "%s (State:%v)\n", n.Name, n.State)
+	for i, child := range n.Children {
+		child.render(w, "", i == len(n.Children)-1)
 	}
 }
 
-// printTree prints the entire tree with its nodes
-func printTree(root Node, rootChildren map[Node][]Node) {
-	// Print the root node (GM)
-	fmt.Println(root.name + " (State:" + root.state.(string) + ")")
-	i := 0
-	for child, children := range rootChildren {
-		isLast := i == len(rootChildren)-1
-		printTreeNode(child, children, "*", isLast)
-		i++
+func (n Node) render(w io.Writer, indent string, isLast bool) {
+	connector, childIndent := "├── ", indent+"│   "
+	if isLast {
+		connector, childIndent = "└── ", indent+"    "
+	}
+	fmt.Fprintf(w, "%s%s%s (State:%v)", indent, connector, n.Name, n.State)
+	if n.Iface != "" {
+		fmt.Fprintf(w, " Iface: %s Offset: %v", n.Iface, n.Offset)
+	}
+	fmt.Fprintln(w)
+	for i, child := range n.Children {
+		child.render(w, childIndent, i == len(n.Children)-1)
 	}
 }
 
 // PrintTree prints the tree if all required keys are present
 func PrintTree() {
-	if !hasAllKeys(requiredKeys) {
-		return
-	}
-	clockClass := Node{
-		name:  iconClockClass,
-		state: state[ClockClassKey].State,
+	if root, ok := GMTree(); ok {
+		root.Render(os.Stdout)
 	}
+}
 
-	ss := getSate(state[GmKey].State.(string))
+// GMTree returns the GM tree, false if not all required states are known yet
+func GMTree() (Node, bool) {
+	lock.Lock()
+	defer lock.Unlock()
+	return gmTree()
+}
+
+func gmTree() (Node, bool) {
+	if !hasAllKeys(requiredKeys) {
+		return Node{}, false
+	}
 	root := Node{
-		name:  "GM (Grand Master Clock)",
-		state: ss, // GM is synchronized
+		Name:  "GM (Grand Master Clock)",
+		State: getSate(state[GmKey].State.(string)),
 	}
-	ss = getSate(state[GnssKey].State.(string))
 	gnss := Node{
-		name:  iconAntenna,
-		state: ss,
+		Name:  iconAntenna,
+		State: getSate(state[GnssKey].State.(string)),
+	}
+	clockClass := Node{
+		Name:  iconClockClass,
+		State: state[ClockClassKey].State,
 	}
-
-	// Define the child nodes (ts2phc and DPLL)
-	ss = getSate(state[OverallTs2phcKey].State.(string))
 	ts2phc := Node{
-		name:  OverallTs2phcKey,
-		state: ss,
+		Name:  OverallTs2phcKey,
+		State: getSate(state[OverallTs2phcKey].State.(string)),
 	}
-	ss = getSate(state[OverallDpllKey].State.(string))
 	dpll := Node{
-		name:  OverallDpllKey,
-		state: ss,
+		Name:  OverallDpllKey,
+		State: getSate(state[OverallDpllKey].State.(string)),
 	}
 
-	// Define child nodes for ts2phc and DPLL
-	ts2phcChildren := []Node{}
-	dpllChildren := []Node{}
-
-	for k, v := range state {
+	keys := make([]string, 0, len(state))
+	for k := range state {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
 		if k == OverallTs2phcKey || k == OverallDpllKey || k == GmKey || k == GnssKey || k == ClockClassKey {
 			continue
 		}
-		ss = getSate(v.State.(string))
-		if strings.Split(k, "-")[0] == Ts2phcKey {
-			ts2phcChildren = append(ts2phcChildren, Node{name: ts2phcIcon, state: ss, iface: strings.Split(k, "-")[1], offset: v.Offset})
-		} else if strings.Split(k, "-")[0] == DpllKey {
-			dpllChildren = append(dpllChildren, Node{name: dpllIcon, state: ss, iface: strings.Split(k, "-")[1], offset: v.Offset})
+		v := state[k]
+		prefix, iface, _ := strings.Cut(k, "-")
+		switch prefix {
+		case Ts2phcKey:
+			ts2phc.Children = append(ts2phc.Children, Node{Name: ts2phcIcon, State: getSate(v.State.(string)), Iface: iface, Offset: v.Offset})
+		case DpllKey:
+			dpll.Children = append(dpll.Children, Node{Name: dpllIcon, State: getSate(v.State.(string)), Iface: iface, Offset: v.Offset})
 		}
 	}
-	// Map the children to their respective parent nodes
-	rootChildren := map[Node][]Node{
-		gnss:       {},
-		clockClass: {},
-		ts2phc:     ts2phcChildren,
-		dpll:       dpllChildren,
-	}
-
-	// Print the tree
-	printTree(root, rootChildren)
+	root.Children = []Node{gnss, clockClass, ts2phc, dpll}
+	return root, true
 }
 
 // hasAllKeys checks if all required keys are present in the state
@@ -209,6 +220,8 @@ func hasAllKeys(keys []string) bool {
 
 // ClearState clears the state and resets resetGM
 func ClearState() {
+	lock.Lock()
+	defer lock.Unlock()
 	state = map[string]StateDB{}
 	resetGM = false
 }
@@ -1,8 +1,11 @@
 package debug_test
 
 import (
-	"github.com/openshift/linuxptp-daemon/pkg/debug"
+	"bytes"
 	"testing"
+
+	"github.com/openshift/linuxptp-daemon/pkg/debug"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestPrintALLState_ChangesStateAndSetsResetGM(t *testing.T) {
@@ -17,3 +20,32 @@ func TestPrintALLState_ChangesStateAndSetsResetGM(t *testing.T) {
 	debug.UpdateClockClass(2)
 	debug.PrintTree()
 }
+
+func TestGMTree(t *testing.T) {
+	debug.ClearState()
+	_, ok := debug.GMTree()
+	assert.False(t, ok)
+
+	debug.UpdateDPLLState("s2", 5, "ens2f0")
+	debug.UpdateDPLLState("s2", 3, "ens1f0")
+	debug.UpdateGNSSState("s2", 1)
+	debug.UpdateTs2phcState("s2", 2, "ens1f0")
+	debug.UpdateDPLLState("s2", 0, debug.OverallDpllKey)
+	debug.UpdateTs2phcState("s2", 0, debug.OverallTs2phcKey)
+	debug.UpdateClockClass(6)
+	debug.UpdateGMState("s2")
+
+	root, ok := debug.GMTree()
+	assert.True(t, ok)
+	var b bytes.Buffer
+	root.Render(&b)
+	assert.Equal(t, `GM (Grand Master Clock) (State:Locked)
+├── GNSS (State:Locked)
+├── ClockClass (State:6)
+├── OVER-ALL-TS2PHC (State:Locked)
+│   └── ts2phc (State:Locked) Iface: ens1f0 Offset: 2
+└── OVER-ALL-DPLL (State:Locked)
+    ├── dpll (State:Locked) Iface: ens1f0 Offset: 3
+    └── dpll (State:Locked) Iface: ens2f0 Offset: 5
+`, b.String())
+}
@@ -6,6 +6,7 @@ package dpll_netlink
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 const DPLL_MCGRP_MONITOR = "monitor"
@@ -77,6 +78,26 @@ const (
 	DPLL_CMD_MAX = (__DPLL_CMD_MAX - 1)
 )
 
+// DPLL modes
+const (
+	DPLL_MODE_MANUAL    = 1
+	DPLL_MODE_AUTOMATIC = 2
+)
+
+// Pin states, directions and capabilities
+const (
+	DPLL_PIN_STATE_CONNECTED    = 1
+	DPLL_PIN_STATE_DISCONNECTED = 2
+	DPLL_PIN_STATE_SELECTABLE   = 3
+
+	DPLL_PIN_DIRECTION_INPUT  = 1
+	DPLL_PIN_DIRECTION_OUTPUT = 2
+
+	DPLL_PIN_CAPABILITIES_DIRECTION_CAN_CHANGE = 1
+	DPLL_PIN_CAPABILITIES_PRIORITY_CAN_CHANGE  = 2
+	DPLL_PIN_CAPABILITIES_STATE_CAN_CHANGE     = 4
+)
+
 // GetLockStatus returns DPLL lock status as a string
 func GetLockStatus(ls uint32) string {
 	lockStatusMap := map[uint32]string{
@@ -120,6 +141,25 @@ func GetMode(md uint32) string {
 	return ""
 }
 
+// ModeFromString returns the settable DPLL mode of its string representation
+func ModeFromString(s string) (uint32, bool) {
+	for k := uint32(DPLL_MODE_MANUAL); k <= DPLL_MODE_AUTOMATIC; k++ {
+		if GetMode(k) == s {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
+// GetModes returns DPLL modes as a comma separated string
+func GetModes(modes []uint32) string {
+	names := make([]string, 0, len(modes))
+	for _, md := range modes {
+		names = append(names, GetMode(md))
+	}
+	return strings.Join(names, ",")
+}
+
 // DpllStatusHR represents human-readable DPLL status
 type DpllStatusHR struct {
 	Id            uint32
@@ -134,33 +174,34 @@ type DpllStatusHR struct {
 // GetDpllStatusHR returns human-readable DPLL status
 func GetDpllStatusHR(reply *DoDeviceGetReply) DpllStatusHR {
 	return DpllStatusHR{
-		Id:         reply.Id,
-		ModuleName: reply.ModuleName,
-		Mode:       GetMode(reply.Mode),
-		LockStatus: GetLockStatus(reply.LockStatus),
-		ClockId:    fmt.Sprintf("0x%x", reply.ClockId),
-		Type:       GetDpllType(reply.Type),
+		Id:            reply.Id,
+		ModuleName:    reply.ModuleName,
+		Mode:          GetMode(reply.Mode),
+		ModeSupported: GetModes(reply.ModeSupported),
+		LockStatus:    GetLockStatus(reply.LockStatus),
+		ClockId:       fmt.Sprintf("0x%x", reply.ClockId),
+		Type:          GetDpllType(reply.Type),
 	}
 }
 
 // DoPinGetReply is used with the DoPinGet method.
 type DoPinGetReplyHR struct {
-	Id                        uint32            `json:"id"`
-	ClockId                   uint64            `json:"clockId"`
-	BoardLabel                string            `json:"boardLabel"`
-	PanelLabel                string            `json:"panelLabel"`
-	PackageLabel              string            `json:"packageLabel"`
-	Type                      string            `json:"type"`
-	Frequency                 uint64            `json:"frequency"`
-	FrequencySupported        FrequencyRange    `json:"frequencySupported"`
-	Capabilities              string            `json:"capabilities"`
-	ParentDevice              PinParentDeviceHR `json:"pinParentDevice"`
-	ParentPin                 PinParentPinHR    `json:"pinParentPin"`
-	PhaseAdjustMin            int32             `json:"phaseAdjustMin"`
-	PhaseAdjustMax            int32             `json:"phaseAdjustMax"`
-	PhaseAdjust               int32             `json:"phaseAdjust"`
-	FractionalFrequencyOffset int               `json:"fractionalFrequencyOffset"`
-	ModuleName                string            `json:"moduleName"`
+	Id                        uint32              `json:"id"`
+	ClockId                   uint64              `json:"clockId"`
+	BoardLabel                string              `json:"boardLabel"`
+	PanelLabel                string              `json:"panelLabel"`
+	PackageLabel              string              `json:"packageLabel"`
+	Type                      string              `json:"type"`
+	Frequency                 uint64              `json:"frequency"`
+	FrequencySupported        FrequencyRange      `json:"frequencySupported"`
+	Capabilities              string              `json:"capabilities"`
+	ParentDevice              []PinParentDeviceHR `json:"pinParentDevice"`
+	ParentPin                 []PinParentPinHR    `json:"pinParentPin"`
+	PhaseAdjustMin            int32               `json:"phaseAdjustMin"`
+	PhaseAdjustMax            int32               `json:"phaseAdjustMax"`
+	PhaseAdjust               int32               `json:"phaseAdjust"`
+	FractionalFrequencyOffset int                 `json:"fractionalFrequencyOffset"`
+	ModuleName                string              `json:"moduleName"`
 }
 
 // PinParentDevice contains nested netlink attributes.
@@ -192,6 +233,16 @@ func GetPinState(s uint32) string {
 	return ""
 }
 
+// PinStateFromString returns the DPLL pin state of its name
+func PinStateFromString(s string) (uint32, bool) {
+	for k := uint32(DPLL_PIN_STATE_CONNECTED); k <= DPLL_PIN_STATE_SELECTABLE; k++ {
+		if GetPinState(k) == s {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
 // GetPinType returns DPLL pin type as a string
 func GetPinType(tp uint32) string {
 	typeMap := map[int]string{
@@ -221,6 +272,16 @@ func GetPinDirection(d uint32) string {
 	return ""
 }
 
+// PinDirectionFromString returns the DPLL pin direction of its name
+func PinDirectionFromString(s string) (uint32, bool) {
+	for k := uint32(DPLL_PIN_DIRECTION_INPUT); k <= DPLL_PIN_DIRECTION_OUTPUT; k++ {
+		if GetPinDirection(k) == s {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
 // GetPinCapabilities returns DPLL pin capabilities as a csv
 func GetPinCapabilities(c uint32) string {
 	cMap := map[int]string{
@@ -242,32 +303,44 @@ func GetPinCapabilities(c uint32) string {
 
 // GetPinInfoHR returns human-readable pin status
 func GetPinInfoHR(reply *DoPinGetReply) ([]byte, error) {
-	hr := DoPinGetReplyHR{
-		Id:                 reply.Id,
-		ClockId:            reply.ClockId,
-		BoardLabel:         reply.BoardLabel,
-		PanelLabel:         reply.PanelLabel,
-		PackageLabel:       reply.PackageLabel,
-		Type:               GetPinType(reply.Type),
-		Frequency:          reply.Frequency,
-		FrequencySupported: reply.FrequencySupported,
-		Capabilities:       GetPinCapabilities(reply.Capabilities),
-		ParentDevice: PinParentDeviceHR{
-			ParentId:    reply.ParentDevice.ParentId,
-			Direction:   GetPinDirection(reply.ParentDevice.Direction),
-			Prio:        reply.ParentDevice.Prio,
-			State:       GetPinState(reply.ParentDevice.State),
-			PhaseOffset: reply.ParentDevice.PhaseOffset,
-		},
-		ParentPin: PinParentPinHR{
-			ParentId: reply.ParentPin.ParentId,
-			State:    GetPinState(reply.ParentPin.State),
-		},
+	return json.Marshal(GetPinHR(reply))
+}
+
+// GetPinHR returns human-readable pin structure
+func GetPinHR(reply *DoPinGetReply) DoPinGetReplyHR {
+	parentDevices := make([]PinParentDeviceHR, 0, len(reply.ParentDevice))
+	for _, pd := range reply.ParentDevice {
+		parentDevices = append(parentDevices, PinParentDeviceHR{
+			ParentId:    pd.ParentId,
+			Direction:   GetPinDirection(pd.Direction),
+			Prio:        pd.Prio,
+			State:       GetPinState(pd.State),
+			PhaseOffset: pd.PhaseOffset,
+		})
+	}
+	parentPins := make([]PinParentPinHR, 0, len(reply.ParentPin))
+	for _, pp := range reply.ParentPin {
+		parentPins = append(parentPins, PinParentPinHR{
+			ParentId: pp.ParentId,
+			State:    GetPinState(pp.State),
+		})
+	}
+	return DoPinGetReplyHR{
+		Id:                        reply.Id,
+		ClockId:                   reply.ClockId,
+		BoardLabel:                reply.BoardLabel,
+		PanelLabel:                reply.PanelLabel,
+		PackageLabel:              reply.PackageLabel,
+		Type:                      GetPinType(reply.Type),
+		Frequency:                 reply.Frequency,
+		FrequencySupported:        reply.FrequencySupported,
+		Capabilities:              GetPinCapabilities(reply.Capabilities),
+		ParentDevice:              parentDevices,
+		ParentPin:                 parentPins,
 		PhaseAdjustMin:            reply.PhaseAdjustMin,
 		PhaseAdjustMax:            reply.PhaseAdjustMax,
 		PhaseAdjust:               reply.PhaseAdjust,
 		FractionalFrequencyOffset: reply.FractionalFrequencyOffset,
 		ModuleName:                reply.ModuleName,
 	}
-	return json.Marshal(hr)
 }
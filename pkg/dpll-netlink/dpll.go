@@ -6,6 +6,7 @@ import (
 	"errors"
 	"log"
 	"math"
+	"sync"
 
 	"github.com/mdlayher/genetlink"
 	"github.com/mdlayher/netlink"
@@ -37,10 +38,30 @@ func (c *Conn) GetMcastGroupId(mcGroup string) (id uint32, found bool) {
 	return 0, false
 }
 
+// dialer opens the generic netlink connections of Dial, see SetDialer
+var dialer = struct {
+	sync.RWMutex
+	dial func(cfg *netlink.Config) (*genetlink.Conn, error)
+}{dial: genetlink.Dial}
+
+// SetDialer makes Dial open its generic netlink connections with dial, e.g. to
+// an in-process simulated DPLL family. Nil restores the kernel generic netlink.
+func SetDialer(dial func(cfg *netlink.Config) (*genetlink.Conn, error)) {
+	dialer.Lock()
+	defer dialer.Unlock()
+	if dial == nil {
+		dial = genetlink.Dial
+	}
+	dialer.dial = dial
+}
+
 // Dial opens a Conn for netlink family "dpll". Any options are passed directly
 // to the underlying netlink package.
 func Dial(cfg *netlink.Config) (*Conn, error) {
-	c, err := genetlink.Dial(cfg)
+	dialer.RLock()
+	dial := dialer.dial
+	dialer.RUnlock()
+	c, err := dial(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -142,9 +163,9 @@ func ParseDeviceReplies(msgs []genetlink.Message) ([]*DoDeviceGetReply, error) {
 			case DPLL_A_MODULE_NAME:
 				reply.ModuleName = ad.String()
 			case DPLL_A_MODE:
-				//reply.Mode = ad.Uint32()
+				reply.Mode = ad.Uint32()
 			case DPLL_A_MODE_SUPPORTED:
-				// reply.ModeSupported = append(reply.ModeSupported, ad.Uint32())
+				reply.ModeSupported = append(reply.ModeSupported, ad.Uint32())
 			case DPLL_A_LOCK_STATUS:
 				reply.LockStatus = ad.Uint32()
 			case DPLL_A_PAD:
@@ -245,13 +266,73 @@ type DoDeviceGetReply struct {
 	Id            uint32
 	ModuleName    string
 	Mode          uint32
-	ModeSupported uint32
+	ModeSupported []uint32
 	LockStatus    uint32
 	Temp          int32
 	ClockId       uint64
 	Type          uint32
 }
 
+// EncodeDeviceGetReply encodes the attributes of a "device-get" reply or
+// device notification
+func EncodeDeviceGetReply(reply *DoDeviceGetReply) ([]byte, error) {
+	ae := netlink.NewAttributeEncoder()
+	ae.Uint32(DPLL_A_ID, reply.Id)
+	if reply.ModuleName != "" {
+		ae.String(DPLL_A_MODULE_NAME, reply.ModuleName)
+	}
+	if reply.Mode != 0 {
+		ae.Uint32(DPLL_A_MODE, reply.Mode)
+	}
+	for _, mode := range reply.ModeSupported {
+		ae.Uint32(DPLL_A_MODE_SUPPORTED, mode)
+	}
+	ae.Uint32(DPLL_A_LOCK_STATUS, reply.LockStatus)
+	if reply.Temp != 0 {
+		ae.Int32(DPLL_A_TEMP, reply.Temp)
+	}
+	ae.Uint64(DPLL_A_CLOCK_ID, reply.ClockId)
+	ae.Uint32(DPLL_A_TYPE, reply.Type)
+	return ae.Encode()
+}
+
+// DeviceSetRequest is used with the DeviceSet method.
+type DeviceSetRequest struct {
+	Id   uint32
+	Mode uint32
+}
+
+// EncodeDeviceSet encodes the attributes of a "device-set" request
+func EncodeDeviceSet(req DeviceSetRequest) ([]byte, error) {
+	ae := netlink.NewAttributeEncoder()
+	ae.Uint32(DPLL_A_ID, req.Id)
+	if req.Mode != 0 {
+		ae.Uint32(DPLL_A_MODE, req.Mode)
+	}
+	return ae.Encode()
+}
+
+// DeviceSet wraps the "device-set" operation:
+// Set attributes, the working mode, of a DPLL device
+func (c *Conn) DeviceSet(req DeviceSetRequest) error {
+	b, err := EncodeDeviceSet(req)
+	if err != nil {
+		return err
+	}
+
+	msg := genetlink.Message{
+		Header: genetlink.Header{
+			Command: DPLL_CMD_DEVICE_SET,
+			Version: c.f.Version,
+		},
+		Data: b,
+	}
+
+	// No replies, the acknowledgement carries the error of a rejected mode.
+	_, err = c.c.Execute(msg, c.f.ID, netlink.Request|netlink.Acknowledge)
+	return err
+}
+
 func ParsePinReplies(msgs []genetlink.Message) ([]*DoPinGetReply, error) {
 	replies := make([]*DoPinGetReply, 0, len(msgs))
 
@@ -260,12 +341,7 @@ func ParsePinReplies(msgs []genetlink.Message) ([]*DoPinGetReply, error) {
 		if err != nil {
 			return nil, err
 		}
-		// Initialize phase offset to a max value, so later we can detect it has been updated
-		reply := DoPinGetReply{
-			ParentDevice: PinParentDevice{
-				PhaseOffset: math.MaxInt64,
-			},
-		}
+		var reply DoPinGetReply
 		for ad.Next() {
 			switch ad.Type() {
 			case DPLL_A_PIN_CLOCK_ID:
@@ -297,36 +373,41 @@ func ParsePinReplies(msgs []genetlink.Message) ([]*DoPinGetReply, error) {
 			case DPLL_A_PIN_CAPABILITIES:
 				reply.Capabilities = ad.Uint32()
 			case DPLL_A_PIN_PARENT_DEVICE:
+				// Initialize phase offset to a max value, so later we can detect it has been updated
+				pd := PinParentDevice{PhaseOffset: math.MaxInt64}
 				ad.Nested(func(ad *netlink.AttributeDecoder) error {
 					for ad.Next() {
 						switch ad.Type() {
 						case DPLL_A_PIN_PARENT_ID:
-							reply.ParentDevice.ParentId = ad.Uint32()
+							pd.ParentId = ad.Uint32()
 						case DPLL_A_PIN_DIRECTION:
-							reply.ParentDevice.Direction = ad.Uint32()
+							pd.Direction = ad.Uint32()
 						case DPLL_A_PIN_PRIO:
-							reply.ParentDevice.Prio = ad.Uint32()
+							pd.Prio = ad.Uint32()
 						case DPLL_A_PIN_STATE:
-							reply.ParentDevice.State = ad.Uint32()
+							pd.State = ad.Uint32()
 						case DPLL_A_PIN_PHASE_OFFSET:
-							reply.ParentDevice.PhaseOffset = ad.Int64()
+							pd.PhaseOffset = ad.Int64()
 						}
 					}
 					return nil
 				})
+				reply.ParentDevice = append(reply.ParentDevice, pd)
 			case DPLL_A_PIN_PARENT_PIN:
+				var pp PinParentPin
 				ad.Nested(func(ad *netlink.AttributeDecoder) error {
 					for ad.Next() {
 						switch ad.Type() {
 						case DPLL_A_PIN_PARENT_ID:
-							reply.ParentPin.ParentId = ad.Uint32()
+							pp.ParentId = ad.Uint32()
 						case DPLL_A_PIN_STATE:
-							reply.ParentPin.State = ad.Uint32()
+							pp.State = ad.Uint32()
 						}
 					}
 
 					return nil
 				})
+				reply.ParentPin = append(reply.ParentPin, pp)
 			case DPLL_A_PIN_PHASE_ADJUST_MIN:
 				reply.PhaseAdjustMin = ad.Int32()
 			case DPLL_A_PIN_PHASE_ADJUST_MAX:
@@ -349,6 +430,68 @@ func ParsePinReplies(msgs []genetlink.Message) ([]*DoPinGetReply, error) {
 	return replies, nil
 }
 
+// EncodePinGetReply encodes the attributes of a "pin-get" reply or pin
+// notification. A parent device phase offset of math.MaxInt64 is not measured
+// and left out.
+func EncodePinGetReply(reply *DoPinGetReply) ([]byte, error) {
+	ae := netlink.NewAttributeEncoder()
+	ae.Uint32(DPLL_A_PIN_ID, reply.Id)
+	if reply.ModuleName != "" {
+		ae.String(DPLL_A_PIN_MODULE_NAME, reply.ModuleName)
+	}
+	ae.Uint64(DPLL_A_PIN_CLOCK_ID, reply.ClockId)
+	if reply.BoardLabel != "" {
+		ae.String(DPLL_A_PIN_BOARD_LABEL, reply.BoardLabel)
+	}
+	if reply.PanelLabel != "" {
+		ae.String(DPLL_A_PIN_PANEL_LABEL, reply.PanelLabel)
+	}
+	if reply.PackageLabel != "" {
+		ae.String(DPLL_A_PIN_PACKAGE_LABEL, reply.PackageLabel)
+	}
+	ae.Uint32(DPLL_A_PIN_TYPE, reply.Type)
+	if reply.Frequency != 0 {
+		ae.Uint64(DPLL_A_PIN_FREQUENCY, reply.Frequency)
+	}
+	if reply.FrequencySupported != (FrequencyRange{}) {
+		fs := reply.FrequencySupported
+		ae.Nested(DPLL_A_PIN_FREQUENCY_SUPPORTED, func(ae *netlink.AttributeEncoder) error {
+			ae.Uint64(DPLL_A_PIN_FREQUENCY_MIN, fs.FrequencyMin)
+			ae.Uint64(DPLL_A_PIN_FREQUENCY_MAX, fs.FrequencyMax)
+			return nil
+		})
+	}
+	ae.Uint32(DPLL_A_PIN_CAPABILITIES, reply.Capabilities)
+	for _, pd := range reply.ParentDevice {
+		pd := pd
+		ae.Nested(DPLL_A_PIN_PARENT_DEVICE, func(ae *netlink.AttributeEncoder) error {
+			ae.Uint32(DPLL_A_PIN_PARENT_ID, pd.ParentId)
+			ae.Uint32(DPLL_A_PIN_DIRECTION, pd.Direction)
+			ae.Uint32(DPLL_A_PIN_PRIO, pd.Prio)
+			ae.Uint32(DPLL_A_PIN_STATE, pd.State)
+			if pd.PhaseOffset != math.MaxInt64 {
+				ae.Int64(DPLL_A_PIN_PHASE_OFFSET, pd.PhaseOffset)
+			}
+			return nil
+		})
+	}
+	for _, pp := range reply.ParentPin {
+		pp := pp
+		ae.Nested(DPLL_A_PIN_PARENT_PIN, func(ae *netlink.AttributeEncoder) error {
+			ae.Uint32(DPLL_A_PIN_PARENT_ID, pp.ParentId)
+			ae.Uint32(DPLL_A_PIN_STATE, pp.State)
+			return nil
+		})
+	}
+	ae.Int32(DPLL_A_PIN_PHASE_ADJUST_MIN, reply.PhaseAdjustMin)
+	ae.Int32(DPLL_A_PIN_PHASE_ADJUST_MAX, reply.PhaseAdjustMax)
+	ae.Int32(DPLL_A_PIN_PHASE_ADJUST, reply.PhaseAdjust)
+	if reply.FractionalFrequencyOffset != 0 {
+		ae.Int32(DPLL_A_PIN_FRACTIONAL_FREQUENCY_OFFSET, int32(reply.FractionalFrequencyOffset))
+	}
+	return ae.Encode()
+}
+
 // DoPinGet wraps the "pin-get" operation:
 func (c *Conn) DoPinGet(req DoPinGetRequest) (*DoPinGetReply, error) {
 	ae := netlink.NewAttributeEncoder()
@@ -429,8 +572,8 @@ type DoPinGetReply struct {
 	Frequency                 uint64
 	FrequencySupported        FrequencyRange
 	Capabilities              uint32
-	ParentDevice              PinParentDevice
-	ParentPin                 PinParentPin
+	ParentDevice              []PinParentDevice // one per DPLL device the pin is attached to
+	ParentPin                 []PinParentPin    // one per mux pin the pin is attached to
 	PhaseAdjustMin            int32
 	PhaseAdjustMax            int32
 	PhaseAdjust               int32
@@ -459,6 +602,27 @@ type PinParentPin struct {
 	State    uint32
 }
 
+// ParentDeviceById returns the relationship of the pin with the parent DPLL device id, nil when the pin is not
+// attached to it
+func (r *DoPinGetReply) ParentDeviceById(id uint32) *PinParentDevice {
+	for i := range r.ParentDevice {
+		if r.ParentDevice[i].ParentId == id {
+			return &r.ParentDevice[i]
+		}
+	}
+	return nil
+}
+
+// HasDirection returns true when the pin has the direction towards one of its parent DPLL devices
+func (r *DoPinGetReply) HasDirection(direction uint32) bool {
+	for _, pd := range r.ParentDevice {
+		if pd.Direction == direction {
+			return true
+		}
+	}
+	return false
+}
+
 // PinPhaseAdjustRequest is used with PinPhaseAdjust method.
 type PinPhaseAdjustRequest struct {
 	Id          uint32
@@ -489,3 +653,70 @@ func (c *Conn) PinPhaseAdjust(req PinPhaseAdjustRequest) error {
 	_, err = c.c.Send(msg, c.f.ID, netlink.Request)
 	return err
 }
+
+// PinParentDeviceCtl is the part of a PinSetRequest for one parent DPLL device of the pin.
+// Nil fields are left unchanged.
+type PinParentDeviceCtl struct {
+	Id        uint32
+	Prio      *uint32
+	State     *uint32
+	Direction *uint32
+}
+
+// PinSetRequest is used with the PinSet method. Nil fields are left unchanged.
+type PinSetRequest struct {
+	Id           uint32
+	Frequency    *uint64
+	PhaseAdjust  *int32
+	ParentDevice []PinParentDeviceCtl
+}
+
+// EncodePinSet encodes the attributes of a "pin-set" request
+func EncodePinSet(req PinSetRequest) ([]byte, error) {
+	ae := netlink.NewAttributeEncoder()
+	ae.Uint32(DPLL_A_PIN_ID, req.Id)
+	if req.Frequency != nil {
+		ae.Uint64(DPLL_A_PIN_FREQUENCY, *req.Frequency)
+	}
+	if req.PhaseAdjust != nil {
+		ae.Int32(DPLL_A_PIN_PHASE_ADJUST, *req.PhaseAdjust)
+	}
+	for _, pd := range req.ParentDevice {
+		pd := pd
+		ae.Nested(DPLL_A_PIN_PARENT_DEVICE, func(ae *netlink.AttributeEncoder) error {
+			ae.Uint32(DPLL_A_PIN_PARENT_ID, pd.Id)
+			if pd.Direction != nil {
+				ae.Uint32(DPLL_A_PIN_DIRECTION, *pd.Direction)
+			}
+			if pd.Prio != nil {
+				ae.Uint32(DPLL_A_PIN_PRIO, *pd.Prio)
+			}
+			if pd.State != nil {
+				ae.Uint32(DPLL_A_PIN_STATE, *pd.State)
+			}
+			return nil
+		})
+	}
+	return ae.Encode()
+}
+
+// PinSet wraps the "pin-set" operation:
+// Set frequency and phase adjust of a pin and its priority, state and direction towards its parent devices
+func (c *Conn) PinSet(req PinSetRequest) error {
+	b, err := EncodePinSet(req)
+	if err != nil {
+		return err
+	}
+
+	msg := genetlink.Message{
+		Header: genetlink.Header{
+			Command: DPLL_CMD_PIN_SET,
+			Version: c.f.Version,
+		},
+		Data: b,
+	}
+
+	// No replies, the acknowledgement carries the error of a rejected setting.
+	_, err = c.c.Execute(msg, c.f.ID, netlink.Request|netlink.Acknowledge)
+	return err
+}
@@ -0,0 +1,538 @@
+// Package dplltest simulates the DPLL generic netlink family in process, so that the DPLL netlink client, the DPLL
+// monitoring and the plugins setting DPLL pins can be tested end to end without DPLL hardware:
+//
+//	sim := dplltest.New()
+//	nl.SetDialer(sim.Dial)
+//	defer nl.SetDialer(nil)
+//	sim.AddDevice(nl.DoDeviceGetReply{Id: 1, ClockId: clockId, Type: 1, LockStatus: 3})
+//	sim.Holdover(clockId)
+//
+// The simulator answers device-get, device-set, pin-get and pin-set, and sends the create, change and delete
+// notifications of the hardware changes to the connections that joined the monitor multicast group.
+package dplltest
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	nl "github.com/openshift/linuxptp-daemon/pkg/dpll-netlink"
+)
+
+const (
+	// FamilyID ... generic netlink id of the simulated "dpll" family
+	FamilyID = 0x30
+	// MonitorGroupID ... id of the simulated "monitor" multicast group
+	MonitorGroupID = 5
+	familyVersion  = 1
+)
+
+// Simulator ... DPLL devices and pins of simulated hardware, served to the connections opened by Dial
+type Simulator struct {
+	mu      sync.Mutex
+	devices map[uint32]*nl.DoDeviceGetReply
+	pins    map[uint32]*nl.DoPinGetReply
+	sockets map[*socket]struct{}
+	lastPid uint32
+}
+
+// New ... simulator without any DPLL device or pin
+func New() *Simulator {
+	return &Simulator{
+		devices: map[uint32]*nl.DoDeviceGetReply{},
+		pins:    map[uint32]*nl.DoPinGetReply{},
+		sockets: map[*socket]struct{}{},
+	}
+}
+
+// Dial ... open a connection to the simulated family, the dialer for nl.SetDialer
+func (s *Simulator) Dial(_ *netlink.Config) (*genetlink.Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastPid++
+	sock := &socket{sim: s, pid: s.lastPid, wake: make(chan struct{}, 1), closed: make(chan struct{})}
+	s.sockets[sock] = struct{}{}
+	return genetlink.NewConn(netlink.NewConn(sock, sock.pid)), nil
+}
+
+// Device ... copy of the simulated device
+func (s *Simulator) Device(id uint32) (nl.DoDeviceGetReply, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.devices[id]
+	if !ok {
+		return nl.DoDeviceGetReply{}, false
+	}
+	return *copyDevice(d), true
+}
+
+// Pin ... copy of the simulated pin
+func (s *Simulator) Pin(id uint32) (nl.DoPinGetReply, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pins[id]
+	if !ok {
+		return nl.DoPinGetReply{}, false
+	}
+	return *copyPin(p), true
+}
+
+// AddDevice ... plug a DPLL device, or replace the device with the same id
+func (s *Simulator) AddDevice(device nl.DoDeviceGetReply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cmd := uint8(nl.DPLL_CMD_DEVICE_CREATE_NTF)
+	if _, ok := s.devices[device.Id]; ok {
+		cmd = nl.DPLL_CMD_DEVICE_CHANGE_NTF
+	}
+	s.devices[device.Id] = copyDevice(&device)
+	s.notifyDevice(cmd, s.devices[device.Id])
+}
+
+// RemoveDevice ... unplug a DPLL device
+func (s *Simulator) RemoveDevice(id uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d, ok := s.devices[id]; ok {
+		delete(s.devices, id)
+		s.notifyDevice(nl.DPLL_CMD_DEVICE_DELETE_NTF, d)
+	}
+}
+
+// AddPin ... plug a pin, or replace the pin with the same id
+func (s *Simulator) AddPin(pin nl.DoPinGetReply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cmd := uint8(nl.DPLL_CMD_PIN_CREATE_NTF)
+	if _, ok := s.pins[pin.Id]; ok {
+		cmd = nl.DPLL_CMD_PIN_CHANGE_NTF
+	}
+	s.pins[pin.Id] = copyPin(&pin)
+	s.notifyPin(cmd, s.pins[pin.Id])
+}
+
+// RemovePin ... unplug a pin
+func (s *Simulator) RemovePin(id uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.pins[id]; ok {
+		delete(s.pins, id)
+		s.notifyPin(nl.DPLL_CMD_PIN_DELETE_NTF, p)
+	}
+}
+
+// SetLockStatus ... lock status of every DPLL device of the clock
+func (s *Simulator) SetLockStatus(clockId uint64, lockStatus uint32) {
+	s.changeDevices(clockId, func(d *nl.DoDeviceGetReply) { d.LockStatus = lockStatus })
+}
+
+// Lock ... the DPLL devices of the clock are locked with holdover acquired
+func (s *Simulator) Lock(clockId uint64) {
+	s.SetLockStatus(clockId, 3)
+}
+
+// Holdover ... the DPLL devices of the clock hold over
+func (s *Simulator) Holdover(clockId uint64) {
+	s.SetLockStatus(clockId, 4)
+}
+
+// SetTemperature ... temperature of the DPLL devices of the clock, celsius
+func (s *Simulator) SetTemperature(clockId uint64, celsius float64) {
+	temp := int32(math.Round(celsius * nl.DPLL_TEMP_DIVIDER))
+	s.changeDevices(clockId, func(d *nl.DoDeviceGetReply) { d.Temp = temp })
+}
+
+// SetPinParent ... relationship of the pin with its parent device parent.ParentId, the phase offset in
+// picoseconds times DPLL_PHASE_OFFSET_DIVIDER, math.MaxInt64 when not measured
+func (s *Simulator) SetPinParent(pinId uint32, parent nl.PinParentDevice) {
+	s.changePin(pinId, func(p *nl.DoPinGetReply) {
+		if pd := p.ParentDeviceById(parent.ParentId); pd != nil {
+			*pd = parent
+			return
+		}
+		p.ParentDevice = append(p.ParentDevice, parent)
+	})
+}
+
+// SetPinFFO ... fractional frequency offset of the pin, ppm
+func (s *Simulator) SetPinFFO(pinId uint32, ffo int) {
+	s.changePin(pinId, func(p *nl.DoPinGetReply) { p.FractionalFrequencyOffset = ffo })
+}
+
+// LosePin ... the signal of the input pin is lost: no phase offset is measured towards its parent devices, which
+// no longer use it
+func (s *Simulator) LosePin(pinId uint32) {
+	s.changePin(pinId, func(p *nl.DoPinGetReply) {
+		p.FractionalFrequencyOffset = 0
+		for i := range p.ParentDevice {
+			p.ParentDevice[i].PhaseOffset = math.MaxInt64
+			if p.ParentDevice[i].State == nl.DPLL_PIN_STATE_CONNECTED {
+				p.ParentDevice[i].State = nl.DPLL_PIN_STATE_SELECTABLE
+			}
+		}
+	})
+}
+
+// Overrun ... the connections that joined the monitor group overrun: queued notifications are dropped and the
+// next receive fails with ENOBUFS
+func (s *Simulator) Overrun() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sock := range s.sockets {
+		sock.overrun()
+	}
+}
+
+// Step ... change of the simulated hardware, applied After the previous step
+type Step struct {
+	After time.Duration
+	Do    func(s *Simulator)
+}
+
+// Run ... apply the steps of a scenario in order, returns once the last step is applied
+func (s *Simulator) Run(steps ...Step) {
+	for _, step := range steps {
+		time.Sleep(step.After)
+		step.Do(s)
+	}
+}
+
+// TemperatureDrift ... n steps, every interval, changing the temperature of the clock from `from` by `step` celsius
+func TemperatureDrift(clockId uint64, from, step float64, every time.Duration, n int) []Step {
+	steps := make([]Step, 0, n)
+	for i := 0; i < n; i++ {
+		temp := from + step*float64(i)
+		steps = append(steps, Step{After: every, Do: func(s *Simulator) { s.SetTemperature(clockId, temp) }})
+	}
+	return steps
+}
+
+func (s *Simulator) changeDevices(clockId uint64, change func(d *nl.DoDeviceGetReply)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range sortedIds(s.devices) {
+		if d := s.devices[id]; d.ClockId == clockId {
+			change(d)
+			s.notifyDevice(nl.DPLL_CMD_DEVICE_CHANGE_NTF, d)
+		}
+	}
+}
+
+func (s *Simulator) changePin(pinId uint32, change func(p *nl.DoPinGetReply)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.pins[pinId]; ok {
+		change(p)
+		s.notifyPin(nl.DPLL_CMD_PIN_CHANGE_NTF, p)
+	}
+}
+
+// notifyDevice ... send a device notification to the monitor group, with the simulator locked
+func (s *Simulator) notifyDevice(cmd uint8, d *nl.DoDeviceGetReply) {
+	b, err := nl.EncodeDeviceGetReply(d)
+	if err != nil {
+		panic(err)
+	}
+	s.notify(cmd, b)
+}
+
+// notifyPin ... send a pin notification to the monitor group, with the simulator locked
+func (s *Simulator) notifyPin(cmd uint8, p *nl.DoPinGetReply) {
+	b, err := nl.EncodePinGetReply(p)
+	if err != nil {
+		panic(err)
+	}
+	s.notify(cmd, b)
+}
+
+func (s *Simulator) notify(cmd uint8, data []byte) {
+	m, err := packMessage(netlink.Header{Type: FamilyID}, genetlink.Header{Command: cmd, Version: familyVersion}, data)
+	if err != nil {
+		panic(err)
+	}
+	for sock := range s.sockets {
+		sock.multicast(m)
+	}
+}
+
+// closed ... forget a closed connection
+func (s *Simulator) closed(sock *socket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sockets, sock)
+}
+
+// handle ... replies to a request, an error message carrying the errno when the request fails
+func (s *Simulator) handle(req netlink.Message) []netlink.Message {
+	var greq genetlink.Message
+	if err := greq.UnmarshalBinary(req.Data); err != nil {
+		return []netlink.Message{errorMessage(req, syscall.EINVAL)}
+	}
+	var replies [][]byte
+	var err error
+	switch {
+	case req.Header.Type == genlIdCtrl && greq.Header.Command == ctrlCmdGetFamily:
+		replies, err = getFamily(greq)
+	case req.Header.Type == FamilyID:
+		s.mu.Lock()
+		replies, err = s.execute(req, greq)
+		s.mu.Unlock()
+	default:
+		err = syscall.ENOENT
+	}
+	if err != nil {
+		return []netlink.Message{errorMessage(req, err)}
+	}
+
+	dump := req.Header.Flags&netlink.Dump == netlink.Dump
+	header := netlink.Header{Type: req.Header.Type, Sequence: req.Header.Sequence, PID: req.Header.PID}
+	if dump {
+		header.Flags = netlink.Multi
+	}
+	reply := genetlink.Header{Command: greq.Header.Command, Version: familyVersion}
+	if req.Header.Type == genlIdCtrl {
+		reply = genetlink.Header{Command: ctrlCmdNewFamily, Version: ctrlFamilyVersion}
+	}
+	msgs := make([]netlink.Message, 0, len(replies)+1)
+	for _, b := range replies {
+		m, err := packMessage(header, reply, b)
+		if err != nil {
+			return []netlink.Message{errorMessage(req, syscall.EINVAL)}
+		}
+		msgs = append(msgs, m)
+	}
+	if dump {
+		done := header
+		done.Type = netlink.Done
+		msgs = append(msgs, fixLength(netlink.Message{Header: done, Data: make([]byte, doneLen)}))
+	}
+	if req.Header.Flags&netlink.Acknowledge != 0 {
+		msgs = append(msgs, errorMessage(req, nil))
+	}
+	return msgs
+}
+
+// execute ... a request to the dpll family, with the simulator locked
+func (s *Simulator) execute(req netlink.Message, greq genetlink.Message) ([][]byte, error) {
+	dump := req.Header.Flags&netlink.Dump == netlink.Dump
+	switch greq.Header.Command {
+	case nl.DPLL_CMD_DEVICE_GET:
+		var devices []*nl.DoDeviceGetReply
+		if dump {
+			for _, id := range sortedIds(s.devices) {
+				devices = append(devices, s.devices[id])
+			}
+		} else {
+			id, err := decodeId(greq.Data, nl.DPLL_A_ID)
+			if err != nil {
+				return nil, err
+			}
+			d, ok := s.devices[id]
+			if !ok {
+				return nil, syscall.ENODEV
+			}
+			devices = append(devices, d)
+		}
+		return encodeAll(devices, nl.EncodeDeviceGetReply)
+	case nl.DPLL_CMD_PIN_GET:
+		var pins []*nl.DoPinGetReply
+		if dump {
+			for _, id := range sortedIds(s.pins) {
+				pins = append(pins, s.pins[id])
+			}
+		} else {
+			id, err := decodeId(greq.Data, nl.DPLL_A_PIN_ID)
+			if err != nil {
+				return nil, err
+			}
+			p, ok := s.pins[id]
+			if !ok {
+				return nil, syscall.ENODEV
+			}
+			pins = append(pins, p)
+		}
+		return encodeAll(pins, nl.EncodePinGetReply)
+	case nl.DPLL_CMD_DEVICE_SET:
+		return nil, s.deviceSet(greq.Data)
+	case nl.DPLL_CMD_PIN_SET:
+		return nil, s.pinSet(greq.Data)
+	}
+	return nil, syscall.EOPNOTSUPP
+}
+
+// deviceSet ... set the working mode of a device, one of its supported modes
+func (s *Simulator) deviceSet(data []byte) error {
+	ad, err := netlink.NewAttributeDecoder(data)
+	if err != nil {
+		return syscall.EINVAL
+	}
+	var id, mode uint32
+	for ad.Next() {
+		switch ad.Type() {
+		case nl.DPLL_A_ID:
+			id = ad.Uint32()
+		case nl.DPLL_A_MODE:
+			mode = ad.Uint32()
+		}
+	}
+	if ad.Err() != nil {
+		return syscall.EINVAL
+	}
+	d, ok := s.devices[id]
+	if !ok {
+		return syscall.ENODEV
+	}
+	if mode == 0 {
+		return nil
+	}
+	if !slices.Contains(d.ModeSupported, mode) {
+		return syscall.EOPNOTSUPP
+	}
+	if d.Mode != mode {
+		d.Mode = mode
+		s.notifyDevice(nl.DPLL_CMD_DEVICE_CHANGE_NTF, d)
+	}
+	return nil
+}
+
+// pinSet ... set the frequency and phase adjustment of a pin, and its priority, state and direction towards its
+// parent devices. The frequency and phase adjustment are checked against the ranges of the pin, when it has any, and
+// the pin is left unchanged when any setting is rejected.
+func (s *Simulator) pinSet(data []byte) error {
+	ad, err := netlink.NewAttributeDecoder(data)
+	if err != nil {
+		return syscall.EINVAL
+	}
+	var req nl.PinSetRequest
+	for ad.Next() {
+		switch ad.Type() {
+		case nl.DPLL_A_PIN_ID:
+			req.Id = ad.Uint32()
+		case nl.DPLL_A_PIN_FREQUENCY:
+			f := ad.Uint64()
+			req.Frequency = &f
+		case nl.DPLL_A_PIN_PHASE_ADJUST:
+			a := ad.Int32()
+			req.PhaseAdjust = &a
+		case nl.DPLL_A_PIN_PARENT_DEVICE:
+			var ctl nl.PinParentDeviceCtl
+			ad.Nested(func(ad *netlink.AttributeDecoder) error {
+				for ad.Next() {
+					v := ad.Uint32()
+					switch ad.Type() {
+					case nl.DPLL_A_PIN_PARENT_ID:
+						ctl.Id = v
+					case nl.DPLL_A_PIN_DIRECTION:
+						ctl.Direction = &v
+					case nl.DPLL_A_PIN_PRIO:
+						ctl.Prio = &v
+					case nl.DPLL_A_PIN_STATE:
+						ctl.State = &v
+					}
+				}
+				return nil
+			})
+			req.ParentDevice = append(req.ParentDevice, ctl)
+		}
+	}
+	if ad.Err() != nil {
+		return syscall.EINVAL
+	}
+	p, ok := s.pins[req.Id]
+	if !ok {
+		return syscall.ENODEV
+	}
+	pin := copyPin(p)
+	if req.Frequency != nil {
+		if fs := pin.FrequencySupported; fs != (nl.FrequencyRange{}) &&
+			(*req.Frequency < fs.FrequencyMin || *req.Frequency > fs.FrequencyMax) {
+			return syscall.EINVAL
+		}
+		pin.Frequency = *req.Frequency
+	}
+	if req.PhaseAdjust != nil {
+		if (pin.PhaseAdjustMin != 0 || pin.PhaseAdjustMax != 0) &&
+			(*req.PhaseAdjust < pin.PhaseAdjustMin || *req.PhaseAdjust > pin.PhaseAdjustMax) {
+			return syscall.EINVAL
+		}
+		pin.PhaseAdjust = *req.PhaseAdjust
+	}
+	for _, ctl := range req.ParentDevice {
+		pd := pin.ParentDeviceById(ctl.Id)
+		if pd == nil {
+			return syscall.EINVAL
+		}
+		if ctl.Prio != nil {
+			if pin.Capabilities&nl.DPLL_PIN_CAPABILITIES_PRIORITY_CAN_CHANGE == 0 {
+				return syscall.EOPNOTSUPP
+			}
+			pd.Prio = *ctl.Prio
+		}
+		if ctl.State != nil {
+			if pin.Capabilities&nl.DPLL_PIN_CAPABILITIES_STATE_CAN_CHANGE == 0 {
+				return syscall.EOPNOTSUPP
+			}
+			pd.State = *ctl.State
+		}
+		if ctl.Direction != nil {
+			if pin.Capabilities&nl.DPLL_PIN_CAPABILITIES_DIRECTION_CAN_CHANGE == 0 {
+				return syscall.EOPNOTSUPP
+			}
+			pd.Direction = *ctl.Direction
+		}
+	}
+	s.pins[pin.Id] = pin
+	s.notifyPin(nl.DPLL_CMD_PIN_CHANGE_NTF, pin)
+	return nil
+}
+
+func decodeId(data []byte, attr uint16) (uint32, error) {
+	ad, err := netlink.NewAttributeDecoder(data)
+	if err != nil {
+		return 0, syscall.EINVAL
+	}
+	for ad.Next() {
+		if ad.Type() == attr {
+			return ad.Uint32(), nil
+		}
+	}
+	return 0, syscall.EINVAL
+}
+
+func encodeAll[T any](replies []*T, encode func(*T) ([]byte, error)) ([][]byte, error) {
+	b := make([][]byte, 0, len(replies))
+	for _, r := range replies {
+		data, err := encode(r)
+		if err != nil {
+			return nil, syscall.EINVAL
+		}
+		b = append(b, data)
+	}
+	return b, nil
+}
+
+func sortedIds[T any](m map[uint32]T) []uint32 {
+	ids := make([]uint32, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func copyDevice(d *nl.DoDeviceGetReply) *nl.DoDeviceGetReply {
+	c := *d
+	c.ModeSupported = slices.Clone(d.ModeSupported)
+	return &c
+}
+
+func copyPin(p *nl.DoPinGetReply) *nl.DoPinGetReply {
+	c := *p
+	c.ParentDevice = slices.Clone(p.ParentDevice)
+	c.ParentPin = slices.Clone(p.ParentPin)
+	return &c
+}
@@ -0,0 +1,170 @@
+package dplltest_test
+
+import (
+	"errors"
+	"math"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mdlayher/genetlink"
+	nl "github.com/openshift/linuxptp-daemon/pkg/dpll-netlink"
+	"github.com/openshift/linuxptp-daemon/pkg/dpll-netlink/dplltest"
+	"github.com/stretchr/testify/assert"
+)
+
+const clockId uint64 = 0x507c6fffff1fb1b8
+
+func simulator(t *testing.T) *dplltest.Simulator {
+	sim := dplltest.New()
+	nl.SetDialer(sim.Dial)
+	t.Cleanup(func() { nl.SetDialer(nil) })
+	sim.AddDevice(nl.DoDeviceGetReply{Id: 1, ClockId: clockId, Type: 2, LockStatus: 3, Mode: nl.DPLL_MODE_AUTOMATIC,
+		ModeSupported: []uint32{nl.DPLL_MODE_AUTOMATIC}})
+	sim.AddDevice(nl.DoDeviceGetReply{Id: 0, ClockId: clockId, Type: 1, LockStatus: 3, Mode: nl.DPLL_MODE_AUTOMATIC,
+		ModeSupported: []uint32{nl.DPLL_MODE_MANUAL, nl.DPLL_MODE_AUTOMATIC}})
+	sim.AddPin(nl.DoPinGetReply{Id: 3, ClockId: clockId, BoardLabel: "GNSS-1PPS", Frequency: 1,
+		Capabilities:   nl.DPLL_PIN_CAPABILITIES_PRIORITY_CAN_CHANGE | nl.DPLL_PIN_CAPABILITIES_STATE_CAN_CHANGE,
+		PhaseAdjustMin: -16723, PhaseAdjustMax: 16723,
+		ParentDevice: []nl.PinParentDevice{
+			{ParentId: 0, Direction: nl.DPLL_PIN_DIRECTION_INPUT, State: nl.DPLL_PIN_STATE_CONNECTED, PhaseOffset: 0},
+			{ParentId: 1, Direction: nl.DPLL_PIN_DIRECTION_INPUT, State: nl.DPLL_PIN_STATE_CONNECTED, PhaseOffset: 1200},
+		}})
+	return sim
+}
+
+func TestSimulator_Get(t *testing.T) {
+	sim := simulator(t)
+	conn, err := nl.Dial(nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+	id, found := conn.GetMcastGroupId("monitor")
+	assert.True(t, found)
+	assert.Equal(t, uint32(dplltest.MonitorGroupID), id)
+
+	devices, err := conn.DumpDeviceGet()
+	assert.NoError(t, err)
+	if assert.Len(t, devices, 2) {
+		assert.Equal(t, uint32(0), devices[0].Id)
+		assert.Equal(t, []uint32{nl.DPLL_MODE_MANUAL, nl.DPLL_MODE_AUTOMATIC}, devices[0].ModeSupported)
+		assert.Equal(t, uint32(1), devices[1].Id)
+	}
+	device, err := conn.DoDeviceGet(nl.DoDeviceGetRequest{Id: 1})
+	assert.NoError(t, err)
+	want, _ := sim.Device(1)
+	assert.Equal(t, &want, device)
+
+	pins, err := conn.DumpPinGet()
+	assert.NoError(t, err)
+	pin, _ := sim.Pin(3)
+	assert.Equal(t, []*nl.DoPinGetReply{&pin}, pins)
+
+	_, err = conn.DoPinGet(nl.DoPinGetRequest{Id: 4})
+	assert.True(t, errors.Is(err, syscall.ENODEV), "%v", err)
+}
+
+func TestSimulator_Set(t *testing.T) {
+	sim := simulator(t)
+	conn, err := nl.Dial(nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	assert.NoError(t, conn.DeviceSet(nl.DeviceSetRequest{Id: 0, Mode: nl.DPLL_MODE_MANUAL}))
+	device, _ := sim.Device(0)
+	assert.Equal(t, uint32(nl.DPLL_MODE_MANUAL), device.Mode)
+	err = conn.DeviceSet(nl.DeviceSetRequest{Id: 1, Mode: nl.DPLL_MODE_MANUAL})
+	assert.True(t, errors.Is(err, syscall.EOPNOTSUPP), "%v", err)
+
+	adjust, prio := int32(6999), uint32(2)
+	assert.NoError(t, conn.PinSet(nl.PinSetRequest{Id: 3, PhaseAdjust: &adjust,
+		ParentDevice: []nl.PinParentDeviceCtl{{Id: 1, Prio: &prio}}}))
+	pin, _ := sim.Pin(3)
+	assert.Equal(t, adjust, pin.PhaseAdjust)
+	assert.Equal(t, prio, pin.ParentDeviceById(1).Prio)
+
+	// out of range, the pin is left unchanged
+	adjust, prio = 20000, 0
+	err = conn.PinSet(nl.PinSetRequest{Id: 3, PhaseAdjust: &adjust,
+		ParentDevice: []nl.PinParentDeviceCtl{{Id: 1, Prio: &prio}}})
+	assert.True(t, errors.Is(err, syscall.EINVAL), "%v", err)
+	pin, _ = sim.Pin(3)
+	assert.Equal(t, int32(6999), pin.PhaseAdjust)
+	assert.Equal(t, uint32(2), pin.ParentDeviceById(1).Prio)
+
+	// the direction cannot change
+	direction := uint32(nl.DPLL_PIN_DIRECTION_OUTPUT)
+	err = conn.PinSet(nl.PinSetRequest{Id: 3, ParentDevice: []nl.PinParentDeviceCtl{{Id: 1, Direction: &direction}}})
+	assert.True(t, errors.Is(err, syscall.EOPNOTSUPP), "%v", err)
+
+	// the phase adjust request is not acknowledged, the next request is unaffected
+	assert.NoError(t, conn.PinPhaseAdjust(nl.PinPhaseAdjustRequest{Id: 3, PhaseAdjust: -500}))
+	got, err := conn.DoPinGet(nl.DoPinGetRequest{Id: 3})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(-500), got.PhaseAdjust)
+	}
+}
+
+func receive(t *testing.T, c *genetlink.Conn) ([]genetlink.Message, error) {
+	type result struct {
+		msgs []genetlink.Message
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		msgs, _, err := c.Receive()
+		ch <- result{msgs, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.msgs, r.err
+	case <-time.After(time.Second):
+		t.Fatal("no notification")
+	}
+	return nil, nil
+}
+
+func TestSimulator_Notifications(t *testing.T) {
+	sim := simulator(t)
+	conn, err := nl.Dial(nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+	c := conn.GetGenetlinkConn()
+	assert.NoError(t, c.JoinGroup(dplltest.MonitorGroupID))
+
+	sim.Holdover(clockId)
+	for _, id := range []uint32{0, 1} {
+		msgs, err := receive(t, c)
+		assert.NoError(t, err)
+		devices, err := nl.ParseDeviceReplies(msgs)
+		assert.NoError(t, err)
+		if assert.Len(t, devices, 1) {
+			assert.Equal(t, uint32(nl.DPLL_CMD_DEVICE_CHANGE_NTF), uint32(msgs[0].Header.Command))
+			assert.Equal(t, id, devices[0].Id)
+			assert.Equal(t, uint32(4), devices[0].LockStatus)
+		}
+	}
+
+	sim.LosePin(3)
+	msgs, err := receive(t, c)
+	assert.NoError(t, err)
+	pins, err := nl.ParsePinReplies(msgs)
+	assert.NoError(t, err)
+	if assert.Len(t, pins, 1) {
+		for _, pd := range pins[0].ParentDevice {
+			assert.Equal(t, int64(math.MaxInt64), pd.PhaseOffset)
+			assert.Equal(t, uint32(nl.DPLL_PIN_STATE_SELECTABLE), pd.State)
+		}
+	}
+
+	sim.Run(dplltest.TemperatureDrift(clockId, 40, 0.5, time.Millisecond, 3)...)
+	sim.Overrun()
+	_, err = receive(t, c)
+	assert.True(t, errors.Is(err, syscall.ENOBUFS), "%v", err)
+
+	sim.RemovePin(3)
+	msgs, err = receive(t, c)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(nl.DPLL_CMD_PIN_DELETE_NTF), uint32(msgs[0].Header.Command))
+	device, _ := sim.Device(0)
+	assert.Equal(t, int32(41000), device.Temp)
+}
@@ -0,0 +1,243 @@
+package dplltest
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+)
+
+// Generic netlink controller, see linux/genetlink.h
+const (
+	genlIdCtrl             = 0x10
+	ctrlCmdNewFamily       = 1
+	ctrlCmdGetFamily       = 3
+	ctrlAttrFamilyId       = 1
+	ctrlAttrFamilyName     = 2
+	ctrlAttrVersion        = 3
+	ctrlAttrMcastGroups    = 7
+	ctrlAttrMcastGroupName = 1
+	ctrlAttrMcastGroupId   = 2
+	nlmsgHeaderLen         = 16
+	ctrlFamilyVersion      = 2
+	familyName             = "dpll"
+	monitorGroupName       = "monitor"
+	errnoLen               = 4
+	doneLen                = 4
+	maxQueuedNotifications = 1024
+)
+
+// socket ... netlink socket of a connection to the simulator. Replies to the requests sent on the socket are received
+// before the notifications of the monitor group, which are received one at a time like the kernel does.
+type socket struct {
+	sim    *Simulator
+	pid    uint32
+	wake   chan struct{}
+	closed chan struct{}
+
+	mu            sync.Mutex
+	replies       [][]netlink.Message
+	notifications []netlink.Message
+	joined        bool
+	overran       bool
+	closeOnce     sync.Once
+}
+
+// Send ... handle a request
+func (s *socket) Send(m netlink.Message) error {
+	return s.SendMessages([]netlink.Message{m})
+}
+
+// SendMessages ... handle requests, their replies are received in a single batch
+func (s *socket) SendMessages(msgs []netlink.Message) error {
+	select {
+	case <-s.closed:
+		return net.ErrClosed
+	default:
+	}
+	var replies []netlink.Message
+	for _, m := range msgs {
+		replies = append(replies, s.sim.handle(m)...)
+	}
+	if len(replies) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	s.replies = append(s.replies, replies)
+	s.mu.Unlock()
+	s.signal()
+	return nil
+}
+
+// Receive ... the next replies, or the next notification, blocks until there is one or the socket is closed
+func (s *socket) Receive() ([]netlink.Message, error) {
+	for {
+		select {
+		case <-s.closed:
+			return nil, net.ErrClosed
+		default:
+		}
+		s.mu.Lock()
+		switch {
+		case len(s.replies) > 0:
+			msgs := s.replies[0]
+			s.replies = s.replies[1:]
+			s.mu.Unlock()
+			return msgs, nil
+		case s.overran:
+			s.overran = false
+			s.mu.Unlock()
+			return nil, syscall.ENOBUFS
+		case len(s.notifications) > 0:
+			m := s.notifications[0]
+			s.notifications = s.notifications[1:]
+			s.mu.Unlock()
+			return []netlink.Message{m}, nil
+		}
+		s.mu.Unlock()
+		select {
+		case <-s.wake:
+		case <-s.closed:
+		}
+	}
+}
+
+// Close ... unblock Receive
+func (s *socket) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.sim.closed(s)
+	})
+	return nil
+}
+
+// JoinGroup ... receive the notifications of the monitor group
+func (s *socket) JoinGroup(group uint32) error {
+	if group != MonitorGroupID {
+		return syscall.EINVAL
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.joined = true
+	return nil
+}
+
+// LeaveGroup ... stop receiving the notifications of the monitor group
+func (s *socket) LeaveGroup(group uint32) error {
+	if group != MonitorGroupID {
+		return syscall.EINVAL
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.joined = false
+	s.notifications = nil
+	return nil
+}
+
+// multicast ... queue a notification when the socket joined the monitor group. A socket not reading its
+// notifications overruns.
+func (s *socket) multicast(m netlink.Message) {
+	s.mu.Lock()
+	if !s.joined {
+		s.mu.Unlock()
+		return
+	}
+	if len(s.notifications) < maxQueuedNotifications {
+		s.notifications = append(s.notifications, m)
+	} else {
+		s.notifications, s.overran = nil, true
+	}
+	s.mu.Unlock()
+	s.signal()
+}
+
+// overrun ... drop the queued notifications, the next Receive fails with ENOBUFS
+func (s *socket) overrun() {
+	s.mu.Lock()
+	if !s.joined {
+		s.mu.Unlock()
+		return
+	}
+	s.notifications, s.overran = nil, true
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *socket) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// getFamily ... reply of the generic netlink controller to the request of a family by name
+func getFamily(greq genetlink.Message) ([][]byte, error) {
+	ad, err := netlink.NewAttributeDecoder(greq.Data)
+	if err != nil {
+		return nil, syscall.EINVAL
+	}
+	var name string
+	for ad.Next() {
+		if ad.Type() == ctrlAttrFamilyName {
+			name = ad.String()
+		}
+	}
+	if name != familyName {
+		return nil, syscall.ENOENT
+	}
+	ae := netlink.NewAttributeEncoder()
+	ae.Uint16(ctrlAttrFamilyId, FamilyID)
+	ae.String(ctrlAttrFamilyName, familyName)
+	ae.Uint32(ctrlAttrVersion, familyVersion)
+	ae.Nested(ctrlAttrMcastGroups, func(ae *netlink.AttributeEncoder) error {
+		// Groups are an array of nested attributes
+		ae.Nested(0, func(ae *netlink.AttributeEncoder) error {
+			ae.String(ctrlAttrMcastGroupName, monitorGroupName)
+			ae.Uint32(ctrlAttrMcastGroupId, MonitorGroupID)
+			return nil
+		})
+		return nil
+	})
+	b, err := ae.Encode()
+	if err != nil {
+		return nil, syscall.EINVAL
+	}
+	return [][]byte{b}, nil
+}
+
+// packMessage ... netlink message carrying a generic netlink message
+func packMessage(header netlink.Header, gheader genetlink.Header, data []byte) (netlink.Message, error) {
+	b, err := genetlink.Message{Header: gheader, Data: data}.MarshalBinary()
+	if err != nil {
+		return netlink.Message{}, err
+	}
+	return fixLength(netlink.Message{Header: header, Data: b}), nil
+}
+
+// errorMessage ... error message of a failed request, or its acknowledgement when err is nil
+func errorMessage(req netlink.Message, err error) netlink.Message {
+	var errno syscall.Errno
+	if err != nil && !errors.As(err, &errno) {
+		errno = syscall.EINVAL
+	}
+	b := make([]byte, errnoLen+nlmsgHeaderLen)
+	nlenc.PutInt32(b[0:4], -int32(errno))
+	nlenc.PutUint32(b[4:8], req.Header.Length)
+	nlenc.PutUint16(b[8:10], uint16(req.Header.Type))
+	nlenc.PutUint16(b[10:12], uint16(req.Header.Flags))
+	nlenc.PutUint32(b[12:16], req.Header.Sequence)
+	nlenc.PutUint32(b[16:20], req.Header.PID)
+	return fixLength(netlink.Message{
+		Header: netlink.Header{Type: netlink.Error, Sequence: req.Header.Sequence, PID: req.Header.PID},
+		Data:   b,
+	})
+}
+
+func fixLength(m netlink.Message) netlink.Message {
+	m.Header.Length = uint32(nlmsgHeaderLen + len(m.Data))
+	return m
+}
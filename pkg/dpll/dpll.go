@@ -1,23 +1,20 @@
 package dpll
 
 import (
-	"context"
 	"fmt"
 	ptpv1 "github.com/openshift/ptp-operator/api/v1"
 	"math"
 	"net"
-	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/golang/glog"
-	"github.com/mdlayher/genetlink"
 	"github.com/openshift/linuxptp-daemon/pkg/config"
 	nl "github.com/openshift/linuxptp-daemon/pkg/dpll-netlink"
 	"github.com/openshift/linuxptp-daemon/pkg/event"
-	"golang.org/x/sync/semaphore"
 )
 
 const (
@@ -84,7 +81,9 @@ func (d *DependingStates) UpdateState(source event.EventSource) {
 	d.currentState = lowestState
 }
 
-// DpllConfig ... DPLL configuration
+// DpllConfig ... DPLL configuration. The embedded mutex guards the fields changing once the DPLL is created: the
+// netlink monitor, the sysfs poller, the holdover timer and the GNSS subscriber update them under it. Netlink
+// requests, event delivery and the handlers run without it.
 type DpllConfig struct {
 	LocalMaxHoldoverOffSet uint64
 	LocalHoldoverTimeout   uint64
@@ -101,11 +100,9 @@ type DpllConfig struct {
 	processConfig          config.ProcessConfig
 	dependsOn              []event.EventSource
 	exitCh                 chan struct{}
-	holdoverCloseCh        chan bool
+	holdoverCloseCh        chan HoldoverTrigger // closes the running holdover, nil once closed
 	ticker                 *time.Ticker
 	apiType                dpllApiType
-	// DPLL netlink connection pointer. If 'nil', use sysfs
-	conn *nl.Conn
 	// We need to keep latest DPLL status values, since Netlink device
 	// change indications don't contain all the status fields, but
 	// only the changed one(s)
@@ -117,61 +114,130 @@ type DpllConfig struct {
 	// is driver-specific and vendor-specific.
 	clockId uint64
 	sync.Mutex
+	// eventLock ... orders the state updates sending an event with their delivery, taken before the mutex
+	eventLock            sync.Mutex
 	isMonitoring         bool
 	subscriber           []*DpllSubscriber
 	phaseOffsetPinFilter map[string]map[string]string
+	pinPriorities        []string          // input pin labels by descending priority
+	deviceIds            []uint32          // DPLL devices of the clock
+	deviceTypes          map[uint32]uint32 // type of the DPLL devices of the clock, by device id
+	mode                 uint32            // declared working mode, 0 for the driver default
+	deviceModes          map[uint32]DeviceMode
+	onModeChange         func()
+	onReport             ReportHandler
+	onRemove             ReportHandler
+	pins                 map[uint32]*nl.DoPinGetReply // latest pin reports of the clock, by pin id
+	selectedPin          uint32                       // input pin connected in manual mode
+	model                *OscillatorModel             // oscillator frequency learned while locked
+	temperature          float64                      // latest DPLL temperature, celsius
+	hasTemperature       bool
+	ts2phcLocked         bool        // ts2phc locked the interface to its 1PPS
+	ts2phcLost           bool        // ts2phc lost the 1PPS of the interface after it locked
+	ts2phcTimer          *time.Timer // extts timeout of the interface
+	// connLock ... guards conn, taken without the mutex
+	connLock sync.Mutex
+	conn     *nl.Conn // netlink connection of the device and pin requests, nil until the first one
 }
 
 func (d *DpllConfig) InSpec() bool {
+	d.Lock()
+	defer d.Unlock()
 	return d.inSpec
 }
 
 // DependsOn ...  depends on other events
 func (d *DpllConfig) DependsOn() []event.EventSource {
+	d.Lock()
+	defer d.Unlock()
 	return d.dependsOn
 }
 
 // SetDependsOn ... set depends on ..
 func (d *DpllConfig) SetDependsOn(dependsOn []event.EventSource) {
+	d.Lock()
+	defer d.Unlock()
 	d.dependsOn = dependsOn
 }
 
 // State ... get dpll state
 func (d *DpllConfig) State() event.PTPState {
+	d.Lock()
+	defer d.Unlock()
 	return d.state
 }
 
+// APIType ... API the DPLL is monitored through
+func (d *DpllConfig) APIType() dpllApiType {
+	d.Lock()
+	defer d.Unlock()
+	return d.apiType
+}
+
 // SetPhaseOffset ...  set phaseOffset
 // Measured phase offset values are fractional with 3-digit decimal places and shall be
 // divided by DPLL_PIN_PHASE_OFFSET_DIVIDER to get integer part
 // The units are picoseconds.
 // We further divide it by 1000 to report nanoseconds
 func (d *DpllConfig) SetPhaseOffset(phaseOffset int64) {
+	d.Lock()
+	defer d.Unlock()
+	d.setPhaseOffset(phaseOffset)
+}
+
+func (d *DpllConfig) setPhaseOffset(phaseOffset int64) {
 	d.phaseOffset = int64(math.Round(float64(phaseOffset / nl.DPLL_PHASE_OFFSET_DIVIDER / 1000)))
 }
 
 // SourceLost ... get source status
 func (d *DpllConfig) SourceLost() bool {
+	d.Lock()
+	defer d.Unlock()
 	return d.sourceLost
 }
 
 // SetSourceLost ... set source status
 func (d *DpllConfig) SetSourceLost(sourceLost bool) {
+	d.Lock()
+	defer d.Unlock()
 	d.sourceLost = sourceLost
 }
 
+// ClockId ... get clock id of the DPLL
+func (d *DpllConfig) ClockId() uint64 {
+	return d.clockId
+}
+
+// Iface ... get the interface the DPLL is associated with
+func (d *DpllConfig) Iface() string {
+	return d.iface
+}
+
+// OnHoldover ... is holdover timer running
+func (d *DpllConfig) OnHoldover() bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.onHoldover
+}
+
 // PhaseOffset ... get phase offset
 func (d *DpllConfig) PhaseOffset() int64 {
+	d.Lock()
+	defer d.Unlock()
 	return d.phaseOffset
 }
 
 // FrequencyStatus ... get frequency status
 func (d *DpllConfig) FrequencyStatus() int64 {
+	d.Lock()
+	defer d.Unlock()
 	return d.frequencyStatus
 }
 
 // PhaseStatus get phase status
 func (d *DpllConfig) PhaseStatus() int64 {
+	d.Lock()
+	defer d.Unlock()
 	return d.phaseStatus
 }
 
@@ -192,28 +258,31 @@ func (s DpllSubscriber) ID() string {
 
 // Notify ... event notification
 func (s DpllSubscriber) Notify(source event.EventSource, state event.PTPState) {
-	if s.dpll == nil || !s.dpll.isMonitoring {
-		glog.Errorf("dpll subscriber %s is not initialized (monitoring state %t)", s.source, s.dpll.isMonitoring)
+	if s.dpll == nil || !s.dpll.monitoring() {
+		glog.Errorf("dpll subscriber %s is not initialized or not monitoring", s.source)
 		return
 	}
+	// the state map is shared by the DPLLs of the node, the pin selection and the decision run outside its lock
 	dependingProcessStateMap.Lock()
-	defer dependingProcessStateMap.Unlock()
 	currentState := dependingProcessStateMap.states[source]
-	if currentState != state {
-		glog.Infof("%s notified on state change: from state %v to state %v", source, currentState, state)
-		dependingProcessStateMap.states[source] = state
-		if source == event.GNSS {
-			if state == event.PTP_LOCKED {
-				s.dpll.sourceLost = false
-			} else {
-				s.dpll.sourceLost = true
-			}
-			glog.Infof("sourceLost %v", s.dpll.sourceLost)
-		}
-		s.dpll.stateDecision()
-		glog.Infof("%s notified on state change: state %v", source, state)
-		dependingProcessStateMap.UpdateState(source)
+	if currentState == state {
+		dependingProcessStateMap.Unlock()
+		return
+	}
+	glog.Infof("%s notified on state change: from state %v to state %v", source, currentState, state)
+	dependingProcessStateMap.states[source] = state
+	dependingProcessStateMap.UpdateState(source)
+	dependingProcessStateMap.Unlock()
+
+	if source == event.GNSS {
+		s.dpll.Lock()
+		s.dpll.sourceLost = state != event.PTP_LOCKED
+		glog.Infof("sourceLost %v", s.dpll.sourceLost)
+		s.dpll.Unlock()
+		s.dpll.selectInputPin()
 	}
+	s.dpll.decide()
+	glog.Infof("%s notified on state change: state %v", source, state)
 }
 
 // Name ... name of the process
@@ -232,7 +301,7 @@ func (d *DpllConfig) ExitCh() chan struct{} {
 	return d.exitCh
 }
 
-// ExitCh ... exit channel
+// hasGNSSAsSource ... the DPLL follows the GNSS, called with d locked
 func (d *DpllConfig) hasGNSSAsSource() bool {
 	if d.dependsOn[0] == event.GNSS {
 		return true
@@ -240,7 +309,7 @@ func (d *DpllConfig) hasGNSSAsSource() bool {
 	return false
 }
 
-// ExitCh ... exit channel
+// hasPPSAsSource ... the DPLL follows a 1PPS input, called with d locked
 func (d *DpllConfig) hasPPSAsSource() bool {
 	if d.dependsOn[0] == event.PPS {
 		return true
@@ -254,6 +323,18 @@ func (d *DpllConfig) CmdStop() {
 	d.ticker.Stop()
 	glog.Infof("Ticker stopped %s", d.Name())
 	close(d.exitCh) // terminate loop
+	d.Lock()
+	apiType := d.apiType
+	if d.ts2phcTimer != nil {
+		d.ts2phcTimer.Stop()
+	}
+	d.Unlock()
+	if apiType == NETLINK {
+		// no notification reaches d once CmdStop returns, the monitor goroutine unsubscribes again
+		sharedMonitor.Unsubscribe(d.clockId, d)
+	}
+	d.closeConn()
+	d.saveModel()
 	glog.Infof("Process %s terminated", d.Name())
 }
 
@@ -276,8 +357,11 @@ func (d *DpllConfig) CmdRun(stdToSocket bool) {
 }
 
 func (d *DpllConfig) unRegisterAll() {
+	d.Lock()
+	subscribers := d.subscriber
+	d.Unlock()
 	// register to event notification from other processes
-	for _, s := range d.subscriber {
+	for _, s := range subscribers {
 		event.StateRegisterer.Unregister(s)
 	}
 }
@@ -309,6 +393,7 @@ func NewDpll(clockId uint64, localMaxHoldoverOffSet, localHoldoverTimeout, maxIn
 		phaseOffset:          FaultyPhaseOffset,
 	}
 
+	d.loadModel()
 	// time to reach maxnInSpecOffset
 	d.timer = int64(math.Round(float64(d.MaxInSpecOffset) / d.slope))
 	glog.Infof("slope %f ns/s, in spec offset %f ns, in spec timer %d /sec Max timer %d /s",
@@ -323,8 +408,16 @@ func (d *DpllConfig) Timer() int64 {
 	return d.timer
 }
 
+// PhaseOffsetPin ... true when the pin of the clock passes the phase offset pin filter and has a phase offset
+// measured towards a DPLL device of the clock
 func (d *DpllConfig) PhaseOffsetPin(pin *nl.DoPinGetReply) bool {
-	if pin.ClockId == d.clockId && pin.ParentDevice.PhaseOffset != math.MaxInt64 {
+	d.Lock()
+	defer d.Unlock()
+	return d.phaseOffsetPin(pin)
+}
+
+func (d *DpllConfig) phaseOffsetPin(pin *nl.DoPinGetReply) bool {
+	if pin.ClockId == d.clockId && d.phaseOffsetParent(pin) != nil {
 		for k, v := range d.phaseOffsetPinFilter[strconv.FormatUint(d.clockId, 10)] {
 			switch k {
 			case "boardLabel":
@@ -344,12 +437,40 @@ func (d *DpllConfig) PhaseOffsetPin(pin *nl.DoPinGetReply) bool {
 	return false
 }
 
-// nlUpdateState updates DPLL state in the DpllConfig structure.
+// phaseOffsetParent ... the parent device relationship of the pin carrying its phase offset: towards the PPS DPLL
+// of the clock, or the first one measuring a phase offset while the PPS DPLL is not known yet
+func (d *DpllConfig) phaseOffsetParent(pin *nl.DoPinGetReply) *nl.PinParentDevice {
+	if id, ok := d.ppsDevice(); ok {
+		if pd := pin.ParentDeviceById(id); pd != nil && pd.PhaseOffset != math.MaxInt64 {
+			return pd
+		}
+		return nil
+	}
+	for i := range pin.ParentDevice {
+		if pin.ParentDevice[i].PhaseOffset != math.MaxInt64 {
+			return &pin.ParentDevice[i]
+		}
+	}
+	return nil
+}
+
+// ppsDevice ... id of the PPS DPLL device of the clock
+func (d *DpllConfig) ppsDevice() (uint32, bool) {
+	for id, typ := range d.deviceTypes {
+		if nl.GetDpllType(typ) == "pps" {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// nlUpdateState updates DPLL state in the DpllConfig structure, called with d locked.
 func (d *DpllConfig) nlUpdateState(devices []*nl.DoDeviceGetReply, pins []*nl.DoPinGetReply) bool {
 	valid := false
 
 	for _, reply := range devices {
 		if reply.ClockId == d.clockId {
+			d.addDevice(reply.Id, reply.Type)
 			if reply.LockStatus == DPLL_INVALID {
 				glog.Info("discarding on invalid lock status: ", nl.GetDpllStatusHR(reply))
 				continue
@@ -368,8 +489,8 @@ func (d *DpllConfig) nlUpdateState(devices []*nl.DoDeviceGetReply, pins []*nl.Do
 		}
 	}
 	for _, pin := range pins {
-		if d.PhaseOffsetPin(pin) {
-			d.SetPhaseOffset(pin.ParentDevice.PhaseOffset)
+		if d.phaseOffsetPin(pin) {
+			d.setPhaseOffset(d.phaseOffsetParent(pin).PhaseOffset)
 			glog.Info("setting phase offset to ", d.phaseOffset, " ns for clock id ", d.clockId)
 			valid = true
 		}
@@ -377,56 +498,53 @@ func (d *DpllConfig) nlUpdateState(devices []*nl.DoDeviceGetReply, pins []*nl.Do
 	return valid
 }
 
-// monitorNtf receives a multicast unsolicited notification and
-// calls dpll state updating function.
-func (d *DpllConfig) monitorNtf(c *genetlink.Conn) {
-	for {
-		msgs, _, err := c.Receive()
-		if err != nil {
-			if err.Error() == "netlink receive: use of closed file" {
-				glog.Infof("netlink connection has been closed - stop monitoring for %s", d.iface)
-			} else {
-				glog.Error(err)
-			}
-			return
-		}
-		devices, pins := []*nl.DoDeviceGetReply{}, []*nl.DoPinGetReply{}
-		for _, msg := range msgs {
-			devices, pins = []*nl.DoDeviceGetReply{}, []*nl.DoPinGetReply{}
-			switch msg.Header.Command {
-			case nl.DPLL_CMD_DEVICE_CHANGE_NTF:
-				devices, err = nl.ParseDeviceReplies([]genetlink.Message{msg})
-				if err != nil {
-					glog.Error(err)
-					return
-				}
-			case nl.DPLL_CMD_PIN_CHANGE_NTF:
-				pins, err = nl.ParsePinReplies([]genetlink.Message{msg})
-				if err != nil {
-					glog.Error(err)
-					return
-				}
-			default:
-				glog.Info("unhandled dpll message", msg.Header.Command, msg.Data)
-
-			}
+// DpllChanged ... device and pin reports of the clock from the DPLL netlink monitor
+func (d *DpllConfig) DpllChanged(devices []*nl.DoDeviceGetReply, pins []*nl.DoPinGetReply) {
+	d.Lock()
+	valid := d.nlUpdateState(devices, pins)
+	d.learnTemperature(devices)
+	d.updatePins(pins)
+	d.Unlock()
+	if len(devices) > 0 {
+		d.enforceMode(devices)
+	}
+	if len(pins) > 0 {
+		// a driver reset restores the default pin priorities
+		d.enforcePinPriorities(pins)
+		d.selectInputPin()
+	}
+	d.update(func() (event.EventChannel, bool) {
+		if len(pins) > 0 && d.hasPPSAsSource() && d.ppsSourceLost() != d.sourceLost {
+			valid = true // the PPS input came or went
 		}
-		if d.nlUpdateState(devices, pins) {
-			d.stateDecision()
+		if !valid {
+			return event.EventChannel{}, false
 		}
-	}
+		return d.stateDecision()
+	})
+	d.report(devices, pins)
 }
 
-// checks whether sysfs file structure exists for dpll associated with the interface
-func (d *DpllConfig) isSysFsPresent() bool {
-	path := fmt.Sprintf("/sys/class/net/%s/device/dpll_0_state", d.iface)
-	if _, err := os.Stat(path); err == nil {
-		return true
+// DpllDeleted ... devices and pins of the clock removed by the driver
+func (d *DpllConfig) DpllDeleted(devices []*nl.DoDeviceGetReply, pins []*nl.DoPinGetReply) {
+	d.Lock()
+	for _, device := range devices {
+		glog.Infof("%s: dpll device %d removed", d.iface, device.Id)
+		d.deviceIds = slices.DeleteFunc(d.deviceIds, func(id uint32) bool { return id == device.Id })
+		delete(d.deviceTypes, device.Id)
+		delete(d.deviceModes, device.Id)
 	}
-	return false
+	for _, pin := range pins {
+		delete(d.pins, pin.Id)
+		if d.selectedPin == pin.Id {
+			d.selectedPin = 0
+		}
+	}
+	d.Unlock()
+	d.removed(devices, pins)
 }
 
-// MonitorDpllSysfs monitors DPLL through sysfs
+// isNetLinkPresent ... the kernel has the DPLL netlink family
 func (d *DpllConfig) isNetLinkPresent() bool {
 	conn, err := nl.Dial(nil)
 	if err != nil {
@@ -437,150 +555,60 @@ func (d *DpllConfig) isNetLinkPresent() bool {
 	return true
 }
 
-// setAPIType
+// setAPIType ... netlink when the kernel has the DPLL netlink family, else the sysfs files of the out-of-tree ice driver
 func (d *DpllConfig) setAPIType() {
-	if d.isSysFsPresent() {
-		d.apiType = SYSFS
-	} else if d.isNetLinkPresent() {
-		d.apiType = NETLINK
-	} else {
-		d.apiType = NONE
+	apiType := NONE
+	if d.isNetLinkPresent() {
+		apiType = NETLINK
+	} else if d.isSysFsPresent() {
+		apiType = SYSFS
 	}
+	d.Lock()
+	d.apiType = apiType
+	d.Unlock()
 }
 
 func (d *DpllConfig) MonitorDpllMock() {
 	glog.Info("starting dpll mock monitoring")
 
-	if d.nlUpdateState([]*nl.DoDeviceGetReply{<-MockDpllReplies}, []*nl.DoPinGetReply{}) {
-		d.stateDecision()
-	}
+	reply := <-MockDpllReplies
+	d.update(func() (event.EventChannel, bool) {
+		if d.nlUpdateState([]*nl.DoDeviceGetReply{reply}, []*nl.DoPinGetReply{}) {
+			return d.stateDecision()
+		}
+		return event.EventChannel{}, false
+	})
 
 	glog.Infof("closing dpll mock ")
 }
 
-// MonitorDpllNetlink monitors DPLL through netlink
+// MonitorDpllNetlink monitors DPLL through the netlink monitor shared by the interfaces
 func (d *DpllConfig) MonitorDpllNetlink() {
-	redial := true
-	var replies []*nl.DoDeviceGetReply
-	var err error
-	var sem *semaphore.Weighted
-	for {
-		if redial {
-			if d.conn == nil {
-				if conn, err2 := nl.Dial(nil); err2 != nil {
-					d.conn = nil
-					glog.Infof("failed to establish dpll netlink connection (%s): %s", d.iface, err2)
-					goto checkExit
-				} else {
-					d.conn = conn
-				}
-			}
-
-			c := d.conn.GetGenetlinkConn()
-			mcastId, found := d.conn.GetMcastGroupId(nl.DPLL_MCGRP_MONITOR)
-			if !found {
-				glog.Warning("multicast ID ", nl.DPLL_MCGRP_MONITOR, " not found")
-				goto abort
-			}
-
-			replies, err = d.conn.DumpDeviceGet()
-			if err != nil {
-				goto abort
-			}
-
-			if d.nlUpdateState(replies, []*nl.DoPinGetReply{}) {
-				d.stateDecision()
-			}
-
-			err = c.JoinGroup(mcastId)
-			if err != nil {
-				goto abort
-			}
-
-			sem = semaphore.NewWeighted(1)
-			err = sem.Acquire(context.Background(), 1)
-			if err != nil {
-				goto abort
-			}
-
-			go func() {
-				defer sem.Release(1)
-				d.monitorNtf(c)
-			}()
-
-			goto checkExit
-
-		abort:
-			d.stopDpll()
-		}
-
-	checkExit:
-		select {
-		case <-d.exitCh:
-			glog.Infof("terminating netlink dpll monitoring")
-			select {
-			case d.processConfig.EventChannel <- event.EventChannel{
-				ProcessName: event.DPLL,
-				IFace:       d.iface,
-				CfgName:     d.processConfig.ConfigName,
-				ClockType:   d.processConfig.ClockType,
-				Time:        time.Now().UnixMilli(),
-				Reset:       true,
-			}:
-			default:
-				glog.Error("failed to send dpll event terminated event")
-			}
-			// unregister from event notification from other processes
-			d.unRegisterAllSubscriber()
-
-			if d.onHoldover {
-				close(d.holdoverCloseCh)
-				glog.Infof("closing holdover for %s", d.iface)
-				d.onHoldover = false
-			}
-
-			d.stopDpll()
-			return
-
-		default:
-			redial = func() bool {
-				ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
-				defer cancel()
-
-				if sem == nil {
-					return false
-				}
-
-				if err = sem.Acquire(ctx, 1); err != nil {
-					return false
-				}
-
-				glog.Infof("dpll monitoring exited, initiating redial (%s)", d.iface)
-				d.stopDpll()
-				return true
-			}()
-			time.Sleep(time.Millisecond * 250) // cpu saver
-		}
-	}
-}
-
-// stopDpll stops DPLL monitoring
-func (d *DpllConfig) stopDpll() {
-	if d.conn != nil {
-		if err := d.conn.Close(); err != nil {
-			glog.Errorf("error closing DPLL netlink connection: (%s) %s", d.iface, err)
-		}
-		d.conn = nil
+	sharedMonitor.Subscribe(d.clockId, d)
+	sharedMonitor.Start()
+	<-d.exitCh
+	glog.Infof("terminating netlink dpll monitoring")
+	sharedMonitor.Unsubscribe(d.clockId, d)
+	d.sendDpllTerminationEvent()
+
+	d.Lock()
+	defer d.Unlock()
+	if d.onHoldover {
+		d.stopHoldover(HoldoverClosed)
+		glog.Infof("closing holdover for %s", d.iface)
+		d.onHoldover = false
 	}
 }
 
 // MonitorProcess is initiating monitoring of DPLL associated with a process
 func (d *DpllConfig) MonitorProcess(processCfg config.ProcessConfig) {
+	d.Lock()
 	d.processConfig = processCfg
+	gnss := false
 	// register to event notification from other processes
 	for _, dep := range d.dependsOn {
 		if dep == event.GNSS { //TODO: fow now no subscription for pps
-			dependingProcessStateMap.states[dep] = event.PTP_UNKNOWN
+			gnss = true
 			// register to event notification from other processes
 			d.subscriber = append(d.subscriber, &DpllSubscriber{source: dep, dpll: d, id: fmt.Sprintf("%s-%x", event.DPLL, d.clockId)})
 		}
@@ -591,24 +619,48 @@ func (d *DpllConfig) MonitorProcess(processCfg config.ProcessConfig) {
 		dpll:   d,
 		id:     fmt.Sprintf("%s-%x", event.DPLL, d.clockId),
 	})
+	d.Unlock()
+	if gnss {
+		// the subscribers are notified with the depending states locked, they lock d then
+		dependingProcessStateMap.Lock()
+		dependingProcessStateMap.states[event.GNSS] = event.PTP_UNKNOWN
+		dependingProcessStateMap.Unlock()
+	}
 	d.registerAllSubscriber()
 }
 
+// unRegisterAllSubscriber ... the notifier calls the subscribers with its own lock held, so they are
+// unregistered without d locked
 func (d *DpllConfig) unRegisterAllSubscriber() {
-	for _, s := range d.subscriber {
+	d.Lock()
+	subscribers := d.subscriber
+	d.subscriber = []*DpllSubscriber{}
+	d.Unlock()
+	for _, s := range subscribers {
 		event.StateRegisterer.Unregister(s)
 	}
-	d.subscriber = []*DpllSubscriber{}
 }
 
 func (d *DpllConfig) registerAllSubscriber() {
-	for _, s := range d.subscriber {
+	d.Lock()
+	subscribers := d.subscriber
+	d.Unlock()
+	for _, s := range subscribers {
 		event.StateRegisterer.Register(s)
 	}
 }
 
+// monitoring ... the DPLL is monitored
+func (d *DpllConfig) monitoring() bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.isMonitoring
+}
+
 // MonitorDpll monitors DPLL on the discovered API, if any
 func (d *DpllConfig) MonitorDpll() {
+	d.Lock()
+	defer d.Unlock()
 	fmt.Println(d.apiType)
 	if d.apiType == MOCK {
 		return
@@ -624,99 +676,111 @@ func (d *DpllConfig) MonitorDpll() {
 	}
 }
 
-// stateDecision
-func (d *DpllConfig) stateDecision() {
+// update ... change the DPLL state with fn, run with d locked, then send the event fn returns, if any. The events
+// leave in the order of the updates.
+func (d *DpllConfig) update(fn func() (event.EventChannel, bool)) {
+	d.eventLock.Lock()
+	defer d.eventLock.Unlock()
+	d.Lock()
+	ev, send := fn()
+	eventCh := d.processConfig.EventChannel
+	d.Unlock()
+	if !send {
+		return
+	}
+	if eventCh == nil {
+		glog.Info("Skip event - dpll is not yet initialized")
+		return
+	}
+	event.Deliver(d.eventProducer(), eventCh, ev)
+	glog.Infof("dpll event queued for (%s)", d.iface)
+}
+
+// decide ... apply the state decision and send its event
+func (d *DpllConfig) decide() {
+	d.update(d.stateDecision)
+}
+
+// stopHoldover ... end the running holdover with trigger, its timer exits on its own. Called with d locked.
+func (d *DpllConfig) stopHoldover(trigger HoldoverTrigger) {
+	if d.holdoverCloseCh != nil {
+		d.holdoverCloseCh <- trigger
+		d.holdoverCloseCh = nil
+	}
+}
+
+// stateDecision ... apply the DecisionTable row matching the current DPLL status, called with d locked. Returns the
+// event of the decision and whether to send it.
+func (d *DpllConfig) stateDecision() (event.EventChannel, bool) {
+	d.updateFrequencyTraceable()
+	if d.hasPPSAsSource() {
+		d.updatePPSSource()
+	}
 	dpllStatus := d.getWorseState(d.phaseStatus, d.frequencyStatus)
-	switch dpllStatus {
-	case DPLL_FREERUN, DPLL_INVALID, DPLL_UNKNOWN:
-		d.inSpec = false
-		d.sourceLost = true
-		if d.hasGNSSAsSource() && d.onHoldover {
-			d.holdoverCloseCh <- true
-		}
-		d.state = event.PTP_FREERUN
+	inputs := DecisionInputs{
+		Status:             dpllStatus,
+		PPSSource:          d.hasPPSAsSource(),
+		SourceLost:         d.sourceLost,
+		OffsetInRange:      d.isOffsetInRange(),
+		InSpec:             d.inSpec,
+		OnHoldover:         d.onHoldover,
+		FrequencyTraceable: d.frequencyTraceable,
+	}
+	row, ok := DecisionFromTable(DecisionTable, inputs)
+	if !ok {
+		glog.Errorf("%s-dpll: no state table row matches %s", d.iface, inputs)
+		return event.EventChannel{}, false
+	}
+	from := d.state
+	if row.State != "" {
+		d.state = row.State
+	}
+	d.inSpec = setCond(row.SetInSpec, d.inSpec)
+	d.sourceLost = setCond(row.SetSourceLost, d.sourceLost)
+	if row.FaultyOffset {
 		d.phaseOffset = FaultyPhaseOffset
-		glog.Infof("dpll is in FREERUN, state is FREERUN (%s)", d.iface)
-		d.sendDpllEvent()
-	case DPLL_LOCKED:
-		if !d.sourceLost && d.isOffsetInRange() {
-			if d.hasGNSSAsSource() && d.onHoldover {
-				d.holdoverCloseCh <- true
-			}
-			glog.Infof("dpll is locked, offset is in range, state is LOCKED(%s)", d.iface)
-			d.state = event.PTP_LOCKED
-			d.inSpec = true
-		} else {
-			glog.Infof("dpll is locked, offset is out of range, state is FREERUN(%s)", d.iface)
-			d.state = event.PTP_FREERUN
-			d.inSpec = true
+	}
+	d.traceTransition(from, "status", row.ID, inputs)
+	switch row.Holdover {
+	case HoldoverStart:
+		if !d.onHoldover {
+			// buffered, closing never waits for the holdover timer, which needs d to take it
+			d.holdoverCloseCh = make(chan HoldoverTrigger, 1)
+			d.onHoldover = true
+			go d.holdover(d.holdoverCloseCh)
 		}
-		d.sendDpllEvent()
-	case DPLL_LOCKED_HO_ACQ, DPLL_HOLDOVER:
-		switch {
-		case d.hasPPSAsSource():
-			if dpllStatus == DPLL_HOLDOVER {
-				d.state = event.PTP_FREERUN
-				d.phaseOffset = FaultyPhaseOffset
-				d.sourceLost = true
-			} else if d.isOffsetInRange() {
-				d.state = event.PTP_LOCKED
-				d.sourceLost = false
-			} else {
-				d.state = event.PTP_FREERUN
-				d.sourceLost = false // phase offset will be the one that was read
-			}
-		case !d.sourceLost && d.isOffsetInRange():
-			glog.Infof("dpll is locked, source is not lost, offset is in range, state is DPLL_LOCKED_HO_ACQ or DPLL_HOLDOVER(%s)", d.iface)
-			if d.hasGNSSAsSource() && d.onHoldover {
-				select {
-				case d.holdoverCloseCh <- true:
-					glog.Infof("closing holdover for %s since source is restored and locked ", d.iface)
-				default:
-				}
-			}
-			d.inSpec = true
-			d.state = event.PTP_LOCKED
-		case d.sourceLost && d.inSpec:
-			if !d.onHoldover {
-				d.holdoverCloseCh = make(chan bool)
-				d.onHoldover = true
-				d.state = event.PTP_HOLDOVER
-				go d.holdover()
-			}
-			return // do not send event holdover  will handle it
-		case !d.inSpec: // this is for GNSS only
-			glog.Infof("dpll is not in spec, state is DPLL_LOCKED_HO_ACQ or DPLL_HOLDOVER, offset is out of range, state is FREERUN(%s)", d.iface)
-			d.state = event.PTP_FREERUN
-			d.phaseOffset = FaultyPhaseOffset
-			select {
-			case d.holdoverCloseCh <- true:
-				glog.Infof("closing holdover for %s since offset if out of spec", d.iface)
-			default:
-			}
+	case HoldoverClose:
+		if d.onHoldover {
+			d.stopHoldover(HoldoverClosed)
+		}
+	case HoldoverCloseNoWait:
+		if d.onHoldover && d.holdoverCloseCh != nil {
+			glog.Infof("closing holdover for %s since source is restored and locked ", d.iface)
+			d.stopHoldover(HoldoverClosed)
 		}
-		d.sendDpllEvent()
+	case HoldoverAbort:
+		if d.holdoverCloseCh != nil {
+			glog.Infof("closing holdover for %s since offset if out of spec", d.iface)
+			d.stopHoldover(HoldoverAborted)
+		}
+	}
+	if !row.Send {
+		return event.EventChannel{}, false // do not send event holdover  will handle it
 	}
 	// log the decision
 	if d.hasPPSAsSource() {
-		glog.Infof("%s-dpll decision: Status %d, Offset %d, In spec %v, Source %v lost %v",
-			d.iface, dpllStatus, d.phaseOffset, d.inSpec, "pps", d.sourceLost)
-		d.sourceLost = false
-		//TODO: do not have a handler to catch pps source , so we will set to false
-		// and to true if state changes to holdover for source PPS based DPLL
+		glog.Infof("%s-dpll decision: Status %d, Offset %d, In spec %v, Source %v lost %v, On holdover %v",
+			d.iface, dpllStatus, d.phaseOffset, d.inSpec, "pps", d.sourceLost, d.onHoldover)
 	} else if d.hasGNSSAsSource() {
 		glog.Infof("%s-dpll decision: Status %d, Offset %d, In spec %v, Source %v lost %v, On holdover %v",
 			d.iface, dpllStatus, d.phaseOffset, d.inSpec, "GNSS", d.sourceLost, d.onHoldover)
 	}
+	return d.dpllEvent(), true
 }
 
-// sendDpllEvent sends DPLL event to the event channel
-func (d *DpllConfig) sendDpllEvent() {
-	if d.processConfig.EventChannel == nil {
-		glog.Info("Skip event - dpll is not yet initialized")
-		return
-	}
-	eventData := event.EventChannel{
+// dpllEvent ... DPLL event of the current state, called with d locked
+func (d *DpllConfig) dpllEvent() event.EventChannel {
+	return event.EventChannel{
 		ProcessName: event.DPLL,
 		State:       d.state,
 		IFace:       d.iface,
@@ -735,20 +799,19 @@ func (d *DpllConfig) sendDpllEvent() {
 		ClockType:          d.processConfig.ClockType,
 		Time:               time.Now().UnixMilli(),
 		OutOfSpec:          !d.inSpec,
-		SourceLost:         d.sourceLost, // Here source lost is either GNSS or PPS , nmea string lost is captured by ts2phc
+		SourceLost:         d.sourceLost, // GNSS or PPS source lost, nmea string lost is captured by ts2phc
 		FrequencyTraceable: d.frequencyTraceable,
 		WriteToLog:         true,
 		Reset:              false,
 	}
-	select {
-	case d.processConfig.EventChannel <- eventData:
-		glog.Infof("dpll event sent for (%s)", d.iface)
-	default:
-		glog.Infof("failed to send dpll event, retying.(%s)", d.iface)
-	}
 }
 
-// MonitorDpllSysfs ... monitor dpPPS_STATUSll events
+// eventProducer ... name of the producer delivering the events of this DPLL
+func (d *DpllConfig) eventProducer() string {
+	return fmt.Sprintf("%s/%s", event.DPLL, d.iface)
+}
+
+// MonitorDpllSysfs ... poll the DPLL sysfs files of the interface every monitoringInterval
 func (d *DpllConfig) MonitorDpllSysfs() {
 	defer func() {
 		if r := recover(); r != nil {
@@ -757,10 +820,12 @@ func (d *DpllConfig) MonitorDpllSysfs() {
 		}
 	}()
 
-	d.ticker = time.NewTicker(monitoringInterval)
+	d.ticker.Reset(monitoringInterval)
 
 	// Determine DPLL state
+	d.Lock()
 	d.inSpec = true
+	d.Unlock()
 
 	for {
 		select {
@@ -768,32 +833,39 @@ func (d *DpllConfig) MonitorDpllSysfs() {
 			glog.Infof("Terminating sysfs DPLL monitoring")
 			d.sendDpllTerminationEvent()
 
+			d.Lock()
 			if d.onHoldover {
-				close(d.holdoverCloseCh) // Cancel any holdover
+				d.stopHoldover(HoldoverClosed) // Cancel any holdover
 			}
+			d.Unlock()
 			return
 		case <-d.ticker.C:
-			// Monitor DPLL
-			d.phaseStatus, d.frequencyStatus, d.phaseOffset = d.sysfs(d.iface)
-			d.stateDecision()
+			status, err := ReadSysfs(d.iface)
+			if err != nil {
+				glog.Errorf("%s-dpll: error reading sysfs: %v", d.iface, err)
+			}
+			d.update(func() (event.EventChannel, bool) {
+				if d.sysfsUpdateState(status) {
+					return d.stateDecision()
+				}
+				return event.EventChannel{}, false
+			})
 		}
 	}
 }
 
 // sendDpllTerminationEvent sends a termination event to the event channel
 func (d *DpllConfig) sendDpllTerminationEvent() {
-	select {
-	case d.processConfig.EventChannel <- event.EventChannel{
-		ProcessName: event.DPLL,
-		IFace:       d.iface,
-		CfgName:     d.processConfig.ConfigName,
-		ClockType:   d.processConfig.ClockType,
-		Time:        time.Now().UnixMilli(),
-		Reset:       true,
-	}:
-	default:
-		glog.Error("failed to send dpll terminated event")
-	}
+	d.update(func() (event.EventChannel, bool) {
+		return event.EventChannel{
+			ProcessName: event.DPLL,
+			IFace:       d.iface,
+			CfgName:     d.processConfig.ConfigName,
+			ClockType:   d.processConfig.ClockType,
+			Time:        time.Now().UnixMilli(),
+			Reset:       true,
+		}, true
+	})
 
 	// unregister from event notification from other processes
 	d.unRegisterAllSubscriber()
@@ -822,42 +894,77 @@ func (d *DpllConfig) getWorseState(pstate, fstate int64) int64 {
 	return fstate
 }
 
-func (d *DpllConfig) holdover() {
+// holdover ... the holdover timer, estimating the phase offset every second until the holdover ends out of spec,
+// times out or is closed through closeCh
+func (d *DpllConfig) holdover(closeCh <-chan HoldoverTrigger) {
 	start := time.Now()
 	ticker := time.NewTicker(1 * time.Second)
 	defer func() {
 		ticker.Stop()
-		d.onHoldover = false
-		d.stateDecision()
+		d.update(func() (event.EventChannel, bool) {
+			// unless the monitoring stopped it and another holdover started since
+			if d.holdoverCloseCh == nil || d.holdoverCloseCh == closeCh {
+				d.onHoldover = false
+				d.holdoverCloseCh = nil
+			}
+			return d.stateDecision()
+		})
 	}()
-	d.sendDpllEvent()
+	d.update(func() (event.EventChannel, bool) { return d.dpllEvent(), true })
 	glog.Infof("setting dpll holdover for max holdover %v", d.LocalHoldoverTimeout)
+	d.saveModel()
+	fit, trained := d.model.Fit()
+	if trained {
+		glog.Infof("(%s) holdover projected from %d bins of %s: frequency %.3f ppb, drift %.3g ppb/s, temperature coefficient %.3f ppb/C, noise %.3f ppb",
+			d.iface, fit.Bins, fit.Source, fit.Frequency, fit.Drift, fit.TempCoefficient, fit.Noise)
+	}
+	// ∫(T - T0)dt since the holdover start, for the temperature term of the projection
+	tempIntegral, lastTick := 0.0, start
 	for timeout := time.After(time.Duration(int64(d.LocalHoldoverTimeout) * int64(time.Second))); ; {
+		var inputs HoldoverInputs
+		var now time.Time
 		select {
-		case <-ticker.C:
-			d.phaseOffset = int64(math.Round((d.slope) * time.Since(start).Seconds()))
-			glog.Infof("(%s) time since holdover start %f, offset %d nanosecond holdover %s", d.iface, time.Since(start).Seconds(), d.phaseOffset, strconv.FormatBool(d.onHoldover))
-			if d.frequencyTraceable {
-				//TODO:  not implemented : add when syncE is handled here
-				// use  !d.isInSpecOffsetInRange()  to declare HOLDOVER with  clockClass 140
-				// !d.isMaxHoldoverOffsetInRange()  for clock class to move from 140 to 248 and event to FREERUN
-			} else if !d.isInSpecOffsetInRange() { // when holdover verify with local max holdover not with regular threshold
-				d.inSpec = false // will be in HO, Out of spec only if  frequency is traceable
-				d.state = event.PTP_FREERUN
-				d.sendDpllEvent()
-				return
-			}
-			d.sendDpllEvent()
-		case <-timeout: // since ts2phc has same timer , ts2phc should also move out of holdover
-			d.inSpec = false // not in HO, Out of spec
-			d.state = event.PTP_FREERUN
-			d.phaseOffset = FaultyPhaseOffset
+		case now = <-ticker.C:
+			inputs.Trigger = HoldoverTick
+		case <-timeout:
 			glog.Infof("holdover timer %d expired", d.timer)
-			d.sendDpllEvent()
-			return
-		case <-d.holdoverCloseCh:
-			glog.Info("holdover was closed")
-			d.inSpec = true // if someone else is closing then it should be back in spec (if it was not in spec before)
+			inputs.Trigger = HoldoverTimeout
+		case inputs.Trigger = <-closeCh:
+			glog.Infof("holdover was %s", inputs.Trigger)
+		}
+		exit := false
+		d.update(func() (event.EventChannel, bool) {
+			if inputs.Trigger == HoldoverTick {
+				if d.hasTemperature {
+					tempIntegral += (d.temperature - fit.Temperature) * now.Sub(lastTick).Seconds()
+				}
+				lastTick = now
+				d.phaseOffset = d.holdoverEstimate(fit, trained, time.Since(start).Seconds(), tempIntegral)
+				glog.Infof("(%s) time since holdover start %f, offset %d nanosecond holdover %s", d.iface, time.Since(start).Seconds(), d.phaseOffset, strconv.FormatBool(d.onHoldover))
+				d.updateFrequencyTraceable()
+				inputs.FrequencyTraceable = d.frequencyTraceable
+				// when holdover verify with local max holdover not with regular threshold
+				inputs.InSpecOffset = d.isInSpecOffsetInRange()
+				inputs.MaxHoldoverOffset = d.isMaxHoldoverOffsetInRange()
+			}
+			row, ok := HoldoverFromTable(HoldoverTable, inputs)
+			if !ok {
+				glog.Errorf("%s-dpll: no holdover table row matches %s", d.iface, inputs)
+				return event.EventChannel{}, false
+			}
+			from := d.state
+			if row.State != "" {
+				d.state = row.State
+			}
+			d.inSpec = setCond(row.SetInSpec, d.inSpec)
+			if row.FaultyOffset {
+				d.phaseOffset = FaultyPhaseOffset
+			}
+			d.traceTransition(from, "holdover "+string(inputs.Trigger), row.ID, inputs)
+			exit = row.Exit
+			return d.dpllEvent(), row.Send
+		})
+		if exit {
 			return
 		}
 	}
@@ -889,54 +996,9 @@ func (d *DpllConfig) isOffsetInRange() bool {
 	return false
 }
 
-// Index of DPLL being configured [0:EEC (DPLL0), 1:PPS (DPLL1)]
-// Frequency State (EEC_DPLL)
-// cat /sys/class/net/interface_name/device/dpll_0_state
-// Phase State
-// cat /sys/class/net/ens7f0/device/dpll_1_state
-// Phase Offset
-// cat /sys/class/net/ens7f0/device/dpll_1_offset
-func (d *DpllConfig) sysfs(iface string) (phaseState, frequencyState, phaseOffset int64) {
-	if iface == "" {
-		return DPLL_INVALID, DPLL_INVALID, 0
-	}
-
-	readInt64FromFile := func(path string) (int64, error) {
-		content, err := os.ReadFile(path)
-		if err != nil {
-			return 0, err
-		}
-		contentStr := strings.TrimSpace(string(content))
-		value, err := strconv.ParseInt(contentStr, 10, 64)
-		if err != nil {
-			return 0, err
-		}
-		return value, nil
-	}
-
-	frequencyStateStr := fmt.Sprintf("/sys/class/net/%s/device/dpll_0_state", iface)
-	phaseStateStr := fmt.Sprintf("/sys/class/net/%s/device/dpll_1_state", iface)
-	phaseOffsetStr := fmt.Sprintf("/sys/class/net/%s/device/dpll_1_offset", iface)
-
-	frequencyState, err := readInt64FromFile(frequencyStateStr)
-	if err != nil {
-		glog.Errorf("Error reading frequency state from %s: %v", frequencyStateStr, err)
-	}
-
-	phaseState, err = readInt64FromFile(phaseStateStr)
-	if err != nil {
-		glog.Errorf("Error reading phase state from %s: %v %s", phaseStateStr, err, d.iface)
-	}
-
-	phaseOffset, err = readInt64FromFile(phaseOffsetStr)
-	if err != nil {
-		glog.Errorf("Error reading phase offset from %s: %v %s", phaseOffsetStr, err, d.iface)
-	} else {
-		phaseOffset /= 100 // Convert to nanoseconds from tens of picoseconds (divide by 100)
-	}
-	return phaseState, frequencyState, phaseOffset
-}
-
+// CalculateTimer ... max in spec offset, max holdover offset, holdover timeout, time to reach the in spec offset, and
+// whether the ts2phc options may use the holdover timeout and offset. They are fixed when ts2phc starts while the SyncE
+// traceability is only known at runtime, see SetFrequencyTraceable, so ts2phc keeps the in spec values.
 func CalculateTimer(nodeProfile *ptpv1.PtpProfile) (int64, int64, int64, int64, bool) {
 	var localMaxHoldoverOffSet uint64 = LocalMaxHoldoverOffSet
 	var localHoldoverTimeout uint64 = LocalHoldoverTimeout
@@ -2,8 +2,6 @@ package dpll_test
 
 import (
 	"fmt"
-	"strconv"
-	"strings"
 	"testing"
 	"time"
 
@@ -12,6 +10,7 @@ import (
 	"github.com/openshift/linuxptp-daemon/pkg/config"
 	"github.com/openshift/linuxptp-daemon/pkg/dpll"
 	"github.com/openshift/linuxptp-daemon/pkg/event"
+	ptpv1 "github.com/openshift/ptp-operator/api/v1"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -44,7 +43,7 @@ func getTestData(source event.EventSource, pinType uint32) []DpllTestCase {
 			Id:            id,
 			ModuleName:    moduleName,
 			Mode:          1,
-			ModeSupported: 0,
+			ModeSupported: nil,
 			LockStatus:    2, //LOCKED,
 			ClockId:       clockid,
 			Type:          2, //1 pps 2 eec
@@ -64,7 +63,7 @@ func getTestData(source event.EventSource, pinType uint32) []DpllTestCase {
 			Id:            id,
 			ModuleName:    moduleName,
 			Mode:          1,
-			ModeSupported: 0,
+			ModeSupported: nil,
 			LockStatus:    2, //LOCKED,
 			ClockId:       clockid,
 			Type:          1, //1 pps 2 eec
@@ -85,7 +84,7 @@ func getTestData(source event.EventSource, pinType uint32) []DpllTestCase {
 				Id:            id,
 				ModuleName:    moduleName,
 				Mode:          1,
-				ModeSupported: 0,
+				ModeSupported: nil,
 				LockStatus: func() uint32 {
 					if pinType == 2 {
 						return 4 // holdover
@@ -117,21 +116,15 @@ func getTestData(source event.EventSource, pinType uint32) []DpllTestCase {
 					return 2
 				}
 			}(), // holdover to free run
-			expectedInSpecState: func() bool {
-				if pinType == 2 {
-					return false
-				} else {
-					return true
-				}
-			}(),
-			desc: fmt.Sprintf("3. Holdover frequency/Phase status status times out in 1sec  : pin %d ", pinType),
+			expectedInSpecState: false,
+			desc:                fmt.Sprintf("3. Holdover frequency/Phase status status times out in 2sec  : pin %d ", pinType),
 		},
 		{
 			reply: &nl.DoDeviceGetReply{
 				Id:            id,
 				ModuleName:    moduleName,
 				Mode:          1,
-				ModeSupported: 0,
+				ModeSupported: nil,
 				LockStatus:    4, // holdover,
 				ClockId:       clockid,
 				Type:          pinType, //1 pps 2 eec
@@ -157,14 +150,8 @@ func getTestData(source event.EventSource, pinType uint32) []DpllTestCase {
 					return 2
 				}
 			}(),
-			expectedInSpecState: func() bool {
-				if pinType == 2 {
-					return false
-				} else {
-					return true
-				}
-			}(),
-			desc: fmt.Sprintf("4.Out of holdover state.or stays in free run for pps , gns:=declare outofSpec Freerun within a sec : pin %d ", pinType),
+			expectedInSpecState: false,
+			desc:                fmt.Sprintf("4.Out of holdover state:=declare outofSpec Freerun within a sec : pin %d ", pinType),
 		},
 	}
 }
@@ -240,6 +227,8 @@ func TestDpllConfig_MonitorProcessPPS(t *testing.T) {
 		d.SetDependsOn([]event.EventSource{tt.source})
 		dpll.MockDpllReplies <- tt.reply
 		d.MonitorDpllMock()
+		time.Sleep(1 * time.Second)
+		assert.Equal(t, tt.expectedIntermediateState, d.State(), tt.desc)
 		time.Sleep(tt.sleep * time.Second)
 		assert.Equal(t, tt.expectedPhaseStatus, d.PhaseStatus(), tt.desc)
 		assert.Equal(t, tt.expectedFrequencyStatus, d.FrequencyStatus(), tt.desc)
@@ -251,16 +240,6 @@ func TestDpllConfig_MonitorProcessPPS(t *testing.T) {
 	closeChn <- true
 }
 
-func TestSysfs(t *testing.T) {
-	//indexStr := fmt.Sprintf("/sys/class/net/%s/ifindex", "lo")
-	//fContent, err := os.ReadFile(indexStr)
-	//assert.Nil(t, err)
-	fcontentStr := strings.ReplaceAll("-26644444444444444", "\n", "")
-	index, err2 := strconv.ParseInt(fcontentStr, 10, 64)
-	assert.Nil(t, err2)
-	assert.GreaterOrEqual(t, index, int64(-26644444444444444))
-}
-
 type dpllTestCase struct {
 	localMaxHoldoverOffSet uint64
 	localHoldoverTimeout   uint64
@@ -290,3 +269,22 @@ func TestSlopeAndTimer(t *testing.T) {
 		assert.Equal(t, tt.expectedSlope, d.Slope(), "Slope")
 	}
 }
+
+func TestCalculateTimer(t *testing.T) {
+	synce4lConf := "[global]"
+	profile := &ptpv1.PtpProfile{
+		Synce4lConf: &synce4lConf,
+		PtpSettings: map[string]string{
+			dpll.LocalMaxHoldoverOffSetStr: "6000",
+			dpll.LocalHoldoverTimeoutStr:   "100",
+			dpll.MaxInSpecOffsetStr:        "100",
+		},
+	}
+	maxInSpecOffset, maxHoldoverOffset, holdoverTimeout, inSpecTimer, frequencyTraceable := dpll.CalculateTimer(profile)
+	assert.Equal(t, int64(100), maxInSpecOffset)
+	assert.Equal(t, int64(6000), maxHoldoverOffset)
+	assert.Equal(t, int64(100), holdoverTimeout)
+	assert.Equal(t, int64(2), inSpecTimer)
+	// running synce4l does not make the frequency traceable, ts2phc keeps the in spec values
+	assert.False(t, frequencyTraceable)
+}
@@ -0,0 +1,247 @@
+package dpll
+
+import (
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/golang/glog"
+	nl "github.com/openshift/linuxptp-daemon/pkg/dpll-netlink"
+)
+
+// DpllModeStr ... ptpSettings key of the working mode of an interface DPLL, manual or automatic,
+// dpllMode[ens1f0]: manual
+const DpllModeStr = "dpllMode"
+
+// DeviceMode ... working mode of a DPLL device of the clock as reported by the driver
+type DeviceMode struct {
+	Id            uint32
+	Type          string // eec or pps
+	Mode          uint32
+	ModeSupported []uint32
+}
+
+// SetMode ... working mode set on the DPLL devices of the clock, 0 leaves the driver default
+func (d *DpllConfig) SetMode(mode uint32) {
+	d.Lock()
+	defer d.Unlock()
+	d.mode = mode
+}
+
+// SetModeChangeHandler ... f is called whenever a DPLL device of the clock reports another mode
+func (d *DpllConfig) SetModeChangeHandler(f func()) {
+	d.Lock()
+	defer d.Unlock()
+	d.onModeChange = f
+}
+
+// DeviceModes ... reported modes of the DPLL devices of the clock, by device id
+func (d *DpllConfig) DeviceModes() []DeviceMode {
+	d.Lock()
+	defer d.Unlock()
+	modes := make([]DeviceMode, 0, len(d.deviceModes))
+	for _, m := range d.deviceModes {
+		modes = append(modes, m)
+	}
+	sort.Slice(modes, func(i, j int) bool { return modes[i].Id < modes[j].Id })
+	return modes
+}
+
+// updateModes ... remember the modes the devices of the clock report, true when one changed
+func (d *DpllConfig) updateModes(devices []*nl.DoDeviceGetReply) bool {
+	d.Lock()
+	defer d.Unlock()
+	changed := false
+	for _, reply := range devices {
+		if reply.ClockId != d.clockId || reply.Mode == 0 {
+			continue
+		}
+		if d.deviceModes == nil {
+			d.deviceModes = map[uint32]DeviceMode{}
+		}
+		m := d.deviceModes[reply.Id]
+		if m.Mode == reply.Mode && (len(reply.ModeSupported) == 0 || slices.Equal(m.ModeSupported, reply.ModeSupported)) {
+			continue
+		}
+		m.Id, m.Type, m.Mode = reply.Id, nl.GetDpllType(reply.Type), reply.Mode
+		if len(reply.ModeSupported) > 0 {
+			m.ModeSupported = slices.Clone(reply.ModeSupported)
+		}
+		d.deviceModes[reply.Id] = m
+		changed = true
+	}
+	return changed
+}
+
+// ModeRequests ... device-set requests moving the devices to mode, devices not supporting it are left alone
+func ModeRequests(mode uint32, devices []DeviceMode) []nl.DeviceSetRequest {
+	var requests []nl.DeviceSetRequest
+	if mode == 0 {
+		return requests
+	}
+	for _, m := range devices {
+		if m.Mode == mode {
+			continue
+		}
+		if !slices.Contains(m.ModeSupported, mode) {
+			glog.Warningf("dpll device %d (%s) does not support mode %s, supported: %s",
+				m.Id, m.Type, nl.GetMode(mode), nl.GetModes(m.ModeSupported))
+			continue
+		}
+		requests = append(requests, nl.DeviceSetRequest{Id: m.Id, Mode: mode})
+	}
+	return requests
+}
+
+// enforceMode ... set the declared mode on the devices of the clock, at start and whenever a device reports
+// another mode
+func (d *DpllConfig) enforceMode(devices []*nl.DoDeviceGetReply) {
+	d.Lock()
+	mode, onModeChange := d.mode, d.onModeChange
+	d.Unlock()
+	if d.updateModes(devices) && onModeChange != nil {
+		onModeChange()
+	}
+	requests := ModeRequests(mode, d.DeviceModes())
+	if len(requests) == 0 {
+		return
+	}
+	d.withConn(func(conn *nl.Conn) error {
+		var failed error
+		for _, req := range requests {
+			if err := conn.DeviceSet(req); err != nil {
+				glog.Errorf("%s: failed to set dpll device %d mode to %s: %s", d.iface, req.Id, nl.GetMode(req.Mode), err)
+				failed = err
+				continue
+			}
+			glog.Infof("%s: set dpll device %d mode to %s", d.iface, req.Id, nl.GetMode(req.Mode))
+		}
+		return failed
+	})
+}
+
+// pinHealthy ... true when the input pin has a signal: a DPLL device measures a phase offset for it, and for a
+// GNSS pin the GNSS receiver is locked
+func pinHealthy(pin *nl.DoPinGetReply, gnssLocked bool) bool {
+	if !slices.ContainsFunc(pin.ParentDevice, func(pd nl.PinParentDevice) bool { return pd.PhaseOffset != math.MaxInt64 }) {
+		return false
+	}
+	return nl.GetPinType(pin.Type) != "gnss" || gnssLocked
+}
+
+// SelectInputPin ... the healthy input pin of the clock highest in priorities, nil when there is none
+func SelectInputPin(clockId uint64, priorities []string, pins []*nl.DoPinGetReply, gnssLocked bool) *nl.DoPinGetReply {
+	for _, label := range priorities {
+		for _, pin := range pins {
+			if pin.ClockId != clockId || !pin.HasDirection(nl.DPLL_PIN_DIRECTION_INPUT) || !pinLabelMatch(pin, label) {
+				continue
+			}
+			if pinHealthy(pin, gnssLocked) {
+				return pin
+			}
+		}
+	}
+	return nil
+}
+
+// PinSelectRequests ... pin-set requests connecting the selected input pin to the DPLL devices of the clock in
+// manual mode and disconnecting the other connected input pins declared in priorities
+func PinSelectRequests(clockId uint64, selected uint32, priorities []string, deviceIds []uint32, pins []*nl.DoPinGetReply) []nl.PinSetRequest {
+	var connect, disconnect []nl.PinSetRequest
+	connected, disconnected := uint32(nl.DPLL_PIN_STATE_CONNECTED), uint32(nl.DPLL_PIN_STATE_DISCONNECTED)
+	for _, pin := range pins {
+		if pin.ClockId != clockId {
+			continue
+		}
+		declared := slices.ContainsFunc(priorities, func(label string) bool { return pinLabelMatch(pin, label) })
+		if pin.Id != selected && !declared {
+			continue
+		}
+		req := nl.PinSetRequest{Id: pin.Id}
+		for _, id := range deviceIds {
+			pd := pin.ParentDeviceById(id)
+			if pd == nil || pd.Direction != nl.DPLL_PIN_DIRECTION_INPUT {
+				continue
+			}
+			if pin.Id == selected && pd.State != connected {
+				req.ParentDevice = append(req.ParentDevice, nl.PinParentDeviceCtl{Id: id, State: &connected})
+			} else if pin.Id != selected && pd.State == connected {
+				req.ParentDevice = append(req.ParentDevice, nl.PinParentDeviceCtl{Id: id, State: &disconnected})
+			}
+		}
+		if len(req.ParentDevice) == 0 {
+			continue
+		}
+		if pin.Capabilities&nl.DPLL_PIN_CAPABILITIES_STATE_CAN_CHANGE == 0 {
+			glog.Warningf("dpll pin %d (%s) state cannot be changed to %s", pin.Id, pin.BoardLabel,
+				nl.GetPinState(*req.ParentDevice[0].State))
+			continue
+		}
+		if pin.Id == selected {
+			connect = append(connect, req)
+		} else {
+			disconnect = append(disconnect, req)
+		}
+	}
+	// connect first, the DPLL keeps an input while switching
+	return append(connect, disconnect...)
+}
+
+// updatePins ... remember the latest reports of the pins of the clock, called with d locked
+func (d *DpllConfig) updatePins(pins []*nl.DoPinGetReply) {
+	for _, pin := range pins {
+		if pin.ClockId != d.clockId {
+			continue
+		}
+		if d.pins == nil {
+			d.pins = map[uint32]*nl.DoPinGetReply{}
+		}
+		d.pins[pin.Id] = pin
+	}
+}
+
+// selectInputPin ... in manual mode, connect the healthy input pin highest in pinPriorities. Without a healthy
+// pin the current one stays connected and the DPLL goes to holdover on its own.
+func (d *DpllConfig) selectInputPin() {
+	d.Lock()
+	if d.mode != nl.DPLL_MODE_MANUAL || len(d.pinPriorities) == 0 || len(d.deviceIds) == 0 {
+		d.Unlock()
+		return
+	}
+	clockId, priorities, deviceIds := d.clockId, d.pinPriorities, slices.Clone(d.deviceIds)
+	gnssLocked, current := !d.sourceLost, d.selectedPin
+	pins := make([]*nl.DoPinGetReply, 0, len(d.pins))
+	for _, pin := range d.pins {
+		pins = append(pins, pin)
+	}
+	d.Unlock()
+
+	selected := SelectInputPin(clockId, priorities, pins, gnssLocked)
+	if selected == nil {
+		if current != 0 {
+			glog.Warningf("%s: no healthy dpll input pin among %v, keeping pin %d", d.iface, priorities, current)
+		}
+		return
+	}
+	if requests := PinSelectRequests(clockId, selected.Id, priorities, deviceIds, pins); len(requests) > 0 {
+		err := d.withConn(func(conn *nl.Conn) error {
+			for _, req := range requests {
+				if err := conn.PinSet(req); err != nil {
+					glog.Errorf("%s: failed to set dpll pin %d %s: %s", d.iface, req.Id,
+						nl.GetPinState(*req.ParentDevice[0].State), err)
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+	if current != selected.Id {
+		glog.Infof("%s: selected dpll input pin %d (%s)", d.iface, selected.Id, selected.BoardLabel)
+	}
+	d.Lock()
+	d.selectedPin = selected.Id
+	d.Unlock()
+}
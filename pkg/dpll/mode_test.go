@@ -0,0 +1,98 @@
+package dpll_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	"github.com/openshift/linuxptp-daemon/pkg/dpll"
+	nl "github.com/openshift/linuxptp-daemon/pkg/dpll-netlink"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDeviceReplies_Mode(t *testing.T) {
+	ae := netlink.NewAttributeEncoder()
+	ae.Uint32(nl.DPLL_A_ID, 3)
+	ae.Uint32(nl.DPLL_A_MODE, nl.DPLL_MODE_MANUAL)
+	ae.Uint32(nl.DPLL_A_MODE_SUPPORTED, nl.DPLL_MODE_MANUAL)
+	ae.Uint32(nl.DPLL_A_MODE_SUPPORTED, nl.DPLL_MODE_AUTOMATIC)
+	b, err := ae.Encode()
+	assert.NoError(t, err)
+	replies, err := nl.ParseDeviceReplies([]genetlink.Message{{Data: b}})
+	assert.NoError(t, err)
+	if assert.Len(t, replies, 1) {
+		assert.Equal(t, uint32(nl.DPLL_MODE_MANUAL), replies[0].Mode)
+		assert.Equal(t, []uint32{nl.DPLL_MODE_MANUAL, nl.DPLL_MODE_AUTOMATIC}, replies[0].ModeSupported)
+		hr := nl.GetDpllStatusHR(replies[0])
+		assert.Equal(t, "manual", hr.Mode)
+		assert.Equal(t, "manual,automatic", hr.ModeSupported)
+	}
+
+	mode, ok := nl.ModeFromString("automatic")
+	assert.True(t, ok)
+	assert.Equal(t, uint32(nl.DPLL_MODE_AUTOMATIC), mode)
+	_, ok = nl.ModeFromString("holdover")
+	assert.False(t, ok, "holdover cannot be set")
+}
+
+func TestModeRequests(t *testing.T) {
+	both := []uint32{nl.DPLL_MODE_MANUAL, nl.DPLL_MODE_AUTOMATIC}
+	devices := []dpll.DeviceMode{
+		{Id: 1, Type: "eec", Mode: nl.DPLL_MODE_AUTOMATIC, ModeSupported: both},
+		{Id: 2, Type: "pps", Mode: nl.DPLL_MODE_MANUAL, ModeSupported: both},
+		{Id: 3, Type: "pps", Mode: nl.DPLL_MODE_AUTOMATIC, ModeSupported: []uint32{nl.DPLL_MODE_AUTOMATIC}},
+	}
+	assert.Equal(t, []nl.DeviceSetRequest{{Id: 1, Mode: nl.DPLL_MODE_MANUAL}}, dpll.ModeRequests(nl.DPLL_MODE_MANUAL, devices))
+	assert.Equal(t, []nl.DeviceSetRequest{{Id: 2, Mode: nl.DPLL_MODE_AUTOMATIC}}, dpll.ModeRequests(nl.DPLL_MODE_AUTOMATIC, devices))
+	assert.Empty(t, dpll.ModeRequests(0, devices), "driver default")
+
+	b, err := nl.EncodeDeviceSet(nl.DeviceSetRequest{Id: 1, Mode: nl.DPLL_MODE_MANUAL})
+	assert.NoError(t, err)
+	ad, err := netlink.NewAttributeDecoder(b)
+	assert.NoError(t, err)
+	attrs := map[uint16]uint32{}
+	for ad.Next() {
+		attrs[ad.Type()] = ad.Uint32()
+	}
+	assert.NoError(t, ad.Err())
+	assert.Equal(t, map[uint16]uint32{nl.DPLL_A_ID: 1, nl.DPLL_A_MODE: nl.DPLL_MODE_MANUAL}, attrs)
+}
+
+func TestSelectInputPin(t *testing.T) {
+	priorities := []string{"GNSS-1PPS", "SMA1", "C827_0-RCLKA"}
+	gnss := inputPin(1, "GNSS-1PPS", 0)
+	gnss.Type = 5
+	sma := inputPin(2, "SMA1", 1)
+	setParents(sma, func(pd *nl.PinParentDevice) { pd.State = nl.DPLL_PIN_STATE_CONNECTED })
+	rclk := inputPin(3, "C827_0-RCLKA", 2)
+	setParents(rclk, func(pd *nl.PinParentDevice) { pd.PhaseOffset = math.MaxInt64 }) // no signal
+	pins := []*nl.DoPinGetReply{rclk, sma, gnss}
+
+	assert.Equal(t, gnss, dpll.SelectInputPin(clockid, priorities, pins, true))
+	assert.Equal(t, sma, dpll.SelectInputPin(clockid, priorities, pins, false), "GNSS lost")
+	setParents(sma, func(pd *nl.PinParentDevice) { pd.PhaseOffset = math.MaxInt64 })
+	assert.Nil(t, dpll.SelectInputPin(clockid, priorities, pins, false), "no healthy input")
+	assert.Nil(t, dpll.SelectInputPin(clockid+1, priorities, pins, true), "other clock")
+
+	// GNSS back: connect it, then disconnect SMA1
+	requests := dpll.PinSelectRequests(clockid, gnss.Id, priorities, []uint32{1, 2}, pins)
+	if assert.Len(t, requests, 2) {
+		assert.Equal(t, gnss.Id, requests[0].Id)
+		assert.Equal(t, sma.Id, requests[1].Id)
+		for i, state := range []uint32{nl.DPLL_PIN_STATE_CONNECTED, nl.DPLL_PIN_STATE_DISCONNECTED} {
+			if assert.Len(t, requests[i].ParentDevice, 2) {
+				assert.Equal(t, state, *requests[i].ParentDevice[1].State)
+				assert.Nil(t, requests[i].ParentDevice[1].Prio)
+			}
+		}
+	}
+	// SMA1 selected and connected already
+	assert.Empty(t, dpll.PinSelectRequests(clockid, sma.Id, priorities, []uint32{1, 2}, pins))
+	// SMA1 dropped by the PPS DPLL only
+	sma.ParentDevice[1].State = nl.DPLL_PIN_STATE_SELECTABLE
+	requests = dpll.PinSelectRequests(clockid, sma.Id, priorities, []uint32{1, 2}, pins)
+	if assert.Len(t, requests, 1) && assert.Len(t, requests[0].ParentDevice, 1) {
+		assert.Equal(t, uint32(2), requests[0].ParentDevice[0].Id)
+	}
+}
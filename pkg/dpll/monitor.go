@@ -0,0 +1,416 @@
+package dpll
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/mdlayher/genetlink"
+	nl "github.com/openshift/linuxptp-daemon/pkg/dpll-netlink"
+)
+
+// monitorRedialInterval ... wait before dialing the DPLL netlink family again after the monitor lost it
+const monitorRedialInterval = 5 * time.Second
+
+// sharedMonitor ... the DPLL netlink monitor of every DpllConfig of the daemon
+var sharedMonitor = NewMonitor()
+
+// SharedMonitor ... the DPLL netlink monitor shared by the DpllConfigs of the daemon, its model answers the queries
+// on the DPLL pins
+func SharedMonitor() *Monitor {
+	return sharedMonitor
+}
+
+// Listener ... receives the DPLL device and pin changes of a clock from a Monitor
+type Listener interface {
+	// DpllChanged ... devices and pins of the clock created or changed, with all their attributes
+	DpllChanged(devices []*nl.DoDeviceGetReply, pins []*nl.DoPinGetReply)
+	// DpllDeleted ... devices and pins of the clock removed by the driver
+	DpllDeleted(devices []*nl.DoDeviceGetReply, pins []*nl.DoPinGetReply)
+}
+
+// Monitor ... keeps a model of every DPLL device and pin from the notifications of the netlink monitor group,
+// subscribed to once, and fans the changes out to the listeners of their clock. A socket overrun, when
+// notifications were dropped, resynchronizes the model with a full dump. Listeners are called without the model
+// lock held, one batch of changes at a time and in order.
+type Monitor struct {
+	sync.Mutex
+	// notifyLock ... serializes the calls to the listeners, taken before the model lock
+	notifyLock sync.Mutex
+	devices    map[uint32]*nl.DoDeviceGetReply
+	pins       map[uint32]*nl.DoPinGetReply
+	listeners  map[uint64][]Listener
+	running    bool
+	conn       *nl.Conn // multicast connection of the running monitor
+}
+
+// NewMonitor ... monitor without listeners, started by Start
+func NewMonitor() *Monitor {
+	return &Monitor{
+		devices:   map[uint32]*nl.DoDeviceGetReply{},
+		pins:      map[uint32]*nl.DoPinGetReply{},
+		listeners: map[uint64][]Listener{},
+	}
+}
+
+// Subscribe ... l receives the changes of the clock, starting with the devices and pins of the clock known already
+func (m *Monitor) Subscribe(clockId uint64, l Listener) {
+	m.notifyLock.Lock()
+	defer m.notifyLock.Unlock()
+	m.Lock()
+	m.listeners[clockId] = append(m.listeners[clockId], l)
+	var devices []*nl.DoDeviceGetReply
+	for _, device := range m.devices {
+		if device.ClockId == clockId {
+			devices = append(devices, device)
+		}
+	}
+	var pins []*nl.DoPinGetReply
+	for _, pin := range m.pins {
+		if pin.ClockId == clockId {
+			pins = append(pins, pin)
+		}
+	}
+	m.Unlock()
+	if len(devices) > 0 || len(pins) > 0 {
+		l.DpllChanged(sortDevices(devices), sortPins(pins))
+	}
+}
+
+// Unsubscribe ... stop sending the changes of the clock to l, the monitor stops with its last listener.
+// Changes being sent when it is called are delivered before it returns.
+func (m *Monitor) Unsubscribe(clockId uint64, l Listener) {
+	m.notifyLock.Lock()
+	defer m.notifyLock.Unlock()
+	m.Lock()
+	defer m.Unlock()
+	m.listeners[clockId] = slices.DeleteFunc(m.listeners[clockId], func(known Listener) bool { return known == l })
+	if len(m.listeners[clockId]) == 0 {
+		delete(m.listeners, clockId)
+	}
+	if len(m.listeners) == 0 && m.conn != nil {
+		// unblocks the receive of the running monitor
+		if err := m.conn.Close(); err != nil {
+			glog.Errorf("error closing dpll monitor netlink connection: %s", err)
+		}
+		m.conn = nil
+		// the next listener gets the model of the next connection
+		m.devices = map[uint32]*nl.DoDeviceGetReply{}
+		m.pins = map[uint32]*nl.DoPinGetReply{}
+	}
+}
+
+// Pins ... snapshot of the pins of the model ordered by id, empty while the monitor has no listener. Replies are
+// replaced on change and never modified, they are read only.
+func (m *Monitor) Pins() []*nl.DoPinGetReply {
+	m.Lock()
+	defer m.Unlock()
+	pins := make([]*nl.DoPinGetReply, 0, len(m.pins))
+	for _, pin := range m.pins {
+		pins = append(pins, pin)
+	}
+	return sortPins(pins)
+}
+
+// Start ... run the monitor, unless it is running, until its last listener unsubscribes
+func (m *Monitor) Start() {
+	m.Lock()
+	defer m.Unlock()
+	if m.running {
+		return
+	}
+	m.running = true
+	go m.run()
+}
+
+// done ... true, and the monitor is stopped, when no listener is left
+func (m *Monitor) done() bool {
+	m.Lock()
+	defer m.Unlock()
+	if len(m.listeners) > 0 {
+		return false
+	}
+	m.running = false
+	m.devices = map[uint32]*nl.DoDeviceGetReply{}
+	m.pins = map[uint32]*nl.DoPinGetReply{}
+	return true
+}
+
+func (m *Monitor) run() {
+	glog.Info("starting dpll netlink monitor")
+	for !m.done() {
+		err := m.monitor()
+		if m.done() {
+			break
+		}
+		if err == nil {
+			// the last listener left and another one subscribed meanwhile
+			continue
+		}
+		glog.Errorf("dpll netlink monitor: %s, redialing in %s", err, monitorRedialInterval)
+		time.Sleep(monitorRedialInterval)
+	}
+	glog.Info("dpll netlink monitor stopped")
+}
+
+// monitor ... join the monitor group, load the model and apply notifications until the connection fails, or closes
+// with the last listener, then nil
+func (m *Monitor) monitor() error {
+	conn, err := nl.Dial(nil)
+	if err != nil {
+		return fmt.Errorf("failed to establish dpll netlink connection: %w", err)
+	}
+	mcastId, found := conn.GetMcastGroupId(nl.DPLL_MCGRP_MONITOR)
+	if !found {
+		conn.Close()
+		return fmt.Errorf("multicast group %s not found", nl.DPLL_MCGRP_MONITOR)
+	}
+	c := conn.GetGenetlinkConn()
+	// join before the dump, a change in between is received twice rather than lost
+	if err = c.JoinGroup(mcastId); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to join multicast group %s: %w", nl.DPLL_MCGRP_MONITOR, err)
+	}
+	m.Lock()
+	if len(m.listeners) == 0 {
+		m.Unlock()
+		conn.Close()
+		return nil
+	}
+	m.conn = conn
+	m.Unlock()
+	defer func() {
+		m.Lock()
+		if m.conn == conn {
+			conn.Close()
+			m.conn = nil
+		}
+		m.Unlock()
+	}()
+
+	if err = m.resync(); err != nil {
+		return err
+	}
+	for {
+		msgs, _, err := c.Receive()
+		if err != nil {
+			m.Lock()
+			closed := m.conn != conn
+			m.Unlock()
+			if closed {
+				// closed by Unsubscribe
+				return nil
+			}
+			if errors.Is(err, syscall.ENOBUFS) {
+				glog.Warning("dpll netlink monitor overrun, notifications were dropped, resynchronizing")
+				if err = m.resync(); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+		m.HandleMessages(msgs)
+	}
+}
+
+// resync ... dump every device and pin over a request connection, the monitor connection only carries notifications
+func (m *Monitor) resync() error {
+	conn, err := nl.Dial(nil)
+	if err != nil {
+		return fmt.Errorf("failed to establish dpll netlink connection: %w", err)
+	}
+	defer conn.Close()
+	devices, err := conn.DumpDeviceGet()
+	if err != nil {
+		return fmt.Errorf("failed to dump dpll devices: %w", err)
+	}
+	pins, err := conn.DumpPinGet()
+	if err != nil {
+		return fmt.Errorf("failed to dump dpll pins: %w", err)
+	}
+	m.Resync(devices, pins)
+	return nil
+}
+
+// clockChanges ... devices and pins of a clock changed or deleted by a batch of notifications or a resync
+type clockChanges struct {
+	devices, deletedDevices map[uint32]*nl.DoDeviceGetReply
+	pins, deletedPins       map[uint32]*nl.DoPinGetReply
+}
+
+func (m *Monitor) changesOf(changes map[uint64]*clockChanges, clockId uint64) *clockChanges {
+	c, ok := changes[clockId]
+	if !ok {
+		c = &clockChanges{
+			devices: map[uint32]*nl.DoDeviceGetReply{}, deletedDevices: map[uint32]*nl.DoDeviceGetReply{},
+			pins: map[uint32]*nl.DoPinGetReply{}, deletedPins: map[uint32]*nl.DoPinGetReply{},
+		}
+		changes[clockId] = c
+	}
+	return c
+}
+
+func (m *Monitor) setDevice(changes map[uint64]*clockChanges, device *nl.DoDeviceGetReply) {
+	m.devices[device.Id] = device
+	c := m.changesOf(changes, device.ClockId)
+	c.devices[device.Id] = device
+	delete(c.deletedDevices, device.Id)
+}
+
+func (m *Monitor) deleteDevice(changes map[uint64]*clockChanges, device *nl.DoDeviceGetReply) {
+	delete(m.devices, device.Id)
+	c := m.changesOf(changes, device.ClockId)
+	c.deletedDevices[device.Id] = device
+	delete(c.devices, device.Id)
+}
+
+func (m *Monitor) setPin(changes map[uint64]*clockChanges, pin *nl.DoPinGetReply) {
+	m.pins[pin.Id] = pin
+	c := m.changesOf(changes, pin.ClockId)
+	c.pins[pin.Id] = pin
+	delete(c.deletedPins, pin.Id)
+}
+
+func (m *Monitor) deletePin(changes map[uint64]*clockChanges, pin *nl.DoPinGetReply) {
+	delete(m.pins, pin.Id)
+	c := m.changesOf(changes, pin.ClockId)
+	c.deletedPins[pin.Id] = pin
+	delete(c.pins, pin.Id)
+}
+
+// HandleMessages ... apply a batch of monitor notifications to the model and send the changes to the listeners,
+// the last notification of a device or pin in the batch wins
+func (m *Monitor) HandleMessages(msgs []genetlink.Message) {
+	m.notifyLock.Lock()
+	defer m.notifyLock.Unlock()
+	m.Lock()
+	changes := map[uint64]*clockChanges{}
+	for _, msg := range msgs {
+		switch msg.Header.Command {
+		case nl.DPLL_CMD_DEVICE_CREATE_NTF, nl.DPLL_CMD_DEVICE_CHANGE_NTF, nl.DPLL_CMD_DEVICE_DELETE_NTF:
+			devices, err := nl.ParseDeviceReplies([]genetlink.Message{msg})
+			if err != nil {
+				glog.Errorf("failed to parse dpll device notification: %s", err)
+				continue
+			}
+			for _, device := range devices {
+				if msg.Header.Command == nl.DPLL_CMD_DEVICE_DELETE_NTF {
+					m.deleteDevice(changes, device)
+				} else {
+					m.setDevice(changes, device)
+				}
+			}
+		case nl.DPLL_CMD_PIN_CREATE_NTF, nl.DPLL_CMD_PIN_CHANGE_NTF, nl.DPLL_CMD_PIN_DELETE_NTF:
+			pins, err := nl.ParsePinReplies([]genetlink.Message{msg})
+			if err != nil {
+				glog.Errorf("failed to parse dpll pin notification: %s", err)
+				continue
+			}
+			for _, pin := range pins {
+				if msg.Header.Command == nl.DPLL_CMD_PIN_DELETE_NTF {
+					m.deletePin(changes, pin)
+				} else {
+					m.setPin(changes, pin)
+				}
+			}
+		default:
+			glog.Info("unhandled dpll message ", msg.Header.Command, msg.Data)
+		}
+	}
+	calls := m.fanOut(changes)
+	m.Unlock()
+	notify(calls)
+}
+
+// Resync ... replace the model with a full dump, devices and pins missing from it are deleted and every other
+// one is sent to the listeners again
+func (m *Monitor) Resync(devices []*nl.DoDeviceGetReply, pins []*nl.DoPinGetReply) {
+	m.notifyLock.Lock()
+	defer m.notifyLock.Unlock()
+	m.Lock()
+	changes := map[uint64]*clockChanges{}
+	for id, device := range m.devices {
+		if !slices.ContainsFunc(devices, func(d *nl.DoDeviceGetReply) bool { return d.Id == id }) {
+			m.deleteDevice(changes, device)
+		}
+	}
+	for id, pin := range m.pins {
+		if !slices.ContainsFunc(pins, func(p *nl.DoPinGetReply) bool { return p.Id == id }) {
+			m.deletePin(changes, pin)
+		}
+	}
+	for _, device := range devices {
+		m.setDevice(changes, device)
+	}
+	for _, pin := range pins {
+		m.setPin(changes, pin)
+	}
+	calls := m.fanOut(changes)
+	m.Unlock()
+	notify(calls)
+}
+
+// listenerCall ... changes of a clock to send to its listeners
+type listenerCall struct {
+	listeners []Listener
+	deleted   bool
+	devices   []*nl.DoDeviceGetReply
+	pins      []*nl.DoPinGetReply
+}
+
+// fanOut ... the calls sending the changes of every clock to its listeners, deletions first. Called with the model
+// lock held, the listeners are copied so the calls are made after releasing it.
+func (m *Monitor) fanOut(changes map[uint64]*clockChanges) []listenerCall {
+	var calls []listenerCall
+	for clockId, c := range changes {
+		listeners := slices.Clone(m.listeners[clockId])
+		if len(listeners) == 0 {
+			continue
+		}
+		if len(c.deletedDevices) > 0 || len(c.deletedPins) > 0 {
+			calls = append(calls, listenerCall{listeners: listeners, deleted: true,
+				devices: sortDevices(mapValues(c.deletedDevices)), pins: sortPins(mapValues(c.deletedPins))})
+		}
+		if len(c.devices) > 0 || len(c.pins) > 0 {
+			calls = append(calls, listenerCall{listeners: listeners,
+				devices: sortDevices(mapValues(c.devices)), pins: sortPins(mapValues(c.pins))})
+		}
+	}
+	return calls
+}
+
+// notify ... make the calls, without the model lock held since listeners do netlink I/O
+func notify(calls []listenerCall) {
+	for _, call := range calls {
+		for _, l := range call.listeners {
+			if call.deleted {
+				l.DpllDeleted(call.devices, call.pins)
+			} else {
+				l.DpllChanged(call.devices, call.pins)
+			}
+		}
+	}
+}
+
+func mapValues[T any](m map[uint32]T) []T {
+	values := make([]T, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	return values
+}
+
+func sortDevices(devices []*nl.DoDeviceGetReply) []*nl.DoDeviceGetReply {
+	slices.SortFunc(devices, func(a, b *nl.DoDeviceGetReply) int { return int(a.Id) - int(b.Id) })
+	return devices
+}
+
+func sortPins(pins []*nl.DoPinGetReply) []*nl.DoPinGetReply {
+	slices.SortFunc(pins, func(a, b *nl.DoPinGetReply) int { return int(a.Id) - int(b.Id) })
+	return pins
+}
@@ -0,0 +1,155 @@
+package dpll_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	"github.com/openshift/linuxptp-daemon/pkg/dpll"
+	nl "github.com/openshift/linuxptp-daemon/pkg/dpll-netlink"
+	"github.com/openshift/linuxptp-daemon/pkg/dpll-netlink/dplltest"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingListener struct {
+	changedDevices, deletedDevices []uint32
+	changedPins, deletedPins       []uint32
+	changes                        int
+}
+
+func (l *recordingListener) DpllChanged(devices []*nl.DoDeviceGetReply, pins []*nl.DoPinGetReply) {
+	l.changes++
+	for _, d := range devices {
+		l.changedDevices = append(l.changedDevices, d.Id)
+	}
+	for _, p := range pins {
+		l.changedPins = append(l.changedPins, p.Id)
+	}
+}
+
+func (l *recordingListener) DpllDeleted(devices []*nl.DoDeviceGetReply, pins []*nl.DoPinGetReply) {
+	for _, d := range devices {
+		l.deletedDevices = append(l.deletedDevices, d.Id)
+	}
+	for _, p := range pins {
+		l.deletedPins = append(l.deletedPins, p.Id)
+	}
+}
+
+func (l *recordingListener) reset() {
+	*l = recordingListener{}
+}
+
+func deviceNtf(t *testing.T, cmd uint8, id uint32, clockId uint64, lockStatus uint32) genetlink.Message {
+	ae := netlink.NewAttributeEncoder()
+	ae.Uint32(nl.DPLL_A_ID, id)
+	ae.Uint64(nl.DPLL_A_CLOCK_ID, clockId)
+	ae.Uint32(nl.DPLL_A_LOCK_STATUS, lockStatus)
+	b, err := ae.Encode()
+	assert.NoError(t, err)
+	return genetlink.Message{Header: genetlink.Header{Command: cmd}, Data: b}
+}
+
+func pinNtf(t *testing.T, cmd uint8, id uint32, clockId uint64) genetlink.Message {
+	ae := netlink.NewAttributeEncoder()
+	ae.Uint32(nl.DPLL_A_PIN_ID, id)
+	ae.Uint64(nl.DPLL_A_PIN_CLOCK_ID, clockId)
+	b, err := ae.Encode()
+	assert.NoError(t, err)
+	return genetlink.Message{Header: genetlink.Header{Command: cmd}, Data: b}
+}
+
+func TestMonitor_FanOut(t *testing.T) {
+	m := dpll.NewMonitor()
+	a, b := &recordingListener{}, &recordingListener{}
+	m.Subscribe(clockid, a)
+	m.Subscribe(clockid+1, b)
+
+	// the last notification of a device wins, every clock gets its own changes in one call
+	m.HandleMessages([]genetlink.Message{
+		deviceNtf(t, nl.DPLL_CMD_DEVICE_CREATE_NTF, 1, clockid, 1),
+		deviceNtf(t, nl.DPLL_CMD_DEVICE_CHANGE_NTF, 1, clockid, 2),
+		deviceNtf(t, nl.DPLL_CMD_DEVICE_CREATE_NTF, 2, clockid+1, 2),
+		pinNtf(t, nl.DPLL_CMD_PIN_CHANGE_NTF, 7, clockid),
+		pinNtf(t, nl.DPLL_CMD_PIN_CREATE_NTF, 8, clockid+2),
+	})
+	assert.Equal(t, &recordingListener{changedDevices: []uint32{1}, changedPins: []uint32{7}, changes: 1}, a)
+	assert.Equal(t, &recordingListener{changedDevices: []uint32{2}, changes: 1}, b)
+	assert.Equal(t, []uint32{7, 8}, pinIds(m.Pins()), "the model keeps the pins of every clock")
+
+	// a new listener starts with the model of its clock
+	c := &recordingListener{}
+	m.Subscribe(clockid, c)
+	assert.Equal(t, &recordingListener{changedDevices: []uint32{1}, changedPins: []uint32{7}, changes: 1}, c)
+	m.Unsubscribe(clockid, c)
+
+	a.reset()
+	b.reset()
+	c.reset()
+	m.HandleMessages([]genetlink.Message{pinNtf(t, nl.DPLL_CMD_PIN_DELETE_NTF, 7, clockid)})
+	assert.Equal(t, &recordingListener{deletedPins: []uint32{7}}, a)
+	assert.Equal(t, &recordingListener{}, b)
+	assert.Equal(t, &recordingListener{}, c, "unsubscribed")
+	assert.Equal(t, []uint32{8}, pinIds(m.Pins()))
+}
+
+func pinIds(pins []*nl.DoPinGetReply) []uint32 {
+	ids := []uint32{}
+	for _, p := range pins {
+		ids = append(ids, p.Id)
+	}
+	return ids
+}
+
+func TestMonitor_Resync(t *testing.T) {
+	m := dpll.NewMonitor()
+	a := &recordingListener{}
+	m.Subscribe(clockid, a)
+	m.HandleMessages([]genetlink.Message{
+		deviceNtf(t, nl.DPLL_CMD_DEVICE_CREATE_NTF, 1, clockid, 2),
+		deviceNtf(t, nl.DPLL_CMD_DEVICE_CREATE_NTF, 2, clockid, 2),
+		pinNtf(t, nl.DPLL_CMD_PIN_CREATE_NTF, 7, clockid),
+		pinNtf(t, nl.DPLL_CMD_PIN_CREATE_NTF, 8, clockid),
+	})
+	a.reset()
+
+	// after an overrun the dump replaces the model: device 2 and pin 8 went away while notifications were dropped
+	m.Resync([]*nl.DoDeviceGetReply{{Id: 1, ClockId: clockid, LockStatus: 4}},
+		[]*nl.DoPinGetReply{{Id: 7, ClockId: clockid}, {Id: 9, ClockId: clockid}})
+	assert.Equal(t, &recordingListener{deletedDevices: []uint32{2}, deletedPins: []uint32{8},
+		changedDevices: []uint32{1}, changedPins: []uint32{7, 9}, changes: 1}, a)
+}
+
+// startingListener ... starts the monitor from its change handler, which takes the model lock
+type startingListener struct {
+	recordingListener
+	m *dpll.Monitor
+}
+
+func (l *startingListener) DpllChanged(devices []*nl.DoDeviceGetReply, pins []*nl.DoPinGetReply) {
+	l.m.Start()
+	l.recordingListener.DpllChanged(devices, pins)
+}
+
+func TestMonitor_ListenerWithoutLock(t *testing.T) {
+	sim := dplltest.New()
+	nl.SetDialer(sim.Dial)
+	t.Cleanup(func() { nl.SetDialer(nil) })
+	m := dpll.NewMonitor()
+	l := &startingListener{m: m}
+	m.Subscribe(clockid, l)
+	defer m.Unsubscribe(clockid, l)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.HandleMessages([]genetlink.Message{deviceNtf(t, nl.DPLL_CMD_DEVICE_CREATE_NTF, 1, clockid, 2)})
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("listener was called with the monitor lock held")
+	}
+	assert.Equal(t, []uint32{1}, l.changedDevices)
+}
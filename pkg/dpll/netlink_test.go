@@ -0,0 +1,154 @@
+package dpll_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	"github.com/openshift/linuxptp-daemon/pkg/dpll"
+	nl "github.com/openshift/linuxptp-daemon/pkg/dpll-netlink"
+	"github.com/openshift/linuxptp-daemon/pkg/dpll-netlink/dplltest"
+	"github.com/openshift/linuxptp-daemon/pkg/event"
+	"github.com/stretchr/testify/assert"
+)
+
+// simulatedClock ... simulated PPS and EEC DPLL devices of the clock, with an SMA input fed with the 1PPS of the
+// primary card
+func simulatedClock(t *testing.T) *dplltest.Simulator {
+	sim := dplltest.New()
+	nl.SetDialer(sim.Dial)
+	t.Cleanup(func() { nl.SetDialer(nil) })
+	modes := []uint32{nl.DPLL_MODE_MANUAL, nl.DPLL_MODE_AUTOMATIC}
+	for _, device := range ppsDevices(dpll.DPLL_LOCKED_HO_ACQ) {
+		device.Mode, device.ModeSupported = nl.DPLL_MODE_AUTOMATIC, modes
+		sim.AddDevice(*device)
+	}
+	sim.AddPin(*smaPin(nl.DPLL_PIN_STATE_CONNECTED, 0)[0])
+	return sim
+}
+
+func TestDpllConfig_MonitorDpllNetlink(t *testing.T) {
+	sim := simulatedClock(t)
+	d := dpll.NewDpll(clockid, dpll.LocalMaxHoldoverOffSet, dpll.LocalHoldoverTimeout, dpll.MaxInSpecOffset,
+		"ens2f0", []event.EventSource{event.PPS}, dpll.NONE, map[string]map[string]string{})
+	d.SetMode(nl.DPLL_MODE_MANUAL)
+	removed := make(chan uint32, 10)
+	d.SetRemoveHandler(func(devices []*nl.DoDeviceGetReply, pins []*nl.DoPinGetReply) {
+		for _, pin := range pins {
+			removed <- pin.Id
+		}
+	})
+	d.CmdInit()
+	assert.Equal(t, dpll.NETLINK, d.APIType())
+	d.MonitorDpll()
+	defer d.CmdStop()
+
+	assert.Eventually(t, func() bool { return d.State() == event.PTP_LOCKED }, time.Second, 10*time.Millisecond)
+	// the declared mode reaches the devices
+	assert.Eventually(t, func() bool {
+		device, _ := sim.Device(1)
+		return device.Mode == nl.DPLL_MODE_MANUAL
+	}, time.Second, 10*time.Millisecond)
+
+	// the SMA input loses its 1PPS: holdover, then the DPLL reports it too
+	sim.Run(
+		dplltest.Step{Do: func(s *dplltest.Simulator) { s.LosePin(7) }},
+		dplltest.Step{After: 100 * time.Millisecond, Do: func(s *dplltest.Simulator) { s.Holdover(clockid) }},
+	)
+	assert.Eventually(t, func() bool { return d.State() == event.PTP_HOLDOVER }, time.Second, 10*time.Millisecond)
+	assert.True(t, d.SourceLost())
+	assert.Equal(t, int64(dpll.DPLL_HOLDOVER), d.PhaseStatus())
+
+	// notifications dropped meanwhile are recovered by the resync
+	sim.Overrun()
+	sim.SetPinParent(7, smaPin(nl.DPLL_PIN_STATE_CONNECTED, 0)[0].ParentDevice[0])
+	sim.Lock(clockid)
+	assert.Eventually(t, func() bool { return d.State() == event.PTP_LOCKED && !d.OnHoldover() },
+		2*time.Second, 50*time.Millisecond)
+	assert.False(t, d.SourceLost())
+
+	// the removed pin is passed to the remove handler
+	sim.RemovePin(7)
+	select {
+	case id := <-removed:
+		assert.Equal(t, uint32(7), id)
+	case <-time.After(time.Second):
+		t.Error("removed pin not reported")
+	}
+}
+
+func TestDpllConfig_PinPrioritiesConnection(t *testing.T) {
+	sim := simulatedClock(t)
+	var dials atomic.Int32
+	nl.SetDialer(func(cfg *netlink.Config) (*genetlink.Conn, error) {
+		dials.Add(1)
+		return sim.Dial(cfg)
+	})
+	parent := nl.PinParentDevice{ParentId: 1, Direction: nl.DPLL_PIN_DIRECTION_INPUT,
+		State: nl.DPLL_PIN_STATE_SELECTABLE, Prio: 5}
+	sim.AddPin(nl.DoPinGetReply{Id: 8, ClockId: clockid, BoardLabel: "SMA2",
+		Capabilities: nl.DPLL_PIN_CAPABILITIES_PRIORITY_CAN_CHANGE, ParentDevice: []nl.PinParentDevice{parent}})
+	d := dpll.NewDpll(clockid, dpll.LocalMaxHoldoverOffSet, dpll.LocalHoldoverTimeout, dpll.MaxInSpecOffset,
+		"ens2f0", []event.EventSource{event.PPS}, dpll.NONE, map[string]map[string]string{})
+	d.SetPinPriorities([]string{"SMA2"})
+	d.CmdInit()
+	d.MonitorDpll()
+	defer d.CmdStop()
+
+	enforced := func() bool {
+		pin, _ := sim.Pin(8)
+		return pin.ParentDeviceById(1).Prio == 0
+	}
+	assert.Eventually(t, enforced, time.Second, 10*time.Millisecond)
+	dialed := dials.Load()
+
+	// the driver restores the priority on every notification, the requests reuse the connection
+	for i := 0; i < 3; i++ {
+		sim.SetPinParent(8, parent)
+		assert.Eventually(t, enforced, time.Second, 10*time.Millisecond)
+	}
+	assert.Equal(t, dialed, dials.Load())
+}
+
+func TestDpllConfig_SelectInputPinNetlink(t *testing.T) {
+	sim := simulatedClock(t)
+	var dials atomic.Int32
+	nl.SetDialer(func(cfg *netlink.Config) (*genetlink.Conn, error) {
+		dials.Add(1)
+		return sim.Dial(cfg)
+	})
+	sim.RemovePin(7)
+	for _, pin := range []nl.DoPinGetReply{
+		{Id: 7, BoardLabel: "SMA1", ParentDevice: []nl.PinParentDevice{{ParentId: 1,
+			Direction: nl.DPLL_PIN_DIRECTION_INPUT, State: nl.DPLL_PIN_STATE_CONNECTED}}},
+		{Id: 8, BoardLabel: "SMA2", ParentDevice: []nl.PinParentDevice{{ParentId: 1,
+			Direction: nl.DPLL_PIN_DIRECTION_INPUT, State: nl.DPLL_PIN_STATE_DISCONNECTED}}},
+	} {
+		pin.ClockId, pin.Capabilities = clockid, nl.DPLL_PIN_CAPABILITIES_STATE_CAN_CHANGE
+		sim.AddPin(pin)
+	}
+	d := dpll.NewDpll(clockid, dpll.LocalMaxHoldoverOffSet, dpll.LocalHoldoverTimeout, dpll.MaxInSpecOffset,
+		"ens2f0", []event.EventSource{event.PPS}, dpll.NONE, map[string]map[string]string{})
+	d.SetMode(nl.DPLL_MODE_MANUAL)
+	d.SetPinPriorities([]string{"SMA2", "SMA1"})
+	d.CmdInit()
+	d.MonitorDpll()
+	defer d.CmdStop()
+
+	connected := func(id uint32) func() bool {
+		return func() bool {
+			pin, _ := sim.Pin(id)
+			return pin.ParentDeviceById(1).State == nl.DPLL_PIN_STATE_CONNECTED
+		}
+	}
+	assert.Eventually(t, connected(8), time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool { return !connected(7)() }, time.Second, 10*time.Millisecond)
+	dialed := dials.Load()
+
+	// the selected pin loses its signal, the next one in priority is connected over the same connection
+	sim.LosePin(8)
+	assert.Eventually(t, connected(7), time.Second, 10*time.Millisecond)
+	assert.Equal(t, dialed, dials.Load())
+}
@@ -0,0 +1,376 @@
+package dpll
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	nl "github.com/openshift/linuxptp-daemon/pkg/dpll-netlink"
+	"github.com/openshift/linuxptp-daemon/pkg/event"
+)
+
+// frequency sources of the oscillator model. The fractional frequency offset of the DPLL input pins is not one:
+// reported in ppm, its quantization noise alone projects a holdover out of specification within seconds.
+const (
+	FrequencySourceTs2phc = "ts2phc" // ts2phc frequency adjustment of the PHC
+)
+
+const (
+	modelBinWidth    = 60 * time.Second // frequency samples are averaged per bin
+	modelWindow      = 24 * time.Hour   // bins older than the window are dropped
+	modelMinBins     = 10               // bins needed before the model replaces the linear slope
+	modelMinTempSpan = 1.0              // celsius spanned by the bins before a temperature coefficient is fitted
+	modelConfidence  = 3.0              // standard deviations covered by the confidence bound
+)
+
+// modelSources ... sources by preference, the first one with enough bins is fitted
+var modelSources = []string{FrequencySourceTs2phc}
+
+// sourceResolution ... resolution of the frequency samples of a source in ppb; the noise of the fit is never
+// taken lower than the quantization noise, so that a constant coarse reading does not look like a perfect oscillator
+var sourceResolution = map[string]float64{
+	FrequencySourceTs2phc: 1,
+}
+
+var modelDir string
+
+// SetModelDir ... directory the learned oscillator models are kept in across restarts, empty keeps them in memory only
+func SetModelDir(dir string) {
+	modelDir = dir
+}
+
+// FrequencyBin ... mean fractional frequency offset of the oscillator over one bin while locked
+type FrequencyBin struct {
+	Time        time.Time `json:"time"`         // first sample of the bin
+	Frequency   float64   `json:"frequencyPpb"` // oscillator frequency offset from the reference
+	Samples     int       `json:"samples"`
+	Temperature float64   `json:"temperatureCelsius,omitempty"` // mean DPLL temperature
+	TempSamples int       `json:"tempSamples,omitempty"`
+}
+
+// OscillatorModel ... frequency offset of the local oscillator of a clock, learned per source while the DPLL is
+// locked, to project the time error in holdover
+type OscillatorModel struct {
+	sync.Mutex
+	ClockId uint64                    `json:"clockId"`
+	Sources map[string][]FrequencyBin `json:"sources"`
+}
+
+// OscillatorFit ... least squares fit of the bins of one source, y(t) = Frequency + Drift·t + TempCoefficient·ΔT,
+// with t and ΔT taken from the latest bin
+type OscillatorFit struct {
+	Source             string
+	Bins               int
+	Frequency          float64 // ppb
+	Drift              float64 // ppb/s
+	TempCoefficient    float64 // ppb/celsius, 0 while the temperature did not vary enough
+	Temperature        float64 // celsius of the latest bin
+	FrequencyErr       float64 // standard errors of the coefficients
+	DriftErr           float64
+	TempCoefficientErr float64
+	Noise              float64 // residual standard deviation, ppb
+}
+
+// Projection ... time error projected in holdover, in nanoseconds
+type Projection struct {
+	Offset float64
+	Bound  float64 // confidence bound around Offset
+}
+
+// Worst ... largest absolute time error within the confidence bound
+func (p Projection) Worst() float64 {
+	return math.Abs(p.Offset) + p.Bound
+}
+
+// NewOscillatorModel ... empty model of the oscillator of the clock
+func NewOscillatorModel(clockId uint64) *OscillatorModel {
+	return &OscillatorModel{ClockId: clockId, Sources: map[string][]FrequencyBin{}}
+}
+
+// AddSample ... add a frequency offset of the oscillator in ppb measured by source at t, with the DPLL temperature
+// when known; true when the sample opened a new bin
+func (m *OscillatorModel) AddSample(source string, t time.Time, ppb float64, temp float64, hasTemp bool) bool {
+	m.Lock()
+	defer m.Unlock()
+	bins := m.Sources[source]
+	opened := false
+	if n := len(bins); n == 0 || t.Sub(bins[n-1].Time) >= modelBinWidth {
+		bins = append(bins, FrequencyBin{Time: t})
+		opened = true
+	}
+	b := &bins[len(bins)-1]
+	b.Samples++
+	b.Frequency += (ppb - b.Frequency) / float64(b.Samples)
+	if hasTemp {
+		b.TempSamples++
+		b.Temperature += (temp - b.Temperature) / float64(b.TempSamples)
+	}
+	for len(bins) > 0 && t.Sub(bins[0].Time) > modelWindow {
+		bins = bins[1:]
+	}
+	m.Sources[source] = bins
+	return opened
+}
+
+// Fit ... fit of the preferred source having enough bins, false while no source can be trusted
+func (m *OscillatorModel) Fit() (OscillatorFit, bool) {
+	if m == nil {
+		return OscillatorFit{}, false
+	}
+	m.Lock()
+	defer m.Unlock()
+	for _, source := range modelSources {
+		if len(m.Sources[source]) >= modelMinBins {
+			return fitBins(source, m.Sources[source])
+		}
+	}
+	return OscillatorFit{}, false
+}
+
+// fitBins ... least squares fit of the bins; the temperature term is only fitted when every bin has a temperature
+// and the bins span modelMinTempSpan
+func fitBins(source string, bins []FrequencyBin) (OscillatorFit, bool) {
+	last := bins[len(bins)-1]
+	withTemp := true
+	minT, maxT := math.Inf(1), math.Inf(-1)
+	for _, b := range bins {
+		if b.TempSamples == 0 {
+			withTemp = false
+			break
+		}
+		minT, maxT = math.Min(minT, b.Temperature), math.Max(maxT, b.Temperature)
+	}
+	withTemp = withTemp && maxT-minT >= modelMinTempSpan
+	p := 2
+	if withTemp {
+		p = 3
+	}
+	if len(bins) <= p {
+		return OscillatorFit{}, false
+	}
+	row := func(b FrequencyBin) []float64 {
+		x := []float64{1, b.Time.Sub(last.Time).Seconds()}
+		if withTemp {
+			x = append(x, b.Temperature-last.Temperature)
+		}
+		return x
+	}
+	xtx := make([][]float64, p)
+	for i := range xtx {
+		xtx[i] = make([]float64, p)
+	}
+	xty := make([]float64, p)
+	for _, b := range bins {
+		x := row(b)
+		for i := 0; i < p; i++ {
+			xty[i] += x[i] * b.Frequency
+			for j := 0; j < p; j++ {
+				xtx[i][j] += x[i] * x[j]
+			}
+		}
+	}
+	inv, ok := invert(xtx)
+	if !ok {
+		return OscillatorFit{}, false
+	}
+	coef := make([]float64, p)
+	for i := 0; i < p; i++ {
+		for j := 0; j < p; j++ {
+			coef[i] += inv[i][j] * xty[j]
+		}
+	}
+	ssr := 0.0
+	for _, b := range bins {
+		x, y := row(b), b.Frequency
+		for i := 0; i < p; i++ {
+			y -= coef[i] * x[i]
+		}
+		ssr += y * y
+	}
+	variance := math.Max(ssr/float64(len(bins)-p), sourceResolution[source]*sourceResolution[source]/12)
+	f := OscillatorFit{
+		Source:       source,
+		Bins:         len(bins),
+		Frequency:    coef[0],
+		Drift:        coef[1],
+		Temperature:  last.Temperature,
+		FrequencyErr: math.Sqrt(variance * inv[0][0]),
+		DriftErr:     math.Sqrt(variance * inv[1][1]),
+		Noise:        math.Sqrt(variance),
+	}
+	if withTemp {
+		f.TempCoefficient = coef[2]
+		f.TempCoefficientErr = math.Sqrt(variance * inv[2][2])
+	}
+	return f, true
+}
+
+// invert ... inverse of a small symmetric matrix by Gauss-Jordan elimination, false when it is singular
+func invert(a [][]float64) ([][]float64, bool) {
+	n := len(a)
+	m := make([][]float64, n)
+	for i := range a {
+		m[i] = make([]float64, 2*n)
+		copy(m[i], a[i])
+		m[i][n+i] = 1
+	}
+	for c := 0; c < n; c++ {
+		pivot := c
+		for r := c + 1; r < n; r++ {
+			if math.Abs(m[r][c]) > math.Abs(m[pivot][c]) {
+				pivot = r
+			}
+		}
+		if math.Abs(m[pivot][c]) < 1e-12 {
+			return nil, false
+		}
+		m[c], m[pivot] = m[pivot], m[c]
+		pv := m[c][c]
+		for j := range m[c] {
+			m[c][j] /= pv
+		}
+		for r := 0; r < n; r++ {
+			if r == c || m[r][c] == 0 {
+				continue
+			}
+			k := m[r][c]
+			for j := range m[r] {
+				m[r][j] -= k * m[c][j]
+			}
+		}
+	}
+	inv := make([][]float64, n)
+	for i := range m {
+		inv[i] = m[i][n:]
+	}
+	return inv, true
+}
+
+// Project ... time error after elapsed seconds of holdover. The DPLL holds the frequency it had when the reference
+// was lost, so the error comes from the drift since then and from the temperature change, tempIntegral being
+// ∫(T - Temperature)dt in celsius·seconds. The bound adds the uncertainty of the held frequency, of the drift and
+// of the temperature coefficient, and the random walk of the frequency noise.
+func (f OscillatorFit) Project(elapsed, tempIntegral float64) Projection {
+	offset := f.Drift*elapsed*elapsed/2 + f.TempCoefficient*tempIntegral
+	bound := f.FrequencyErr*elapsed + f.DriftErr*elapsed*elapsed/2 + f.TempCoefficientErr*math.Abs(tempIntegral) +
+		f.Noise*math.Sqrt(modelBinWidth.Seconds()*elapsed)
+	return Projection{Offset: offset, Bound: modelConfidence * bound}
+}
+
+// modelPath ... file of the model of the clock in dir
+func modelPath(dir string, clockId uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("oscillator-%x.json", clockId))
+}
+
+// Save ... write the model to dir, replacing the previous one
+func (m *OscillatorModel) Save(dir string) error {
+	m.Lock()
+	b, err := json.Marshal(m)
+	m.Unlock()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create oscillator model directory: %w", err)
+	}
+	path := modelPath(dir, m.ClockId)
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadOscillatorModel ... model of the clock saved in dir, an empty one when there is none
+func LoadOscillatorModel(dir string, clockId uint64) (*OscillatorModel, error) {
+	m := NewOscillatorModel(clockId)
+	b, err := os.ReadFile(modelPath(dir, clockId))
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return m, err
+	}
+	if err = json.Unmarshal(b, m); err != nil {
+		return NewOscillatorModel(clockId), fmt.Errorf("corrupt oscillator model %s: %w", modelPath(dir, clockId), err)
+	}
+	if m.Sources == nil {
+		m.Sources = map[string][]FrequencyBin{}
+	}
+	// bins of sources no longer learned, e.g. the DPLL FFO
+	for source := range m.Sources {
+		if !slices.Contains(modelSources, source) {
+			delete(m.Sources, source)
+		}
+	}
+	m.ClockId = clockId
+	return m, nil
+}
+
+// loadModel ... the oscillator model of the clock saved by a previous run, an empty one without
+func (d *DpllConfig) loadModel() {
+	d.model = NewOscillatorModel(d.clockId)
+	if modelDir == "" {
+		return
+	}
+	m, err := LoadOscillatorModel(modelDir, d.clockId)
+	if err != nil {
+		glog.Errorf("%s: failed to load the oscillator model, learning it again: %s", d.iface, err)
+	}
+	d.model = m
+}
+
+// Model ... learned oscillator model of the clock
+func (d *DpllConfig) Model() *OscillatorModel {
+	return d.model
+}
+
+// FrequencySample ... frequency offset of the oscillator in ppb from source; samples are only learned while the
+// DPLL is locked to its reference
+func (d *DpllConfig) FrequencySample(source string, ppb float64) {
+	d.Lock()
+	defer d.Unlock()
+	d.frequencySample(source, ppb)
+}
+
+func (d *DpllConfig) frequencySample(source string, ppb float64) {
+	if d.model == nil || d.state != event.PTP_LOCKED || d.onHoldover {
+		return
+	}
+	d.model.AddSample(source, time.Now(), ppb, d.temperature, d.hasTemperature)
+}
+
+// saveModel ... keep the learned model across restarts; it is saved when a holdover starts and when the DPLL stops
+func (d *DpllConfig) saveModel() {
+	if d.model == nil || modelDir == "" {
+		return
+	}
+	if err := d.model.Save(modelDir); err != nil {
+		glog.Errorf("%s: failed to save the oscillator model: %s", d.iface, err)
+	}
+}
+
+// learnTemperature ... learn the temperature of the DPLL devices, called with d locked
+func (d *DpllConfig) learnTemperature(devices []*nl.DoDeviceGetReply) {
+	for _, reply := range devices {
+		if reply.ClockId == d.clockId && reply.Temp != 0 {
+			d.temperature, d.hasTemperature = float64(reply.Temp)/nl.DPLL_TEMP_DIVIDER, true
+		}
+	}
+}
+
+// holdoverEstimate ... estimated time error after elapsed seconds of holdover in ns: the worst case of the
+// projection of the learned oscillator model, or the linear slope while the model is not trained
+func (d *DpllConfig) holdoverEstimate(fit OscillatorFit, trained bool, elapsed, tempIntegral float64) int64 {
+	if !trained {
+		return int64(math.Round(d.slope * elapsed))
+	}
+	p := fit.Project(elapsed, tempIntegral)
+	glog.Infof("(%s) holdover projection %.1f ns ± %.1f ns after %.0f s", d.iface, p.Offset, p.Bound, elapsed)
+	return int64(math.Round(p.Worst()))
+}
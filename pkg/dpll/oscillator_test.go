@@ -0,0 +1,128 @@
+package dpll_test
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openshift/linuxptp-daemon/pkg/dpll"
+	"github.com/openshift/linuxptp-daemon/pkg/event"
+	"github.com/stretchr/testify/assert"
+)
+
+// trainModel ... two hours of samples every 10s, frequency y(t) in ppb and temperature temp(t) at t seconds
+func trainModel(m *dpll.OscillatorModel, source string, start time.Time, y, temp func(t float64) float64) {
+	for s := 0.0; s < 7200; s += 10 {
+		if temp == nil {
+			m.AddSample(source, start.Add(time.Duration(s)*time.Second), y(s), 0, false)
+		} else {
+			m.AddSample(source, start.Add(time.Duration(s)*time.Second), y(s), temp(s), true)
+		}
+	}
+}
+
+func TestOscillatorModel_Fit(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := dpll.NewOscillatorModel(clockid)
+	_, trained := m.Fit()
+	assert.False(t, trained, "no samples")
+
+	// aging of 1e-4 ppb/s around 5 ppb
+	trainModel(m, dpll.FrequencySourceTs2phc, start, func(s float64) float64 { return 5 + 1e-4*s }, nil)
+	fit, trained := m.Fit()
+	if assert.True(t, trained) {
+		assert.Equal(t, dpll.FrequencySourceTs2phc, fit.Source)
+		assert.Equal(t, 120, fit.Bins)
+		assert.InDelta(t, 1e-4, fit.Drift, 1e-6)
+		assert.InDelta(t, 5+1e-4*7175, fit.Frequency, 0.5, "frequency of the latest bin")
+		assert.Zero(t, fit.TempCoefficient)
+		assert.InDelta(t, 1/math.Sqrt(12), fit.Noise, 1e-9, "a perfect fit keeps the quantization noise")
+	}
+
+	// the projection follows the drift, and the bound widens with time
+	p1 := fit.Project(600, 0)
+	p2 := fit.Project(3600, 0)
+	assert.InDelta(t, 1e-4*600*600/2, p1.Offset, 1)
+	assert.InDelta(t, 1e-4*3600*3600/2, p2.Offset, 10)
+	assert.Greater(t, p1.Bound, 0.0)
+	assert.Greater(t, p2.Bound, p1.Bound)
+	assert.Equal(t, math.Abs(p2.Offset)+p2.Bound, p2.Worst())
+}
+
+func TestOscillatorModel_Temperature(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := dpll.NewOscillatorModel(clockid)
+	temp := func(s float64) float64 { return 40 + 3*math.Sin(s/1000) }
+	trainModel(m, dpll.FrequencySourceTs2phc, start, func(s float64) float64 { return 2 + 0.5*(temp(s)-40) }, temp)
+	fit, trained := m.Fit()
+	if assert.True(t, trained) {
+		assert.InDelta(t, 0.5, fit.TempCoefficient, 0.05)
+		assert.InDelta(t, 0, fit.Drift, 1e-4)
+	}
+	// 2 °C warmer for 1000 s
+	assert.InDelta(t, 0.5*2*1000, fit.Project(1000, 2*1000).Offset, 100)
+}
+
+func TestOscillatorModel_Sources(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := dpll.NewOscillatorModel(clockid)
+	// a DPLL FFO in ppm is too coarse to project a holdover from, it is never fitted
+	trainModel(m, "ffo", start, func(float64) float64 { return 0 }, nil)
+	_, trained := m.Fit()
+	assert.False(t, trained)
+
+	// ts2phc is fitted once it has enough bins
+	for i := 0; i < 9; i++ {
+		m.AddSample(dpll.FrequencySourceTs2phc, start.Add(time.Duration(i)*time.Minute), 1, 0, false)
+	}
+	_, trained = m.Fit()
+	assert.False(t, trained)
+	m.AddSample(dpll.FrequencySourceTs2phc, start.Add(9*time.Minute), 1, 0, false)
+	fit, trained := m.Fit()
+	assert.True(t, trained)
+	assert.Equal(t, dpll.FrequencySourceTs2phc, fit.Source)
+
+	// bins older than a day are dropped
+	m.AddSample(dpll.FrequencySourceTs2phc, start.Add(26*time.Hour), 1, 0, false)
+	assert.Len(t, m.Sources[dpll.FrequencySourceTs2phc], 1)
+}
+
+func TestOscillatorModel_Persistence(t *testing.T) {
+	dir := t.TempDir()
+	m := dpll.NewOscillatorModel(clockid)
+	trainModel(m, dpll.FrequencySourceTs2phc, time.Now().Add(-2*time.Hour), func(s float64) float64 { return 3 - 2e-5*s }, nil)
+	m.AddSample("ffo", time.Now(), 0, 0, false)
+	assert.NoError(t, m.Save(dir))
+	want, _ := m.Fit()
+
+	loaded, err := dpll.LoadOscillatorModel(dir, clockid)
+	assert.NoError(t, err)
+	got, trained := loaded.Fit()
+	assert.True(t, trained)
+	assert.InDelta(t, want.Drift, got.Drift, 1e-12)
+	assert.NotContains(t, loaded.Sources, "ffo", "bins of a source no longer learned")
+
+	// a restarted daemon projects the holdover with the saved model
+	dpll.SetModelDir(dir)
+	defer dpll.SetModelDir("")
+	d := dpll.NewDpll(clockid, dpll.LocalMaxHoldoverOffSet, dpll.LocalHoldoverTimeout, dpll.MaxInSpecOffset,
+		"test", []event.EventSource{event.GNSS}, dpll.MOCK, map[string]map[string]string{})
+	_, trained = d.Model().Fit()
+	assert.True(t, trained)
+	// and saves it again when it stops
+	path := filepath.Join(dir, fmt.Sprintf("oscillator-%x.json", clockid))
+	assert.NoError(t, os.Remove(path))
+	d.CmdStop()
+	assert.FileExists(t, path)
+
+	empty, err := dpll.LoadOscillatorModel(dir, clockid+1)
+	assert.NoError(t, err, "no model saved")
+	assert.Empty(t, empty.Sources)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "oscillator-bad.json"), []byte("{"), 0644))
+	_, err = dpll.LoadOscillatorModel(dir, 0xbad)
+	assert.Error(t, err)
+}
@@ -0,0 +1,145 @@
+package dpll
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/golang/glog"
+	nl "github.com/openshift/linuxptp-daemon/pkg/dpll-netlink"
+)
+
+// PinPrioritiesStr ... ptpSettings key of the input pins of an interface DPLL by descending priority,
+// pinPriorities[ens1f0]: GNSS-1PPS,SMA1,C827_0-RCLKA
+const PinPrioritiesStr = "pinPriorities"
+
+// ParsePinPriorities ... pin labels of a comma separated pinPriorities setting, highest priority first
+func ParsePinPriorities(s string) []string {
+	var labels []string
+	for _, label := range strings.Split(s, ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// pinLabelMatch ... true when the board or panel label of the pin is label
+func pinLabelMatch(pin *nl.DoPinGetReply, label string) bool {
+	return strings.EqualFold(pin.BoardLabel, label) || strings.EqualFold(pin.PanelLabel, label)
+}
+
+// PinPriorityRequests ... pin-set requests giving the input pins of the clock the priority of their position in
+// priorities towards every DPLL device of the clock they are attached to, the first label gets the highest
+// priority 0. Parent devices reporting the desired priority already, and pins whose priority cannot change, are
+// left alone.
+func PinPriorityRequests(clockId uint64, priorities []string, deviceIds []uint32, pins []*nl.DoPinGetReply) []nl.PinSetRequest {
+	var requests []nl.PinSetRequest
+	for _, pin := range pins {
+		if pin.ClockId != clockId {
+			continue
+		}
+		for i, label := range priorities {
+			if !pinLabelMatch(pin, label) {
+				continue
+			}
+			prio := uint32(i)
+			req := nl.PinSetRequest{Id: pin.Id}
+			for _, id := range deviceIds {
+				pd := pin.ParentDeviceById(id)
+				if pd == nil || pd.Direction != nl.DPLL_PIN_DIRECTION_INPUT || pd.Prio == prio {
+					continue
+				}
+				req.ParentDevice = append(req.ParentDevice, nl.PinParentDeviceCtl{Id: id, Prio: &prio})
+			}
+			if len(req.ParentDevice) == 0 {
+				break
+			}
+			if pin.Capabilities&nl.DPLL_PIN_CAPABILITIES_PRIORITY_CAN_CHANGE == 0 {
+				glog.Warningf("dpll pin %s priority cannot be changed to %d", label, prio)
+				break
+			}
+			requests = append(requests, req)
+			break
+		}
+	}
+	return requests
+}
+
+// SetPinPriorities ... input pin labels by descending priority, enforced on the DPLL devices of the clock
+func (d *DpllConfig) SetPinPriorities(labels []string) {
+	d.Lock()
+	defer d.Unlock()
+	d.pinPriorities = labels
+}
+
+// addDevice ... remember a DPLL device of the clock, the parent device of its pins, called with d locked
+func (d *DpllConfig) addDevice(id, typ uint32) {
+	if d.deviceTypes == nil {
+		d.deviceTypes = map[uint32]uint32{}
+	}
+	d.deviceTypes[id] = typ
+	for _, known := range d.deviceIds {
+		if known == id {
+			return
+		}
+	}
+	d.deviceIds = append(d.deviceIds, id)
+}
+
+// withConn ... run f over the netlink connection of the device and pin requests of the DPLL, dialed on the first
+// request and kept for the next ones. A failing f closes it, the next request dials again.
+func (d *DpllConfig) withConn(f func(conn *nl.Conn) error) error {
+	d.connLock.Lock()
+	defer d.connLock.Unlock()
+	if d.conn == nil {
+		conn, err := nl.Dial(nil)
+		if err != nil {
+			glog.Errorf("%s: failed to dial dpll netlink: %s", d.iface, err)
+			return err
+		}
+		d.conn = conn
+	}
+	err := f(d.conn)
+	if err != nil {
+		d.conn.Close()
+		d.conn = nil
+	}
+	return err
+}
+
+// closeConn ... close the netlink connection of the device and pin requests
+func (d *DpllConfig) closeConn() {
+	d.connLock.Lock()
+	defer d.connLock.Unlock()
+	if d.conn != nil {
+		d.conn.Close()
+		d.conn = nil
+	}
+}
+
+// enforcePinPriorities ... set the declared priorities of the input pins, at start and whenever the driver
+// reports a pin with another priority
+func (d *DpllConfig) enforcePinPriorities(pins []*nl.DoPinGetReply) {
+	d.Lock()
+	clockId, priorities, deviceIds := d.clockId, d.pinPriorities, slices.Clone(d.deviceIds)
+	d.Unlock()
+	if len(priorities) == 0 || len(deviceIds) == 0 {
+		return
+	}
+	requests := PinPriorityRequests(clockId, priorities, deviceIds, pins)
+	if len(requests) == 0 {
+		return
+	}
+	d.withConn(func(conn *nl.Conn) error {
+		var failed error
+		for _, req := range requests {
+			if err := conn.PinSet(req); err != nil {
+				glog.Errorf("%s: failed to set priority %d of dpll pin %d: %s", d.iface, *req.ParentDevice[0].Prio, req.Id, err)
+				failed = err
+				continue
+			}
+			glog.Infof("%s: set priority of dpll pin %d to %d", d.iface, req.Id, *req.ParentDevice[0].Prio)
+		}
+		return failed
+	})
+}
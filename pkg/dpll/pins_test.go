@@ -0,0 +1,152 @@
+package dpll_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	"github.com/openshift/linuxptp-daemon/pkg/dpll"
+	nl "github.com/openshift/linuxptp-daemon/pkg/dpll-netlink"
+	"github.com/stretchr/testify/assert"
+)
+
+// inputPin ... input pin attached to the EEC DPLL 1 and the PPS DPLL 2 of the clock
+func inputPin(id uint32, label string, prio uint32) *nl.DoPinGetReply {
+	return &nl.DoPinGetReply{Id: id, ClockId: clockid, BoardLabel: label,
+		Capabilities: nl.DPLL_PIN_CAPABILITIES_PRIORITY_CAN_CHANGE | nl.DPLL_PIN_CAPABILITIES_STATE_CAN_CHANGE,
+		ParentDevice: []nl.PinParentDevice{
+			{ParentId: 1, Direction: nl.DPLL_PIN_DIRECTION_INPUT, Prio: prio, PhaseOffset: math.MaxInt64},
+			{ParentId: 2, Direction: nl.DPLL_PIN_DIRECTION_INPUT, Prio: prio},
+		}}
+}
+
+// setParents ... apply f to every parent device relationship of the pin
+func setParents(pin *nl.DoPinGetReply, f func(pd *nl.PinParentDevice)) {
+	for i := range pin.ParentDevice {
+		f(&pin.ParentDevice[i])
+	}
+}
+
+func TestPinPriorityRequests(t *testing.T) {
+	priorities := dpll.ParsePinPriorities(" GNSS-1PPS, SMA1 ,C827_0-RCLKA,")
+	assert.Equal(t, []string{"GNSS-1PPS", "SMA1", "C827_0-RCLKA"}, priorities)
+
+	fixed := inputPin(4, "C827_0-RCLKA", 9)
+	fixed.Capabilities = 0
+	other := inputPin(5, "SMA1", 7)
+	other.ClockId = clockid + 1
+	output := inputPin(6, "SMA2", 7)
+	setParents(output, func(pd *nl.PinParentDevice) { pd.Direction = nl.DPLL_PIN_DIRECTION_OUTPUT })
+	pps := inputPin(7, "GNSS-1PPS", 0)
+	pps.ParentDevice[1].Prio = 4 // reset on the PPS DPLL only
+	pins := []*nl.DoPinGetReply{
+		inputPin(1, "GNSS-1PPS", 0), // already set
+		inputPin(2, "sma1", 5),      // reset by the driver
+		inputPin(3, "U.FL2", 5),     // not declared
+		fixed, other, output, pps,
+	}
+	requests := dpll.PinPriorityRequests(clockid, priorities, []uint32{1, 2}, pins)
+	if assert.Len(t, requests, 2) {
+		assert.Equal(t, uint32(2), requests[0].Id)
+		if assert.Len(t, requests[0].ParentDevice, 2) {
+			for i, pd := range requests[0].ParentDevice {
+				assert.Equal(t, uint32(i+1), pd.Id)
+				assert.Equal(t, uint32(1), *pd.Prio)
+				assert.Nil(t, pd.State)
+			}
+		}
+		assert.Equal(t, uint32(7), requests[1].Id)
+		if assert.Len(t, requests[1].ParentDevice, 1) {
+			assert.Equal(t, uint32(2), requests[1].ParentDevice[0].Id)
+			assert.Equal(t, uint32(0), *requests[1].ParentDevice[0].Prio)
+		}
+	}
+}
+
+func TestParsePinReplies_Parents(t *testing.T) {
+	ae := netlink.NewAttributeEncoder()
+	ae.Uint32(nl.DPLL_A_PIN_ID, 3)
+	ae.Uint64(nl.DPLL_A_PIN_CLOCK_ID, clockid)
+	for _, parent := range []struct{ id, state uint32 }{{1, nl.DPLL_PIN_STATE_CONNECTED}, {2, nl.DPLL_PIN_STATE_SELECTABLE}} {
+		parent := parent
+		ae.Nested(nl.DPLL_A_PIN_PARENT_DEVICE, func(ae *netlink.AttributeEncoder) error {
+			ae.Uint32(nl.DPLL_A_PIN_PARENT_ID, parent.id)
+			ae.Uint32(nl.DPLL_A_PIN_DIRECTION, nl.DPLL_PIN_DIRECTION_INPUT)
+			ae.Uint32(nl.DPLL_A_PIN_PRIO, parent.id+1)
+			ae.Uint32(nl.DPLL_A_PIN_STATE, parent.state)
+			if parent.id == 2 {
+				ae.Int64(nl.DPLL_A_PIN_PHASE_OFFSET, -1500)
+			}
+			return nil
+		})
+	}
+	for _, id := range []uint32{10, 11} {
+		id := id
+		ae.Nested(nl.DPLL_A_PIN_PARENT_PIN, func(ae *netlink.AttributeEncoder) error {
+			ae.Uint32(nl.DPLL_A_PIN_PARENT_ID, id)
+			ae.Uint32(nl.DPLL_A_PIN_STATE, nl.DPLL_PIN_STATE_DISCONNECTED)
+			return nil
+		})
+	}
+	b, err := ae.Encode()
+	assert.NoError(t, err)
+
+	replies, err := nl.ParsePinReplies([]genetlink.Message{{Data: b}})
+	assert.NoError(t, err)
+	if !assert.Len(t, replies, 1) {
+		return
+	}
+	pin := replies[0]
+	assert.Equal(t, []nl.PinParentDevice{
+		{ParentId: 1, Direction: nl.DPLL_PIN_DIRECTION_INPUT, Prio: 2, State: nl.DPLL_PIN_STATE_CONNECTED, PhaseOffset: math.MaxInt64},
+		{ParentId: 2, Direction: nl.DPLL_PIN_DIRECTION_INPUT, Prio: 3, State: nl.DPLL_PIN_STATE_SELECTABLE, PhaseOffset: -1500},
+	}, pin.ParentDevice)
+	assert.Equal(t, []nl.PinParentPin{{ParentId: 10, State: nl.DPLL_PIN_STATE_DISCONNECTED},
+		{ParentId: 11, State: nl.DPLL_PIN_STATE_DISCONNECTED}}, pin.ParentPin)
+	assert.Equal(t, int64(-1500), pin.ParentDeviceById(2).PhaseOffset)
+	assert.Nil(t, pin.ParentDeviceById(3))
+	assert.True(t, pin.HasDirection(nl.DPLL_PIN_DIRECTION_INPUT))
+	assert.False(t, pin.HasDirection(nl.DPLL_PIN_DIRECTION_OUTPUT))
+
+	hr := nl.GetPinHR(pin)
+	if assert.Len(t, hr.ParentDevice, 2) {
+		assert.Equal(t, "selectable", hr.ParentDevice[1].State)
+	}
+	assert.Len(t, hr.ParentPin, 2)
+}
+
+func TestEncodePinSet(t *testing.T) {
+	prio, state, frequency := uint32(2), uint32(nl.DPLL_PIN_STATE_SELECTABLE), uint64(10000000)
+	b, err := nl.EncodePinSet(nl.PinSetRequest{Id: 7, Frequency: &frequency,
+		ParentDevice: []nl.PinParentDeviceCtl{{Id: 1, Prio: &prio}, {Id: 2, State: &state}}})
+	assert.NoError(t, err)
+
+	ad, err := netlink.NewAttributeDecoder(b)
+	assert.NoError(t, err)
+	var parents []map[uint16]uint32
+	for ad.Next() {
+		switch ad.Type() {
+		case nl.DPLL_A_PIN_ID:
+			assert.Equal(t, uint32(7), ad.Uint32())
+		case nl.DPLL_A_PIN_FREQUENCY:
+			assert.Equal(t, frequency, ad.Uint64())
+		case nl.DPLL_A_PIN_PARENT_DEVICE:
+			parent := map[uint16]uint32{}
+			ad.Nested(func(nad *netlink.AttributeDecoder) error {
+				for nad.Next() {
+					parent[nad.Type()] = nad.Uint32()
+				}
+				return nil
+			})
+			parents = append(parents, parent)
+		default:
+			t.Errorf("unexpected attribute %d", ad.Type())
+		}
+	}
+	assert.NoError(t, ad.Err())
+	assert.Equal(t, []map[uint16]uint32{
+		{nl.DPLL_A_PIN_PARENT_ID: 1, nl.DPLL_A_PIN_PRIO: 2},
+		{nl.DPLL_A_PIN_PARENT_ID: 2, nl.DPLL_A_PIN_STATE: nl.DPLL_PIN_STATE_SELECTABLE},
+	}, parents)
+}
@@ -0,0 +1,92 @@
+package dpll
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	nl "github.com/openshift/linuxptp-daemon/pkg/dpll-netlink"
+	"github.com/openshift/linuxptp-daemon/pkg/event"
+)
+
+// Ts2phcPPSTimeout ... ts2phc logs an offset for every extts event of the 1PPS, once a second; a PPS fed DPLL whose
+// interface ts2phc did not report for this long lost its 1PPS
+var Ts2phcPPSTimeout = 3 * time.Second
+
+// ppsSourceLost ... a PPS fed DPLL lost its 1PPS input, e.g. the SMA 1PPS of the primary card: the PPS DPLL holds
+// over, ts2phc lost the extts events of the interface, or, once the pins of the clock were reported, no input pin
+// passing the phase offset pin filter is connected to the PPS DPLL with a phase offset measured. Called with d locked.
+func (d *DpllConfig) ppsSourceLost() bool {
+	if d.phaseStatus == DPLL_HOLDOVER || d.ts2phcLost {
+		return true
+	}
+	if len(d.pins) == 0 {
+		return false // no pin information, e.g. sysfs
+	}
+	for _, pin := range d.pins {
+		if !pin.HasDirection(nl.DPLL_PIN_DIRECTION_INPUT) || !d.phaseOffsetPin(pin) {
+			continue
+		}
+		if d.phaseOffsetParent(pin).State == nl.DPLL_PIN_STATE_CONNECTED {
+			return false
+		}
+	}
+	return true
+}
+
+// updatePPSSource ... follow the PPS input of a PPS fed DPLL, reported in the PPS_STATUS of the DPLL events.
+// Called with d locked.
+func (d *DpllConfig) updatePPSSource() {
+	lost := d.ppsSourceLost()
+	if lost != d.sourceLost {
+		glog.Infof("%s-dpll: pps source lost %v", d.iface, lost)
+	}
+	d.sourceLost = lost
+}
+
+// Ts2phcState ... clock state ts2phc reports for the interface of a PPS fed DPLL from its extts events. Once ts2phc
+// locked to the 1PPS, the 1PPS is lost when ts2phc falls back to FREERUN or stops reporting for Ts2phcPPSTimeout,
+// until it locks again. HOLDOVER follows the loss of the time of day source, the 1PPS still arrives.
+func (d *DpllConfig) Ts2phcState(state event.PTPState) {
+	d.update(func() (event.EventChannel, bool) {
+		if !d.hasPPSAsSource() {
+			return event.EventChannel{}, false
+		}
+		lost := d.ts2phcLost
+		switch state {
+		case event.PTP_LOCKED:
+			d.ts2phcLocked, lost = true, false
+			d.armTs2phcTimer()
+		case event.PTP_HOLDOVER:
+			d.armTs2phcTimer()
+		case event.PTP_FREERUN:
+			lost = d.ts2phcLocked
+		}
+		return d.setTs2phcLost(lost)
+	})
+}
+
+// armTs2phcTimer ... (re)start the extts timeout of the interface, called with d locked
+func (d *DpllConfig) armTs2phcTimer() {
+	if d.ts2phcTimer == nil {
+		d.ts2phcTimer = time.AfterFunc(Ts2phcPPSTimeout, d.ts2phcTimeout)
+		return
+	}
+	d.ts2phcTimer.Reset(Ts2phcPPSTimeout)
+}
+
+// ts2phcTimeout ... ts2phc did not report the interface for Ts2phcPPSTimeout
+func (d *DpllConfig) ts2phcTimeout() {
+	d.update(func() (event.EventChannel, bool) {
+		return d.setTs2phcLost(d.ts2phcLocked)
+	})
+}
+
+// setTs2phcLost ... the state decision when the 1PPS seen by ts2phc came or went, called with d locked
+func (d *DpllConfig) setTs2phcLost(lost bool) (event.EventChannel, bool) {
+	if lost == d.ts2phcLost {
+		return event.EventChannel{}, false
+	}
+	glog.Infof("%s-dpll: ts2phc 1PPS lost %v", d.iface, lost)
+	d.ts2phcLost = lost
+	return d.stateDecision()
+}
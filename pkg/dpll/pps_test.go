@@ -0,0 +1,98 @@
+package dpll_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/openshift/linuxptp-daemon/pkg/dpll"
+	nl "github.com/openshift/linuxptp-daemon/pkg/dpll-netlink"
+	"github.com/openshift/linuxptp-daemon/pkg/event"
+	"github.com/stretchr/testify/assert"
+)
+
+// ppsDevices ... EEC and PPS DPLL devices of the clock with the lock status
+func ppsDevices(lockStatus uint32) []*nl.DoDeviceGetReply {
+	return []*nl.DoDeviceGetReply{
+		{Id: 1, ClockId: clockid, Type: 1, LockStatus: lockStatus}, // pps
+		{Id: 2, ClockId: clockid, Type: 2, LockStatus: lockStatus}, // eec
+	}
+}
+
+// smaPin ... SMA input pin fed with the 1PPS of the primary card, towards the PPS DPLL
+func smaPin(state uint32, phaseOffset int64) []*nl.DoPinGetReply {
+	return []*nl.DoPinGetReply{{Id: 7, ClockId: clockid, BoardLabel: "SMA1", ParentDevice: []nl.PinParentDevice{
+		{ParentId: 1, Direction: nl.DPLL_PIN_DIRECTION_INPUT, State: state, PhaseOffset: phaseOffset},
+	}}}
+}
+
+func TestDpllConfig_PPSSourceLost(t *testing.T) {
+	d := dpll.NewDpll(clockid, dpll.LocalMaxHoldoverOffSet, dpll.LocalHoldoverTimeout, dpll.MaxInSpecOffset,
+		"ens2f0", []event.EventSource{event.PPS}, dpll.MOCK, map[string]map[string]string{})
+
+	d.DpllChanged(ppsDevices(dpll.DPLL_LOCKED_HO_ACQ), smaPin(nl.DPLL_PIN_STATE_CONNECTED, 0))
+	assert.Equal(t, event.PTP_LOCKED, d.State())
+	assert.False(t, d.SourceLost())
+
+	// the SMA input loses its 1PPS before the DPLL reports holdover: the DPLL holds over on its own
+	d.DpllChanged(nil, smaPin(nl.DPLL_PIN_STATE_SELECTABLE, math.MaxInt64))
+	assert.True(t, d.SourceLost(), "pps status unavailable")
+	assert.Equal(t, event.PTP_HOLDOVER, d.State())
+	assert.True(t, d.OnHoldover())
+
+	// the 1PPS is back
+	d.DpllChanged(ppsDevices(dpll.DPLL_LOCKED), smaPin(nl.DPLL_PIN_STATE_CONNECTED, 0))
+	assert.False(t, d.SourceLost())
+	assert.Eventually(t, func() bool { return !d.OnHoldover() }, 2*time.Second, 50*time.Millisecond)
+	assert.Equal(t, event.PTP_LOCKED, d.State())
+	assert.True(t, d.InSpec())
+
+	// without pin reports, as with sysfs, the PPS DPLL holdover tells the input is gone
+	d = dpll.NewDpll(clockid, dpll.LocalMaxHoldoverOffSet, dpll.LocalHoldoverTimeout, dpll.MaxInSpecOffset,
+		"ens2f0", []event.EventSource{event.PPS}, dpll.MOCK, map[string]map[string]string{})
+	d.SetPhaseOffset(0)
+	d.DpllChanged(ppsDevices(dpll.DPLL_LOCKED_HO_ACQ), nil)
+	assert.Equal(t, event.PTP_LOCKED, d.State())
+	d.DpllChanged(ppsDevices(dpll.DPLL_HOLDOVER), nil)
+	assert.True(t, d.SourceLost())
+	assert.Equal(t, event.PTP_HOLDOVER, d.State())
+	d.DpllChanged(ppsDevices(dpll.DPLL_LOCKED), nil)
+	assert.Eventually(t, func() bool { return !d.OnHoldover() }, 2*time.Second, 50*time.Millisecond)
+	assert.Equal(t, event.PTP_LOCKED, d.State())
+}
+
+func TestDpllConfig_PPSSourceLostTs2phc(t *testing.T) {
+	timeout := dpll.Ts2phcPPSTimeout
+	defer func() { dpll.Ts2phcPPSTimeout = timeout }()
+	dpll.Ts2phcPPSTimeout = 200 * time.Millisecond
+
+	d := dpll.NewDpll(clockid, dpll.LocalMaxHoldoverOffSet, dpll.LocalHoldoverTimeout, dpll.MaxInSpecOffset,
+		"ens2f0", []event.EventSource{event.PPS}, dpll.MOCK, map[string]map[string]string{})
+	defer d.CmdStop()
+	d.DpllChanged(ppsDevices(dpll.DPLL_LOCKED_HO_ACQ), smaPin(nl.DPLL_PIN_STATE_CONNECTED, 0))
+	assert.Equal(t, event.PTP_LOCKED, d.State())
+
+	// before ts2phc locked to the 1PPS its free run is no loss
+	d.Ts2phcState(event.PTP_FREERUN)
+	assert.False(t, d.SourceLost())
+
+	// ts2phc loses the extts events while the pin still reports the 1PPS
+	d.Ts2phcState(event.PTP_LOCKED)
+	d.Ts2phcState(event.PTP_FREERUN)
+	assert.True(t, d.SourceLost(), "ts2phc lost the 1PPS")
+	assert.Equal(t, event.PTP_HOLDOVER, d.State())
+	d.DpllChanged(nil, smaPin(nl.DPLL_PIN_STATE_CONNECTED, 0))
+	assert.True(t, d.SourceLost(), "pin report does not clear the ts2phc loss")
+
+	// the 1PPS is back
+	d.Ts2phcState(event.PTP_LOCKED)
+	assert.False(t, d.SourceLost())
+	assert.Eventually(t, func() bool { return !d.OnHoldover() }, 2*time.Second, 50*time.Millisecond)
+	assert.Equal(t, event.PTP_LOCKED, d.State())
+
+	// ts2phc holdover keeps the 1PPS alive, then ts2phc stops reporting the interface
+	d.Ts2phcState(event.PTP_HOLDOVER)
+	assert.False(t, d.SourceLost())
+	assert.Eventually(t, d.SourceLost, 2*time.Second, 20*time.Millisecond, "extts timeout")
+	assert.Equal(t, event.PTP_HOLDOVER, d.State())
+}
@@ -0,0 +1,219 @@
+package dpll
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/openshift/linuxptp-daemon/pkg/event"
+)
+
+// HoldoverAction ... action taken on the holdover timer by a state decision
+type HoldoverAction int
+
+const (
+	// HoldoverNone ... holdover is left as is
+	HoldoverNone HoldoverAction = iota
+	// HoldoverStart ... start the holdover timer unless it is already running
+	HoldoverStart
+	// HoldoverClose ... close a running GNSS holdover
+	HoldoverClose
+	// HoldoverCloseNoWait ... close a running GNSS holdover without waiting
+	HoldoverCloseNoWait
+	// HoldoverAbort ... close any running holdover without waiting
+	HoldoverAbort
+)
+
+// DecisionInputs ... inputs of the DPLL state decision
+type DecisionInputs struct {
+	Status             int64 // worse of the phase and frequency status
+	PPSSource          bool
+	SourceLost         bool
+	OffsetInRange      bool
+	InSpec             bool
+	OnHoldover         bool
+	FrequencyTraceable bool // SyncE traceable to a PRC or better
+}
+
+func (in DecisionInputs) String() string {
+	return fmt.Sprintf("status %d pps %v sourceLost %v offsetInRange %v inSpec %v onHoldover %v frequencyTraceable %v",
+		in.Status, in.PPSSource, in.SourceLost, in.OffsetInRange, in.InSpec, in.OnHoldover, in.FrequencyTraceable)
+}
+
+// DecisionRow ... row of the DPLL state table. A nil status list matches any status.
+// SetInSpec and SetSourceLost set the flag when Yes or No and leave it unchanged when Any;
+// an empty State keeps the current state.
+type DecisionRow struct {
+	ID                 string
+	Status             []int64
+	PPSSource          event.Cond
+	SourceLost         event.Cond
+	OffsetInRange      event.Cond
+	InSpec             event.Cond
+	OnHoldover         event.Cond
+	FrequencyTraceable event.Cond
+	State              event.PTPState
+	SetInSpec          event.Cond
+	SetSourceLost      event.Cond
+	FaultyOffset       bool
+	Holdover           HoldoverAction
+	// Send is false when the holdover timer reports the state
+	Send bool
+}
+
+// Match ... true when the row applies to the inputs
+func (r DecisionRow) Match(in DecisionInputs) bool {
+	if r.Status != nil {
+		found := false
+		for _, s := range r.Status {
+			found = found || s == in.Status
+		}
+		if !found {
+			return false
+		}
+	}
+	return r.PPSSource.Match(in.PPSSource) && r.SourceLost.Match(in.SourceLost) && r.OffsetInRange.Match(in.OffsetInRange) &&
+		r.InSpec.Match(in.InSpec) && r.OnHoldover.Match(in.OnHoldover) && r.FrequencyTraceable.Match(in.FrequencyTraceable)
+}
+
+func (r DecisionRow) String() string {
+	status := make([]string, 0, len(r.Status))
+	for _, s := range r.Status {
+		status = append(status, fmt.Sprint(s))
+	}
+	return fmt.Sprintf("%s: status %s pps %s sourceLost %s offsetInRange %s inSpec %s onHoldover %s frequencyTraceable %s -> state %s",
+		r.ID, strings.Join(status, "|"), r.PPSSource, r.SourceLost, r.OffsetInRange, r.InSpec, r.OnHoldover, r.FrequencyTraceable, r.State)
+}
+
+// DecisionTable ... DPLL state from the DPLL status, documented as the DPLL table above the GM state table in the
+// event package. Rows are evaluated in order, the first matching row decides.
+var DecisionTable = []DecisionRow{
+	{ID: "freerun", Status: []int64{DPLL_FREERUN, DPLL_INVALID, DPLL_UNKNOWN},
+		State: event.PTP_FREERUN, SetInSpec: event.No, SetSourceLost: event.Yes, FaultyOffset: true, Holdover: HoldoverClose, Send: true},
+	{ID: "locked-in-range", Status: []int64{DPLL_LOCKED}, SourceLost: event.No, OffsetInRange: event.Yes,
+		State: event.PTP_LOCKED, SetInSpec: event.Yes, Holdover: HoldoverClose, Send: true},
+	{ID: "locked-out-of-range", Status: []int64{DPLL_LOCKED},
+		State: event.PTP_FREERUN, SetInSpec: event.Yes, Send: true},
+	{ID: "locked-ho-acq-in-range", Status: []int64{DPLL_LOCKED_HO_ACQ, DPLL_HOLDOVER}, SourceLost: event.No, OffsetInRange: event.Yes,
+		State: event.PTP_LOCKED, SetInSpec: event.Yes, Holdover: HoldoverCloseNoWait, Send: true},
+	// a PPS fed DPLL with its PPS input but out of range, not recovering from a holdover
+	{ID: "pps-locked-ho-acq-out-of-range", Status: []int64{DPLL_LOCKED_HO_ACQ}, PPSSource: event.Yes, SourceLost: event.No, OnHoldover: event.No,
+		State: event.PTP_FREERUN, Send: true},
+	// the GNSS or PPS source is lost, see ppsSourceLost for a PPS fed DPLL
+	{ID: "source-lost-start-holdover", Status: []int64{DPLL_LOCKED_HO_ACQ, DPLL_HOLDOVER}, SourceLost: event.Yes, InSpec: event.Yes, OnHoldover: event.No,
+		State: event.PTP_HOLDOVER, Holdover: HoldoverStart},
+	{ID: "source-lost-on-holdover", Status: []int64{DPLL_LOCKED_HO_ACQ, DPLL_HOLDOVER}, SourceLost: event.Yes, InSpec: event.Yes},
+	// out of holdover specification, a frequency traceable holdover keeps running and reports the state
+	{ID: "frequency-traceable-on-holdover", Status: []int64{DPLL_LOCKED_HO_ACQ, DPLL_HOLDOVER}, SourceLost: event.Yes, OnHoldover: event.Yes,
+		FrequencyTraceable: event.Yes},
+	{ID: "out-of-spec", Status: []int64{DPLL_LOCKED_HO_ACQ, DPLL_HOLDOVER}, InSpec: event.No,
+		State: event.PTP_FREERUN, FaultyOffset: true, Holdover: HoldoverAbort, Send: true},
+	// source is back but the offset is not in range yet
+	{ID: "locked-ho-acq-out-of-range", Status: []int64{DPLL_LOCKED_HO_ACQ, DPLL_HOLDOVER}, Send: true},
+}
+
+// DecisionFromTable ... first row of the table matching the inputs, false when no row matches
+func DecisionFromTable(table []DecisionRow, in DecisionInputs) (DecisionRow, bool) {
+	for _, r := range table {
+		if r.Match(in) {
+			return r, true
+		}
+	}
+	return DecisionRow{}, false
+}
+
+// HoldoverTrigger ... what woke up the holdover timer
+type HoldoverTrigger string
+
+const (
+	// HoldoverTick ... the holdover offset was estimated
+	HoldoverTick HoldoverTrigger = "tick"
+	// HoldoverTimeout ... the holdover timeout expired
+	HoldoverTimeout HoldoverTrigger = "timeout"
+	// HoldoverClosed ... the state decision closed the holdover
+	HoldoverClosed HoldoverTrigger = "closed"
+	// HoldoverAborted ... the state decision closed the holdover out of spec
+	HoldoverAborted HoldoverTrigger = "aborted"
+)
+
+// HoldoverInputs ... inputs of a holdover timer step
+type HoldoverInputs struct {
+	Trigger            HoldoverTrigger
+	FrequencyTraceable bool
+	InSpecOffset       bool // estimated offset within MaxInSpecOffset
+	MaxHoldoverOffset  bool // estimated offset within LocalMaxHoldoverOffSet
+}
+
+func (in HoldoverInputs) String() string {
+	return fmt.Sprintf("trigger %s frequencyTraceable %v inSpecOffset %v maxHoldoverOffset %v",
+		in.Trigger, in.FrequencyTraceable, in.InSpecOffset, in.MaxHoldoverOffset)
+}
+
+// HoldoverRow ... row of the holdover table; Exit ends the holdover
+type HoldoverRow struct {
+	ID                 string
+	Trigger            HoldoverTrigger
+	FrequencyTraceable event.Cond
+	InSpecOffset       event.Cond
+	MaxHoldoverOffset  event.Cond
+	State              event.PTPState
+	SetInSpec          event.Cond
+	FaultyOffset       bool
+	Send               bool
+	Exit               bool
+}
+
+// Match ... true when the row applies to the inputs
+func (r HoldoverRow) Match(in HoldoverInputs) bool {
+	return r.Trigger == in.Trigger && r.FrequencyTraceable.Match(in.FrequencyTraceable) && r.InSpecOffset.Match(in.InSpecOffset) &&
+		r.MaxHoldoverOffset.Match(in.MaxHoldoverOffset)
+}
+
+// HoldoverTable ... holdover timer steps; the holdover ends out of spec when the estimated offset exceeds
+// MaxInSpecOffset or when LocalHoldoverTimeout expires. With a SyncE traceable frequency the holdover goes on out of
+// spec, clock class 140, until the estimated offset exceeds LocalMaxHoldoverOffSet or LocalHoldoverTimeout expires.
+var HoldoverTable = []HoldoverRow{
+	{ID: "frequency-traceable-out-of-range", Trigger: HoldoverTick, FrequencyTraceable: event.Yes, MaxHoldoverOffset: event.No,
+		State: event.PTP_FREERUN, SetInSpec: event.No, Send: true, Exit: true},
+	{ID: "frequency-traceable-out-of-spec", Trigger: HoldoverTick, FrequencyTraceable: event.Yes, InSpecOffset: event.No,
+		SetInSpec: event.No, Send: true},
+	{ID: "frequency-traceable", Trigger: HoldoverTick, FrequencyTraceable: event.Yes, Send: true},
+	{ID: "out-of-spec", Trigger: HoldoverTick, InSpecOffset: event.No,
+		State: event.PTP_FREERUN, SetInSpec: event.No, Send: true, Exit: true},
+	{ID: "in-spec", Trigger: HoldoverTick, Send: true},
+	// since ts2phc has the same timer, ts2phc also moves out of holdover
+	{ID: "timeout", Trigger: HoldoverTimeout,
+		State: event.PTP_FREERUN, SetInSpec: event.No, FaultyOffset: true, Send: true, Exit: true},
+	// whoever closes the holdover is back in spec
+	{ID: "closed", Trigger: HoldoverClosed, SetInSpec: event.Yes, Exit: true},
+	// the state decision declared the DPLL out of spec already
+	{ID: "aborted", Trigger: HoldoverAborted, Exit: true},
+}
+
+// HoldoverFromTable ... first row of the table matching the inputs, false when no row matches
+func HoldoverFromTable(table []HoldoverRow, in HoldoverInputs) (HoldoverRow, bool) {
+	for _, r := range table {
+		if r.Match(in) {
+			return r, true
+		}
+	}
+	return HoldoverRow{}, false
+}
+
+// setCond ... value of a flag after a row set it
+func setCond(c event.Cond, v bool) bool {
+	switch c {
+	case event.Yes:
+		return true
+	case event.No:
+		return false
+	}
+	return v
+}
+
+// traceTransition ... log a DPLL state change with the row and inputs deciding it
+func (d *DpllConfig) traceTransition(from event.PTPState, trigger, row string, inputs fmt.Stringer) {
+	if from != d.state {
+		glog.Infof("%s-dpll state %s -> %s, trigger %s, row %s, inputs: %s", d.iface, from, d.state, trigger, row, inputs)
+	}
+}
@@ -0,0 +1,100 @@
+package dpll_test
+
+import (
+	"testing"
+
+	"github.com/openshift/linuxptp-daemon/pkg/dpll"
+	"github.com/openshift/linuxptp-daemon/pkg/event"
+	"github.com/stretchr/testify/assert"
+)
+
+// decisionCases generates every combination of DPLL decision inputs, grouped by the table row deciding it
+func decisionCases() (map[string][]dpll.DecisionInputs, []dpll.DecisionInputs) {
+	cases := map[string][]dpll.DecisionInputs{}
+	var unmatched []dpll.DecisionInputs
+	for status := int64(dpll.DPLL_UNKNOWN); status <= dpll.DPLL_HOLDOVER; status++ {
+		// every combination of the six flags
+		for flags := 0; flags < 1<<6; flags++ {
+			in := dpll.DecisionInputs{
+				Status:             status,
+				PPSSource:          flags&1 != 0,
+				SourceLost:         flags&2 != 0,
+				OffsetInRange:      flags&4 != 0,
+				InSpec:             flags&8 != 0,
+				OnHoldover:         flags&16 != 0,
+				FrequencyTraceable: flags&32 != 0,
+			}
+			row, ok := dpll.DecisionFromTable(dpll.DecisionTable, in)
+			if !ok {
+				unmatched = append(unmatched, in)
+				continue
+			}
+			cases[row.ID] = append(cases[row.ID], in)
+		}
+	}
+	return cases, unmatched
+}
+
+func TestDecisionTable_Rows(t *testing.T) {
+	cases, unmatched := decisionCases()
+	assert.Empty(t, unmatched, "inputs not covered by the DPLL state table")
+	for _, row := range dpll.DecisionTable {
+		assert.NotEmpty(t, cases[row.ID], "row is never selected: %s", row)
+	}
+}
+
+func TestHoldoverTable_Rows(t *testing.T) {
+	selected := map[string]bool{}
+	for _, trigger := range []dpll.HoldoverTrigger{dpll.HoldoverTick, dpll.HoldoverTimeout, dpll.HoldoverClosed, dpll.HoldoverAborted} {
+		for _, traceable := range []bool{false, true} {
+			for _, inSpec := range []bool{false, true} {
+				for _, inMax := range []bool{false, true} {
+					in := dpll.HoldoverInputs{Trigger: trigger, FrequencyTraceable: traceable, InSpecOffset: inSpec, MaxHoldoverOffset: inMax}
+					row, ok := dpll.HoldoverFromTable(dpll.HoldoverTable, in)
+					if assert.True(t, ok, "no row for %s", in) {
+						selected[row.ID] = true
+					}
+				}
+			}
+		}
+	}
+	for _, row := range dpll.HoldoverTable {
+		assert.True(t, selected[row.ID], "row is never selected: %s", row.ID)
+	}
+	// only a tick within spec keeps the holdover running
+	row, _ := dpll.HoldoverFromTable(dpll.HoldoverTable, dpll.HoldoverInputs{Trigger: dpll.HoldoverTick, InSpecOffset: true})
+	assert.False(t, row.Exit)
+	row, _ = dpll.HoldoverFromTable(dpll.HoldoverTable, dpll.HoldoverInputs{Trigger: dpll.HoldoverTimeout})
+	assert.True(t, row.Exit)
+}
+
+func TestHoldover_FrequencyTraceable(t *testing.T) {
+	// out of spec without SyncE: FREERUN
+	row, _ := dpll.HoldoverFromTable(dpll.HoldoverTable, dpll.HoldoverInputs{Trigger: dpll.HoldoverTick, MaxHoldoverOffset: true})
+	assert.Equal(t, event.PTP_FREERUN, row.State)
+	assert.True(t, row.Exit)
+	// out of spec with SyncE traceable: still in holdover, out of spec
+	row, _ = dpll.HoldoverFromTable(dpll.HoldoverTable, dpll.HoldoverInputs{Trigger: dpll.HoldoverTick, FrequencyTraceable: true, MaxHoldoverOffset: true})
+	assert.Equal(t, "frequency-traceable-out-of-spec", row.ID)
+	assert.Equal(t, event.No, row.SetInSpec)
+	assert.False(t, row.Exit)
+	// beyond LocalMaxHoldoverOffSet: FREERUN, announced 140 while traceable
+	row, _ = dpll.HoldoverFromTable(dpll.HoldoverTable, dpll.HoldoverInputs{Trigger: dpll.HoldoverTick, FrequencyTraceable: true})
+	assert.Equal(t, event.PTP_FREERUN, row.State)
+	assert.True(t, row.Exit)
+
+	// a status report does not abort a frequency traceable holdover out of spec, unless SyncE is lost
+	in := dpll.DecisionInputs{Status: dpll.DPLL_HOLDOVER, SourceLost: true, OnHoldover: true, FrequencyTraceable: true}
+	decision, _ := dpll.DecisionFromTable(dpll.DecisionTable, in)
+	assert.Equal(t, dpll.HoldoverNone, decision.Holdover)
+	assert.Empty(t, decision.State)
+	in.FrequencyTraceable = false
+	decision, _ = dpll.DecisionFromTable(dpll.DecisionTable, in)
+	assert.Equal(t, dpll.HoldoverAbort, decision.Holdover)
+
+	dpll.SetFrequencyTraceable(clockid, true)
+	assert.True(t, dpll.FrequencyTraceable(clockid))
+	assert.False(t, dpll.FrequencyTraceable(clockid+1))
+	dpll.SetFrequencyTraceable(clockid, false)
+	assert.False(t, dpll.FrequencyTraceable(clockid))
+}
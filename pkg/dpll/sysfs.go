@@ -0,0 +1,105 @@
+package dpll
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Files of the out-of-tree ice driver under /sys/class/net/<iface>/device, for kernels without the DPLL netlink family.
+// DPLL 0 is the EEC DPLL, giving the frequency state, DPLL 1 the PPS DPLL, giving the phase state and offset.
+const (
+	sysfsFrequencyState = "dpll_0_state"
+	sysfsPhaseState     = "dpll_1_state"
+	sysfsPhaseOffset    = "dpll_1_offset"
+)
+
+// sysfsRoot ... root of the sysfs tree, replaced by a fake tree in tests
+var sysfsRoot = struct {
+	sync.Mutex
+	path string
+}{path: "/sys"}
+
+// SetSysfsRoot ... read the DPLL sysfs files under root instead of /sys
+func SetSysfsRoot(root string) {
+	sysfsRoot.Lock()
+	defer sysfsRoot.Unlock()
+	sysfsRoot.path = root
+}
+
+// sysfsDevicePath ... directory holding the DPLL files of the interface
+func sysfsDevicePath(iface string) string {
+	sysfsRoot.Lock()
+	defer sysfsRoot.Unlock()
+	return filepath.Join(sysfsRoot.path, "class", "net", iface, "device")
+}
+
+// SysfsStatus ... DPLL status read from sysfs
+type SysfsStatus struct {
+	FrequencyState int64
+	PhaseState     int64
+	// PhaseOffset ... in nanoseconds
+	PhaseOffset int64
+}
+
+// ReadSysfs ... read the DPLL status of the interface. A state that cannot be read is DPLL_INVALID, an offset that
+// cannot be read FaultyPhaseOffset, and the error tells which files failed.
+func ReadSysfs(iface string) (SysfsStatus, error) {
+	status := SysfsStatus{FrequencyState: DPLL_INVALID, PhaseState: DPLL_INVALID, PhaseOffset: FaultyPhaseOffset}
+	if iface == "" {
+		return status, fmt.Errorf("no interface")
+	}
+	dir := sysfsDevicePath(iface)
+	var errs []error
+	if v, err := readSysfsInt64(filepath.Join(dir, sysfsFrequencyState)); err != nil {
+		errs = append(errs, err)
+	} else {
+		status.FrequencyState = v
+	}
+	if v, err := readSysfsInt64(filepath.Join(dir, sysfsPhaseState)); err != nil {
+		errs = append(errs, err)
+	} else {
+		status.PhaseState = v
+	}
+	if v, err := readSysfsInt64(filepath.Join(dir, sysfsPhaseOffset)); err != nil {
+		errs = append(errs, err)
+	} else {
+		status.PhaseOffset = v / 100 // tens of picoseconds to nanoseconds
+	}
+	return status, errors.Join(errs...)
+}
+
+// readSysfsInt64 ... integer value of a sysfs file
+func readSysfsInt64(path string) (int64, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	return value, nil
+}
+
+// isSysFsPresent ... the driver of the interface exposes its DPLLs in sysfs
+func (d *DpllConfig) isSysFsPresent() bool {
+	_, err := os.Stat(filepath.Join(sysfsDevicePath(d.iface), sysfsFrequencyState))
+	return err == nil
+}
+
+// sysfsUpdateState ... apply the DPLL status read from sysfs, returns true when it changed. The phase offset is left
+// alone on holdover, where it is the holdover estimate. Called with d locked.
+func (d *DpllConfig) sysfsUpdateState(status SysfsStatus) bool {
+	changed := status.PhaseState != d.phaseStatus || status.FrequencyState != d.frequencyStatus
+	d.phaseStatus, d.frequencyStatus = status.PhaseState, status.FrequencyState
+	if !d.onHoldover && status.PhaseOffset != d.phaseOffset {
+		d.phaseOffset = status.PhaseOffset
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,87 @@
+package dpll_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openshift/linuxptp-daemon/pkg/dpll"
+	nl "github.com/openshift/linuxptp-daemon/pkg/dpll-netlink"
+	"github.com/openshift/linuxptp-daemon/pkg/event"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSysfs ... sysfs tree of the out-of-tree ice driver with the DPLL files of iface
+func fakeSysfs(t *testing.T, iface string, files map[string]string) string {
+	root := t.TempDir()
+	writeSysfs(t, root, iface, files)
+	dpll.SetSysfsRoot(root)
+	t.Cleanup(func() { dpll.SetSysfsRoot("/sys") })
+	return root
+}
+
+func writeSysfs(t *testing.T, root, iface string, files map[string]string) {
+	dir := filepath.Join(root, "class", "net", iface, "device")
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+}
+
+func TestReadSysfs(t *testing.T) {
+	root := fakeSysfs(t, "ens1f0", map[string]string{
+		"dpll_0_state":  "2\n",
+		"dpll_1_state":  "3\n",
+		"dpll_1_offset": "-1234\n",
+	})
+	status, err := dpll.ReadSysfs("ens1f0")
+	assert.NoError(t, err)
+	assert.Equal(t, dpll.SysfsStatus{FrequencyState: dpll.DPLL_LOCKED, PhaseState: dpll.DPLL_LOCKED_HO_ACQ, PhaseOffset: -12}, status,
+		"offset in tens of picoseconds")
+
+	writeSysfs(t, root, "ens1f0", map[string]string{"dpll_1_state": "locked"})
+	assert.NoError(t, os.Remove(filepath.Join(root, "class", "net", "ens1f0", "device", "dpll_1_offset")))
+	status, err = dpll.ReadSysfs("ens1f0")
+	assert.Error(t, err)
+	assert.Equal(t, dpll.SysfsStatus{FrequencyState: dpll.DPLL_LOCKED, PhaseState: dpll.DPLL_INVALID, PhaseOffset: dpll.FaultyPhaseOffset}, status)
+
+	_, err = dpll.ReadSysfs("ens2f0")
+	assert.Error(t, err, "no DPLL files")
+}
+
+func TestDpllConfig_MonitorDpllSysfs(t *testing.T) {
+	root := fakeSysfs(t, "ens1f0", map[string]string{
+		"dpll_0_state":  "2",
+		"dpll_1_state":  "2",
+		"dpll_1_offset": "0",
+	})
+	d := dpll.NewDpll(clockid, dpll.LocalMaxHoldoverOffSet, dpll.LocalHoldoverTimeout, dpll.MaxInSpecOffset,
+		"ens1f0", []event.EventSource{event.GNSS}, dpll.NONE, map[string]map[string]string{})
+	d.CmdInit()
+	if conn, err := nl.Dial(nil); err == nil {
+		conn.Close()
+		t.Skip("the kernel has the DPLL netlink family, which is preferred over sysfs")
+	}
+	assert.Equal(t, dpll.SYSFS, d.APIType(), "no DPLL netlink family")
+
+	d.MonitorDpll()
+	defer d.CmdStop()
+	assert.Eventually(t, func() bool { return d.State() == event.PTP_LOCKED }, 3*time.Second, 100*time.Millisecond)
+	assert.Equal(t, int64(dpll.DPLL_LOCKED), d.PhaseStatus())
+	assert.Equal(t, int64(dpll.DPLL_LOCKED), d.FrequencyStatus())
+
+	// GNSS lost, the DPLLs hold over
+	d.SetSourceLost(true)
+	writeSysfs(t, root, "ens1f0", map[string]string{"dpll_0_state": "4", "dpll_1_state": "4"})
+	assert.Eventually(t, func() bool { return d.State() == event.PTP_HOLDOVER }, 3*time.Second, 100*time.Millisecond)
+	assert.True(t, d.OnHoldover())
+}
+
+func TestDpllConfig_NoDpll(t *testing.T) {
+	fakeSysfs(t, "ens1f0", map[string]string{})
+	d := dpll.NewDpll(clockid, dpll.LocalMaxHoldoverOffSet, dpll.LocalHoldoverTimeout, dpll.MaxInSpecOffset,
+		"ens2f0", []event.EventSource{event.GNSS}, dpll.NONE, map[string]map[string]string{})
+	d.CmdInit()
+	assert.Contains(t, []interface{}{dpll.NETLINK, dpll.NONE}, d.APIType(), "no sysfs files")
+}
@@ -0,0 +1,91 @@
+package dpll
+
+import (
+	"slices"
+	"strconv"
+
+	nl "github.com/openshift/linuxptp-daemon/pkg/dpll-netlink"
+)
+
+// ReportHandler ... receives the device and pin reports of the clock
+type ReportHandler func(devices []*nl.DoDeviceGetReply, pins []*nl.DoPinGetReply)
+
+// SetReportHandler ... f is called with the device and pin reports of the clock received over netlink, when
+// monitoring starts and on every change notification
+func (d *DpllConfig) SetReportHandler(f ReportHandler) {
+	d.Lock()
+	defer d.Unlock()
+	d.onReport = f
+}
+
+// SetRemoveHandler ... f is called with the devices and pins of the clock removed by the driver
+func (d *DpllConfig) SetRemoveHandler(f ReportHandler) {
+	d.Lock()
+	defer d.Unlock()
+	d.onRemove = f
+}
+
+// DeviceType ... type, eec or pps, of a DPLL device of the clock, the device id while the device is not known
+func (d *DpllConfig) DeviceType(id uint32) string {
+	d.Lock()
+	defer d.Unlock()
+	if typ, ok := d.deviceTypes[id]; ok {
+		return nl.GetDpllType(typ)
+	}
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// PinLabel ... board label of the pin, its panel label without one
+func PinLabel(pin *nl.DoPinGetReply) string {
+	if pin.BoardLabel != "" {
+		return pin.BoardLabel
+	}
+	return pin.PanelLabel
+}
+
+// report ... pass the reports of the clock to the report handler
+func (d *DpllConfig) report(devices []*nl.DoDeviceGetReply, pins []*nl.DoPinGetReply) {
+	d.Lock()
+	onReport := d.onReport
+	d.Unlock()
+	if onReport == nil {
+		return
+	}
+	clockDevices, clockPins := d.clockReports(devices, pins)
+	clockDevices = slices.DeleteFunc(clockDevices, func(reply *nl.DoDeviceGetReply) bool {
+		return reply.LockStatus == DPLL_INVALID
+	})
+	if len(clockDevices) > 0 || len(clockPins) > 0 {
+		onReport(clockDevices, clockPins)
+	}
+}
+
+// removed ... pass the devices and pins of the clock removed by the driver to the remove handler
+func (d *DpllConfig) removed(devices []*nl.DoDeviceGetReply, pins []*nl.DoPinGetReply) {
+	d.Lock()
+	onRemove := d.onRemove
+	d.Unlock()
+	if onRemove == nil {
+		return
+	}
+	if clockDevices, clockPins := d.clockReports(devices, pins); len(clockDevices) > 0 || len(clockPins) > 0 {
+		onRemove(clockDevices, clockPins)
+	}
+}
+
+// clockReports ... the reports of the devices and pins of the clock
+func (d *DpllConfig) clockReports(devices []*nl.DoDeviceGetReply, pins []*nl.DoPinGetReply) ([]*nl.DoDeviceGetReply, []*nl.DoPinGetReply) {
+	var clockDevices []*nl.DoDeviceGetReply
+	for _, reply := range devices {
+		if reply.ClockId == d.clockId {
+			clockDevices = append(clockDevices, reply)
+		}
+	}
+	var clockPins []*nl.DoPinGetReply
+	for _, pin := range pins {
+		if pin.ClockId == d.clockId {
+			clockPins = append(clockPins, pin)
+		}
+	}
+	return clockDevices, clockPins
+}
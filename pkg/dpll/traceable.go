@@ -0,0 +1,41 @@
+package dpll
+
+import (
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// frequencyTraceability ... SyncE frequency traceability of the clocks, by clock id, reported by synce4l
+var frequencyTraceability = struct {
+	sync.Mutex
+	clocks map[uint64]bool
+}{clocks: map[uint64]bool{}}
+
+// SetFrequencyTraceable ... the EEC of the clock is locked to a SyncE input traceable to a PRC or better. A DPLL of
+// the clock losing its time source then stays in frequency traceable holdover, announced with clock class 140 once
+// out of holdover specification instead of moving to FREERUN.
+func SetFrequencyTraceable(clockId uint64, traceable bool) {
+	frequencyTraceability.Lock()
+	defer frequencyTraceability.Unlock()
+	if frequencyTraceability.clocks[clockId] != traceable {
+		glog.Infof("dpll clock id %d: frequency traceable %v", clockId, traceable)
+	}
+	frequencyTraceability.clocks[clockId] = traceable
+}
+
+// FrequencyTraceable ... SyncE frequency traceability of the clock, false while synce4l reported none
+func FrequencyTraceable(clockId uint64) bool {
+	frequencyTraceability.Lock()
+	defer frequencyTraceability.Unlock()
+	return frequencyTraceability.clocks[clockId]
+}
+
+// updateFrequencyTraceable ... follow the SyncE traceability of the clock, called with d locked
+func (d *DpllConfig) updateFrequencyTraceable() {
+	traceable := FrequencyTraceable(d.clockId)
+	if traceable != d.frequencyTraceable {
+		glog.Infof("%s-dpll: frequency traceable %v", d.iface, traceable)
+	}
+	d.frequencyTraceable = traceable
+}
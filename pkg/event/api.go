@@ -0,0 +1,171 @@
+package event
+
+import (
+	"sort"
+	"time"
+
+	"github.com/openshift/linuxptp-daemon/pkg/api"
+	"github.com/openshift/linuxptp-daemon/pkg/protocol"
+)
+
+// publishTransition sends a process or interface state change to the query api subscribers
+func publishTransition(event EventChannel, from PTPState) {
+	values := make(map[string]interface{}, len(event.Values))
+	for k, v := range event.Values {
+		values[string(k)] = v
+	}
+	api.PublishTransition(api.StateTransition{
+		Time:       time.UnixMilli(event.Time),
+		ConfigName: event.CfgName,
+		Process:    string(event.ProcessName),
+		Interface:  event.IFace,
+		From:       string(from),
+		To:         string(event.State),
+		Values:     values,
+	})
+}
+
+// publishGMTransition sends a GM state change to the query api subscribers
+func publishGMTransition(t GMTransition, g *grandMasterSyncState) {
+	if t.From == t.To {
+		return
+	}
+	api.PublishTransition(api.StateTransition{
+		Time:       time.Now(),
+		ConfigName: t.ConfigName,
+		Process:    string(GM),
+		Interface:  g.gmIFace,
+		From:       string(t.From),
+		To:         string(t.To),
+		Trigger:    string(t.Trigger),
+		Values: map[string]interface{}{
+			"clock_class":         uint8(g.clockClass),
+			"clock_accuracy":      uint8(g.clockAccuracy),
+			"source_lost":         g.sourceLost,
+			"row":                 t.Row,
+			"dpll_state":          string(t.Inputs.Dpll),
+			"gnss_state":          string(t.Inputs.Gnss),
+			"ts2phc_state":        string(t.Inputs.Ts2phc),
+			"out_of_spec":         t.Inputs.OutOfSpec,
+			"frequency_traceable": t.Inputs.FrequencyTraceable,
+		},
+	})
+}
+
+// Snapshot returns a copy of the event handler data and GM sync states for the query api
+func (e *EventHandler) Snapshot() api.Status {
+	e.Lock()
+	defer e.Unlock()
+	status := api.Status{
+		Node:        e.nodeName,
+		Time:        time.Now(),
+		Processes:   []api.ProcessData{},
+		GMSyncState: []api.GMSyncState{},
+	}
+	for cfgName, clk := range e.clocks {
+		if clk.clockClass == protocol.ClockClassUninitialized {
+			continue
+		}
+		if status.ClockClasses == nil {
+			status.ClockClasses = map[string]uint8{}
+		}
+		status.ClockClasses[cfgName] = uint8(clk.clockClass)
+		if status.ClockClass == 0 || uint8(clk.clockClass) < status.ClockClass {
+			status.ClockClass = uint8(clk.clockClass)
+		}
+	}
+	for cfgName, data := range e.data {
+		for _, d := range data {
+			pd := api.ProcessData{
+				ConfigName: cfgName,
+				Process:    string(d.ProcessName),
+				State:      string(d.State),
+				Details:    make([]api.ProcessDetail, 0, len(d.Details)),
+			}
+			for _, dd := range d.Details {
+				pd.Details = append(pd.Details, api.ProcessDetail{
+					Interface:    dd.IFace,
+					State:        string(dd.State),
+					ClockType:    string(dd.ClockType),
+					SignalSource: string(dd.signalSource),
+					SourceLost:   dd.sourceLost,
+					LastUpdate:   time.UnixMilli(dd.time),
+					Values:       numericValues(dd.values),
+				})
+			}
+			status.Processes = append(status.Processes, pd)
+		}
+	}
+	for cfgName, g := range e.gmSyncState {
+		status.GMSyncState = append(status.GMSyncState, api.GMSyncState{
+			ConfigName:    cfgName,
+			Interface:     g.gmIFace,
+			State:         string(g.state),
+			ClockClass:    uint8(g.clockClass),
+			ClockAccuracy: uint8(g.clockAccuracy),
+			SourceLost:    g.sourceLost,
+		})
+	}
+	sort.Slice(status.Processes, func(i, j int) bool {
+		if status.Processes[i].ConfigName != status.Processes[j].ConfigName {
+			return status.Processes[i].ConfigName < status.Processes[j].ConfigName
+		}
+		return status.Processes[i].Process < status.Processes[j].Process
+	})
+	sort.Slice(status.GMSyncState, func(i, j int) bool {
+		return status.GMSyncState[i].ConfigName < status.GMSyncState[j].ConfigName
+	})
+	return status
+}
+
+func numericValues(values map[ValueType]interface{}) map[string]float64 {
+	out := map[string]float64{}
+	for k, v := range values {
+		switch val := v.(type) {
+		case int64:
+			out[string(k)] = float64(val)
+		case int:
+			out[string(k)] = float64(val)
+		case int32:
+			out[string(k)] = float64(val)
+		case float64:
+			out[string(k)] = val
+		case byte:
+			out[string(k)] = float64(val)
+		}
+	}
+	return out
+}
+
+// QueryHistory returns the event history records selected by the query api
+func QueryHistory(q api.HistoryQuery) []api.HistoryRecord {
+	records := EventHistory.Query(HistoryFilter{
+		From:       q.From,
+		To:         q.To,
+		Process:    q.Process,
+		Interface:  q.Interface,
+		ConfigName: q.ConfigName,
+	})
+	out := make([]api.HistoryRecord, 0, len(records))
+	for _, r := range records {
+		hr := api.HistoryRecord{
+			Time:       r.Time,
+			Kind:       string(r.Kind),
+			ConfigName: r.ConfigName,
+			Process:    r.Process,
+			Interface:  r.Interface,
+			State:      string(r.State),
+			ClockClass: r.ClockClass,
+			SourceLost: r.SourceLost,
+			OutOfSpec:  r.OutOfSpec,
+		}
+		if len(r.Values) > 0 {
+			hr.Values = make(map[string]interface{}, len(r.Values))
+			for k, v := range r.Values {
+				hr.Values[string(k)] = v
+			}
+		}
+		out = append(out, hr)
+	}
+	return out
+}
@@ -0,0 +1,173 @@
+package event
+
+import (
+	"fmt"
+	"time"
+
+	fbprotocol "github.com/facebook/time/ptp/protocol"
+	"github.com/golang/glog"
+	"github.com/openshift/linuxptp-daemon/pkg/api"
+	"github.com/openshift/linuxptp-daemon/pkg/protocol"
+)
+
+// bcSyncState ... T-BC state of a master-facing ptp4l config
+type bcSyncState struct {
+	state           PTPState
+	clockClass      fbprotocol.ClockClass
+	clockAccuracy   fbprotocol.ClockAccuracy
+	slaveIFace      string
+	port            PTPState // state reported for the slave port
+	outOfSpec       bool     // holdover timer of the slave port expired
+	phc2sysHoldover bool     // phc2sys of the T-BC profile lost the lock it had
+}
+
+// BCInputs ... inputs of the T-BC state machine
+type BCInputs struct {
+	Port            PTPState
+	OutOfSpec       bool
+	Phc2sysHoldover bool
+}
+
+func (in BCInputs) String() string {
+	return fmt.Sprintf("port %s outOfSpec %v phc2sysHoldover %v", in.Port, in.OutOfSpec, in.Phc2sysHoldover)
+}
+
+// BCStateRow ... row of the T-BC state table. A nil state list matches any state. A zero ClockClass leaves the
+// clock class to the parent, Reset restores the default GRANDMASTER_SETTINGS_NP so the BC announces the parent again.
+type BCStateRow struct {
+	ID              string
+	Port            []PTPState
+	OutOfSpec       Cond
+	Phc2sysHoldover Cond
+	State           PTPState
+	ClockClass      fbprotocol.ClockClass
+	ClockAccuracy   fbprotocol.ClockAccuracy
+	Reset           bool
+}
+
+// Match ... true when the row applies to the inputs
+func (r BCStateRow) Match(in BCInputs) bool {
+	return stateIn(in.Port, r.Port) && r.OutOfSpec.Match(in.OutOfSpec) && r.Phc2sysHoldover.Match(in.Phc2sysHoldover)
+}
+
+func (r BCStateRow) String() string {
+	return fmt.Sprintf("%s: port %s outOfSpec %s phc2sysHoldover %s -> state %s class %d accuracy %#x",
+		r.ID, statesString(r.Port), r.OutOfSpec, r.Phc2sysHoldover, r.State, r.ClockClass, r.ClockAccuracy)
+}
+
+// BCStateTable ... T-BC state and clock class from the slave port state, T-REC-G.8275.1-202211-I section 6.4 table 3.
+// The port is HOLDOVER from the loss of the slave port until the in-spec timer expires and FREERUN after the
+// holdover timeout; a DPLL reporting out of holdover specification for the config also moves the BC out of spec.
+// The phc2sys of the T-BC profile is in holdover once it loses the lock it had, the BC holds over with it while the slave
+// port stays locked.
+var BCStateTable = []BCStateRow{
+	// synchronized to the parent, the parent clock class is announced
+	{ID: "slave-locked", Port: states(PTP_LOCKED), Phc2sysHoldover: No, State: PTP_LOCKED, Reset: true},
+	// T-BC in holdover, out of holdover specification
+	{ID: "holdover-out-of-spec", Port: states(PTP_LOCKED, PTP_HOLDOVER), OutOfSpec: Yes,
+		State: PTP_HOLDOVER, ClockClass: protocol.ClockClassBCHoldoverOutOfSpec, ClockAccuracy: fbprotocol.ClockAccuracyUnknown},
+	// T-BC in holdover, within holdover specification
+	{ID: "holdover-in-spec", Port: states(PTP_LOCKED, PTP_HOLDOVER),
+		State: PTP_HOLDOVER, ClockClass: protocol.ClockClassBCHoldoverInSpec, ClockAccuracy: fbprotocol.ClockAccuracyUnknown},
+	// T-BC in free-run mode
+	{ID: "freerun", State: PTP_FREERUN, ClockClass: protocol.ClockClassFreerun, ClockAccuracy: fbprotocol.ClockAccuracyUnknown},
+}
+
+// BCStateFromTable ... first row of the table matching the inputs, false when no row matches
+func BCStateFromTable(table []BCStateRow, in BCInputs) (BCStateRow, bool) {
+	for _, r := range table {
+		if r.Match(in) {
+			return r, true
+		}
+	}
+	return BCStateRow{}, false
+}
+
+// updateBCState ... compute the T-BC state of the config and request the clock class of the new state;
+// returns the BC state record when the state or clock class changed
+func (e *EventHandler) updateBCState(cfgName string, trigger EventSource) []Record {
+	b, ok := e.bcSyncState[cfgName]
+	if !ok || b.port == PTP_NOTSET {
+		// the slave port is not reported yet
+		return nil
+	}
+	inputs := BCInputs{Port: b.port, OutOfSpec: b.outOfSpec || e.dpllOutOfSpec(cfgName), Phc2sysHoldover: b.phc2sysHoldover}
+	row, ok := BCStateFromTable(BCStateTable, inputs)
+	if !ok {
+		glog.Errorf("no BC state table row matches %s", inputs)
+		return nil
+	}
+	if row.State == b.state && row.ClockClass == b.clockClass {
+		return nil
+	}
+	from, fromClass := b.state, b.clockClass
+	b.state, b.clockClass, b.clockAccuracy = row.State, row.ClockClass, row.ClockAccuracy
+	glog.Infof("[%s] BC state %s -> %s clock class %d -> %d, trigger %s, row %s, inputs: %s",
+		cfgName, from, b.state, fromClass, b.clockClass, trigger, row.ID, inputs)
+	if from != b.state {
+		api.PublishTransition(api.StateTransition{
+			Time:       time.Now(),
+			ConfigName: cfgName,
+			Process:    string(BC),
+			Interface:  b.slaveIFace,
+			From:       string(from),
+			To:         string(b.state),
+			Trigger:    string(trigger),
+			Values: map[string]interface{}{
+				"clock_class":      uint8(b.clockClass),
+				"row":              row.ID,
+				"port_state":       string(inputs.Port),
+				"out_of_spec":      inputs.OutOfSpec,
+				"phc2sys_holdover": inputs.Phc2sysHoldover,
+			},
+		})
+	}
+	clk := ClockClassRequest{
+		cfgName:       cfgName,
+		gmState:       b.state,
+		clockType:     BC,
+		clockClass:    b.clockClass,
+		clockAccuracy: b.clockAccuracy,
+	}
+	if row.Reset {
+		clk.clockClass, clk.clockAccuracy, clk.reset = protocol.ClockClassFreerun, fbprotocol.ClockAccuracyUnknown, true
+	}
+	e.clockClassQueues.put(clk)
+	return []Record{NewBCStateRecord(cfgName, b.slaveIFace, b.state, uint8(b.clockClass), b.port != PTP_LOCKED, time.Now())}
+}
+
+// dpllOutOfSpec ... a DPLL feeding the T-BC config reports out of holdover specification. DPLL events carry the
+// ts2phc config of the profile, the T-BC state is kept for the config registered with SetBCConfig.
+func (e *EventHandler) dpllOutOfSpec(cfgName string) bool {
+	for name, bcCfgName := range e.bcConfigs {
+		if clk, ok := e.clocks[name]; ok && bcCfgName == cfgName && clk.outOfSpec {
+			return true
+		}
+	}
+	return false
+}
+
+// bcState ... T-BC state of the config, created on the first event
+func (e *EventHandler) bcState(cfgName string) *bcSyncState {
+	b, ok := e.bcSyncState[cfgName]
+	if !ok {
+		b = &bcSyncState{state: PTP_NOTSET, port: PTP_NOTSET, clockAccuracy: fbprotocol.ClockAccuracyUnknown}
+		e.bcSyncState[cfgName] = b
+	}
+	return b
+}
+
+// addBCPhc2sysEvent ... keep the holdover status of the phc2sys of a T-BC profile
+func (e *EventHandler) addBCPhc2sysEvent(event EventChannel) {
+	e.bcState(event.CfgName).phc2sysHoldover = event.State == PTP_HOLDOVER
+}
+
+// addBCEvent ... keep the slave port state reported for a T-BC config
+func (e *EventHandler) addBCEvent(event EventChannel) {
+	b := e.bcState(event.CfgName)
+	b.port = event.State
+	b.outOfSpec = event.OutOfSpec
+	if event.IFace != "" {
+		b.slaveIFace = event.IFace
+	}
+}
@@ -0,0 +1,325 @@
+package event_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	fbprotocol "github.com/facebook/time/ptp/protocol"
+	"github.com/openshift/linuxptp-daemon/pkg/event"
+	"github.com/openshift/linuxptp-daemon/pkg/leap"
+	"github.com/openshift/linuxptp-daemon/pkg/protocol"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockLeap ... leap manager of the test, stopped before the next test starts its own
+func mockLeap(t *testing.T) {
+	assert.NoError(t, leap.MockLeapFile())
+	lm := leap.LeapMgr
+	t.Cleanup(func() {
+		close(lm.Close)
+		select {
+		case <-lm.Done:
+		case <-time.After(time.Second):
+			t.Error("leap manager not stopped")
+		}
+	})
+}
+
+func TestBCStateTable(t *testing.T) {
+	tests := []struct {
+		in        event.BCInputs
+		wantRow   string
+		wantState event.PTPState
+		wantClass fbprotocol.ClockClass
+	}{
+		{event.BCInputs{Port: event.PTP_LOCKED}, "slave-locked", event.PTP_LOCKED, 0},
+		{event.BCInputs{Port: event.PTP_LOCKED, OutOfSpec: true}, "slave-locked", event.PTP_LOCKED, 0},
+		{event.BCInputs{Port: event.PTP_HOLDOVER}, "holdover-in-spec", event.PTP_HOLDOVER, protocol.ClockClassBCHoldoverInSpec},
+		{event.BCInputs{Port: event.PTP_HOLDOVER, OutOfSpec: true}, "holdover-out-of-spec", event.PTP_HOLDOVER, protocol.ClockClassBCHoldoverOutOfSpec},
+		{event.BCInputs{Port: event.PTP_FREERUN, OutOfSpec: true}, "freerun", event.PTP_FREERUN, protocol.ClockClassFreerun},
+		{event.BCInputs{Port: event.PTP_NOTSET}, "freerun", event.PTP_FREERUN, protocol.ClockClassFreerun},
+		// the phc2sys of the profile lost its lock while the slave port stays locked
+		{event.BCInputs{Port: event.PTP_LOCKED, Phc2sysHoldover: true}, "holdover-in-spec", event.PTP_HOLDOVER, protocol.ClockClassBCHoldoverInSpec},
+		{event.BCInputs{Port: event.PTP_LOCKED, OutOfSpec: true, Phc2sysHoldover: true}, "holdover-out-of-spec", event.PTP_HOLDOVER, protocol.ClockClassBCHoldoverOutOfSpec},
+		{event.BCInputs{Port: event.PTP_HOLDOVER, Phc2sysHoldover: true}, "holdover-in-spec", event.PTP_HOLDOVER, protocol.ClockClassBCHoldoverInSpec},
+		{event.BCInputs{Port: event.PTP_FREERUN, OutOfSpec: true, Phc2sysHoldover: true}, "freerun", event.PTP_FREERUN, protocol.ClockClassFreerun},
+	}
+	for _, tt := range tests {
+		row, ok := event.BCStateFromTable(event.BCStateTable, tt.in)
+		assert.True(t, ok, tt.in.String())
+		assert.Equal(t, tt.wantRow, row.ID, tt.in.String())
+		assert.Equal(t, tt.wantState, row.State, tt.in.String())
+		assert.Equal(t, tt.wantClass, row.ClockClass, tt.in.String())
+	}
+}
+
+func TestEventHandler_BCClockClass(t *testing.T) {
+	getter, setter := event.PMCGMGetter, event.PMCGMSetter
+	defer func() { event.PMCGMGetter, event.PMCGMSetter = getter, setter }()
+	current := protocol.GrandmasterSettings{}
+	set := make(chan protocol.GrandmasterSettings, 10)
+	event.PMCGMGetter = func(cfgName string) (protocol.GrandmasterSettings, error) {
+		assert.Equal(t, "ptp4l.1.config", cfgName)
+		return current, nil
+	}
+	event.PMCGMSetter = func(cfgName string, g protocol.GrandmasterSettings) error {
+		current = g
+		set <- g
+		return nil
+	}
+	mockLeap(t)
+
+	eChannel := make(chan event.EventChannel, 10)
+	closeChn := make(chan bool)
+	clockClassMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "bc_clock_class"}, []string{"process", "node", "config"})
+	eventManager := event.Init("node", false, "", eChannel, closeChn, nil, nil, clockClassMetric)
+	go eventManager.ProcessEvents()
+	defer close(closeChn)
+
+	steps := []struct {
+		state     event.PTPState
+		outOfSpec bool
+		wantClass fbprotocol.ClockClass
+		wantTime  bool
+	}{
+		{event.PTP_HOLDOVER, false, protocol.ClockClassBCHoldoverInSpec, true},
+		{event.PTP_HOLDOVER, true, protocol.ClockClassBCHoldoverOutOfSpec, false},
+		{event.PTP_FREERUN, true, protocol.ClockClassFreerun, false},
+	}
+	for _, s := range steps {
+		eChannel <- event.EventChannel{ProcessName: event.PTP4l, ClockType: event.BC, CfgName: "ptp4l.1.config",
+			IFace: "ens1f0", State: s.state, OutOfSpec: s.outOfSpec, Time: time.Now().UnixMilli()}
+		select {
+		case g := <-set:
+			assert.Equal(t, s.wantClass, g.ClockQuality.ClockClass)
+			assert.Equal(t, s.wantTime, g.TimePropertiesDS.TimeTraceable)
+			assert.Equal(t, fbprotocol.TimeSourceInternalOscillator, g.TimePropertiesDS.TimeSource)
+			assert.Equal(t, uint16(0xffff), g.ClockQuality.OffsetScaledLogVariance)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("clock class %d was not set", s.wantClass)
+		}
+	}
+	// the slave port is back, the GM settings are restored without a clock class change
+	eChannel <- event.EventChannel{ProcessName: event.PTP4l, ClockType: event.BC, CfgName: "ptp4l.1.config",
+		IFace: "ens1f0", State: event.PTP_HOLDOVER, Time: time.Now().UnixMilli()}
+	g := <-set
+	assert.Equal(t, protocol.ClockClassBCHoldoverInSpec, g.ClockQuality.ClockClass)
+	eChannel <- event.EventChannel{ProcessName: event.PTP4l, ClockType: event.BC, CfgName: "ptp4l.1.config",
+		IFace: "ens1f0", State: event.PTP_LOCKED, Time: time.Now().UnixMilli()}
+	select {
+	case g = <-set:
+		assert.Equal(t, protocol.ClockClassFreerun, g.ClockQuality.ClockClass)
+	case <-time.After(5 * time.Second):
+		t.Fatal("default GM settings were not restored")
+	}
+
+	assert.Eventually(t, func() bool {
+		records := event.EventHistory.Query(event.HistoryFilter{ConfigName: "ptp4l.1.config", Process: string(event.BC)})
+		if len(records) == 0 {
+			return false
+		}
+		last := records[len(records)-1]
+		return last.Kind == event.BCStateRecord && last.State == event.PTP_LOCKED && last.Interface == "ens1f0"
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func TestEventHandler_BCClockClassFromPhc2sys(t *testing.T) {
+	getter, setter := event.PMCGMGetter, event.PMCGMSetter
+	defer func() { event.PMCGMGetter, event.PMCGMSetter = getter, setter }()
+	var lock sync.Mutex
+	current := protocol.GrandmasterSettings{}
+	set := make(chan protocol.GrandmasterSettings, 10)
+	event.PMCGMGetter = func(cfgName string) (protocol.GrandmasterSettings, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		return current, nil
+	}
+	event.PMCGMSetter = func(cfgName string, g protocol.GrandmasterSettings) error {
+		lock.Lock()
+		current = g
+		lock.Unlock()
+		set <- g
+		return nil
+	}
+	mockLeap(t)
+
+	eChannel := make(chan event.EventChannel, 10)
+	closeChn := make(chan bool)
+	clockClassMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "phc2sys_bc_clock_class"}, []string{"process", "node", "config"})
+	eventManager := event.Init("node", false, "", eChannel, closeChn, nil, nil, clockClassMetric)
+	go eventManager.ProcessEvents()
+	defer close(closeChn)
+
+	bcState := func(state event.PTPState) func() bool {
+		return func() bool {
+			records := event.EventHistory.Query(event.HistoryFilter{ConfigName: "ptp4l.5.config", Process: string(event.BC)})
+			return len(records) > 0 && records[len(records)-1].State == state
+		}
+	}
+	// phc2sys reporting before the slave port leaves the BC state alone
+	eChannel <- event.EventChannel{ProcessName: event.PHC2SYS, ClockType: event.BC, CfgName: "ptp4l.5.config",
+		State: event.PTP_HOLDOVER, Time: time.Now().UnixMilli()}
+	eChannel <- event.EventChannel{ProcessName: event.PHC2SYS, ClockType: event.BC, CfgName: "ptp4l.5.config",
+		State: event.PTP_LOCKED, Time: time.Now().UnixMilli()}
+	eChannel <- event.EventChannel{ProcessName: event.PTP4l, ClockType: event.BC, CfgName: "ptp4l.5.config",
+		IFace: "ens1f0", State: event.PTP_LOCKED, Time: time.Now().UnixMilli()}
+	assert.Eventually(t, bcState(event.PTP_LOCKED), 5*time.Second, 100*time.Millisecond)
+
+	// phc2sys loses its lock: the BC holds over although the slave port is locked
+	eChannel <- event.EventChannel{ProcessName: event.PHC2SYS, ClockType: event.BC, CfgName: "ptp4l.5.config",
+		State: event.PTP_HOLDOVER, Time: time.Now().UnixMilli()}
+	for {
+		select {
+		case g := <-set:
+			if g.ClockQuality.ClockClass != protocol.ClockClassBCHoldoverInSpec {
+				continue // the default GM settings of the locked BC
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("holdover clock class was not set")
+		}
+		break
+	}
+	assert.Eventually(t, bcState(event.PTP_HOLDOVER), 5*time.Second, 100*time.Millisecond)
+	// phc2sys locks again, the default GM settings are restored
+	eChannel <- event.EventChannel{ProcessName: event.PHC2SYS, ClockType: event.BC, CfgName: "ptp4l.5.config",
+		State: event.PTP_LOCKED, Time: time.Now().UnixMilli()}
+	select {
+	case g := <-set:
+		assert.Equal(t, protocol.ClockClassFreerun, g.ClockQuality.ClockClass)
+	case <-time.After(5 * time.Second):
+		t.Fatal("default GM settings were not restored")
+	}
+	assert.Eventually(t, bcState(event.PTP_LOCKED), 5*time.Second, 100*time.Millisecond)
+}
+
+func TestEventHandler_ClockClassPerConfig(t *testing.T) {
+	getter, setter := event.PMCGMGetter, event.PMCGMSetter
+	defer func() { event.PMCGMGetter, event.PMCGMSetter = getter, setter }()
+	var lock sync.Mutex
+	current := map[string]protocol.GrandmasterSettings{}
+	set := make(chan string, 10)
+	release := make(chan struct{})
+	event.PMCGMGetter = func(cfgName string) (protocol.GrandmasterSettings, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		return current[cfgName], nil
+	}
+	event.PMCGMSetter = func(cfgName string, g protocol.GrandmasterSettings) error {
+		if cfgName == "ptp4l.1.config" {
+			<-release // a slow pmc on one instance does not hold back the other
+		}
+		lock.Lock()
+		current[cfgName] = g
+		lock.Unlock()
+		set <- cfgName
+		return nil
+	}
+	mockLeap(t)
+
+	eChannel := make(chan event.EventChannel, 10)
+	closeChn := make(chan bool)
+	clockClassMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "config_clock_class"}, []string{"process", "node", "config"})
+	eventManager := event.Init("node", false, "", eChannel, closeChn, nil, nil, clockClassMetric)
+	go eventManager.ProcessEvents()
+	defer close(closeChn)
+
+	for _, cfgName := range []string{"ptp4l.1.config", "ptp4l.2.config"} {
+		eChannel <- event.EventChannel{ProcessName: event.PTP4l, ClockType: event.BC, CfgName: cfgName,
+			IFace: "ens1f0", State: event.PTP_HOLDOVER, Time: time.Now().UnixMilli()}
+	}
+	select {
+	case cfgName := <-set:
+		assert.Equal(t, "ptp4l.2.config", cfgName)
+	case <-time.After(5 * time.Second):
+		t.Fatal("clock class of ptp4l.2.config was not set")
+	}
+	eChannel <- event.EventChannel{ProcessName: event.PTP4l, ClockType: event.BC, CfgName: "ptp4l.2.config",
+		IFace: "ens1f0", State: event.PTP_FREERUN, OutOfSpec: true, Time: time.Now().UnixMilli()}
+	assert.Equal(t, "ptp4l.2.config", <-set)
+	close(release)
+	assert.Equal(t, "ptp4l.1.config", <-set)
+
+	assert.Eventually(t, func() bool {
+		s := eventManager.Snapshot()
+		return s.ClockClasses["ptp4l.1.config"] == uint8(protocol.ClockClassBCHoldoverInSpec) &&
+			s.ClockClasses["ptp4l.2.config"] == uint8(protocol.ClockClassFreerun)
+	}, 5*time.Second, 100*time.Millisecond)
+	assert.Equal(t, uint8(protocol.ClockClassBCHoldoverInSpec), eventManager.Snapshot().ClockClass)
+	assert.Equal(t, float64(protocol.ClockClassFreerun), testutil.ToFloat64(clockClassMetric.With(prometheus.Labels{
+		"process": event.PTP4lProcessName, "node": "node", "config": "ptp4l.2.config"})))
+	assert.Equal(t, float64(protocol.ClockClassBCHoldoverInSpec), testutil.ToFloat64(clockClassMetric.With(prometheus.Labels{
+		"process": event.PTP4lProcessName, "node": "node", "config": "ptp4l.1.config"})))
+}
+
+func TestEventHandler_BCClockClassFromDPLL(t *testing.T) {
+	// the T-BC announces on its own ptp4l config, or on the master-only config naming it as controllingProfile
+	for _, bcCfgName := range []string{"ptp4l.1.config", "ptp4l.2.config"} {
+		t.Run(bcCfgName, func(t *testing.T) {
+			testBCClockClassFromDPLL(t, bcCfgName)
+		})
+	}
+}
+
+func testBCClockClassFromDPLL(t *testing.T, bcCfgName string) {
+	getter, setter := event.PMCGMGetter, event.PMCGMSetter
+	defer func() { event.PMCGMGetter, event.PMCGMSetter = getter, setter }()
+	var lock sync.Mutex
+	current := protocol.GrandmasterSettings{}
+	set := make(chan protocol.GrandmasterSettings, 10)
+	event.PMCGMGetter = func(cfgName string) (protocol.GrandmasterSettings, error) {
+		assert.Equal(t, bcCfgName, cfgName, "the GM clock class of the DPLLs is not applied to the T-BC")
+		lock.Lock()
+		defer lock.Unlock()
+		return current, nil
+	}
+	event.PMCGMSetter = func(cfgName string, g protocol.GrandmasterSettings) error {
+		assert.Equal(t, bcCfgName, cfgName)
+		lock.Lock()
+		current = g
+		lock.Unlock()
+		set <- g
+		return nil
+	}
+	mockLeap(t)
+
+	eChannel := make(chan event.EventChannel, 10)
+	closeChn := make(chan bool)
+	clockClassMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "dpll_bc_clock_class"}, []string{"process", "node", "config"})
+	offsetMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "dpll_bc_offset"}, []string{"from", "process", "node", "iface"})
+	clockMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "dpll_bc_clock_state"}, []string{"process", "node", "iface"})
+	eventManager := event.Init("node", false, "", eChannel, closeChn, offsetMetric, clockMetric, clockClassMetric)
+	// the DPLLs of the profile report on its ts2phc config
+	eventManager.SetBCConfig("ts2phc.1.config", bcCfgName)
+	go eventManager.ProcessEvents()
+	defer close(closeChn)
+
+	eChannel <- event.EventChannel{ProcessName: event.PTP4l, ClockType: event.BC, CfgName: bcCfgName,
+		IFace: "ens1f0", State: event.PTP_HOLDOVER, Time: time.Now().UnixMilli()}
+	for _, s := range []struct {
+		outOfSpec bool
+		wantClass fbprotocol.ClockClass
+	}{
+		{false, protocol.ClockClassBCHoldoverInSpec},
+		{true, protocol.ClockClassBCHoldoverOutOfSpec},
+	} {
+		if s.outOfSpec {
+			eChannel <- event.EventChannel{ProcessName: event.DPLL, ClockType: event.BC, CfgName: "ts2phc.1.config",
+				IFace: "ens1f0", State: event.PTP_HOLDOVER, OutOfSpec: true,
+				Values: map[event.ValueType]interface{}{event.OFFSET: int64(1200)}, Time: time.Now().UnixMilli()}
+		}
+		select {
+		case g := <-set:
+			assert.Equal(t, s.wantClass, g.ClockQuality.ClockClass)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("clock class %d was not set", s.wantClass)
+		}
+	}
+	assert.Eventually(t, func() bool {
+		return eventManager.Snapshot().ClockClasses[bcCfgName] == uint8(protocol.ClockClassBCHoldoverOutOfSpec)
+	}, 5*time.Second, 100*time.Millisecond)
+	_, ok := eventManager.Snapshot().ClockClasses["ptp4l.1.config"]
+	assert.Equal(t, bcCfgName == "ptp4l.1.config", ok, "no clock class is requested for the slave side ptp4l")
+}
@@ -0,0 +1,332 @@
+package event
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// ProducerQueueSize ... number of events a producer can have pending before it waits for the event handler
+	ProducerQueueSize = 16
+	// deliveryWarning ... time a pending event waits for the event handler before it is reported as stalled
+	deliveryWarning = 10 * time.Second
+	// clockClassProducer ... producer name of the clock class requests
+	clockClassProducer = "clock_class"
+)
+
+var (
+	// EventsBlocked ... events whose producer waited for room in its full queue
+	EventsBlocked = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "events_blocked_total",
+			Help:      "Number of events whose producer waited for the event handler because its queue was full, by producer",
+		}, []string{"producer"})
+
+	// EventsCoalesced ... pending state events replaced by a newer event of the same source
+	EventsCoalesced = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "events_coalesced_total",
+			Help:      "Number of pending events superseded by a newer event of the same process and interface, by producer",
+		}, []string{"producer"})
+
+	// EventQueueDepth ... pending events per producer
+	EventQueueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "event_queue_depth",
+			Help:      "Number of events pending delivery to the event handler, by producer",
+		}, []string{"producer"})
+
+	producers = struct {
+		sync.Mutex
+		m map[string]*producer
+	}{m: map[string]*producer{}}
+)
+
+// producer ... bounded queue of the events of one producer in front of the event channel
+type producer struct {
+	sync.Mutex
+	name    string
+	out     chan<- EventChannel
+	queue   []EventChannel
+	running bool
+	// room ... signaled when the queue has room again
+	room *sync.Cond
+}
+
+// Deliver ... queue the event for the event handler, no event is ever dropped.
+// A pending state event of the same config, process and interface is replaced by a newer one carrying the
+// same values, so the latest state always reaches the handler; reset events are never coalesced. When the queue is full
+// the producer waits until the event handler reads its pending events.
+func Deliver(name string, out chan<- EventChannel, ev EventChannel) {
+	if out == nil {
+		glog.Infof("skip %s event, event channel is not initialized", name)
+		return
+	}
+	producers.Lock()
+	p, ok := producers.m[name]
+	if !ok {
+		p = &producer{name: name}
+		p.room = sync.NewCond(p)
+		producers.m[name] = p
+	}
+	producers.Unlock()
+	p.send(out, ev)
+}
+
+func (p *producer) send(out chan<- EventChannel, ev EventChannel) {
+	p.Lock()
+	defer p.Unlock()
+	p.out = out
+	for blocked := false; ; {
+		// a pending event may be superseded while the producer waits
+		if !ev.Reset && p.coalesce(ev) {
+			EventsCoalesced.WithLabelValues(p.name).Inc()
+			return
+		}
+		if len(p.queue) < ProducerQueueSize {
+			break
+		}
+		if !blocked {
+			blocked = true
+			glog.Warningf("%s event queue is full, waiting for the event handler", p.name)
+			EventsBlocked.WithLabelValues(p.name).Inc()
+		}
+		p.room.Wait()
+	}
+	p.queue = append(p.queue, ev)
+	EventQueueDepth.WithLabelValues(p.name).Set(float64(len(p.queue)))
+	if !p.running {
+		p.running = true
+		go p.run()
+	}
+}
+
+// coalesce replaces the latest pending event of the same source, unless a reset of that source is queued after it
+func (p *producer) coalesce(ev EventChannel) bool {
+	for i := len(p.queue) - 1; i >= 0; i-- {
+		q := p.queue[i]
+		if q.CfgName != ev.CfgName || q.ProcessName != ev.ProcessName {
+			continue
+		}
+		if q.Reset {
+			return false
+		}
+		if q.IFace == ev.IFace {
+			if !supersedes(ev, q) {
+				return false
+			}
+			p.queue[i] = ev
+			return true
+		}
+	}
+	return false
+}
+
+// supersedes is true when ev carries every value of the pending event and is logged whenever the pending one is
+func supersedes(ev, pending EventChannel) bool {
+	if pending.WriteToLog && !ev.WriteToLog {
+		return false
+	}
+	for k := range pending.Values {
+		if _, ok := ev.Values[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *producer) run() {
+	for {
+		p.Lock()
+		if len(p.queue) == 0 {
+			p.running = false
+			p.Unlock()
+			return
+		}
+		ev, out := p.queue[0], p.out
+		p.queue = p.queue[1:]
+		EventQueueDepth.WithLabelValues(p.name).Set(float64(len(p.queue)))
+		p.room.Broadcast()
+		p.Unlock()
+		p.deliver(out, ev)
+	}
+}
+
+// deliver ... hand the event to the event handler, waiting as long as it takes
+func (p *producer) deliver(out chan<- EventChannel, ev EventChannel) {
+	timer := time.NewTimer(deliveryWarning)
+	defer timer.Stop()
+	for waited := deliveryWarning; ; waited += deliveryWarning {
+		select {
+		case out <- ev:
+			return
+		case <-timer.C:
+			glog.Warningf("%s event for %s was not read by the event handler in %s", p.name, ev.IFace, waited)
+			timer.Reset(deliveryWarning)
+		}
+	}
+}
+
+// clockClassQueues ... one clock class mailbox and updater per ptp4l instance, so the clock classes of
+// several GM or BC instances on the node never supersede or wait for each other
+type clockClassQueues struct {
+	sync.Mutex
+	mailboxes map[string]*clockClassMailbox
+	apply     func(ClockClassRequest)
+	closeCh   chan struct{}
+}
+
+func newClockClassQueues() *clockClassQueues {
+	return &clockClassQueues{mailboxes: map[string]*clockClassMailbox{}, closeCh: make(chan struct{})}
+}
+
+// start ... apply the requests of every instance with fn, requests put before start wait for it
+func (q *clockClassQueues) start(fn func(ClockClassRequest)) {
+	q.Lock()
+	defer q.Unlock()
+	if q.apply != nil {
+		return
+	}
+	q.apply = fn
+	for _, m := range q.mailboxes {
+		go q.run(m)
+	}
+}
+
+// put ... queue the request for the ptp4l instance of its config
+func (q *clockClassQueues) put(r ClockClassRequest) {
+	name := ptp4lConfigName(r.cfgName)
+	q.Lock()
+	m, ok := q.mailboxes[name]
+	if !ok {
+		m = &clockClassMailbox{name: clockClassProducer + "/" + name, notify: make(chan struct{}, 1)}
+		q.mailboxes[name] = m
+		if q.apply != nil {
+			go q.run(m)
+		}
+	}
+	q.Unlock()
+	m.put(r)
+}
+
+func (q *clockClassQueues) run(m *clockClassMailbox) {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("restored from clock class update of %s: %s", m.name, err)
+		}
+	}()
+	for {
+		select {
+		case <-m.notify:
+			// only the latest request is applied, older pending requests are superseded
+			if clk, ok := m.take(); ok {
+				q.apply(clk)
+			}
+		case <-q.closeCh:
+			return
+		}
+	}
+}
+
+// stop ... stop the updaters
+func (q *clockClassQueues) stop() {
+	q.Lock()
+	defer q.Unlock()
+	select {
+	case <-q.closeCh:
+	default:
+		close(q.closeCh)
+	}
+}
+
+// clockClassMailbox ... keeps the latest clock class request, a newer request supersedes a pending one
+type clockClassMailbox struct {
+	sync.Mutex
+	name    string
+	request *ClockClassRequest
+	notify  chan struct{}
+}
+
+func (m *clockClassMailbox) put(r ClockClassRequest) {
+	m.Lock()
+	if m.request != nil {
+		EventsCoalesced.WithLabelValues(m.name).Inc()
+	}
+	m.request = &r
+	m.Unlock()
+	select {
+	case m.notify <- struct{}{}:
+	default: // the consumer is already notified
+	}
+}
+
+func (m *clockClassMailbox) take() (ClockClassRequest, bool) {
+	m.Lock()
+	defer m.Unlock()
+	if m.request == nil {
+		return ClockClassRequest{}, false
+	}
+	r := *m.request
+	m.request = nil
+	return r, true
+}
+
+func recordKey(r Record) string {
+	return strings.Join([]string{string(r.Kind), r.ConfigName, r.Process, r.Interface}, "/")
+}
+
+// rememberRecord keeps the latest record of each kind and source for replay
+func (e *EventHandler) rememberRecord(r Record) {
+	if r.Kind == LogRecord {
+		return
+	}
+	e.recordsLock.Lock()
+	defer e.recordsLock.Unlock()
+	if e.lastRecords == nil {
+		e.lastRecords = map[string]Record{}
+	}
+	e.lastRecords[recordKey(r)] = r
+}
+
+// forgetRecords drops the records of a process that was reset; a ts2phc reset clears the whole config
+func (e *EventHandler) forgetRecords(cfgName string, process EventSource) {
+	e.recordsLock.Lock()
+	defer e.recordsLock.Unlock()
+	for k, r := range e.lastRecords {
+		if r.ConfigName == cfgName && (process == TS2PHC || r.Process == string(process)) {
+			delete(e.lastRecords, k)
+		}
+	}
+}
+
+// replayRecords writes the latest known state to a new socket connection, oldest first
+func (e *EventHandler) replayRecords(c net.Conn) {
+	e.recordsLock.Lock()
+	records := make([]Record, 0, len(e.lastRecords))
+	for _, r := range e.lastRecords {
+		records = append(records, r)
+	}
+	e.recordsLock.Unlock()
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+	glog.Infof("replaying %d events after event socket reconnect", len(records))
+	for _, r := range records {
+		if _, err := c.Write(r.Bytes()); err != nil {
+			glog.Errorf("failed to replay %s event: %s", r.Kind, err)
+			return
+		}
+	}
+}
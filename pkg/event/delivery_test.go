@@ -0,0 +1,125 @@
+package event_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/openshift/linuxptp-daemon/pkg/event"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func offsetEvent(iface string, offset int64) event.EventChannel {
+	return event.EventChannel{
+		ProcessName: event.TS2PHC,
+		CfgName:     "ts2phc.0.config",
+		IFace:       iface,
+		State:       event.PTP_LOCKED,
+		Values:      map[event.ValueType]interface{}{event.OFFSET: offset},
+	}
+}
+
+// waitInFlight waits until the producer handed its first event to the channel
+func waitInFlight(t *testing.T, producer string) {
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(event.EventQueueDepth.WithLabelValues(producer)) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func count(c interface {
+	WithLabelValues(...string) prometheus.Counter
+}, producer string) float64 {
+	return testutil.ToFloat64(c.WithLabelValues(producer))
+}
+
+func receive(t *testing.T, out chan event.EventChannel) event.EventChannel {
+	select {
+	case e := <-out:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("event was not delivered")
+	}
+	return event.EventChannel{}
+}
+
+func TestDeliver_Coalesce(t *testing.T) {
+	producer := "test/coalesce"
+	coalesced, blocked := count(event.EventsCoalesced, producer), count(event.EventsBlocked, producer)
+	out := make(chan event.EventChannel)
+	event.Deliver(producer, out, offsetEvent("ens1f0", 1))
+	waitInFlight(t, producer)
+
+	event.Deliver(producer, out, offsetEvent("ens1f0", 2))
+	event.Deliver(producer, out, offsetEvent("ens2f0", 10))
+	event.Deliver(producer, out, offsetEvent("ens1f0", 3))
+	event.Deliver(producer, out, event.EventChannel{ProcessName: event.TS2PHC, CfgName: "ts2phc.0.config", Reset: true})
+	// a queued reset is a barrier, the event after it is not merged into the one before it
+	event.Deliver(producer, out, offsetEvent("ens1f0", 4))
+
+	assert.Equal(t, int64(1), receive(t, out).Values[event.OFFSET])
+	assert.Equal(t, int64(3), receive(t, out).Values[event.OFFSET])
+	assert.Equal(t, int64(10), receive(t, out).Values[event.OFFSET])
+	assert.True(t, receive(t, out).Reset)
+	assert.Equal(t, int64(4), receive(t, out).Values[event.OFFSET])
+	assert.Equal(t, coalesced+1, count(event.EventsCoalesced, producer))
+	assert.Equal(t, blocked, count(event.EventsBlocked, producer))
+}
+
+func TestDeliver_KeepsValues(t *testing.T) {
+	producer := "test/values"
+	coalesced := count(event.EventsCoalesced, producer)
+	out := make(chan event.EventChannel)
+	event.Deliver(producer, out, offsetEvent("ens1f0", 1))
+	waitInFlight(t, producer)
+
+	ql := offsetEvent("ens1f0", 0)
+	ql.Values = map[event.ValueType]interface{}{event.QL: byte(2)}
+	event.Deliver(producer, out, ql)
+	// a newer event without the pending QL value does not replace it
+	event.Deliver(producer, out, offsetEvent("ens1f0", 2))
+
+	receive(t, out)
+	assert.Equal(t, byte(2), receive(t, out).Values[event.QL])
+	assert.Equal(t, int64(2), receive(t, out).Values[event.OFFSET])
+	assert.Equal(t, coalesced, count(event.EventsCoalesced, producer))
+}
+
+func TestDeliver_StalledHandler(t *testing.T) {
+	producer := "test/stalled"
+	blocked := count(event.EventsBlocked, producer)
+	out := make(chan event.EventChannel)
+	total := 3 * event.ProducerQueueSize
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < total; i++ {
+			// events of distinct interfaces never supersede each other
+			event.Deliver(producer, out, offsetEvent(fmt.Sprintf("ens%d", i), int64(i)))
+		}
+		// a queue holding only resets keeps all of them
+		for i := 0; i < event.ProducerQueueSize+1; i++ {
+			event.Deliver(producer, out, event.EventChannel{ProcessName: event.TS2PHC, CfgName: "ts2phc.0.config", Reset: true})
+		}
+	}()
+
+	// the handler stalls, the producer waits for it
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(event.EventQueueDepth.WithLabelValues(producer)) == event.ProducerQueueSize
+	}, time.Second, time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("producer did not wait for the stalled handler")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Greater(t, count(event.EventsBlocked, producer), blocked)
+
+	for i := 0; i < total; i++ {
+		assert.Equal(t, int64(i), receive(t, out).Values[event.OFFSET])
+	}
+	for i := 0; i < event.ProducerQueueSize+1; i++ {
+		assert.True(t, receive(t, out).Reset)
+	}
+	<-done
+}
@@ -3,8 +3,8 @@ package event
 import (
 	"fmt"
 	"github.com/openshift/linuxptp-daemon/pkg/debug"
+	"maps"
 	"net"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -63,20 +63,23 @@ type ClockClassRequest struct {
 	clockType     ClockType
 	clockClass    fbprotocol.ClockClass
 	clockAccuracy fbprotocol.ClockAccuracy
+	// offsetScaledLogVariance of a locked T-GM, measured from the time error of its sources
+	offsetScaledLogVariance uint16
+	profile                 protocol.TelecomProfile
+	reset                   bool // restore the default settings without reporting a clock class change
 }
 
-var (
-	//  make sure only one clock class update is tried if it fails next  try will pass
-	// this will also stop flooding
-	clockClassRequestCh = make(chan ClockClassRequest, 1)
+// ptp4lConfigName ... config of the ptp4l instance announcing the clock class of a config
+func ptp4lConfigName(cfgName string) string {
+	return strings.Replace(cfgName, TS2PHCProcessName, PTP4lProcessName, 1)
+}
 
+var (
 	PMCGMGetter = func(cfgName string) (protocol.GrandmasterSettings, error) {
-		cfgName = strings.Replace(cfgName, TS2PHCProcessName, PTP4lProcessName, 1)
-		return pmc.RunPMCExpGetGMSettings(cfgName)
+		return pmc.RunPMCExpGetGMSettings(ptp4lConfigName(cfgName))
 	}
 	PMCGMSetter = func(cfgName string, g protocol.GrandmasterSettings) error {
-		cfgName = strings.Replace(cfgName, TS2PHCProcessName, PTP4lProcessName, 1)
-		err := pmc.RunPMCExpSetGMSettings(cfgName, g)
+		err := pmc.RunPMCExpSetGMSettings(ptp4lConfigName(cfgName), g)
 		if err != nil {
 			return fmt.Errorf("failed to update GRANDMASTER_SETTINGS_NP: %s", err)
 		}
@@ -144,30 +147,48 @@ type grandMasterSyncState struct {
 	state          PTPState
 	clockClass     fbprotocol.ClockClass
 	sourceLost     bool
-	gmLog          string
+	gmLog          *Record
 	lastLoggedTime int64
 	gmIFace        string
 	clockAccuracy  fbprotocol.ClockAccuracy
 }
 
+// configClockState ... clock class applied to the ptp4l instance of a config and the DPLL holdover state reported for it
+type configClockState struct {
+	clockClass         fbprotocol.ClockClass
+	clockAccuracy      fbprotocol.ClockAccuracy
+	variance           uint16 // offsetScaledLogVariance applied to the ptp4l instance
+	outOfSpec          bool   // is offset out of spec, used for Lost Source,In Spec and OPut of Spec state transitions
+	frequencyTraceable bool   // will be tru if synce is traceable
+}
+
 // EventHandler ... event handler to process events
 type EventHandler struct {
 	sync.Mutex
-	nodeName           string
-	stdoutSocket       string
-	stdoutToSocket     bool
-	processChannel     <-chan EventChannel
-	closeCh            chan bool
-	data               map[string][]*Data
-	offsetMetric       *prometheus.GaugeVec
-	clockMetric        *prometheus.GaugeVec
-	clockClassMetric   *prometheus.GaugeVec
-	clockClass         fbprotocol.ClockClass
-	clockAccuracy      fbprotocol.ClockAccuracy
-	gmSyncState        map[string]*grandMasterSyncState
-	outOfSpec          bool // is offset out of spec, used for Lost Source,In Spec and OPut of Spec state transitions
-	frequencyTraceable bool // will be tru if synce is traceable
-	ReduceLog          bool // reduce logs for every announce
+	nodeName         string
+	stdoutSocket     string
+	stdoutToSocket   bool
+	processChannel   <-chan EventChannel
+	closeCh          chan bool
+	data             map[string][]*Data
+	offsetMetric     *prometheus.GaugeVec
+	clockMetric      *prometheus.GaugeVec
+	clockClassMetric *prometheus.GaugeVec
+	clocks           map[string]*configClockState
+	clockClassQueues *clockClassQueues
+	gmSyncState      map[string]*grandMasterSyncState
+	bcSyncState      map[string]*bcSyncState
+	bcConfigs        map[string]string                  // T-BC config of the DPLLs reporting on a ts2phc config
+	telecomProfiles  map[string]protocol.TelecomProfile // telecom profile of each ptp4l config
+	qualities        map[string]*clockQuality           // measured clock quality of each GM config
+	emit             *emitFilter                        // emit policies of the state records
+	ReduceLog        bool                               // reduce logs for every announce
+	// last record written to the socket per kind and source, replayed after a reconnect
+	recordsLock sync.Mutex
+	lastRecords map[string]Record
+	// connection to the event socket, replaced on reconnect and read by the clock class updaters
+	connLock sync.Mutex
+	conn     net.Conn
 }
 
 // EventChannel .. event channel to subscriber to events
@@ -200,52 +221,38 @@ func (e *EventHandler) MockEnable() {
 func Init(nodeName string, stdOutToSocket bool, socketName string, processChannel chan EventChannel, closeCh chan bool,
 	offsetMetric *prometheus.GaugeVec, clockMetric *prometheus.GaugeVec, clockClassMetric *prometheus.GaugeVec) *EventHandler {
 	ptpEvent := &EventHandler{
-		nodeName:           nodeName,
-		stdoutSocket:       socketName,
-		stdoutToSocket:     stdOutToSocket,
-		closeCh:            closeCh,
-		processChannel:     processChannel,
-		data:               map[string][]*Data{},
-		clockMetric:        clockMetric,
-		offsetMetric:       offsetMetric,
-		clockClassMetric:   clockClassMetric,
-		clockClass:         protocol.ClockClassUninitialized,
-		gmSyncState:        map[string]*grandMasterSyncState{},
-		outOfSpec:          false,
-		frequencyTraceable: false,
-		ReduceLog:          true,
-	}
-	if clockClassMetric != nil {
-		clockClassMetric.With(prometheus.Labels{
-			"process": PTP4lProcessName, "node": nodeName}).Set(248)
+		nodeName:         nodeName,
+		stdoutSocket:     socketName,
+		stdoutToSocket:   stdOutToSocket,
+		closeCh:          closeCh,
+		processChannel:   processChannel,
+		data:             map[string][]*Data{},
+		clockMetric:      clockMetric,
+		offsetMetric:     offsetMetric,
+		clockClassMetric: clockClassMetric,
+		clocks:           map[string]*configClockState{},
+		clockClassQueues: newClockClassQueues(),
+		gmSyncState:      map[string]*grandMasterSyncState{},
+		bcSyncState:      map[string]*bcSyncState{},
+		bcConfigs:        map[string]string{},
+		telecomProfiles:  map[string]protocol.TelecomProfile{},
+		qualities:        map[string]*clockQuality{},
+		emit:             newEmitFilter(),
+		ReduceLog:        true,
+		lastRecords:      map[string]Record{},
 	}
 	StateRegisterer = NewStateNotifier()
 	return ptpEvent
 
 }
 
+// GetLogData ... text line of the event
 func (e *EventChannel) GetLogData() string {
-	logData := make([]string, 0, len(e.Values))
-	for k, v := range e.Values {
-		switch val := v.(type) {
-		case int64, int, int32:
-			logData = append(logData, fmt.Sprintf("%s %d", k, val))
-		case float64:
-			logData = append(logData, fmt.Sprintf("%s %f", k, val))
-		case string:
-			logData = append(logData, fmt.Sprintf("%s %s", k, val))
-		case byte:
-			logData = append(logData, fmt.Sprintf("%s %#x", k, val))
-		default:
-			continue //ignore string for metrics
-		}
-	}
-	sort.Strings(logData)
-	return fmt.Sprintf("%s[%d]:[%s] %s %s %s\n", e.ProcessName,
-		time.Now().Unix(), e.CfgName, e.IFace, strings.Join(logData, " "), e.State)
+	return e.Record().Text()
 }
 
-// getGMState ... get lowest state of all the interfaces
+// updateGMState ... compute the GM state of the config from GMStateTable; the DPLL rows are decided by the
+// DPLL state table in the dpll package
 /*
 GNSS State + DPLL State= DPLL State
 DPLL STate + Ts2phc State =GM State
@@ -264,7 +271,7 @@ DPLL | Frequency/Phase  	|  Offset  | GNSS STATE |  DPLL PTP STATE
 3.  |  2 (LOCKED)       	| in Range |  LOCKED      | LOCKED
 4.  |  2 (LOCKED)       	| in Range |  FREERUN     | LOCKED
 -----------------------------------------------------------------
-SL :-> Source Lost
+SL :-> Source Lost, GNSS lost or, for a PPS fed DPLL, its 1PPS input lost
 ------------------------------------------------------------------------------------------
 DPLL| Frequency/Phase      | Offset      | GNSS STATE               | DPLL PTP State
 ------------------------------------------------------------------------------------------
@@ -289,7 +296,8 @@ FINAL GM STATE  *SL = Source Lost
 ---------------------------------------------------------------------------------------------
 | FREERUN               | NA                | NA                | FREERUN  | 248
 | HOLDOVER IN SPEC      | NA                | NA                | HOLDOVER | 7
-| FREERUN OUT OF SPEC   | NA                | NA                | FREERUN  | 140
+| HOLDOVER OUT OF SPEC  | NA                | NA                | HOLDOVER | 140 (SyncE frequency traceable)
+| FREERUN OUT OF SPEC   | NA                | NA                | FREERUN  | 140 (SyncE frequency traceable)
 | LOCKED                | LOCKED            | LOCKED            | LOCKED   | 6
 | LOCKED                | LOCKED            | FREERUN           | FREERUN  | 248
 | LOCKED                | *FREERUN (SL)     | LOCKED            | NA       | Wait for DPLL
@@ -310,7 +318,7 @@ DPLL PTP State |  GNSS PTP STATE  |	TS2PHC PTP STATE| GM STATE | Clock Class
 | NA           |  LOCKED          |	LOCKED          | LOCKED   | 6
 
 */
-func (e *EventHandler) updateGMState(cfgName string) grandMasterSyncState {
+func (e *EventHandler) updateGMState(cfgName string, trigger EventSource) grandMasterSyncState {
 	dpllState := PTP_NOTSET
 	gnssState := PTP_FREERUN
 	ts2phcState := PTP_FREERUN
@@ -330,6 +338,7 @@ func (e *EventHandler) updateGMState(cfgName string) grandMasterSyncState {
 			gmIFace:       gmInterface,
 		}
 	}
+	previousState := e.gmSyncState[cfgName].state
 	// right now if GPS offset || mode is bad then consider source lost
 	e.gmSyncState[cfgName].sourceLost = gnssSrcLost
 	e.gmSyncState[cfgName].gmIFace = gmInterface
@@ -351,103 +360,39 @@ func (e *EventHandler) updateGMState(cfgName string) grandMasterSyncState {
 		e.gmSyncState[cfgName].clockAccuracy = fbprotocol.ClockAccuracyUnknown
 		e.gmSyncState[cfgName].lastLoggedTime = time.Now().Unix()
 		e.gmSyncState[cfgName].gmIFace = gmInterface
-		e.gmSyncState[cfgName].gmLog = fmt.Sprintf("%s[%d]:[%s] %s T-GM-STATUS %s\n", GM, e.gmSyncState[cfgName].lastLoggedTime, cfgName, gmInterface, e.gmSyncState[cfgName].state)
+		gmLog := NewGMStateRecord(cfgName, gmInterface, e.gmSyncState[cfgName].state, uint8(e.gmSyncState[cfgName].clockClass),
+			e.gmSyncState[cfgName].sourceLost, time.Unix(e.gmSyncState[cfgName].lastLoggedTime, 0))
+		e.gmSyncState[cfgName].gmLog = &gmLog
 		return *e.gmSyncState[cfgName]
 	}
 	e.gmSyncState[cfgName].gmIFace = gmInterface
-	switch dpllState {
-	case PTP_FREERUN: // This is OVER ALL State with HOLDOVER having the highest priority
-		// add check so that clock class won't change if GM was in HOLDOVER state
-		e.gmSyncState[cfgName].state = dpllState
-		// T-GM or T-BC in free-run mode
-		if e.outOfSpec && e.frequencyTraceable {
-			// T-GM in holdover, out of holdover specification
-			e.gmSyncState[cfgName].clockClass = protocol.ClockClassOutOfSpec
-		} else { // from holdover it goes to out of spec to free run
-			// T-GM or T-BC in free-run mode
-			e.gmSyncState[cfgName].clockClass = protocol.ClockClassFreerun
-		}
-		e.gmSyncState[cfgName].clockAccuracy = fbprotocol.ClockAccuracyUnknown
-	case PTP_HOLDOVER:
-		e.gmSyncState[cfgName].state = dpllState
-		// T-GM in holdover, within holdover specification
-		e.gmSyncState[cfgName].clockClass = fbprotocol.ClockClass7
-	case PTP_LOCKED, PTP_NOTSET: // consider DPLL is locked if DPLL is not available
-		switch gnssState {
-		case PTP_LOCKED:
-			switch ts2phcState {
-			case PTP_FREERUN:
-				e.gmSyncState[cfgName].state = PTP_FREERUN
-				// T-GM or T-BC in free-run mode
-				e.gmSyncState[cfgName].clockClass = protocol.ClockClassFreerun
-				e.gmSyncState[cfgName].clockAccuracy = fbprotocol.ClockAccuracyUnknown
-			case PTP_LOCKED:
-				e.gmSyncState[cfgName].state = PTP_LOCKED
-				// T-GM connected to a PRTC in locked mode (e.g., PRTC traceable to GNSS)
-				e.gmSyncState[cfgName].clockClass = fbprotocol.ClockClass6
-				e.gmSyncState[cfgName].clockAccuracy = fbprotocol.ClockAccuracyNanosecond100
-			case PTP_HOLDOVER:
-				e.gmSyncState[cfgName].state = PTP_HOLDOVER
-				e.gmSyncState[cfgName].clockClass = fbprotocol.ClockClass7
-			}
-		case PTP_FREERUN:
-			if gnssSrcLost {
-				switch ts2phcState {
-				case PTP_LOCKED, PTP_FREERUN:
-				// stay with last GM state and wait for DPLL to move to HOLDOVER
-				case PTP_HOLDOVER:
-					e.gmSyncState[cfgName].state = PTP_HOLDOVER
-					e.gmSyncState[cfgName].clockClass = fbprotocol.ClockClass7
-				}
-			} else {
-				switch ts2phcState {
-				case PTP_FREERUN, PTP_LOCKED, PTP_UNKNOWN, PTP_NOTSET:
-					e.gmSyncState[cfgName].state = PTP_FREERUN
-					// T-GM or T-BC in free-run mode
-					e.gmSyncState[cfgName].clockClass = protocol.ClockClassFreerun
-					e.gmSyncState[cfgName].clockAccuracy = fbprotocol.ClockAccuracyUnknown
-				}
-			}
-		}
-	default:
-		switch gnssState {
-		case PTP_LOCKED:
-			switch ts2phcState {
-			case PTP_FREERUN, PTP_UNKNOWN, PTP_NOTSET:
-				e.gmSyncState[cfgName].state = PTP_FREERUN
-				// T-GM or T-BC in free-run mode
-				e.gmSyncState[cfgName].clockClass = protocol.ClockClassFreerun
-				e.gmSyncState[cfgName].clockAccuracy = fbprotocol.ClockAccuracyUnknown
-			case PTP_LOCKED:
-				e.gmSyncState[cfgName].state = PTP_LOCKED
-				// T-GM connected to a PRTC in locked mode (e.g., PRTC traceable to GNSS)
-				e.gmSyncState[cfgName].clockClass = fbprotocol.ClockClass6
-				e.gmSyncState[cfgName].clockAccuracy = fbprotocol.ClockAccuracyNanosecond100
-			case PTP_HOLDOVER:
-				e.gmSyncState[cfgName].state = PTP_HOLDOVER
-				e.gmSyncState[cfgName].clockClass = fbprotocol.ClockClass7 //TODO: check if this is correct
-			}
-		case PTP_FREERUN:
-			switch ts2phcState {
-			case PTP_FREERUN, PTP_LOCKED, PTP_UNKNOWN, PTP_NOTSET: // when GNSS is lost ts2phc will stop printing and will wait to move to HOLDOVER
-				e.gmSyncState[cfgName].state = PTP_FREERUN
-				e.gmSyncState[cfgName].clockClass = protocol.ClockClassFreerun
-				e.gmSyncState[cfgName].clockAccuracy = fbprotocol.ClockAccuracyUnknown
-			case PTP_HOLDOVER: // if holdover is detected then wait for ts2phc to move to HOLDOVER
-				e.gmSyncState[cfgName].state = PTP_HOLDOVER
-				e.gmSyncState[cfgName].clockClass = fbprotocol.ClockClass7 //TODO: check if this is correct
-			}
-		default: // bad case
-			e.gmSyncState[cfgName].state = ts2phcState
-			switch ts2phcState {
-			case PTP_FREERUN:
-				e.gmSyncState[cfgName].clockClass = protocol.ClockClassFreerun
-				e.gmSyncState[cfgName].clockAccuracy = fbprotocol.ClockAccuracyUnknown
-			case PTP_LOCKED:
-				e.gmSyncState[cfgName].clockClass = fbprotocol.ClockClass7
-				e.gmSyncState[cfgName].clockAccuracy = fbprotocol.ClockAccuracyNanosecond100
+	inputs := GMInputs{
+		Dpll:               dpllState,
+		Gnss:               gnssState,
+		Ts2phc:             ts2phcState,
+		SourceLost:         gnssSrcLost,
+		OutOfSpec:          e.clockState(cfgName).outOfSpec,
+		FrequencyTraceable: e.clockState(cfgName).frequencyTraceable,
+	}
+	previousClass := e.gmSyncState[cfgName].clockClass
+	if row, ok := GMStateFromTable(GMStateTable, inputs); ok {
+		e.gmSyncState[cfgName].apply(row)
+		if g := e.gmSyncState[cfgName]; g.state != previousState || g.clockClass != previousClass {
+			t := GMTransition{
+				ConfigName: cfgName,
+				From:       previousState,
+				To:         g.state,
+				FromClass:  previousClass,
+				ToClass:    g.clockClass,
+				Trigger:    trigger,
+				Row:        row.ID,
+				Inputs:     inputs,
 			}
+			glog.Info(t)
+			publishGMTransition(t, g)
 		}
+	} else {
+		glog.Errorf("no GM state table row matches %s", inputs)
 	}
 	gSycState := e.gmSyncState[cfgName]
 	rGrandMasterSyncState := grandMasterSyncState{
@@ -460,10 +405,10 @@ func (e *EventHandler) updateGMState(cfgName string) grandMasterSyncState {
 	// this will reduce log noise and prints 1 per sec
 	logTime := time.Now().Unix()
 	if e.gmSyncState[cfgName].lastLoggedTime != logTime {
-		gmLog := fmt.Sprintf("%s[%d]:[%s] %s T-GM-STATUS %s\n", GM, logTime, cfgName, gSycState.gmIFace, gSycState.state)
+		gmLog := NewGMStateRecord(cfgName, gSycState.gmIFace, gSycState.state, uint8(gSycState.clockClass), gSycState.sourceLost, time.Unix(logTime, 0))
 		e.gmSyncState[cfgName].lastLoggedTime = logTime
-		e.gmSyncState[cfgName].gmLog = gmLog
-		rGrandMasterSyncState.gmLog = gmLog
+		e.gmSyncState[cfgName].gmLog = &gmLog
+		rGrandMasterSyncState.gmLog = &gmLog
 		glog.Infof("dpll State %s, gnss State %s, tsphc state %s, gm state %s,", dpllState, gnssState, ts2phcState, e.gmSyncState[cfgName].state)
 	}
 	return rGrandMasterSyncState
@@ -517,8 +462,9 @@ func (e *EventHandler) getGNSSInterface(cfgName string) string {
 func (e *EventHandler) updateSpecState(event EventChannel) {
 	// update if DPLL holdover is out of spec
 	if event.ProcessName == DPLL {
-		e.outOfSpec = event.OutOfSpec
-		e.frequencyTraceable = event.FrequencyTraceable
+		clk := e.clockState(event.CfgName)
+		clk.outOfSpec = event.OutOfSpec
+		clk.frequencyTraceable = event.FrequencyTraceable
 	}
 }
 func (e *EventHandler) toString() string {
@@ -569,6 +515,7 @@ func (e *EventHandler) ProcessEvents() {
 	var err error
 	redialClockClass := true
 	retryCount := 0
+	defer e.clockClassQueues.stop()
 	defer func() {
 		if e.stdoutToSocket && c != nil {
 			if err = c.Close(); err != nil {
@@ -577,6 +524,7 @@ func (e *EventHandler) ProcessEvents() {
 		}
 	}()
 	var lastgmState PTPState
+	reconnect := false
 connect:
 	select {
 	case <-e.closeCh:
@@ -594,36 +542,32 @@ connect:
 				goto connect
 			}
 			retryCount = 0
+			e.setConn(c)
+			if reconnect {
+				// the consumer may have missed events while the socket was down
+				e.replayRecords(c)
+			}
 		}
 	}
 
 	if redialClockClass {
-		go func(eConn *net.Conn) {
-			defer func() {
-				if err := recover(); err != nil {
-					glog.Errorf("restored from clock class update: %s", err)
-				}
-			}()
-			for {
-				select {
-				case clk := <-clockClassRequestCh:
-					e.UpdateClockClass(c, clk)
-				case <-e.closeCh:
-					return
-				}
-			}
-		}(&c)
+		// every ptp4l instance gets its own updater, writing to the connection in use
+		e.clockClassQueues.start(func(clk ClockClassRequest) {
+			e.UpdateClockClass(e.socketConn(), clk)
+		})
 		redialClockClass = false
 	}
 	// call all monitoring candidates; verify every 5 secs for any new
 	ticker := time.NewTicker(5 * time.Second)
+	// the notifier of this handler, Init replaces the package one
+	notifier := StateRegisterer
 	go func() {
 		for {
 			select {
 			case <-e.closeCh:
 				return
 			case <-ticker.C:
-				StateRegisterer.monitor()
+				notifier.monitor()
 			}
 		}
 	}()
@@ -634,56 +578,84 @@ connect:
 		case event := <-e.processChannel: // for non GM this thread will be in sleep forever
 			// ts2phc[123455]:[ts2phc.0.config] 12345 s0 offset/gps
 			// replace ts2phc logs here
+			// data is read by the query api
+			e.Lock()
 			if event.Reset { // clean up
 				debug.ClearState() // clear any state data used for debug
+				e.forgetRecords(event.CfgName, event.ProcessName)
+				EventHistory.Forget(event.CfgName, event.ProcessName)
+				e.emit.forget(event.CfgName, event.ProcessName)
 				if event.ProcessName == TS2PHC {
 					e.unregisterMetrics(event.CfgName, "")
 					delete(e.data, event.CfgName) // this will delete all index
-					e.clockClass = protocol.ClockClassUninitialized
-					e.clockAccuracy = fbprotocol.ClockAccuracyUnknown
+					e.removeClockState(event.CfgName)
+					delete(e.qualities, event.CfgName)
+				} else if event.ProcessName == PTP4l && event.ClockType == BC {
+					e.removeData(event.CfgName, event.ProcessName)
+					delete(e.bcSyncState, event.CfgName)
+					e.removeClockState(event.CfgName)
 				} else {
-					// Check if the index is within the slice bounds
-					for indexToRemove, d := range e.data[event.CfgName] {
-						if d.ProcessName == event.ProcessName {
-							e.unregisterMetrics(event.CfgName, string(event.ProcessName))
-							if indexToRemove < len(e.data[event.CfgName]) {
-								e.data[event.CfgName] = append(e.data[event.CfgName][:indexToRemove], e.data[event.CfgName][indexToRemove+1:]...)
-							}
-						}
-					}
+					e.removeData(event.CfgName, event.ProcessName)
 					delete(e.gmSyncState, event.CfgName) // delete the gmSyncState
-					e.outOfSpec = false
-					e.frequencyTraceable = false
+					delete(e.qualities, event.CfgName)
+					if clk, ok := e.clocks[event.CfgName]; ok {
+						clk.outOfSpec = false
+						clk.frequencyTraceable = false
+					}
 				}
+				e.Unlock()
 				continue
 			}
-			var logOut []string
-			logDataValues := ""
+			var logOut []Record
 			if event.ProcessName == SYNCE {
 				// Update the metrics
-				logDataValues = event.GetLogData()
-				if event.WriteToLog && logDataValues != "" {
-					logOut = append(logOut, logDataValues)
+				if event.WriteToLog {
+					logOut = append(logOut, event.Record())
 				}
 				e.UpdateClockStateMetrics(event.State, string(event.ProcessName), event.IFace)
+			} else if event.ProcessName == PTP4l && event.ClockType == BC {
+				// T-BC slave port state, the clock class follows the BC state table
+				e.addEvent(event)
+				e.addBCEvent(event)
+				logOut = append(logOut, e.updateBCState(event.CfgName, event.ProcessName)...)
+			} else if event.ProcessName == PHC2SYS && event.ClockType == BC {
+				// holdover status of the phc2sys of a T-BC profile
+				e.addBCPhc2sysEvent(event)
+				logOut = append(logOut, e.updateBCState(event.CfgName, event.ProcessName)...)
+			} else if event.ProcessName == PTP4l || event.ProcessName == PHC2SYS {
+				// offset state of a ptp4l or phc2sys series, e.g. FREERUN once the series is no longer updated
+				if event.WriteToLog {
+					logOut = append(logOut, event.Record())
+				}
 			} else {
 				// Update the in MemData
 				dataDetails := e.addEvent(event)
+				// the time error of the locked sources is the measured quality of the clock, a lost source starts over
+				if event.ProcessName == GNSS || event.ProcessName == TS2PHC || event.ProcessName == DPLL {
+					if offset, ok := event.Values[OFFSET].(int64); ok && event.State == PTP_LOCKED {
+						e.clockQuality(event.CfgName).add(event.ProcessName, event.IFace, offset)
+					} else if event.State != PTP_LOCKED {
+						e.clockQuality(event.CfgName).drop(event.ProcessName, event.IFace)
+					}
+				}
+				// the record is taken before the values are altered below
+				eventRecord := event.Record()
 				// Computes GM state
-				gmState := e.updateGMState(event.CfgName)
+				gmState := e.updateGMState(event.CfgName, event.ProcessName)
 				// right now if GPS offset || mode is bad then consider source lost
 				if e.gmSyncState[event.CfgName] != nil {
 					e.gmSyncState[event.CfgName].sourceLost = event.OutOfSpec
 				}
 				if gmState.state != PTP_LOCKED { // here update nmea status
 					if _, ok := event.Values[NMEA_STATUS]; ok {
+						// the values map is still read by the sender
+						event.Values = maps.Clone(event.Values)
 						event.Values[NMEA_STATUS] = 0
 					}
 				}
 
-				logDataValues = dataDetails.logData
-				if event.WriteToLog && logDataValues != "" {
-					logOut = append(logOut, logDataValues)
+				if event.WriteToLog && dataDetails.logData != "" {
+					logOut = append(logOut, eventRecord)
 				}
 				// only if config has this special name
 				d := e.GetData(event.CfgName, event.ProcessName)
@@ -700,8 +672,8 @@ connect:
 				}
 				debug.UpdateGMState(string(gmState.state))
 
-				if gmState.gmLog != "" && gmState.gmIFace != GM_INTERFACE_UNKNOWN {
-					logOut = append(logOut, gmState.gmLog)
+				if gmState.gmLog != nil && gmState.gmIFace != GM_INTERFACE_UNKNOWN {
+					logOut = append(logOut, *gmState.gmLog)
 				}
 
 				// Update the metrics
@@ -728,7 +700,8 @@ connect:
 
 				// Default Assignment: The clockAccuracy of gmState is initially set to the clockAccuracy of the event
 				//This serves as a default value.
-				gmState.clockAccuracy = e.clockAccuracy
+				clk := e.clockState(event.CfgName)
+				gmState.clockAccuracy = clk.clockAccuracy
 
 				// Conditional Update: Check if the clockClass of gmState is either fbprotocol.ClockClass7 or protocol.ClockClassOutOfSpec
 				// and if the ProcessName of the event is DPLL.
@@ -748,26 +721,50 @@ connect:
 					}
 				}
 
-				// If the clockClass of gmState is not protocol.ClockClassUninitialized and there is a change in clockClass or clockAccuracy,
-				// log the change and update the clock class.
-				if gmState.clockClass != protocol.ClockClassUninitialized &&
-					(uint8(gmState.clockClass) != uint8(e.clockClass) || gmState.clockAccuracy != e.clockAccuracy) {
-					glog.Infof("clock class change request from %d to %d with clock accuracy from %d to %d",
-						uint8(e.clockClass), uint8(gmState.clockClass), uint8(e.clockAccuracy), uint8(gmState.clockAccuracy))
+				// the clock class of the state in the telecom profile of the config
+				profile := e.telecomProfile(event.CfgName)
+				gmState.clockClass = profile.ClockClass(gmState.clockClass)
+
+				// The measured quality is announced when it is worse than the profile values of a locked T-GM;
+				// in holdover it bounds the accuracy estimated from the DPLL offset.
+				variance := uint16(0xffff)
+				measuredAccuracy, measuredVariance, measured := e.clockQuality(event.CfgName).update(eventTime(event))
+				switch gmState.clockClass {
+				case fbprotocol.ClockClass6:
+					gmState.clockAccuracy, variance = profile.LockedClockAccuracy(), profile.LockedOffsetScaledLogVariance()
+					if measured {
+						gmState.clockAccuracy = worseAccuracy(gmState.clockAccuracy, measuredAccuracy)
+						variance = max(variance, measuredVariance)
+					}
+				case fbprotocol.ClockClass7, protocol.ClockClassOutOfSpec, protocol.ClockClassBCHoldoverInSpec, protocol.ClockClassBCHoldoverOutOfSpec:
+					if measured {
+						gmState.clockAccuracy = worseAccuracy(gmState.clockAccuracy, measuredAccuracy)
+					}
+				}
+
+				// If the clockClass of gmState is not protocol.ClockClassUninitialized and there is a change in clockClass, clockAccuracy
+				// or offsetScaledLogVariance, log the change and update the clock class.
+				// the clock class of a T-BC fed by the DPLLs of the config follows the BC state table
+				bcCfgName, isBC := e.bcConfigs[event.CfgName]
+				if !isBC && gmState.clockClass != protocol.ClockClassUninitialized &&
+					(uint8(gmState.clockClass) != uint8(clk.clockClass) || gmState.clockAccuracy != clk.clockAccuracy ||
+						(gmState.clockClass == fbprotocol.ClockClass6 && variance != clk.variance)) {
+					glog.Infof("[%s] clock class change request from %d to %d with clock accuracy from %d to %d variance 0x%x", event.CfgName,
+						uint8(clk.clockClass), uint8(gmState.clockClass), uint8(clk.clockAccuracy), uint8(gmState.clockAccuracy), variance)
 					debug.UpdateClockClass(uint8(gmState.clockClass))
-					go func() {
-						select {
-						case clockClassRequestCh <- ClockClassRequest{
-							cfgName:       event.CfgName,
-							gmState:       gmState.state,
-							clockType:     event.ClockType,
-							clockClass:    gmState.clockClass,
-							clockAccuracy: gmState.clockAccuracy,
-						}:
-						default:
-							glog.Error("clock class request busy updating previous request, will try next event")
-						}
-					}()
+					e.clockClassQueues.put(ClockClassRequest{
+						cfgName:                 event.CfgName,
+						gmState:                 gmState.state,
+						clockType:               event.ClockType,
+						clockClass:              gmState.clockClass,
+						clockAccuracy:           gmState.clockAccuracy,
+						offsetScaledLogVariance: variance,
+						profile:                 profile,
+					})
+				}
+				// a DPLL leaving its holdover specification moves the T-BC out of spec
+				if isBC && event.ProcessName == DPLL {
+					logOut = append(logOut, e.updateBCState(bcCfgName, event.ProcessName)...)
 				}
 				if lastgmState != gmState.state {
 					glog.Infof("PTP State: GM State %v, Clock Class %d Time %s sourceLost %v", gmState.state, gmState.clockClass, time.Now(), gmState.sourceLost)
@@ -775,19 +772,32 @@ connect:
 				}
 
 			} // end of GM condition
+			// the latest records are replayed after a reconnect, also those held back by the emit policies
+			if e.stdoutToSocket {
+				for _, l := range logOut {
+					e.rememberRecord(l)
+				}
+			}
+			// the in memory state is updated, records of sources that did not change are not written
+			logOut = e.filterRecords(logOut)
+			e.Unlock()
+			for _, l := range logOut {
+				EventHistory.Add(l)
+			}
 			if len(logOut) > 0 {
 				if e.stdoutToSocket {
 					for _, l := range logOut {
-						fmt.Printf("%s", l)
-						_, err = c.Write([]byte(l))
+						fmt.Printf("%s", l.Text())
+						_, err = c.Write(l.Bytes())
 						if err != nil {
-							glog.Errorf("Write %s error %s:", l, err)
+							glog.Errorf("Write %s error %s:", l.Text(), err)
+							reconnect = true
 							goto connect
 						}
 					}
 				} else {
 					for _, l := range logOut {
-						fmt.Printf("%s", l)
+						fmt.Printf("%s", l.Text())
 					}
 				}
 			}
@@ -799,12 +809,12 @@ connect:
 }
 
 func (e *EventHandler) updateCLockClass(cfgName string, clkClass fbprotocol.ClockClass, clockType ClockType, clkAccuracy fbprotocol.ClockAccuracy,
-	gmGetterFn func(string) (protocol.GrandmasterSettings, error),
-	gmSetterFn func(string, protocol.GrandmasterSettings) error) (err error, clockClass fbprotocol.ClockClass, clockAccuracy fbprotocol.ClockAccuracy) {
+	clkVariance uint16, profile protocol.TelecomProfile, gmGetterFn func(string) (protocol.GrandmasterSettings, error),
+	gmSetterFn func(string, protocol.GrandmasterSettings) error) (err error, clockQuality fbprotocol.ClockQuality) {
 	g, err := gmGetterFn(cfgName)
 	if err != nil {
 		glog.Errorf("failed to get current GRANDMASTER_SETTINGS_NP: %s", err)
-		return err, clockClass, clockAccuracy
+		return err, clockQuality
 	}
 	switch clockType {
 	case GM:
@@ -814,18 +824,22 @@ func (e *EventHandler) updateCLockClass(cfgName string, clkClass fbprotocol.Cloc
 		g.TimePropertiesDS.CurrentUtcOffset = int32(leap.GetUtcOffset())
 		switch clkClass {
 		case fbprotocol.ClockClass6: // T-GM connected to a PRTC in locked mode (e.g., PRTC traceable to GNSS)
-			// update only when ClockClass is changed or clockAccuracy changes
-			if g.ClockQuality.ClockClass != fbprotocol.ClockClass6 {
+			if clkVariance == 0 { // not measured
+				clkAccuracy, clkVariance = profile.LockedClockAccuracy(), profile.LockedOffsetScaledLogVariance()
+			}
+			// update only when ClockClass is changed or clockAccuracy or offsetScaledLogVariance changes
+			if g.ClockQuality.ClockClass != fbprotocol.ClockClass6 || g.ClockQuality.ClockAccuracy != clkAccuracy ||
+				g.ClockQuality.OffsetScaledLogVariance != clkVariance {
 				g.ClockQuality.ClockClass = fbprotocol.ClockClass6
 				g.TimePropertiesDS.TimeTraceable = true
-				g.ClockQuality.ClockAccuracy = fbprotocol.ClockAccuracyNanosecond100
+				g.ClockQuality.ClockAccuracy = clkAccuracy
 				g.TimePropertiesDS.TimeSource = fbprotocol.TimeSourceGNSS
-				// T-REC-G.8275.1-202211-I section 6.3.5
-				g.ClockQuality.OffsetScaledLogVariance = 0x4e5d
+				// T-REC-G.8275.1-202211-I section 6.3.5, the profile value unless the measured variance is larger
+				g.ClockQuality.OffsetScaledLogVariance = clkVariance
 				err = gmSetterFn(cfgName, g)
 			}
 		case protocol.ClockClassOutOfSpec: // GM out of holdover specification, traceable to Category 3
-			if g.ClockQuality.ClockClass != protocol.ClockClassOutOfSpec {
+			if g.ClockQuality.ClockClass != protocol.ClockClassOutOfSpec || g.ClockQuality.ClockAccuracy != clkAccuracy {
 				g.ClockQuality.ClockClass = protocol.ClockClassOutOfSpec
 				g.TimePropertiesDS.TimeTraceable = false
 				g.ClockQuality.ClockAccuracy = clkAccuracy
@@ -835,7 +849,7 @@ func (e *EventHandler) updateCLockClass(cfgName string, clkClass fbprotocol.Cloc
 				err = gmSetterFn(cfgName, g)
 			}
 		case fbprotocol.ClockClass7: // T-GM in holdover, within holdover specification
-			if g.ClockQuality.ClockClass != fbprotocol.ClockClass7 {
+			if g.ClockQuality.ClockClass != fbprotocol.ClockClass7 || g.ClockQuality.ClockAccuracy != clkAccuracy {
 				g.ClockQuality.ClockClass = fbprotocol.ClockClass7
 				g.TimePropertiesDS.TimeTraceable = true
 				g.ClockQuality.ClockAccuracy = clkAccuracy
@@ -844,6 +858,15 @@ func (e *EventHandler) updateCLockClass(cfgName string, clkClass fbprotocol.Cloc
 				g.ClockQuality.OffsetScaledLogVariance = 0xffff
 				err = gmSetterFn(cfgName, g)
 			}
+		case protocol.ClockClassBCHoldoverInSpec, protocol.ClockClassBCHoldoverOutOfSpec: // APTS T-GM in holdover, T-REC-G.8275.2-202211-I section 6.7
+			if g.ClockQuality.ClockClass != clkClass || g.ClockQuality.ClockAccuracy != clkAccuracy {
+				g.ClockQuality.ClockClass = clkClass
+				g.TimePropertiesDS.TimeTraceable = clkClass == protocol.ClockClassBCHoldoverInSpec
+				g.ClockQuality.ClockAccuracy = clkAccuracy
+				g.TimePropertiesDS.TimeSource = fbprotocol.TimeSourceInternalOscillator
+				g.ClockQuality.OffsetScaledLogVariance = 0xffff
+				err = gmSetterFn(cfgName, g)
+			}
 		case protocol.ClockClassFreerun: // T-GM or T-BC in free-run mode
 			if g.ClockQuality.ClockClass != protocol.ClockClassFreerun {
 				g.ClockQuality.ClockClass = protocol.ClockClassFreerun
@@ -857,9 +880,48 @@ func (e *EventHandler) updateCLockClass(cfgName string, clkClass fbprotocol.Cloc
 		default:
 			glog.Infof("No clock class identified for %d", clkClass)
 		}
+	case BC:
+		g.TimePropertiesDS.PtpTimescale = true
+		g.TimePropertiesDS.FrequencyTraceable = false
+		g.TimePropertiesDS.CurrentUtcOffsetValid = true
+		g.TimePropertiesDS.CurrentUtcOffset = int32(leap.GetUtcOffset())
+		switch clkClass {
+		case protocol.ClockClassBCHoldoverInSpec: // T-BC in holdover, within holdover specification
+			if g.ClockQuality.ClockClass != protocol.ClockClassBCHoldoverInSpec {
+				g.ClockQuality.ClockClass = protocol.ClockClassBCHoldoverInSpec
+				g.TimePropertiesDS.TimeTraceable = true
+				g.ClockQuality.ClockAccuracy = clkAccuracy
+				g.TimePropertiesDS.TimeSource = fbprotocol.TimeSourceInternalOscillator
+				// T-REC-G.8275.1-202211-I section 6.3.5
+				g.ClockQuality.OffsetScaledLogVariance = 0xffff
+				err = gmSetterFn(cfgName, g)
+			}
+		case protocol.ClockClassBCHoldoverOutOfSpec: // T-BC in holdover, out of holdover specification
+			if g.ClockQuality.ClockClass != protocol.ClockClassBCHoldoverOutOfSpec {
+				g.ClockQuality.ClockClass = protocol.ClockClassBCHoldoverOutOfSpec
+				g.TimePropertiesDS.TimeTraceable = false
+				g.ClockQuality.ClockAccuracy = clkAccuracy
+				g.TimePropertiesDS.TimeSource = fbprotocol.TimeSourceInternalOscillator
+				// T-REC-G.8275.1-202211-I section 6.3.5
+				g.ClockQuality.OffsetScaledLogVariance = 0xffff
+				err = gmSetterFn(cfgName, g)
+			}
+		case protocol.ClockClassFreerun: // T-BC in free-run mode, also the default settings while a slave port is locked
+			if g.ClockQuality.ClockClass != protocol.ClockClassFreerun {
+				g.ClockQuality.ClockClass = protocol.ClockClassFreerun
+				g.TimePropertiesDS.TimeTraceable = false
+				g.ClockQuality.ClockAccuracy = fbprotocol.ClockAccuracyUnknown
+				g.TimePropertiesDS.TimeSource = fbprotocol.TimeSourceInternalOscillator
+				// T-REC-G.8275.1-202211-I section 6.3.5
+				g.ClockQuality.OffsetScaledLogVariance = 0xffff
+				err = gmSetterFn(cfgName, g)
+			}
+		default:
+			glog.Infof("No clock class identified for %d", clkClass)
+		}
 	default:
 	}
-	return err, g.ClockQuality.ClockClass, g.ClockQuality.ClockAccuracy
+	return err, g.ClockQuality
 }
 
 // GetPTPState ...
@@ -989,6 +1051,95 @@ func (e *EventHandler) unregisterMetrics(configName string, processName string)
 	}
 }
 
+// clockQuality ... measured clock quality of the config
+func (e *EventHandler) clockQuality(cfgName string) *clockQuality {
+	q, ok := e.qualities[cfgName]
+	if !ok {
+		q = newClockQuality()
+		e.qualities[cfgName] = q
+	}
+	return q
+}
+
+// eventTime ... time the event was sent, now for an event without time
+func eventTime(event EventChannel) time.Time {
+	if event.Time == 0 {
+		return time.Now()
+	}
+	return time.UnixMilli(event.Time)
+}
+
+// clockState ... clock state of the config, created with an uninitialized clock class
+func (e *EventHandler) clockState(cfgName string) *configClockState {
+	clk, ok := e.clocks[cfgName]
+	if !ok {
+		clk = &configClockState{clockClass: protocol.ClockClassUninitialized, clockAccuracy: fbprotocol.ClockAccuracyUnknown}
+		e.clocks[cfgName] = clk
+		e.setClockClassMetric(cfgName, protocol.ClockClassFreerun)
+	}
+	return clk
+}
+
+// SetTelecomProfile ... set the telecom profile deciding the clock class and accuracy announced by the ptp4l config
+func (e *EventHandler) SetTelecomProfile(cfgName string, profile protocol.TelecomProfile) {
+	e.Lock()
+	defer e.Unlock()
+	glog.Infof("[%s] telecom profile %s", cfgName, profile)
+	e.telecomProfiles[ptp4lConfigName(cfgName)] = profile
+}
+
+// SetBCConfig ... set the T-BC config fed by the DPLLs reporting on cfgName, the config announcing the clock class
+// of the T-BC; an empty bcCfgName removes it
+func (e *EventHandler) SetBCConfig(cfgName, bcCfgName string) {
+	e.Lock()
+	defer e.Unlock()
+	if bcCfgName == "" {
+		delete(e.bcConfigs, cfgName)
+		return
+	}
+	glog.Infof("[%s] DPLLs feed the T-BC of %s", cfgName, bcCfgName)
+	e.bcConfigs[cfgName] = bcCfgName
+}
+
+// telecomProfile ... telecom profile of the config, G.8275.1 with a PRTC-A when not set
+func (e *EventHandler) telecomProfile(cfgName string) protocol.TelecomProfile {
+	if p, ok := e.telecomProfiles[ptp4lConfigName(cfgName)]; ok {
+		return p
+	}
+	return protocol.TelecomProfile{Name: protocol.ProfileG8275_1, PRTC: protocol.PRTCA}
+}
+
+// removeClockState ... forget the clock state and clock class metric of the config
+func (e *EventHandler) removeClockState(cfgName string) {
+	delete(e.clocks, cfgName)
+	if e.clockClassMetric != nil {
+		e.clockClassMetric.Delete(prometheus.Labels{
+			"process": PTP4lProcessName, "node": e.nodeName, "config": ptp4lConfigName(cfgName)})
+	}
+}
+
+// setClockClassMetric ... clock class metric of the ptp4l instance of the config, only kept when events are not enabled
+func (e *EventHandler) setClockClassMetric(cfgName string, clockClass fbprotocol.ClockClass) {
+	if e.stdoutToSocket || e.clockClassMetric == nil {
+		return
+	}
+	e.clockClassMetric.With(prometheus.Labels{
+		"process": PTP4lProcessName, "node": e.nodeName, "config": ptp4lConfigName(cfgName)}).Set(float64(clockClass))
+}
+
+// removeData ... drop the data and metrics of a process of the config
+func (e *EventHandler) removeData(cfgName string, processName EventSource) {
+	// Check if the index is within the slice bounds
+	for indexToRemove, d := range e.data[cfgName] {
+		if d.ProcessName == processName {
+			e.unregisterMetrics(cfgName, string(processName))
+			if indexToRemove < len(e.data[cfgName]) {
+				e.data[cfgName] = append(e.data[cfgName][:indexToRemove], e.data[cfgName][indexToRemove+1:]...)
+			}
+		}
+	}
+}
+
 // GetData returns the queried Data and create one if not exist
 func (e *EventHandler) GetData(cfgName string, processName EventSource) *Data {
 	if e.data[cfgName] == nil {
@@ -1019,21 +1170,44 @@ func (e *EventHandler) addEvent(event EventChannel) *DataDetails {
 	return d.GetDataDetails(event.IFace)
 }
 
+// setConn ... connection to the event socket in use
+func (e *EventHandler) setConn(c net.Conn) {
+	e.connLock.Lock()
+	defer e.connLock.Unlock()
+	e.conn = c
+}
+
+// socketConn ... connection to the event socket in use, nil before the first connection
+func (e *EventHandler) socketConn() net.Conn {
+	e.connLock.Lock()
+	defer e.connLock.Unlock()
+	return e.conn
+}
+
 // UpdateClockClass ... update clock class
 func (e *EventHandler) UpdateClockClass(c net.Conn, clk ClockClassRequest) {
-	classErr, clockClass, clockAccuracy := e.updateCLockClass(clk.cfgName, clk.clockClass, clk.clockType, clk.clockAccuracy,
-		PMCGMGetter, PMCGMSetter)
+	classErr, quality := e.updateCLockClass(clk.cfgName, clk.clockClass, clk.clockType, clk.clockAccuracy,
+		clk.offsetScaledLogVariance, clk.profile, PMCGMGetter, PMCGMSetter)
+	clockClass, clockAccuracy := quality.ClockClass, quality.ClockAccuracy
 	glog.Infof("received %s,%v,%s,%v", clk.cfgName, clk.clockClass, clk.clockType, clk.clockAccuracy)
 	if classErr != nil {
 		glog.Errorf("error updating clock class %s", classErr)
+	} else if clk.reset {
+		glog.Infof("restored default GRANDMASTER_SETTINGS_NP of %s, clock class %d", clk.cfgName, clockClass)
 	} else {
-		glog.Infof("updated clock class for last clock class %d to %d with clock accuracy %d", e.clockClass, clockClass, clockAccuracy)
-		e.clockClass = clockClass
-		e.clockAccuracy = clockAccuracy
-		clockClassOut := fmt.Sprintf("%s[%d]:[%s] CLOCK_CLASS_CHANGE %d\n", PTP4l, time.Now().Unix(), clk.cfgName, clockClass)
+		e.Lock()
+		state := e.clockState(clk.cfgName)
+		glog.Infof("[%s] updated clock class for last clock class %d to %d with clock accuracy %d", clk.cfgName, state.clockClass, clockClass, clockAccuracy)
+		state.clockClass = clockClass
+		state.clockAccuracy = clockAccuracy
+		state.variance = quality.OffsetScaledLogVariance
+		e.Unlock()
+		clockClassOut := NewClockClassRecord(string(PTP4l), clk.cfgName, int64(clockClass))
+		EventHistory.Add(clockClassOut)
 		if e.stdoutToSocket {
+			e.rememberRecord(clockClassOut)
 			if c != nil {
-				_, err := c.Write([]byte(clockClassOut))
+				_, err := c.Write(clockClassOut.Bytes())
 				if err != nil {
 					glog.Errorf("failed to write class change event %s", err.Error())
 				}
@@ -1041,10 +1215,9 @@ func (e *EventHandler) UpdateClockClass(c net.Conn, clk ClockClassRequest) {
 				glog.Errorf("failed to write class change event, connection is nil")
 			}
 		} else {
-			e.clockClassMetric.With(prometheus.Labels{
-				"process": PTP4lProcessName, "node": e.nodeName}).Set(float64(clockClass))
+			e.setClockClassMetric(clk.cfgName, clockClass)
 		}
-		fmt.Printf("%s", clockClassOut)
+		fmt.Printf("%s", clockClassOut.Text())
 	}
 }
 
@@ -12,7 +12,6 @@ import (
 	fbprotocol "github.com/facebook/time/ptp/protocol"
 	"github.com/golang/glog"
 	"github.com/openshift/linuxptp-daemon/pkg/event"
-	"github.com/openshift/linuxptp-daemon/pkg/leap"
 	"github.com/openshift/linuxptp-daemon/pkg/protocol"
 	"github.com/stretchr/testify/assert"
 )
@@ -281,6 +280,54 @@ func TestEventHandler_ProcessEvents(t *testing.T) {
 			wantProcessState: "ts2phc[0]:[ts2phc.0.config] ens2f0 offset 5000 pps_status 0 s0",
 			desc:             "2nd card ts2phc offset spiked when in holdover",
 		},
+		{
+			processName:      event.GNSS,
+			cfgName:          "ts2phc.0.config",
+			clockState:       event.PTP_LOCKED,
+			outOfSpec:        false,
+			iface:            "ens1f0",
+			values:           map[event.ValueType]interface{}{event.OFFSET: 0, event.GPS_STATUS: 3},
+			wantGMState:      "GM[0]:[ts2phc.0.config] ens1f0 T-GM-STATUS s1",
+			wantClockState:   "ptp4l[0]:[ts2phc.0.config] CLOCK_CLASS_CHANGE 7",
+			wantProcessState: "gnss[0]:[ts2phc.0.config] ens1f0 gnss_status 3 offset 0 s2",
+			desc:             "GPS is locked again, dpll 1 and 2 are still in holdover",
+		},
+		{
+			processName:      event.DPLL,
+			cfgName:          "ts2phc.0.config",
+			clockState:       event.PTP_LOCKED,
+			outOfSpec:        false,
+			iface:            "ens1f0",
+			values:           map[event.ValueType]interface{}{event.OFFSET: 0, event.PHASE_STATUS: 3, event.FREQUENCY_STATUS: 3, event.PPS_STATUS: 1},
+			wantGMState:      "GM[0]:[ts2phc.0.config] ens1f0 T-GM-STATUS s1",
+			wantClockState:   "ptp4l[0]:[ts2phc.0.config] CLOCK_CLASS_CHANGE 7",
+			wantProcessState: "dpll[0]:[ts2phc.0.config] ens1f0 frequency_status 3 offset 0 phase_status 3 pps_status 1 s2",
+			desc:             "dpll 1 is locked, dpll 2 still holds over its lost 1PPS input",
+		},
+		{
+			processName:      event.DPLL,
+			cfgName:          "ts2phc.0.config",
+			clockState:       event.PTP_LOCKED,
+			outOfSpec:        false,
+			iface:            "ens2f0",
+			values:           map[event.ValueType]interface{}{event.OFFSET: 0, event.PHASE_STATUS: 3, event.FREQUENCY_STATUS: 3, event.PPS_STATUS: 1},
+			wantGMState:      "GM[0]:[ts2phc.0.config] ens1f0 T-GM-STATUS s0",
+			wantClockState:   "ptp4l[0]:[ts2phc.0.config] CLOCK_CLASS_CHANGE 248",
+			wantProcessState: "dpll[0]:[ts2phc.0.config] ens2f0 frequency_status 3 offset 0 phase_status 3 pps_status 1 s2",
+			desc:             "dpll 2 has its 1PPS input again, the 2nd card ts2phc is not locked yet",
+		},
+		{
+			processName:      event.TS2PHCProcessName,
+			cfgName:          "ts2phc.0.config",
+			clockState:       event.PTP_LOCKED,
+			outOfSpec:        false,
+			iface:            "ens2f0",
+			values:           map[event.ValueType]interface{}{event.OFFSET: 0, event.PPS_STATUS: 1},
+			wantGMState:      "GM[0]:[ts2phc.0.config] ens1f0 T-GM-STATUS s2",
+			wantClockState:   "ptp4l[0]:[ts2phc.0.config] CLOCK_CLASS_CHANGE 6",
+			wantProcessState: "ts2phc[0]:[ts2phc.0.config] ens2f0 offset 0 pps_status 1 s2",
+			desc:             "2nd card restored after its 1PPS input was lost",
+		},
 	}
 
 	logOut := make(chan string, 100)
@@ -290,8 +337,7 @@ func TestEventHandler_ProcessEvents(t *testing.T) {
 	eventManager := event.Init("node", true, "/tmp/go.sock", eChannel, closeChn, nil, nil, nil)
 	eventManager.MockEnable()
 	go eventManager.ProcessEvents()
-	assert.NoError(t, leap.MockLeapFile())
-	defer close(leap.LeapMgr.Close)
+	mockLeap(t)
 	time.Sleep(1 * time.Second)
 	for _, test := range tests {
 		select {
@@ -0,0 +1,311 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// EventFormat ... format of the events written to the event socket
+type EventFormat string
+
+const (
+	// TextFormat ... text lines, e.g. ts2phc[1700000000]:[ts2phc.0.config] ens1f0 offset 3 s2
+	TextFormat EventFormat = "text"
+	// JSONFormat ... one JSON encoded Record per line
+	JSONFormat EventFormat = "json"
+	// CloudEventsFormat ... one CloudEvents 1.0 structured mode envelope per line, the Record is the data
+	CloudEventsFormat EventFormat = "cloudevents"
+
+	// CloudEventsTypePrefix ... prefix of the CloudEvents type attribute, the record kind is appended
+	CloudEventsTypePrefix = "com.openshift.linuxptp."
+)
+
+// RecordKind ... kind of event record
+type RecordKind string
+
+const (
+	// StateRecord ... process state and values of an interface
+	StateRecord RecordKind = "state"
+	// GMStateRecord ... grandmaster state of a config
+	GMStateRecord RecordKind = "gm_state"
+	// BCStateRecord ... T-BC state of a config
+	BCStateRecord RecordKind = "bc_state"
+	// ProcessStatusRecord ... process started or stopped
+	ProcessStatusRecord RecordKind = "process_status"
+	// ClockClassRecord ... clock class change
+	ClockClassRecord RecordKind = "clock_class_change"
+	// HAProfileRecord ... phc2sys high availability profile state
+	HAProfileRecord RecordKind = "ha_profile"
+	// UnicastGrantRecord ... unicast negotiation grant or denial received by a port
+	UnicastGrantRecord RecordKind = "unicast_grant"
+	// LogRecord ... process output forwarded as is
+	LogRecord RecordKind = "log"
+)
+
+const (
+	// CLOCK_CLASS ... clock class value of a clock class change record
+	CLOCK_CLASS ValueType = "clock_class"
+	// HA_PROFILE ... profile name of an HA profile record
+	HA_PROFILE ValueType = "ha_profile"
+	// UNICAST_MESSAGE ... message type of a unicast grant record
+	UNICAST_MESSAGE ValueType = "message"
+	// UNICAST_RESULT ... granted or denied
+	UNICAST_RESULT ValueType = "result"
+	// UNICAST_DURATION ... duration of a unicast grant in seconds, 0 when denied
+	UNICAST_DURATION ValueType = "duration"
+)
+
+var (
+	outputFormat = TextFormat
+	outputNode   string
+	recordSeq    uint64
+)
+
+// SetOutputFormat ... set the format of the events written to the event socket
+func SetOutputFormat(format EventFormat, nodeName string) error {
+	switch format {
+	case TextFormat, JSONFormat, CloudEventsFormat:
+	default:
+		return fmt.Errorf("unsupported event format %q, expected one of %s, %s, %s", format, TextFormat, JSONFormat, CloudEventsFormat)
+	}
+	outputFormat = format
+	outputNode = nodeName
+	return nil
+}
+
+// GetOutputFormat ... get the format of the events written to the event socket
+func GetOutputFormat() EventFormat {
+	return outputFormat
+}
+
+// Record ... structured event; every line written to the event socket is rendered from a Record
+type Record struct {
+	Kind       RecordKind                `json:"kind"`
+	Node       string                    `json:"node,omitempty"`
+	Process    string                    `json:"process"`
+	ConfigName string                    `json:"configName,omitempty"`
+	Interface  string                    `json:"interface,omitempty"`
+	State      PTPState                  `json:"state,omitempty"`
+	Values     map[ValueType]interface{} `json:"values,omitempty"`
+	ClockType  ClockType                 `json:"clockType,omitempty"`
+	ClockClass *uint8                    `json:"clockClass,omitempty"`
+	SourceLost bool                      `json:"sourceLost"`
+	OutOfSpec  bool                      `json:"outOfSpec"`
+	Message    string                    `json:"message,omitempty"`
+	Time       time.Time                 `json:"time"`
+}
+
+// cloudEvent ... CloudEvents 1.0 structured mode envelope
+type cloudEvent struct {
+	SpecVersion     string `json:"specversion"`
+	ID              string `json:"id"`
+	Source          string `json:"source"`
+	Type            string `json:"type"`
+	Subject         string `json:"subject,omitempty"`
+	Time            string `json:"time"`
+	DataContentType string `json:"datacontenttype"`
+	Data            Record `json:"data"`
+}
+
+// Record ... structured state record of the event
+func (e *EventChannel) Record() Record {
+	values := make(map[ValueType]interface{}, len(e.Values))
+	for k, v := range e.Values {
+		values[k] = v
+	}
+	return Record{
+		Kind:       StateRecord,
+		Process:    string(e.ProcessName),
+		ConfigName: e.CfgName,
+		Interface:  e.IFace,
+		State:      e.State,
+		Values:     values,
+		ClockType:  e.ClockType,
+		SourceLost: e.SourceLost,
+		OutOfSpec:  e.OutOfSpec,
+		Time:       time.Now(),
+	}
+}
+
+// NewGMStateRecord ... grandmaster state record of a config
+func NewGMStateRecord(cfgName, iface string, state PTPState, clockClass uint8, sourceLost bool, t time.Time) Record {
+	return Record{
+		Kind:       GMStateRecord,
+		Process:    string(GM),
+		ConfigName: cfgName,
+		Interface:  iface,
+		State:      state,
+		ClockType:  GM,
+		ClockClass: &clockClass,
+		SourceLost: sourceLost,
+		Time:       t,
+	}
+}
+
+// NewBCStateRecord ... T-BC state record of a config, iface is the slave port
+func NewBCStateRecord(cfgName, iface string, state PTPState, clockClass uint8, sourceLost bool, t time.Time) Record {
+	return Record{
+		Kind:       BCStateRecord,
+		Process:    string(BC),
+		ConfigName: cfgName,
+		Interface:  iface,
+		State:      state,
+		ClockType:  BC,
+		ClockClass: &clockClass,
+		SourceLost: sourceLost,
+		Time:       t,
+	}
+}
+
+// NewProcessStatusRecord ... process status record, status is 1 when the process is up
+func NewProcessStatusRecord(process, cfgName string, status int64) Record {
+	return Record{
+		Kind:       ProcessStatusRecord,
+		Process:    process,
+		ConfigName: cfgName,
+		Values:     map[ValueType]interface{}{PROCESS_STATUS: status},
+		Time:       time.Now(),
+	}
+}
+
+// NewClockClassRecord ... clock class change record, the value keeps its type in the text format
+func NewClockClassRecord(process, cfgName string, clockClass interface{}) Record {
+	r := Record{
+		Kind:       ClockClassRecord,
+		Process:    process,
+		ConfigName: cfgName,
+		Values:     map[ValueType]interface{}{CLOCK_CLASS: clockClass},
+		Time:       time.Now(),
+	}
+	var class uint8
+	switch v := clockClass.(type) {
+	case uint8:
+		class = v
+	case int64:
+		class = uint8(v)
+	case float64:
+		class = uint8(v)
+	}
+	r.ClockClass = &class
+	return r
+}
+
+// NewHAProfileRecord ... HA profile state record, state is 1 for the active profile
+func NewHAProfileRecord(process, cfgName, profile string, state int64) Record {
+	return Record{
+		Kind:       HAProfileRecord,
+		Process:    process,
+		ConfigName: cfgName,
+		Values:     map[ValueType]interface{}{HA_PROFILE: profile, STATE: state},
+		Time:       time.Now(),
+	}
+}
+
+// NewUnicastGrantRecord ... unicast grant record of a port, duration is 0 for a denial
+func NewUnicastGrantRecord(cfgName, iface, message, result string, duration int64) Record {
+	return Record{
+		Kind:       UnicastGrantRecord,
+		Process:    string(PTP4l),
+		ConfigName: cfgName,
+		Interface:  iface,
+		Values:     map[ValueType]interface{}{UNICAST_MESSAGE: message, UNICAST_RESULT: result, UNICAST_DURATION: duration},
+		Time:       time.Now(),
+	}
+}
+
+// NewLogRecord ... record forwarding a process output line
+func NewLogRecord(process, cfgName, message string) Record {
+	return Record{
+		Kind:       LogRecord,
+		Process:    process,
+		ConfigName: cfgName,
+		Message:    strings.TrimSuffix(message, "\n"),
+		Time:       time.Now(),
+	}
+}
+
+// Text ... text line of the record
+func (r Record) Text() string {
+	ts := r.Time.Unix()
+	switch r.Kind {
+	case GMStateRecord:
+		return fmt.Sprintf("%s[%d]:[%s] %s T-GM-STATUS %s\n", r.Process, ts, r.ConfigName, r.Interface, r.State)
+	case BCStateRecord:
+		return fmt.Sprintf("%s[%d]:[%s] %s T-BC-STATUS %s\n", r.Process, ts, r.ConfigName, r.Interface, r.State)
+	case ProcessStatusRecord:
+		return fmt.Sprintf("%s[%d]:[%s] PTP_PROCESS_STATUS:%d\n", r.Process, ts, r.ConfigName, r.Values[PROCESS_STATUS])
+	case ClockClassRecord:
+		class, _ := formatValue(r.Values[CLOCK_CLASS])
+		return fmt.Sprintf("%s[%d]:[%s] CLOCK_CLASS_CHANGE %s\n", r.Process, ts, r.ConfigName, class)
+	case HAProfileRecord:
+		return fmt.Sprintf("%s[%d]:[%s] ptp_ha_profile %s state %d\n", r.Process, ts, r.ConfigName, r.Values[HA_PROFILE], r.Values[STATE])
+	case UnicastGrantRecord:
+		return fmt.Sprintf("%s[%d]:[%s] %s UNICAST_GRANT %s %s %d\n", r.Process, ts, r.ConfigName, r.Interface,
+			r.Values[UNICAST_MESSAGE], r.Values[UNICAST_RESULT], r.Values[UNICAST_DURATION])
+	case LogRecord:
+		return r.Message + "\n"
+	}
+	logData := make([]string, 0, len(r.Values))
+	for k, v := range r.Values {
+		if s, ok := formatValue(v); ok {
+			logData = append(logData, fmt.Sprintf("%s %s", k, s))
+		}
+	}
+	sort.Strings(logData)
+	return fmt.Sprintf("%s[%d]:[%s] %s %s %s\n", r.Process, ts, r.ConfigName, r.Interface, strings.Join(logData, " "), r.State)
+}
+
+// Render ... render the record in the given format, always newline terminated
+func (r Record) Render(format EventFormat) []byte {
+	if format == TextFormat || format == "" {
+		return []byte(r.Text())
+	}
+	if r.Node == "" {
+		r.Node = outputNode
+	}
+	var v interface{} = r
+	if format == CloudEventsFormat {
+		v = cloudEvent{
+			SpecVersion:     "1.0",
+			ID:              fmt.Sprintf("%s-%d-%d", r.Node, r.Time.UnixNano(), atomic.AddUint64(&recordSeq, 1)),
+			Source:          fmt.Sprintf("/cluster/node/%s/%s", r.Node, r.Process),
+			Type:            CloudEventsTypePrefix + string(r.Kind),
+			Subject:         strings.Trim(r.ConfigName+"/"+r.Interface, "/"),
+			Time:            r.Time.UTC().Format(time.RFC3339Nano),
+			DataContentType: "application/json",
+			Data:            r,
+		}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		glog.Errorf("failed to encode %s event record, falling back to text: %s", r.Kind, err)
+		return []byte(r.Text())
+	}
+	return append(b, '\n')
+}
+
+// Bytes ... render the record in the configured output format
+func (r Record) Bytes() []byte {
+	return r.Render(outputFormat)
+}
+
+// formatValue ... text representation of a value, false for types not written to the log
+func formatValue(v interface{}) (string, bool) {
+	switch val := v.(type) {
+	case int64, int, int32:
+		return fmt.Sprintf("%d", val), true
+	case float64:
+		return fmt.Sprintf("%f", val), true
+	case string:
+		return val, true
+	case byte:
+		return fmt.Sprintf("%#x", val), true
+	}
+	return "", false
+}
@@ -0,0 +1,64 @@
+package event_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/openshift/linuxptp-daemon/pkg/event"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecord_Render(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	e := event.EventChannel{
+		ProcessName: event.TS2PHC,
+		State:       event.PTP_LOCKED,
+		IFace:       "ens1f0",
+		CfgName:     "ts2phc.0.config",
+		Values:      map[event.ValueType]interface{}{event.OFFSET: int64(3), event.NMEA_STATUS: 1, event.QL: byte(2)},
+		ClockType:   event.GM,
+		OutOfSpec:   true,
+	}
+	state := e.Record()
+	state.Time = ts
+	classRecord := event.NewClockClassRecord("ptp4l", "ptp4l.0.config", float64(135))
+	classRecord.Time = ts
+	tests := []struct {
+		record event.Record
+		text   string
+	}{
+		{state, "ts2phc[1700000000]:[ts2phc.0.config] ens1f0 nmea_status 1 offset 3 ql 0x2 s2\n"},
+		{event.NewGMStateRecord("ts2phc.0.config", "ens1f0", event.PTP_HOLDOVER, 7, true, ts),
+			"GM[1700000000]:[ts2phc.0.config] ens1f0 T-GM-STATUS s1\n"},
+		{classRecord, "ptp4l[1700000000]:[ptp4l.0.config] CLOCK_CLASS_CHANGE 135.000000\n"},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.text, string(tc.record.Render(event.TextFormat)))
+
+		var r event.Record
+		assert.NoError(t, json.Unmarshal(tc.record.Render(event.JSONFormat), &r))
+		assert.Equal(t, tc.record.Kind, r.Kind)
+		assert.Equal(t, tc.record.Process, r.Process)
+		assert.Equal(t, tc.record.ConfigName, r.ConfigName)
+		assert.Equal(t, tc.record.State, r.State)
+		assert.Equal(t, tc.record.ClockClass, r.ClockClass)
+		assert.True(t, tc.record.Time.Equal(r.Time))
+
+		var ce struct {
+			SpecVersion string       `json:"specversion"`
+			Type        string       `json:"type"`
+			Data        event.Record `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(tc.record.Render(event.CloudEventsFormat), &ce))
+		assert.Equal(t, "1.0", ce.SpecVersion)
+		assert.Equal(t, event.CloudEventsTypePrefix+string(tc.record.Kind), ce.Type)
+		assert.Equal(t, r, ce.Data)
+	}
+
+	var r event.Record
+	assert.NoError(t, json.Unmarshal(state.Render(event.JSONFormat), &r))
+	assert.Equal(t, float64(3), r.Values[event.OFFSET])
+	assert.True(t, r.OutOfSpec)
+	assert.Error(t, event.SetOutputFormat("xml", "node"))
+}
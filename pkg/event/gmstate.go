@@ -0,0 +1,203 @@
+package event
+
+import (
+	"fmt"
+	"strings"
+
+	fbprotocol "github.com/facebook/time/ptp/protocol"
+	"github.com/openshift/linuxptp-daemon/pkg/protocol"
+)
+
+// Cond ... condition on a boolean input of a state table row
+type Cond int
+
+const (
+	// Any ... the input is not considered
+	Any Cond = iota
+	// Yes ... the input must be true
+	Yes
+	// No ... the input must be false
+	No
+)
+
+// Match ... true when the value satisfies the condition
+func (c Cond) Match(v bool) bool {
+	return c == Any || (c == Yes) == v
+}
+
+func (c Cond) String() string {
+	switch c {
+	case Yes:
+		return "yes"
+	case No:
+		return "no"
+	}
+	return "*"
+}
+
+// GMInputs ... inputs of the GM state machine
+type GMInputs struct {
+	Dpll               PTPState
+	Gnss               PTPState
+	Ts2phc             PTPState
+	SourceLost         bool
+	OutOfSpec          bool
+	FrequencyTraceable bool
+}
+
+func (in GMInputs) String() string {
+	return fmt.Sprintf("dpll %s gnss %s ts2phc %s sourceLost %v outOfSpec %v frequencyTraceable %v",
+		in.Dpll, in.Gnss, in.Ts2phc, in.SourceLost, in.OutOfSpec, in.FrequencyTraceable)
+}
+
+// GMStateRow ... row of the GM state table. A nil state list matches any state. Zero State, ClockClass
+// or ClockAccuracy leave the current value unchanged, a row with none of them set keeps the GM state.
+type GMStateRow struct {
+	ID                 string
+	Dpll               []PTPState
+	Gnss               []PTPState
+	Ts2phc             []PTPState
+	SourceLost         Cond
+	OutOfSpec          Cond
+	FrequencyTraceable Cond
+	State              PTPState
+	ClockClass         fbprotocol.ClockClass
+	ClockAccuracy      fbprotocol.ClockAccuracy
+}
+
+// Match ... true when the row applies to the inputs
+func (r GMStateRow) Match(in GMInputs) bool {
+	return stateIn(in.Dpll, r.Dpll) && stateIn(in.Gnss, r.Gnss) && stateIn(in.Ts2phc, r.Ts2phc) &&
+		r.SourceLost.Match(in.SourceLost) && r.OutOfSpec.Match(in.OutOfSpec) && r.FrequencyTraceable.Match(in.FrequencyTraceable)
+}
+
+func (r GMStateRow) String() string {
+	return fmt.Sprintf("%s: dpll %s gnss %s ts2phc %s sourceLost %s outOfSpec %s frequencyTraceable %s -> state %s class %d accuracy %#x",
+		r.ID, statesString(r.Dpll), statesString(r.Gnss), statesString(r.Ts2phc), r.SourceLost, r.OutOfSpec, r.FrequencyTraceable,
+		r.State, r.ClockClass, r.ClockAccuracy)
+}
+
+func stateIn(s PTPState, states []PTPState) bool {
+	if states == nil {
+		return true
+	}
+	for _, st := range states {
+		if st == s {
+			return true
+		}
+	}
+	return false
+}
+
+func statesString(states []PTPState) string {
+	if states == nil {
+		return "*"
+	}
+	s := make([]string, 0, len(states))
+	for _, st := range states {
+		s = append(s, string(st))
+	}
+	return strings.Join(s, "|")
+}
+
+// GMStates ... every state an input of the GM state machine can be in
+var GMStates = []PTPState{PTP_NOTSET, PTP_UNKNOWN, PTP_FREERUN, PTP_HOLDOVER, PTP_LOCKED}
+
+func states(s ...PTPState) []PTPState { return s }
+
+// GMStateTable ... GM state and clock class of the T-GM, documented above updateGMState.
+// Rows are evaluated in order, the first matching row decides; every combination of inputs matches a row.
+// DPLL holdover has the highest priority, a missing DPLL (NOTSET) is handled like a locked one.
+var GMStateTable = []GMStateRow{
+	// DPLL FREERUN is the overall state; from holdover it goes out of spec (140) when the frequency is traceable
+	{ID: "dpll-freerun-out-of-spec", Dpll: states(PTP_FREERUN), OutOfSpec: Yes, FrequencyTraceable: Yes,
+		State: PTP_FREERUN, ClockClass: protocol.ClockClassOutOfSpec, ClockAccuracy: fbprotocol.ClockAccuracyUnknown},
+	{ID: "dpll-freerun", Dpll: states(PTP_FREERUN),
+		State: PTP_FREERUN, ClockClass: protocol.ClockClassFreerun, ClockAccuracy: fbprotocol.ClockAccuracyUnknown},
+	// T-GM in frequency traceable holdover (SyncE traceable to a PRC), out of holdover specification
+	{ID: "dpll-holdover-out-of-spec", Dpll: states(PTP_HOLDOVER), OutOfSpec: Yes, FrequencyTraceable: Yes,
+		State: PTP_HOLDOVER, ClockClass: protocol.ClockClassOutOfSpec, ClockAccuracy: fbprotocol.ClockAccuracyUnknown},
+	// T-GM in holdover, within holdover specification
+	{ID: "dpll-holdover", Dpll: states(PTP_HOLDOVER),
+		State: PTP_HOLDOVER, ClockClass: fbprotocol.ClockClass7},
+
+	// DPLL locked or not available
+	{ID: "dpll-locked-gnss-locked-ts2phc-freerun", Dpll: states(PTP_LOCKED, PTP_NOTSET), Gnss: states(PTP_LOCKED), Ts2phc: states(PTP_FREERUN),
+		State: PTP_FREERUN, ClockClass: protocol.ClockClassFreerun, ClockAccuracy: fbprotocol.ClockAccuracyUnknown},
+	// T-GM connected to a PRTC in locked mode (e.g., PRTC traceable to GNSS)
+	{ID: "dpll-locked-gnss-locked-ts2phc-locked", Dpll: states(PTP_LOCKED, PTP_NOTSET), Gnss: states(PTP_LOCKED), Ts2phc: states(PTP_LOCKED),
+		State: PTP_LOCKED, ClockClass: fbprotocol.ClockClass6, ClockAccuracy: fbprotocol.ClockAccuracyNanosecond100},
+	{ID: "dpll-locked-gnss-locked-ts2phc-holdover", Dpll: states(PTP_LOCKED, PTP_NOTSET), Gnss: states(PTP_LOCKED), Ts2phc: states(PTP_HOLDOVER),
+		State: PTP_HOLDOVER, ClockClass: fbprotocol.ClockClass7},
+	{ID: "dpll-locked-gnss-locked-ts2phc-unknown", Dpll: states(PTP_LOCKED, PTP_NOTSET), Gnss: states(PTP_LOCKED)},
+	// GNSS source lost: stay with the last GM state and wait for the DPLL to move to HOLDOVER
+	{ID: "dpll-locked-gnss-lost-ts2phc-holdover", Dpll: states(PTP_LOCKED, PTP_NOTSET), Gnss: states(PTP_FREERUN), SourceLost: Yes, Ts2phc: states(PTP_HOLDOVER),
+		State: PTP_HOLDOVER, ClockClass: fbprotocol.ClockClass7},
+	{ID: "dpll-locked-gnss-lost-wait-holdover", Dpll: states(PTP_LOCKED, PTP_NOTSET), Gnss: states(PTP_FREERUN), SourceLost: Yes},
+	// GNSS FREERUN on offset
+	{ID: "dpll-locked-gnss-freerun", Dpll: states(PTP_LOCKED, PTP_NOTSET), Gnss: states(PTP_FREERUN), Ts2phc: states(PTP_FREERUN, PTP_LOCKED, PTP_UNKNOWN, PTP_NOTSET),
+		State: PTP_FREERUN, ClockClass: protocol.ClockClassFreerun, ClockAccuracy: fbprotocol.ClockAccuracyUnknown},
+	{ID: "dpll-locked-gnss-freerun-ts2phc-holdover", Dpll: states(PTP_LOCKED, PTP_NOTSET), Gnss: states(PTP_FREERUN)},
+	{ID: "dpll-locked-gnss-unknown", Dpll: states(PTP_LOCKED, PTP_NOTSET)},
+
+	// DPLL in an unknown state
+	{ID: "dpll-unknown-gnss-locked-ts2phc-freerun", Gnss: states(PTP_LOCKED), Ts2phc: states(PTP_FREERUN, PTP_UNKNOWN, PTP_NOTSET),
+		State: PTP_FREERUN, ClockClass: protocol.ClockClassFreerun, ClockAccuracy: fbprotocol.ClockAccuracyUnknown},
+	{ID: "dpll-unknown-gnss-locked-ts2phc-locked", Gnss: states(PTP_LOCKED), Ts2phc: states(PTP_LOCKED),
+		State: PTP_LOCKED, ClockClass: fbprotocol.ClockClass6, ClockAccuracy: fbprotocol.ClockAccuracyNanosecond100},
+	{ID: "dpll-unknown-gnss-locked-ts2phc-holdover", Gnss: states(PTP_LOCKED), Ts2phc: states(PTP_HOLDOVER),
+		State: PTP_HOLDOVER, ClockClass: fbprotocol.ClockClass7},
+	// when GNSS is lost ts2phc stops printing and waits to move to HOLDOVER
+	{ID: "dpll-unknown-gnss-freerun", Gnss: states(PTP_FREERUN), Ts2phc: states(PTP_FREERUN, PTP_LOCKED, PTP_UNKNOWN, PTP_NOTSET),
+		State: PTP_FREERUN, ClockClass: protocol.ClockClassFreerun, ClockAccuracy: fbprotocol.ClockAccuracyUnknown},
+	{ID: "dpll-unknown-gnss-freerun-ts2phc-holdover", Gnss: states(PTP_FREERUN), Ts2phc: states(PTP_HOLDOVER),
+		State: PTP_HOLDOVER, ClockClass: fbprotocol.ClockClass7},
+	// neither DPLL nor GNSS state is known, follow ts2phc
+	{ID: "ts2phc-freerun", Ts2phc: states(PTP_FREERUN),
+		State: PTP_FREERUN, ClockClass: protocol.ClockClassFreerun, ClockAccuracy: fbprotocol.ClockAccuracyUnknown},
+	{ID: "ts2phc-locked", Ts2phc: states(PTP_LOCKED),
+		State: PTP_LOCKED, ClockClass: fbprotocol.ClockClass7, ClockAccuracy: fbprotocol.ClockAccuracyNanosecond100},
+	{ID: "ts2phc-holdover", Ts2phc: states(PTP_HOLDOVER), State: PTP_HOLDOVER},
+	{ID: "ts2phc-unknown", Ts2phc: states(PTP_UNKNOWN), State: PTP_UNKNOWN},
+	{ID: "ts2phc-notset", Ts2phc: states(PTP_NOTSET), State: PTP_NOTSET},
+}
+
+// GMStateFromTable ... first row of the table matching the inputs, false when no row matches
+func GMStateFromTable(table []GMStateRow, in GMInputs) (GMStateRow, bool) {
+	for _, r := range table {
+		if r.Match(in) {
+			return r, true
+		}
+	}
+	return GMStateRow{}, false
+}
+
+// GMTransition ... trace of a GM state change
+type GMTransition struct {
+	ConfigName string
+	From       PTPState
+	To         PTPState
+	FromClass  fbprotocol.ClockClass
+	ToClass    fbprotocol.ClockClass
+	Trigger    EventSource
+	Row        string
+	Inputs     GMInputs
+}
+
+func (t GMTransition) String() string {
+	return fmt.Sprintf("[%s] GM state %s -> %s clock class %d -> %d, trigger %s, row %s, inputs: %s",
+		t.ConfigName, t.From, t.To, t.FromClass, t.ToClass, t.Trigger, t.Row, t.Inputs)
+}
+
+// apply ... set the state, clock class and accuracy of the row
+func (g *grandMasterSyncState) apply(r GMStateRow) {
+	if r.State != "" {
+		g.state = r.State
+	}
+	if r.ClockClass != 0 {
+		g.clockClass = r.ClockClass
+	}
+	if r.ClockAccuracy != 0 {
+		g.clockAccuracy = r.ClockAccuracy
+	}
+}
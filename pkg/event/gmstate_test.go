@@ -0,0 +1,90 @@
+package event_test
+
+import (
+	"fmt"
+	"testing"
+
+	fbprotocol "github.com/facebook/time/ptp/protocol"
+	"github.com/openshift/linuxptp-daemon/pkg/event"
+	"github.com/openshift/linuxptp-daemon/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+// gmStateCases generates every combination of GM state machine inputs, grouped by the table row deciding it
+func gmStateCases(table []event.GMStateRow) (map[string][]event.GMInputs, []event.GMInputs) {
+	cases := map[string][]event.GMInputs{}
+	var unmatched []event.GMInputs
+	bools := []bool{false, true}
+	for _, dpll := range event.GMStates {
+		for _, gnss := range event.GMStates {
+			for _, ts2phc := range event.GMStates {
+				for _, sourceLost := range bools {
+					for _, outOfSpec := range bools {
+						for _, traceable := range bools {
+							in := event.GMInputs{Dpll: dpll, Gnss: gnss, Ts2phc: ts2phc,
+								SourceLost: sourceLost, OutOfSpec: outOfSpec, FrequencyTraceable: traceable}
+							row, ok := event.GMStateFromTable(table, in)
+							if !ok {
+								unmatched = append(unmatched, in)
+								continue
+							}
+							cases[row.ID] = append(cases[row.ID], in)
+						}
+					}
+				}
+			}
+		}
+	}
+	return cases, unmatched
+}
+
+func TestGMStateTable_Rows(t *testing.T) {
+	cases, unmatched := gmStateCases(event.GMStateTable)
+	assert.Empty(t, unmatched, "inputs not covered by the GM state table")
+	ids := map[string]bool{}
+	for _, row := range event.GMStateTable {
+		assert.False(t, ids[row.ID], "duplicate row %s", row.ID)
+		ids[row.ID] = true
+		// every row is reachable, no earlier row shadows it
+		if assert.NotEmpty(t, cases[row.ID], "row is never selected: %s", row) {
+			for _, in := range cases[row.ID] {
+				assert.True(t, row.Match(in), "%s does not match %s", row, in)
+			}
+		}
+	}
+}
+
+// TestGMStateTable_Documented checks the table against the final GM state tables documented above updateGMState
+func TestGMStateTable_Documented(t *testing.T) {
+	keep := event.PTPState("")
+	tests := []struct {
+		in         event.GMInputs
+		state      event.PTPState
+		clockClass fbprotocol.ClockClass
+	}{
+		{event.GMInputs{Dpll: event.PTP_FREERUN, Gnss: event.PTP_LOCKED, Ts2phc: event.PTP_LOCKED}, event.PTP_FREERUN, protocol.ClockClassFreerun},
+		{event.GMInputs{Dpll: event.PTP_HOLDOVER, Gnss: event.PTP_FREERUN, Ts2phc: event.PTP_FREERUN, SourceLost: true}, event.PTP_HOLDOVER, fbprotocol.ClockClass7},
+		{event.GMInputs{Dpll: event.PTP_FREERUN, Gnss: event.PTP_FREERUN, Ts2phc: event.PTP_FREERUN, SourceLost: true, OutOfSpec: true, FrequencyTraceable: true}, event.PTP_FREERUN, protocol.ClockClassOutOfSpec},
+		{event.GMInputs{Dpll: event.PTP_HOLDOVER, Gnss: event.PTP_FREERUN, Ts2phc: event.PTP_HOLDOVER, SourceLost: true, OutOfSpec: true, FrequencyTraceable: true}, event.PTP_HOLDOVER, protocol.ClockClassOutOfSpec},
+		{event.GMInputs{Dpll: event.PTP_FREERUN, Gnss: event.PTP_FREERUN, Ts2phc: event.PTP_FREERUN, SourceLost: true, OutOfSpec: true}, event.PTP_FREERUN, protocol.ClockClassFreerun},
+		{event.GMInputs{Dpll: event.PTP_LOCKED, Gnss: event.PTP_LOCKED, Ts2phc: event.PTP_LOCKED}, event.PTP_LOCKED, fbprotocol.ClockClass6},
+		{event.GMInputs{Dpll: event.PTP_LOCKED, Gnss: event.PTP_LOCKED, Ts2phc: event.PTP_FREERUN}, event.PTP_FREERUN, protocol.ClockClassFreerun},
+		{event.GMInputs{Dpll: event.PTP_LOCKED, Gnss: event.PTP_FREERUN, Ts2phc: event.PTP_LOCKED, SourceLost: true}, keep, 0},
+		{event.GMInputs{Dpll: event.PTP_LOCKED, Gnss: event.PTP_FREERUN, Ts2phc: event.PTP_FREERUN, SourceLost: true}, keep, 0},
+		{event.GMInputs{Dpll: event.PTP_LOCKED, Gnss: event.PTP_FREERUN, Ts2phc: event.PTP_LOCKED}, event.PTP_FREERUN, protocol.ClockClassFreerun},
+		{event.GMInputs{Dpll: event.PTP_LOCKED, Gnss: event.PTP_FREERUN, Ts2phc: event.PTP_FREERUN}, event.PTP_FREERUN, protocol.ClockClassFreerun},
+		// DPLL not available
+		{event.GMInputs{Dpll: event.PTP_NOTSET, Gnss: event.PTP_FREERUN, Ts2phc: event.PTP_LOCKED}, event.PTP_FREERUN, protocol.ClockClassFreerun},
+		{event.GMInputs{Dpll: event.PTP_NOTSET, Gnss: event.PTP_FREERUN, Ts2phc: event.PTP_FREERUN}, event.PTP_FREERUN, protocol.ClockClassFreerun},
+		{event.GMInputs{Dpll: event.PTP_NOTSET, Gnss: event.PTP_LOCKED, Ts2phc: event.PTP_FREERUN}, event.PTP_FREERUN, protocol.ClockClassFreerun},
+		{event.GMInputs{Dpll: event.PTP_NOTSET, Gnss: event.PTP_LOCKED, Ts2phc: event.PTP_LOCKED}, event.PTP_LOCKED, fbprotocol.ClockClass6},
+	}
+	for _, tc := range tests {
+		t.Run(fmt.Sprint(tc.in), func(t *testing.T) {
+			row, ok := event.GMStateFromTable(event.GMStateTable, tc.in)
+			assert.True(t, ok)
+			assert.Equal(t, tc.state, row.State, row.String())
+			assert.Equal(t, tc.clockClass, row.ClockClass, row.String())
+		})
+	}
+}
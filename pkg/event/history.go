@@ -0,0 +1,220 @@
+package event
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// DefaultHistorySize ... number of records kept by the event history
+const DefaultHistorySize = 10000
+
+// EventHistory ... history of the state transitions, clock class changes, HA failovers and process status changes
+var EventHistory = NewHistory(DefaultHistorySize)
+
+// HistoryFilter ... selects history records, zero values match everything
+type HistoryFilter struct {
+	From       time.Time
+	To         time.Time
+	Process    string
+	Interface  string
+	ConfigName string
+}
+
+// Match ... true when the record is selected by the filter
+func (f HistoryFilter) Match(r Record) bool {
+	if !f.From.IsZero() && r.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && r.Time.After(f.To) {
+		return false
+	}
+	if f.Process != "" && f.Process != r.Process {
+		return false
+	}
+	if f.Interface != "" && f.Interface != r.Interface {
+		return false
+	}
+	return f.ConfigName == "" || f.ConfigName == r.ConfigName
+}
+
+// History ... ring buffer of records, optionally mirrored to a file so it survives a daemon restart.
+// State records are only kept when the state of their source changes, every other record is kept as is.
+type History struct {
+	sync.Mutex
+	records []Record
+	next    int
+	full    bool
+	last    map[string]Record
+	path    string
+	file    *os.File
+	lines   int
+}
+
+// NewHistory ... in-memory history keeping the last size records
+func NewHistory(size int) *History {
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	return &History{records: make([]Record, size), last: map[string]Record{}}
+}
+
+// ConfigureHistory ... replace the event history; when path is set, records are appended to that file and the
+// records already in it are loaded
+func ConfigureHistory(size int, path string) error {
+	h := NewHistory(size)
+	if path != "" {
+		if err := h.open(path); err != nil {
+			return err
+		}
+	}
+	old := EventHistory
+	EventHistory = h
+	return old.Close()
+}
+
+func (h *History) open(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create event history directory: %w", err)
+	}
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var r Record
+			if err = json.Unmarshal(scanner.Bytes(), &r); err != nil {
+				glog.Warningf("skipping corrupt event history line in %s: %s", path, err)
+				continue
+			}
+			h.add(r)
+		}
+		f.Close()
+	}
+	h.path = path
+	// rewrite the file with the loaded records only, dropping what fell out of the ring
+	return h.compact()
+}
+
+// Add ... keep the record; log records and repeated states of a source are ignored
+func (h *History) Add(r Record) {
+	if r.Kind == LogRecord {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	if r.Kind == StateRecord || r.Kind == GMStateRecord || r.Kind == BCStateRecord {
+		key := recordKey(r)
+		if last, ok := h.last[key]; ok && last.State == r.State && last.SourceLost == r.SourceLost && last.OutOfSpec == r.OutOfSpec {
+			return
+		}
+		h.last[key] = r
+	}
+	h.add(r)
+	if h.file == nil {
+		return
+	}
+	b, err := json.Marshal(r)
+	if err == nil {
+		_, err = h.file.Write(append(b, '\n'))
+	}
+	if err != nil {
+		glog.Errorf("failed to write event history to %s: %s", h.path, err)
+		return
+	}
+	h.lines++
+	if h.lines >= 2*len(h.records) {
+		if err = h.compact(); err != nil {
+			glog.Errorf("failed to compact event history %s: %s", h.path, err)
+		}
+	}
+}
+
+func (h *History) add(r Record) {
+	h.records[h.next] = r
+	h.next = (h.next + 1) % len(h.records)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Forget ... the next state of a reset process is kept even if it did not change; a ts2phc reset covers the whole config
+func (h *History) Forget(cfgName string, process EventSource) {
+	h.Lock()
+	defer h.Unlock()
+	for k, r := range h.last {
+		if r.ConfigName == cfgName && (process == TS2PHC || r.Process == string(process)) {
+			delete(h.last, k)
+		}
+	}
+}
+
+// Query ... records selected by the filter, oldest first
+func (h *History) Query(f HistoryFilter) []Record {
+	h.Lock()
+	defer h.Unlock()
+	out := []Record{}
+	for _, r := range h.ordered() {
+		if f.Match(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func (h *History) ordered() []Record {
+	if !h.full {
+		return h.records[:h.next]
+	}
+	return append(append([]Record{}, h.records[h.next:]...), h.records[:h.next]...)
+}
+
+// compact ... rewrite the history file with the records in the ring
+func (h *History) compact() error {
+	tmp := h.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	records := h.ordered()
+	for _, r := range records {
+		if err = enc.Encode(r); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
+	if err = os.Rename(tmp, h.path); err != nil {
+		return err
+	}
+	if h.file != nil {
+		h.file.Close()
+	}
+	if h.file, err = os.OpenFile(h.path, os.O_APPEND|os.O_WRONLY, 0644); err != nil {
+		return err
+	}
+	h.lines = len(records)
+	return nil
+}
+
+// Close ... close the history file
+func (h *History) Close() error {
+	h.Lock()
+	defer h.Unlock()
+	if h.file == nil {
+		return nil
+	}
+	err := h.file.Close()
+	h.file = nil
+	return err
+}
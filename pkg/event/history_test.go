@@ -0,0 +1,64 @@
+package event_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openshift/linuxptp-daemon/pkg/event"
+	"github.com/stretchr/testify/assert"
+)
+
+func stateRecord(process event.EventSource, iface string, state event.PTPState, t time.Time) event.Record {
+	e := event.EventChannel{ProcessName: process, CfgName: "ts2phc.0.config", IFace: iface, State: state,
+		Values: map[event.ValueType]interface{}{event.OFFSET: int64(1)}}
+	r := e.Record()
+	r.Time = t
+	return r
+}
+
+func TestHistory(t *testing.T) {
+	base := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	h := event.NewHistory(4)
+	h.Add(stateRecord(event.GNSS, "ens1f0", event.PTP_LOCKED, base))
+	// repeated states are not transitions
+	h.Add(stateRecord(event.GNSS, "ens1f0", event.PTP_LOCKED, base.Add(time.Minute)))
+	h.Add(stateRecord(event.GNSS, "ens1f0", event.PTP_FREERUN, base.Add(10*time.Minute)))
+	h.Add(stateRecord(event.DPLL, "ens1f0", event.PTP_HOLDOVER, base.Add(11*time.Minute)))
+	h.Add(event.NewLogRecord("ptp4l", "ptp4l.0.config", "ptp4l[1]: port 1: SLAVE to UNCALIBRATED"))
+	assert.Len(t, h.Query(event.HistoryFilter{}), 3)
+
+	got := h.Query(event.HistoryFilter{From: base.Add(10 * time.Minute), To: base.Add(15 * time.Minute), Process: string(event.GNSS)})
+	if assert.Len(t, got, 1) {
+		assert.Equal(t, event.PTP_FREERUN, got[0].State)
+	}
+
+	// after a reset the first state is kept again
+	h.Forget("ts2phc.0.config", event.GNSS)
+	h.Add(stateRecord(event.GNSS, "ens1f0", event.PTP_FREERUN, base.Add(12*time.Minute)))
+	h.Add(stateRecord(event.GNSS, "ens1f0", event.PTP_LOCKED, base.Add(13*time.Minute)))
+	got = h.Query(event.HistoryFilter{})
+	// the ring keeps the last 4 records, oldest first
+	if assert.Len(t, got, 4) {
+		assert.Equal(t, base.Add(10*time.Minute), got[0].Time)
+		assert.Equal(t, base.Add(13*time.Minute), got[3].Time)
+	}
+}
+
+func TestConfigureHistory_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history", "events.json")
+	base := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	assert.NoError(t, event.ConfigureHistory(2, path))
+	for i, state := range []event.PTPState{event.PTP_LOCKED, event.PTP_FREERUN, event.PTP_HOLDOVER, event.PTP_LOCKED, event.PTP_FREERUN} {
+		event.EventHistory.Add(stateRecord(event.TS2PHC, "ens1f0", state, base.Add(time.Duration(i)*time.Minute)))
+	}
+	// a restarted daemon loads the records kept on disk
+	assert.NoError(t, event.ConfigureHistory(2, path))
+	got := event.EventHistory.Query(event.HistoryFilter{Interface: "ens1f0"})
+	if assert.Len(t, got, 2) {
+		assert.Equal(t, event.PTP_LOCKED, got[0].State)
+		assert.Equal(t, event.PTP_FREERUN, got[1].State)
+		assert.True(t, base.Add(4*time.Minute).Equal(got[1].Time))
+	}
+	assert.NoError(t, event.ConfigureHistory(event.DefaultHistorySize, ""))
+}
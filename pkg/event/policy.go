@@ -0,0 +1,179 @@
+package event
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	// EventsSuppressed ... state records not written to the event socket by the emit policy of their source
+	EventsSuppressed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: PTPNamespace,
+			Subsystem: PTPSubsystem,
+			Name:      "events_suppressed_total",
+			Help:      "Number of state events not emitted because neither their state nor their values changed, by process",
+		}, []string{"process"})
+
+	// DefaultEmitPolicies ... policies of the sources reporting every second, for the configs that opt in
+	DefaultEmitPolicies = map[string]EmitPolicy{
+		string(DPLL): {OffsetThreshold: 100, Heartbeat: 10},
+		string(GNSS): {OffsetThreshold: 100, Heartbeat: 10},
+		string(GM):   {Heartbeat: 10},
+	}
+)
+
+// EmitPolicy ... when a state record of a source is written to the event socket. A record is emitted when
+// the state, sourceLost, outOfSpec or a status value changed, when the offset moved by more than
+// OffsetThreshold ns since the last emitted record, or when Heartbeat seconds passed. The zero policy emits
+// every record.
+type EmitPolicy struct {
+	OffsetThreshold int64 `json:"offsetThreshold,omitempty"` // ns, 0 ignores offset changes of a policy with a heartbeat
+	Heartbeat       int   `json:"heartbeat,omitempty"`       // seconds
+}
+
+// suppresses ... true for a policy that can hold back records
+func (p EmitPolicy) suppresses() bool {
+	return p.OffsetThreshold > 0 || p.Heartbeat > 0
+}
+
+// ParseEmitPolicies ... emit policies by source from their YAML value
+//
+//	dpll:
+//	  offsetThreshold: 50
+//	  heartbeat: 30
+//	GM:
+//	  heartbeat: 5
+func ParseEmitPolicies(value string) (map[string]EmitPolicy, error) {
+	policies := map[string]EmitPolicy{}
+	if err := yaml.UnmarshalStrict([]byte(value), &policies); err != nil {
+		return nil, err
+	}
+	for source, p := range policies {
+		switch EventSource(source) {
+		case DPLL, GNSS, TS2PHC, PTP4l, PHC2SYS, SYNCE, EventSource(GM):
+		default:
+			return nil, fmt.Errorf("unknown event source %q", source)
+		}
+		if p.OffsetThreshold < 0 || p.Heartbeat < 0 {
+			return nil, fmt.Errorf("negative emit policy of %s", source)
+		}
+	}
+	return policies, nil
+}
+
+// emitFilter ... applies the emit policies of the configs to their state records
+type emitFilter struct {
+	policies map[string]map[string]EmitPolicy // by config and process
+	last     map[string]Record                // last emitted record by kind, config, process and interface
+}
+
+func newEmitFilter() *emitFilter {
+	return &emitFilter{policies: map[string]map[string]EmitPolicy{}, last: map[string]Record{}}
+}
+
+// allow ... true when the record is emitted, a suppressed record is counted
+func (f *emitFilter) allow(r Record) bool {
+	if r.Kind != StateRecord && r.Kind != GMStateRecord {
+		return true
+	}
+	p := f.policies[r.ConfigName][r.Process]
+	if !p.suppresses() {
+		return true
+	}
+	key := string(r.Kind) + "/" + r.ConfigName + "/" + r.Process + "/" + r.Interface
+	last, ok := f.last[key]
+	if !ok || changed(last, r, p) {
+		f.last[key] = r
+		return true
+	}
+	EventsSuppressed.WithLabelValues(r.Process).Inc()
+	return false
+}
+
+// forget ... emit the next record of the config process whatever the last emitted one was, the GM state
+// goes with ts2phc
+func (f *emitFilter) forget(cfgName string, process EventSource) {
+	for key, r := range f.last {
+		if r.ConfigName == cfgName && (r.Process == string(process) || (process == TS2PHC && r.Process == string(GM))) {
+			delete(f.last, key)
+		}
+	}
+}
+
+// changed ... true when r differs from the last emitted record by more than the policy allows
+func changed(last, r Record, p EmitPolicy) bool {
+	if last.State != r.State || last.SourceLost != r.SourceLost || last.OutOfSpec != r.OutOfSpec ||
+		!reflect.DeepEqual(last.ClockClass, r.ClockClass) {
+		return true
+	}
+	if p.Heartbeat > 0 && r.Time.Sub(last.Time) >= time.Duration(p.Heartbeat)*time.Second {
+		return true
+	}
+	for k, v := range r.Values {
+		if k == OFFSET {
+			continue
+		}
+		if !reflect.DeepEqual(v, last.Values[k]) {
+			return true
+		}
+	}
+	if p.OffsetThreshold > 0 {
+		offset, ok := offsetOf(r)
+		lastOffset, lastOk := offsetOf(last)
+		if ok != lastOk {
+			return true
+		}
+		if ok && (offset-lastOffset > p.OffsetThreshold || lastOffset-offset > p.OffsetThreshold) {
+			return true
+		}
+	}
+	return false
+}
+
+// offsetOf ... offset value of the record in ns
+func offsetOf(r Record) (int64, bool) {
+	switch v := r.Values[OFFSET].(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// WithDefaultEmitPolicies ... the policies, with the DefaultEmitPolicies of the sources they leave out
+func WithDefaultEmitPolicies(policies map[string]EmitPolicy) map[string]EmitPolicy {
+	merged := maps.Clone(DefaultEmitPolicies)
+	maps.Copy(merged, policies)
+	return merged
+}
+
+// SetEmitPolicies ... set the emit policies by source of the state records of a config, nil emits every record
+func (e *EventHandler) SetEmitPolicies(cfgName string, policies map[string]EmitPolicy) {
+	e.Lock()
+	defer e.Unlock()
+	if policies == nil {
+		delete(e.emit.policies, cfgName)
+		return
+	}
+	e.emit.policies[cfgName] = policies
+}
+
+// filterRecords ... records emitted by the policies of their sources
+func (e *EventHandler) filterRecords(records []Record) []Record {
+	emitted := records[:0]
+	for _, r := range records {
+		if e.emit.allow(r) {
+			emitted = append(emitted, r)
+		}
+	}
+	return emitted
+}
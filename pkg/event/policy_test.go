@@ -0,0 +1,220 @@
+package event_test
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openshift/linuxptp-daemon/pkg/event"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEmitPolicies(t *testing.T) {
+	policies, err := event.ParseEmitPolicies("dpll:\n  offsetThreshold: 50\n  heartbeat: 30\nGM:\n  heartbeat: 5\n")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]event.EmitPolicy{
+		"dpll": {OffsetThreshold: 50, Heartbeat: 30},
+		"GM":   {Heartbeat: 5},
+	}, policies)
+
+	_, err = event.ParseEmitPolicies("nmea:\n  heartbeat: 5\n")
+	assert.Error(t, err, "unknown source")
+	_, err = event.ParseEmitPolicies("gnss:\n  heartbeat: -1\n")
+	assert.Error(t, err, "negative heartbeat")
+	_, err = event.ParseEmitPolicies("gnss:\n  heartbeats: 1\n")
+	assert.Error(t, err, "unknown field")
+}
+
+func TestEventHandler_EmitPolicy(t *testing.T) {
+	mockLeap(t)
+	eChannel := make(chan event.EventChannel, 100)
+	closeChn := make(chan bool)
+	clockClassMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "policy_clock_class"}, []string{"process", "node", "config"})
+	offsetMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "policy_offset"}, []string{"from", "process", "node", "iface"})
+	clockMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "policy_clock_state"}, []string{"process", "node", "iface"})
+	eventManager := event.Init("node", false, "", eChannel, closeChn, offsetMetric, clockMetric, clockClassMetric)
+	eventManager.SetEmitPolicies("ts2phc.9.config", map[string]event.EmitPolicy{
+		string(event.DPLL): {OffsetThreshold: 100, Heartbeat: 1},
+	})
+	go eventManager.ProcessEvents()
+	defer close(closeChn)
+
+	suppressed := func() float64 { return testutil.ToFloat64(event.EventsSuppressed.WithLabelValues(string(event.DPLL))) }
+	before := suppressed()
+	send := func(state event.PTPState, offset int64, phaseStatus int) {
+		eChannel <- event.EventChannel{ProcessName: event.DPLL, ClockType: event.GM, CfgName: "ts2phc.9.config",
+			IFace: "ens1f0", State: state, WriteToLog: true, Time: time.Now().UnixMilli(),
+			Values: map[event.ValueType]interface{}{event.OFFSET: offset, event.PHASE_STATUS: phaseStatus}}
+	}
+	// the first record is emitted, the following ones within the offset threshold are not
+	send(event.PTP_LOCKED, 0, 3)
+	for i := 0; i < 5; i++ {
+		send(event.PTP_LOCKED, int64(10*i), 3)
+	}
+	// an offset change beyond the threshold, a status change and a state change are emitted
+	send(event.PTP_LOCKED, 200, 3)
+	send(event.PTP_LOCKED, 200, 4)
+	send(event.PTP_HOLDOVER, 200, 4)
+	assert.Eventually(t, func() bool { return suppressed()-before == 5 }, time.Second, 10*time.Millisecond)
+
+	// suppressed records still update the in memory state
+	send(event.PTP_HOLDOVER, 250, 4)
+	assert.Eventually(t, func() bool { return suppressed()-before == 6 }, time.Second, 10*time.Millisecond)
+	for _, p := range eventManager.Snapshot().Processes {
+		if p.ConfigName == "ts2phc.9.config" && p.Process == string(event.DPLL) && assert.NotEmpty(t, p.Details) {
+			assert.Equal(t, float64(250), p.Details[0].Values[string(event.OFFSET)])
+		}
+	}
+
+	// the heartbeat emits an unchanged record
+	time.Sleep(1100 * time.Millisecond)
+	send(event.PTP_HOLDOVER, 250, 4)
+	send(event.PTP_HOLDOVER, 250, 4)
+	assert.Eventually(t, func() bool { return suppressed()-before == 7 }, time.Second, 10*time.Millisecond)
+
+	// a config without emit policies writes every record, the default policies are opt-in
+	for i := 0; i < 3; i++ {
+		eChannel <- event.EventChannel{ProcessName: event.DPLL, ClockType: event.GM, CfgName: "ts2phc.8.config",
+			IFace: "ens2f0", State: event.PTP_LOCKED, WriteToLog: true, Time: time.Now().UnixMilli(),
+			Values: map[event.ValueType]interface{}{event.OFFSET: int64(0), event.PHASE_STATUS: 3}}
+	}
+	send(event.PTP_HOLDOVER, 250, 4)
+	assert.Eventually(t, func() bool { return suppressed()-before == 8 }, time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, float64(8), suppressed()-before)
+}
+
+func TestWithDefaultEmitPolicies(t *testing.T) {
+	policies := event.WithDefaultEmitPolicies(map[string]event.EmitPolicy{
+		string(event.GNSS):  {Heartbeat: 60},
+		string(event.PTP4l): {OffsetThreshold: 20},
+	})
+	// the policies of the profile replace the defaults of their sources only
+	assert.Equal(t, event.EmitPolicy{Heartbeat: 60}, policies[string(event.GNSS)])
+	assert.Equal(t, event.EmitPolicy{OffsetThreshold: 20}, policies[string(event.PTP4l)])
+	assert.Equal(t, event.DefaultEmitPolicies[string(event.DPLL)], policies[string(event.DPLL)])
+	assert.Equal(t, event.DefaultEmitPolicies[string(event.GM)], policies[string(event.GM)])
+	assert.Equal(t, event.EmitPolicy{OffsetThreshold: 100, Heartbeat: 10}, event.DefaultEmitPolicies[string(event.GNSS)])
+}
+
+func TestEventHandler_EmitPolicyReplay(t *testing.T) {
+	mockLeap(t)
+	socket := filepath.Join(t.TempDir(), "event.sock")
+	l, err := net.Listen("unix", socket)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+	eChannel := make(chan event.EventChannel, 100)
+	closeChn := make(chan bool)
+	clockClassMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "replay_clock_class"}, []string{"process", "node", "config"})
+	offsetMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "replay_offset"}, []string{"from", "process", "node", "iface"})
+	clockMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "replay_clock_state"}, []string{"process", "node", "iface"})
+	eventManager := event.Init("node", true, socket, eChannel, closeChn, offsetMetric, clockMetric, clockClassMetric)
+	eventManager.SetEmitPolicies("ts2phc.9.config", map[string]event.EmitPolicy{
+		string(event.DPLL): {OffsetThreshold: 100},
+	})
+	go eventManager.ProcessEvents()
+	defer close(closeChn)
+
+	send := func(process event.EventSource, offset int64) {
+		eChannel <- event.EventChannel{ProcessName: process, ClockType: event.GM, CfgName: "ts2phc.9.config",
+			IFace: "ens1f0", State: event.PTP_LOCKED, WriteToLog: true, Time: time.Now().UnixMilli(),
+			Values: map[event.ValueType]interface{}{event.OFFSET: offset}}
+	}
+	// readUntil ... read the lines written on the connection until one of the DPLL contains want
+	readUntil := func(c net.Conn, want string) bool {
+		assert.NoError(t, c.SetReadDeadline(time.Now().Add(3*time.Second)))
+		scanner := bufio.NewScanner(c)
+		for scanner.Scan() {
+			if strings.HasPrefix(scanner.Text(), "dpll[") && strings.Contains(scanner.Text(), want) {
+				return true
+			}
+		}
+		return false
+	}
+
+	c, err := l.Accept()
+	if !assert.NoError(t, err) {
+		return
+	}
+	send(event.DPLL, 0)
+	assert.True(t, readUntil(c, "offset 0"), "first record written")
+	// held back by the policy, still the latest value of the source
+	send(event.DPLL, 50)
+	time.Sleep(100 * time.Millisecond)
+	c.Close()
+
+	// the next write fails, the handler reconnects and replays the latest records
+	send(event.GNSS, 0)
+	send(event.GNSS, 0)
+	c, err = l.Accept()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+	assert.True(t, readUntil(c, "offset 50"), "suppressed record replayed")
+}
+
+func TestEventHandler_StaleSeriesReplay(t *testing.T) {
+	mockLeap(t)
+	socket := filepath.Join(t.TempDir(), "event.sock")
+	l, err := net.Listen("unix", socket)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+	eChannel := make(chan event.EventChannel, 100)
+	closeChn := make(chan bool)
+	clockClassMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "stale_clock_class"}, []string{"process", "node", "config"})
+	offsetMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "stale_offset"}, []string{"from", "process", "node", "iface"})
+	clockMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "stale_clock_state"}, []string{"process", "node", "iface"})
+	eventManager := event.Init("node", true, socket, eChannel, closeChn, offsetMetric, clockMetric, clockClassMetric)
+	go eventManager.ProcessEvents()
+	defer close(closeChn)
+
+	// readUntil ... read the lines written on the connection until one contains want
+	readUntil := func(c net.Conn, want string) bool {
+		assert.NoError(t, c.SetReadDeadline(time.Now().Add(3*time.Second)))
+		scanner := bufio.NewScanner(c)
+		for scanner.Scan() {
+			if strings.Contains(scanner.Text(), want) {
+				return true
+			}
+		}
+		return false
+	}
+
+	c, err := l.Accept()
+	if !assert.NoError(t, err) {
+		return
+	}
+	// the offset of the ptp4l series is no longer updated
+	eChannel <- event.EventChannel{ProcessName: event.PTP4l, CfgName: "ptp4l.7.config", IFace: "ens1fx",
+		State: event.PTP_FREERUN, WriteToLog: true, Time: time.Now().UnixMilli(),
+		Values: map[event.ValueType]interface{}{event.OFFSET: int64(999999)}}
+	assert.True(t, readUntil(c, "[ptp4l.7.config] ens1fx offset 999999 s0"), "stale series written")
+	records := event.EventHistory.Query(event.HistoryFilter{ConfigName: "ptp4l.7.config", Process: string(event.PTP4l)})
+	if assert.NotEmpty(t, records) {
+		assert.Equal(t, event.PTP_FREERUN, records[len(records)-1].State)
+	}
+	c.Close()
+
+	// the next write fails, the handler reconnects and replays the stale series
+	for i := 0; i < 2; i++ {
+		eChannel <- event.EventChannel{ProcessName: event.GNSS, ClockType: event.GM, CfgName: "ts2phc.7.config",
+			IFace: "ens1f0", State: event.PTP_LOCKED, WriteToLog: true, Time: time.Now().UnixMilli(),
+			Values: map[event.ValueType]interface{}{event.OFFSET: int64(i)}}
+	}
+	c, err = l.Accept()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+	assert.True(t, readUntil(c, "[ptp4l.7.config] ens1fx offset 999999 s0"), "stale series replayed")
+}
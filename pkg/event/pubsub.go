@@ -44,11 +44,11 @@ func (n *StateNotifier) Unregister(s Subscriber) {
 }
 
 func (n *StateNotifier) monitor() {
+	n.Lock()
+	defer n.Unlock()
 	if len(n.Subscribers) == 0 {
 		return
 	}
-	n.Lock()
-	defer n.Unlock()
 	for key, o := range n.Subscribers {
 		if o.Topic() == MONITORING {
 			o.Monitor()
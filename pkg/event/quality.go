@@ -0,0 +1,169 @@
+package event
+
+import (
+	"math"
+	"time"
+
+	fbprotocol "github.com/facebook/time/ptp/protocol"
+	"github.com/golang/glog"
+	"github.com/openshift/linuxptp-daemon/pkg/protocol"
+)
+
+const (
+	// QualityWindow ... time error samples of a source the clock quality is computed from
+	QualityWindow = 64
+	// QualityMinSamples ... samples of a source needed before its statistics are used
+	QualityMinSamples = 8
+	// QualityRecoveryTime ... time a better clock quality has to be measured before it is announced, a worse one is announced at once
+	QualityRecoveryTime = 30 * time.Second
+	// varianceDeadband ... changes of offsetScaledLogVariance below one octave of variance are not announced
+	varianceDeadband = 0x100
+)
+
+// timeErrorWindow ... last time error samples of a source in ns
+type timeErrorWindow struct {
+	samples []float64
+}
+
+// add ... append a sample, dropping the oldest one of a full window
+func (w *timeErrorWindow) add(offset float64) {
+	if len(w.samples) == QualityWindow {
+		copy(w.samples, w.samples[1:])
+		w.samples = w.samples[:QualityWindow-1]
+	}
+	w.samples = append(w.samples, offset)
+}
+
+// maxTimeError ... largest absolute time error of the window in ns
+func (w *timeErrorWindow) maxTimeError() float64 {
+	m := 0.0
+	for _, x := range w.samples {
+		m = math.Max(m, math.Abs(x))
+	}
+	return m
+}
+
+// ptpVariance ... PTP variance of the window in s² at the sample interval, IEEE 1588-2019 section 7.6.3.3.
+// It is the time variance TVAR(τ0) = 1/(6(N-2)) Σ (x[i+2] - 2x[i+1] + x[i])², insensitive to a constant
+// time error and to a constant frequency offset of the phase samples x.
+func (w *timeErrorWindow) ptpVariance() float64 {
+	n := len(w.samples)
+	if n < 3 {
+		return 0
+	}
+	sum := 0.0
+	for i := 0; i+2 < n; i++ {
+		d := (w.samples[i+2] - 2*w.samples[i+1] + w.samples[i]) * 1e-9
+		sum += d * d
+	}
+	return sum / float64(6*(n-2))
+}
+
+// clockQuality ... time error statistics of the GNSS, ts2phc and DPLL sources of a config and the clockAccuracy
+// and offsetScaledLogVariance measured from them. The worst source decides the quality.
+type clockQuality struct {
+	windows           map[string]*timeErrorWindow // by source and interface
+	measured          bool
+	accuracy          fbprotocol.ClockAccuracy
+	variance          uint16
+	accuracyCandidate fbprotocol.ClockAccuracy // better accuracy waiting for QualityRecoveryTime
+	accuracySince     time.Time
+	varianceCandidate uint16 // better variance waiting for QualityRecoveryTime
+	varianceSince     time.Time
+}
+
+func newClockQuality() *clockQuality {
+	return &clockQuality{windows: map[string]*timeErrorWindow{}}
+}
+
+func qualityKey(source EventSource, iface string) string {
+	return string(source) + "/" + iface
+}
+
+// add ... time error sample of a source interface in ns
+func (q *clockQuality) add(source EventSource, iface string, offset int64) {
+	key := qualityKey(source, iface)
+	w, ok := q.windows[key]
+	if !ok {
+		w = &timeErrorWindow{}
+		q.windows[key] = w
+	}
+	w.add(float64(offset))
+}
+
+// drop ... forget the samples of a source interface that lost its lock, the samples after the loss start a new window
+func (q *clockQuality) drop(source EventSource, iface string) {
+	delete(q.windows, qualityKey(source, iface))
+}
+
+// measure ... clockAccuracy from the largest time error and offsetScaledLogVariance from the largest PTP
+// variance of the sources with enough samples, false when there is no such source
+func (q *clockQuality) measure() (fbprotocol.ClockAccuracy, uint16, bool) {
+	maxTE, maxVar, ok := 0.0, 0.0, false
+	for _, w := range q.windows {
+		if len(w.samples) < QualityMinSamples {
+			continue
+		}
+		ok = true
+		maxTE = math.Max(maxTE, w.maxTimeError())
+		maxVar = math.Max(maxVar, w.ptpVariance())
+	}
+	if !ok {
+		return fbprotocol.ClockAccuracyUnknown, 0xffff, false
+	}
+	return fbprotocol.ClockAccuracyFromOffset(time.Duration(maxTE) * time.Nanosecond),
+		protocol.OffsetScaledLogVarianceFromVariance(maxVar), true
+}
+
+// update ... measured quality with hysteresis, each field on its own: a worse value is taken at once, a better
+// one once it has been measured for QualityRecoveryTime, and variance changes within the deadband are ignored
+func (q *clockQuality) update(now time.Time) (fbprotocol.ClockAccuracy, uint16, bool) {
+	accuracy, variance, ok := q.measure()
+	if !ok {
+		return q.accuracy, q.variance, q.measured
+	}
+	if !q.measured {
+		q.measured, q.accuracy, q.variance = true, accuracy, variance
+		return q.accuracy, q.variance, true
+	}
+	switch {
+	case accuracy > q.accuracy:
+		glog.Infof("measured clock accuracy degraded to 0x%x", accuracy)
+		q.accuracy, q.accuracySince = accuracy, time.Time{}
+	case accuracy == q.accuracy:
+		q.accuracySince = time.Time{}
+	case q.accuracySince.IsZero() || q.accuracyCandidate != accuracy:
+		q.accuracyCandidate, q.accuracySince = accuracy, now
+	case now.Sub(q.accuracySince) >= QualityRecoveryTime:
+		glog.Infof("measured clock accuracy improved to 0x%x", accuracy)
+		q.accuracy, q.accuracySince = accuracy, time.Time{}
+	}
+	switch {
+	case absDiff(variance, q.variance) < varianceDeadband:
+		q.varianceSince = time.Time{}
+	case variance > q.variance:
+		glog.Infof("measured offsetScaledLogVariance degraded to 0x%x", variance)
+		q.variance, q.varianceSince = variance, time.Time{}
+	case q.varianceSince.IsZero() || absDiff(q.varianceCandidate, variance) >= varianceDeadband:
+		q.varianceCandidate, q.varianceSince = variance, now
+	case now.Sub(q.varianceSince) >= QualityRecoveryTime:
+		glog.Infof("measured offsetScaledLogVariance improved to 0x%x", variance)
+		q.variance, q.varianceSince = variance, time.Time{}
+	}
+	return q.accuracy, q.variance, true
+}
+
+func absDiff(a, b uint16) uint16 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// worseAccuracy ... the larger, less accurate of two clockAccuracy values
+func worseAccuracy(a, b fbprotocol.ClockAccuracy) fbprotocol.ClockAccuracy {
+	if a > b {
+		return a
+	}
+	return b
+}
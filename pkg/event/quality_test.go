@@ -0,0 +1,183 @@
+package event_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	fbprotocol "github.com/facebook/time/ptp/protocol"
+	"github.com/openshift/linuxptp-daemon/pkg/event"
+	"github.com/openshift/linuxptp-daemon/pkg/protocol"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOffsetScaledLogVarianceFromVariance(t *testing.T) {
+	// the G.8275.1 PRTC-A value is a PTP deviation of about 34ns
+	assert.Equal(t, uint16(0x4e5d), protocol.OffsetScaledLogVarianceFromVariance(1.14e-15))
+	assert.Equal(t, uint16(0x4e00), protocol.OffsetScaledLogVarianceFromVariance(math.Exp2(-50)))
+	assert.Equal(t, uint16(0x8000), protocol.OffsetScaledLogVarianceFromVariance(1))
+	assert.Equal(t, uint16(0xffff), protocol.OffsetScaledLogVarianceFromVariance(1e40))
+	assert.Equal(t, uint16(0), protocol.OffsetScaledLogVarianceFromVariance(0))
+}
+
+func TestEventHandler_MeasuredClockQuality(t *testing.T) {
+	getter, setter := event.PMCGMGetter, event.PMCGMSetter
+	defer func() { event.PMCGMGetter, event.PMCGMSetter = getter, setter }()
+	current := protocol.GrandmasterSettings{}
+	set := make(chan protocol.GrandmasterSettings, 100)
+	event.PMCGMGetter = func(cfgName string) (protocol.GrandmasterSettings, error) {
+		return current, nil
+	}
+	event.PMCGMSetter = func(cfgName string, g protocol.GrandmasterSettings) error {
+		current = g
+		set <- g
+		return nil
+	}
+	mockLeap(t)
+
+	eChannel := make(chan event.EventChannel, 100)
+	closeChn := make(chan bool)
+	clockClassMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "quality_clock_class"}, []string{"process", "node", "config"})
+	offsetMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "quality_offset"}, []string{"from", "process", "node", "iface"})
+	clockMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "quality_clock_state"}, []string{"process", "node", "iface"})
+	eventManager := event.Init("node", false, "", eChannel, closeChn, offsetMetric, clockMetric, clockClassMetric)
+	go eventManager.ProcessEvents()
+	defer close(closeChn)
+
+	start := time.Now()
+	send := func(process event.EventSource, at time.Duration, values map[event.ValueType]interface{}) {
+		eChannel <- event.EventChannel{ProcessName: process, ClockType: event.GM, CfgName: "ts2phc.0.config",
+			IFace: "ens1f0", State: event.PTP_LOCKED, Values: values, Time: start.Add(at).UnixMilli()}
+	}
+	// the clock quality of the last GRANDMASTER_SETTINGS_NP set once the events are processed
+	settle := func() protocol.GrandmasterSettings {
+		var g protocol.GrandmasterSettings
+		for {
+			select {
+			case g = <-set:
+			case <-time.After(500 * time.Millisecond):
+				return g
+			}
+		}
+	}
+
+	send(event.DPLL, 0, map[event.ValueType]interface{}{event.OFFSET: int64(0), event.PHASE_STATUS: 3, event.FREQUENCY_STATUS: 3})
+	send(event.GNSS, 0, map[event.ValueType]interface{}{event.OFFSET: int64(0), event.GPS_STATUS: 3})
+	for i := 0; i < event.QualityMinSamples; i++ {
+		send(event.TS2PHC, time.Duration(i)*time.Second, map[event.ValueType]interface{}{event.OFFSET: int64(1)})
+	}
+	g := settle()
+	assert.Equal(t, fbprotocol.ClockClass6, g.ClockQuality.ClockClass)
+	// a stable chain announces the profile values
+	assert.Equal(t, fbprotocol.ClockAccuracyNanosecond100, g.ClockQuality.ClockAccuracy)
+	assert.Equal(t, uint16(0x4e5d), g.ClockQuality.OffsetScaledLogVariance)
+
+	// a noisy ts2phc degrades the announced quality at once:
+	// TVAR = 1200ns² / 6, 0x5615 within the deadband of the variance steps, and a time error of 300ns, accuracy within 1µs
+	at := time.Duration(event.QualityMinSamples) * time.Second
+	for i := 0; i < event.QualityWindow; i++ {
+		offset := int64(300)
+		if i%2 == 1 {
+			offset = -300
+		}
+		send(event.TS2PHC, at, map[event.ValueType]interface{}{event.OFFSET: offset})
+		at += time.Second
+	}
+	g = settle()
+	assert.Equal(t, fbprotocol.ClockClass6, g.ClockQuality.ClockClass)
+	assert.Equal(t, fbprotocol.ClockAccuracyMicrosecond1, g.ClockQuality.ClockAccuracy)
+	assert.InDelta(t, 0x5615, g.ClockQuality.OffsetScaledLogVariance, 0x100)
+
+	// better figures are measured once the noisy samples left the window, they are announced after the recovery time
+	for i := 0; i < event.QualityWindow; i++ {
+		send(event.TS2PHC, at, map[event.ValueType]interface{}{event.OFFSET: int64(1)})
+		at += time.Second
+	}
+	assert.Empty(t, settle().ClockQuality.ClockClass, "nothing is set before the recovery time")
+	for end := at + event.QualityRecoveryTime; at <= end; at += time.Second {
+		send(event.TS2PHC, at, map[event.ValueType]interface{}{event.OFFSET: int64(1)})
+	}
+	g = settle()
+	assert.Equal(t, fbprotocol.ClockAccuracyNanosecond100, g.ClockQuality.ClockAccuracy)
+	assert.Equal(t, uint16(0x4e5d), g.ClockQuality.OffsetScaledLogVariance)
+}
+
+func TestEventHandler_MeasuredClockQualityFields(t *testing.T) {
+	getter, setter := event.PMCGMGetter, event.PMCGMSetter
+	defer func() { event.PMCGMGetter, event.PMCGMSetter = getter, setter }()
+	current := protocol.GrandmasterSettings{}
+	set := make(chan protocol.GrandmasterSettings, 100)
+	event.PMCGMGetter = func(cfgName string) (protocol.GrandmasterSettings, error) {
+		return current, nil
+	}
+	event.PMCGMSetter = func(cfgName string, g protocol.GrandmasterSettings) error {
+		current = g
+		set <- g
+		return nil
+	}
+	mockLeap(t)
+
+	eChannel := make(chan event.EventChannel, 100)
+	closeChn := make(chan bool)
+	clockClassMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "fields_clock_class"}, []string{"process", "node", "config"})
+	offsetMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "fields_offset"}, []string{"from", "process", "node", "iface"})
+	clockMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "fields_clock_state"}, []string{"process", "node", "iface"})
+	eventManager := event.Init("node", false, "", eChannel, closeChn, offsetMetric, clockMetric, clockClassMetric)
+	go eventManager.ProcessEvents()
+	defer close(closeChn)
+
+	start := time.Now()
+	at := time.Duration(0)
+	send := func(process event.EventSource, state event.PTPState, values map[event.ValueType]interface{}) {
+		eChannel <- event.EventChannel{ProcessName: process, ClockType: event.GM, CfgName: "ts2phc.1.config",
+			IFace: "ens1f0", State: state, Values: values, Time: start.Add(at).UnixMilli()}
+	}
+	ts2phc := func(offsets ...int64) {
+		for _, offset := range offsets {
+			send(event.TS2PHC, event.PTP_LOCKED, map[event.ValueType]interface{}{event.OFFSET: offset})
+			at += time.Second
+		}
+	}
+	settle := func() protocol.GrandmasterSettings {
+		var g protocol.GrandmasterSettings
+		for {
+			select {
+			case g = <-set:
+			case <-time.After(500 * time.Millisecond):
+				return g
+			}
+		}
+	}
+	repeat := func(offset int64, n int) []int64 {
+		offsets := make([]int64, n)
+		for i := range offsets {
+			offsets[i] = offset
+		}
+		return offsets
+	}
+
+	send(event.DPLL, event.PTP_LOCKED, map[event.ValueType]interface{}{event.OFFSET: int64(0), event.PHASE_STATUS: 3, event.FREQUENCY_STATUS: 3})
+	send(event.GNSS, event.PTP_LOCKED, map[event.ValueType]interface{}{event.OFFSET: int64(0), event.GPS_STATUS: 3})
+	// a constant time error of 2µs: a worse accuracy and, once the step left the window, a zero variance
+	ts2phc(repeat(2000, event.QualityWindow+int(event.QualityRecoveryTime/time.Second)+1)...)
+	g := settle()
+	assert.Equal(t, fbprotocol.ClockAccuracyMicrosecond2point5, g.ClockQuality.ClockAccuracy)
+	assert.Equal(t, uint16(0x4e5d), g.ClockQuality.OffsetScaledLogVariance)
+
+	// ts2phc loses its lock, its samples are dropped
+	send(event.TS2PHC, event.PTP_FREERUN, map[event.ValueType]interface{}{event.OFFSET: int64(2000)})
+	at += time.Second
+	settle()
+
+	// back with a time error within 100ns: the accuracy improves while the variance worsens
+	ts2phc(30, 18, 30, 18, 30, 18, 30, 18)
+	assert.Equal(t, fbprotocol.ClockAccuracyMicrosecond2point5, settle().ClockQuality.ClockAccuracy)
+	// the variance worsens by more than an octave after the recovery time, the better accuracy is announced
+	// nevertheless
+	at += event.QualityRecoveryTime
+	ts2phc(-100)
+	g = settle()
+	assert.Equal(t, fbprotocol.ClockAccuracyNanosecond100, g.ClockQuality.ClockAccuracy)
+	assert.Equal(t, uint16(0x4e5d), g.ClockQuality.OffsetScaledLogVariance)
+}
@@ -38,6 +38,7 @@ type DataDetails struct {
 	logData      string
 	signalSource EventSource // GNSS PPS
 	sourceLost   bool
+	values       map[ValueType]interface{} // last values received, exposed by the query api
 }
 
 // UpdateState .. update process state
@@ -79,7 +80,9 @@ func (d *Data) AddEvent(event EventChannel) {
 					if len(StateRegisterer.Subscribers) > 0 {
 						go StateRegisterer.notify(event.ProcessName, event.State)
 					}
+					publishTransition(event, dd.State)
 				}
+				dd.values = event.Values
 				dd.State = event.State
 				dd.sourceLost = event.SourceLost
 				dd.ClockType = event.ClockType
@@ -100,7 +103,9 @@ func (d *Data) AddEvent(event EventChannel) {
 		logData:    event.GetLogData(),
 		State:      event.State,
 		sourceLost: event.SourceLost,
+		values:     event.Values,
 	}
+	publishTransition(event, PTP_NOTSET)
 	d.logData = details.logData
 	d.Details = append(d.Details, details)
 	if len(StateRegisterer.Subscribers) > 0 {
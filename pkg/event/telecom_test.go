@@ -0,0 +1,98 @@
+package event_test
+
+import (
+	"testing"
+	"time"
+
+	fbprotocol "github.com/facebook/time/ptp/protocol"
+	"github.com/openshift/linuxptp-daemon/pkg/event"
+	"github.com/openshift/linuxptp-daemon/pkg/protocol"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTelecomProfile(t *testing.T) {
+	p, err := protocol.ParseTelecomProfile("g.8275.2", "prtc-b", true)
+	assert.NoError(t, err)
+	assert.True(t, p.PartialTiming())
+	assert.Equal(t, protocol.ClockClassBCHoldoverInSpec, p.ClockClass(fbprotocol.ClockClass7))
+	assert.Equal(t, protocol.ClockClassBCHoldoverOutOfSpec, p.ClockClass(protocol.ClockClassOutOfSpec))
+	assert.Equal(t, fbprotocol.ClockClass6, p.ClockClass(fbprotocol.ClockClass6))
+	assert.Equal(t, fbprotocol.ClockAccuracyNanosecond25, p.LockedClockAccuracy())
+	assert.Equal(t, uint16(0x4b32), p.LockedOffsetScaledLogVariance())
+
+	p, err = protocol.ParseTelecomProfile("", "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, protocol.ProfileG8275_1, p.Name)
+	assert.Equal(t, fbprotocol.ClockClass7, p.ClockClass(fbprotocol.ClockClass7))
+	assert.Equal(t, fbprotocol.ClockAccuracyNanosecond100, p.LockedClockAccuracy())
+	assert.Equal(t, uint16(0x4e5d), p.LockedOffsetScaledLogVariance())
+
+	_, err = protocol.ParseTelecomProfile(protocol.ProfileG8275_1, "", true)
+	assert.Error(t, err, "APTS is a G.8275.2 variant")
+	_, err = protocol.ParseTelecomProfile("G.8265.1", "", false)
+	assert.Error(t, err)
+	_, err = protocol.ParseTelecomProfile("", "PRTC-C", false)
+	assert.Error(t, err)
+}
+
+func TestEventHandler_TelecomProfileClockClass(t *testing.T) {
+	getter, setter := event.PMCGMGetter, event.PMCGMSetter
+	defer func() { event.PMCGMGetter, event.PMCGMSetter = getter, setter }()
+	current := protocol.GrandmasterSettings{}
+	set := make(chan protocol.GrandmasterSettings, 10)
+	event.PMCGMGetter = func(cfgName string) (protocol.GrandmasterSettings, error) {
+		return current, nil
+	}
+	event.PMCGMSetter = func(cfgName string, g protocol.GrandmasterSettings) error {
+		current = g
+		set <- g
+		return nil
+	}
+	mockLeap(t)
+
+	eChannel := make(chan event.EventChannel, 10)
+	closeChn := make(chan bool)
+	clockClassMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "telecom_clock_class"}, []string{"process", "node", "config"})
+	offsetMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "telecom_offset"}, []string{"from", "process", "node", "iface"})
+	clockMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "telecom_clock_state"}, []string{"process", "node", "iface"})
+	eventManager := event.Init("node", false, "", eChannel, closeChn, offsetMetric, clockMetric, clockClassMetric)
+	profile, err := protocol.ParseTelecomProfile(protocol.ProfileG8275_2, protocol.PRTCB, true)
+	assert.NoError(t, err)
+	eventManager.SetTelecomProfile("ptp4l.0.config", profile)
+	go eventManager.ProcessEvents()
+	defer close(closeChn)
+
+	send := func(process event.EventSource, state event.PTPState, values map[event.ValueType]interface{}) {
+		eChannel <- event.EventChannel{ProcessName: process, ClockType: event.GM, CfgName: "ts2phc.0.config",
+			IFace: "ens1f0", State: state, Values: values, Time: time.Now().UnixMilli()}
+	}
+	next := func() protocol.GrandmasterSettings {
+		select {
+		case g := <-set:
+			return g
+		case <-time.After(5 * time.Second):
+			t.Fatal("clock class was not set")
+		}
+		return protocol.GrandmasterSettings{}
+	}
+
+	send(event.DPLL, event.PTP_LOCKED, map[event.ValueType]interface{}{event.OFFSET: int64(0), event.PHASE_STATUS: 3, event.FREQUENCY_STATUS: 3})
+	send(event.GNSS, event.PTP_LOCKED, map[event.ValueType]interface{}{event.OFFSET: int64(0), event.GPS_STATUS: 3})
+	send(event.TS2PHC, event.PTP_LOCKED, map[event.ValueType]interface{}{event.OFFSET: int64(0)})
+	g := next()
+	for g.ClockQuality.ClockClass != fbprotocol.ClockClass6 {
+		g = next()
+	}
+	// PRTC-B locked
+	assert.Equal(t, fbprotocol.ClockAccuracyNanosecond25, g.ClockQuality.ClockAccuracy)
+	assert.Equal(t, uint16(0x4b32), g.ClockQuality.OffsetScaledLogVariance)
+
+	// APTS holdover announces the T-BC holdover class
+	send(event.GNSS, event.PTP_FREERUN, map[event.ValueType]interface{}{event.OFFSET: int64(0), event.GPS_STATUS: 0})
+	send(event.DPLL, event.PTP_HOLDOVER, map[event.ValueType]interface{}{event.OFFSET: int64(0), event.PHASE_STATUS: 4, event.FREQUENCY_STATUS: 4})
+	g = next()
+	assert.Equal(t, protocol.ClockClassBCHoldoverInSpec, g.ClockQuality.ClockClass)
+	assert.True(t, g.TimePropertiesDS.TimeTraceable)
+	assert.Equal(t, fbprotocol.TimeSourceInternalOscillator, g.TimePropertiesDS.TimeSource)
+}
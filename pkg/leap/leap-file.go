@@ -41,11 +41,15 @@ type LeapManager struct {
 	UbloxLsInd chan ublox.TimeLs
 	// Close channel
 	Close chan bool
+	// Done channel, closed when Run returned
+	Done chan struct{}
 	// ts2phc path of leap-seconds.list file
 	LeapFilePath string
 	// client
 	client    kubernetes.Interface
 	namespace string
+	// Leap file and UTC offset lock, they are read outside Run
+	dataLock sync.RWMutex
 	// Leap file structure
 	leapFile LeapFile
 	// Retry configmap update if failed
@@ -77,41 +81,65 @@ var lock = &sync.Mutex{}
 var LeapMgr *LeapManager
 
 func New(kubeclient kubernetes.Interface, namespace string) (*LeapManager, error) {
+	lock.Lock()
+	defer lock.Unlock()
 	if LeapMgr == nil {
-		lock.Lock()
-		defer lock.Unlock()
-		if LeapMgr == nil {
-			lm := &LeapManager{
-				UbloxLsInd:   make(chan ublox.TimeLs, 2),
-				Close:        make(chan bool),
-				client:       kubeclient,
-				namespace:    namespace,
-				leapFile:     LeapFile{},
-				leapFilePath: defaultLeapFilePath,
-				leapFileName: defaultLeapFileName,
-			}
-			err := lm.populateLeapData()
-			if err != nil {
-				return nil, err
-			}
-			LeapMgr = lm
+		lm := &LeapManager{
+			UbloxLsInd:   make(chan ublox.TimeLs, 2),
+			Close:        make(chan bool),
+			Done:         make(chan struct{}),
+			client:       kubeclient,
+			namespace:    namespace,
+			leapFile:     LeapFile{},
+			leapFilePath: defaultLeapFilePath,
+			leapFileName: defaultLeapFileName,
 		}
+		err := lm.populateLeapData()
+		if err != nil {
+			return nil, err
+		}
+		LeapMgr = lm
 	}
 	return LeapMgr, nil
 }
 
+// Manager returns the running leap manager, nil when there is none
+func Manager() *LeapManager {
+	lock.Lock()
+	defer lock.Unlock()
+	return LeapMgr
+}
+
 func GetUtcOffset() int {
-	if LeapMgr != nil {
-		if time.Now().UTC().After(LeapMgr.utcOffsetTime) {
-			return LeapMgr.utcOffset
-		} else if len(LeapMgr.leapFile.LeapEvents) > 1 {
-			return LeapMgr.leapFile.LeapEvents[len(LeapMgr.leapFile.LeapEvents)-2].LeapSec
+	if lm := Manager(); lm != nil {
+		lm.dataLock.RLock()
+		defer lm.dataLock.RUnlock()
+		if time.Now().UTC().After(lm.utcOffsetTime) {
+			return lm.utcOffset
+		} else if len(lm.leapFile.LeapEvents) > 1 {
+			return lm.leapFile.LeapEvents[len(lm.leapFile.LeapEvents)-2].LeapSec
 		}
 	}
 	glog.Fatal("failed to get UTC offset")
 	return 0
 }
 
+// GetLeapFile returns a copy of the leap file data
+func (l *LeapManager) GetLeapFile() LeapFile {
+	l.dataLock.RLock()
+	defer l.dataLock.RUnlock()
+	lf := l.leapFile
+	lf.LeapEvents = append([]LeapEvent{}, l.leapFile.LeapEvents...)
+	return lf
+}
+
+// UtcOffset returns the current UTC offset
+func (l *LeapManager) UtcOffset() int {
+	l.dataLock.RLock()
+	defer l.dataLock.RUnlock()
+	return l.utcOffset
+}
+
 func (l *LeapManager) setUtcOffset() error {
 	startTime := time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC)
 	lastLeap := l.leapFile.LeapEvents[len(l.leapFile.LeapEvents)-1]
@@ -239,13 +267,16 @@ func (l *LeapManager) populateLeapData() error {
 
 func (l *LeapManager) Run() {
 	glog.Info("starting Leap file manager")
+	defer close(l.Done)
 	ticker := time.NewTicker(MaintenancePeriod)
 	for {
 		select {
 		case v := <-l.UbloxLsInd:
 			l.handleLeapIndication(&v)
 		case <-l.Close:
+			lock.Lock()
 			LeapMgr = nil
+			lock.Unlock()
 			return
 		case <-ticker.C:
 			if l.retryUpdate {
@@ -289,6 +320,8 @@ func (l *LeapManager) Run() {
 // updateLeapFile updates a new leap event to the list of leap events, if provided
 func (l *LeapManager) updateLeapFile(leapTime time.Time,
 	leapSec int, currentTime time.Time) {
+	l.dataLock.Lock()
+	defer l.dataLock.Unlock()
 
 	startTime := time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC)
 	if leapSec != 0 {
@@ -402,7 +402,7 @@ func Test_Run(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 	offset := GetUtcOffset()
 	assert.Equal(t, 38, offset)
-	close(LeapMgr.Close)
-	time.Sleep(100 * time.Millisecond)
-	assert.Nil(t, LeapMgr)
+	close(lm.Close)
+	<-lm.Done
+	assert.Nil(t, Manager())
 }
@@ -19,6 +19,9 @@ var (
 	CmdGetParentDataSet   = "GET PARENT_DATA_SET"
 	CmdGetGMSettings      = "GET GRANDMASTER_SETTINGS_NP"
 	CmdSetGMSettings      = "SET GRANDMASTER_SETTINGS_NP"
+	CmdGetPortDataSet     = "GET PORT_DATA_SET"
+	CmdGetPortDataSetNP   = "GET PORT_DATA_SET_NP"
+	CmdGetTimeStatusNP    = "GET TIME_STATUS_NP"
 	cmdTimeout            = 2000 * time.Millisecond
 	sigTimeout            = 500 * time.Millisecond
 	numRetry              = 6
@@ -0,0 +1,107 @@
+package protocol
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+)
+
+var (
+	//	507c6f.fffe.1fb1b8-1 seq 0 RESPONSE MANAGEMENT PORT_DATA_SET
+	//		portIdentity            507c6f.fffe.1fb1b8-1
+	//		portState               SLAVE
+	//		logMinDelayReqInterval  0
+	//		peerMeanPathDelay       412
+	portDataSetRegEx = regexp.MustCompile(`PORT_DATA_SET\s+portIdentity\s+[0-9a-f.]+-(\d+)\s+portState\s+(\w+)\s+logMinDelayReqInterval\s+-?\d+\s+peerMeanPathDelay\s+(-?\d+)`)
+	//	507c6f.fffe.1fb1b8-1 seq 1 RESPONSE MANAGEMENT PORT_DATA_SET_NP
+	//		neighborPropDelayThresh 800
+	//		asCapable               1
+	portDataSetNPRegEx = regexp.MustCompile(`[0-9a-f.]+-(\d+) seq \d+ RESPONSE MANAGEMENT PORT_DATA_SET_NP\s+neighborPropDelayThresh\s+(\d+)\s+asCapable\s+(\d+)`)
+	//	cumulativeScaledRateOffset +0.000000015
+	//	...
+	//	gmPresent                  true
+	timeStatusNPRegEx = regexp.MustCompile(`cumulativeScaledRateOffset\s+([+-]?\d+(?:\.\d+)?)[\s\S]*?gmPresent\s+(true|false)`)
+)
+
+// PortDataSet ... state and peer delay of a ptp4l port, pmc GET PORT_DATA_SET
+type PortDataSet struct {
+	PortNumber        int
+	PortState         string
+	PeerMeanPathDelay int64 // ns, the neighborPropDelay of a gPTP port
+}
+
+// PortDataSetNP ... gPTP state of a ptp4l port, pmc GET PORT_DATA_SET_NP
+type PortDataSetNP struct {
+	PortNumber              int
+	NeighborPropDelayThresh int64 // ns
+	AsCapable               bool
+}
+
+// TimeStatusNP ... rate offset to the grandmaster, pmc GET TIME_STATUS_NP
+type TimeStatusNP struct {
+	CumulativeScaledRateOffset float64 // (rateRatio - 1) as printed by pmc
+	GMPresent                  bool
+}
+
+// RateRatio ... ratio of the grandmaster frequency to the local clock frequency, IEEE 802.1AS-2020 section 10.2.4.9
+func (t TimeStatusNP) RateRatio() float64 {
+	return 1 + t.CumulativeScaledRateOffset
+}
+
+// PortDataSetRegEx ... regex matching the PORT_DATA_SET responses of n ports
+func PortDataSetRegEx(n int) *regexp.Regexp {
+	return repeatRegEx(portDataSetRegEx, n)
+}
+
+// PortDataSetNPRegEx ... regex matching the PORT_DATA_SET_NP responses of n ports
+func PortDataSetNPRegEx(n int) *regexp.Regexp {
+	return repeatRegEx(portDataSetNPRegEx, n)
+}
+
+// TimeStatusNPRegEx ... regex matching the TIME_STATUS_NP response
+func TimeStatusNPRegEx() *regexp.Regexp {
+	return timeStatusNPRegEx
+}
+
+// ParsePortDataSets ... PORT_DATA_SET of every port in the pmc output
+func ParsePortDataSets(result string) []PortDataSet {
+	var ds []PortDataSet
+	for _, m := range portDataSetRegEx.FindAllStringSubmatch(result, -1) {
+		port, _ := strconv.Atoi(m[1])
+		delay, _ := strconv.ParseInt(m[3], 10, 64)
+		ds = append(ds, PortDataSet{PortNumber: port, PortState: m[2], PeerMeanPathDelay: delay})
+	}
+	return ds
+}
+
+// ParsePortDataSetsNP ... PORT_DATA_SET_NP of every port in the pmc output
+func ParsePortDataSetsNP(result string) []PortDataSetNP {
+	var ds []PortDataSetNP
+	for _, m := range portDataSetNPRegEx.FindAllStringSubmatch(result, -1) {
+		port, _ := strconv.Atoi(m[1])
+		thresh, _ := strconv.ParseInt(m[2], 10, 64)
+		ds = append(ds, PortDataSetNP{PortNumber: port, NeighborPropDelayThresh: thresh, AsCapable: m[3] == "1"})
+	}
+	return ds
+}
+
+// ParseTimeStatusNP ... TIME_STATUS_NP in the pmc output, false when there is none
+func ParseTimeStatusNP(result string) (TimeStatusNP, bool) {
+	m := timeStatusNPRegEx.FindStringSubmatch(result)
+	if m == nil {
+		return TimeStatusNP{}, false
+	}
+	offset, err := strconv.ParseFloat(m[1], 64)
+	if err != nil || math.IsNaN(offset) {
+		return TimeStatusNP{}, false
+	}
+	return TimeStatusNP{CumulativeScaledRateOffset: offset, GMPresent: m[2] == "true"}, true
+}
+
+// repeatRegEx ... regex matching n occurrences of re, pmc prints one response per port
+func repeatRegEx(re *regexp.Regexp, n int) *regexp.Regexp {
+	if n < 1 {
+		n = 1
+	}
+	return regexp.MustCompile(`(?:` + re.String() + `[\s\S]*?){` + strconv.Itoa(n) + `}`)
+}
@@ -0,0 +1,95 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/facebook/time/ptp/protocol"
+)
+
+const (
+	// ProfileG8275_1 ... ITU-T G.8275.1 full timing support telecom profile
+	ProfileG8275_1 = "G.8275.1"
+	// ProfileG8275_2 ... ITU-T G.8275.2 partial timing support telecom profile, unicast over IPv4/IPv6
+	ProfileG8275_2 = "G.8275.2"
+	// PRTCA ... primary reference time clock class A, T-REC-G.8272
+	PRTCA = "PRTC-A"
+	// PRTCB ... primary reference time clock class B, T-REC-G.8272
+	PRTCB = "PRTC-B"
+)
+
+// TelecomProfile ... telecom profile of a ptp4l instance and the PRTC it is connected to.
+// APTS is set for assisted partial timing support, where the T-GM is a T-BC-A keeping time from
+// the local PRTC and announces the T-BC holdover clock classes, T-REC-G.8275.2-202211-I section 6.7.
+type TelecomProfile struct {
+	Name string
+	PRTC string
+	APTS bool
+}
+
+// ParseTelecomProfile ... telecom profile from its name and PRTC variant, an empty name is G.8275.1
+func ParseTelecomProfile(name, prtc string, apts bool) (TelecomProfile, error) {
+	p := TelecomProfile{Name: ProfileG8275_1, PRTC: PRTCA, APTS: apts}
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "", ProfileG8275_1:
+	case ProfileG8275_2:
+		p.Name = ProfileG8275_2
+	default:
+		return p, fmt.Errorf("unsupported telecom profile %q, expected %s or %s", name, ProfileG8275_1, ProfileG8275_2)
+	}
+	switch strings.ToUpper(strings.TrimSpace(prtc)) {
+	case "", PRTCA:
+	case PRTCB:
+		p.PRTC = PRTCB
+	default:
+		return p, fmt.Errorf("unsupported PRTC %q, expected %s or %s", prtc, PRTCA, PRTCB)
+	}
+	if p.APTS && p.Name != ProfileG8275_2 {
+		return p, fmt.Errorf("APTS requires the %s profile", ProfileG8275_2)
+	}
+	return p, nil
+}
+
+// PartialTiming ... true for the G.8275.2 profile
+func (p TelecomProfile) PartialTiming() bool {
+	return p.Name == ProfileG8275_2
+}
+
+// ClockClass ... clock class announced by the T-GM for the G.8275.1 clock class of its state.
+// An APTS clock in holdover announces the T-BC holdover classes 135 and 165 instead of 7 and 140.
+func (p TelecomProfile) ClockClass(c protocol.ClockClass) protocol.ClockClass {
+	if !p.APTS {
+		return c
+	}
+	switch c {
+	case protocol.ClockClass7:
+		return ClockClassBCHoldoverInSpec
+	case ClockClassOutOfSpec:
+		return ClockClassBCHoldoverOutOfSpec
+	}
+	return c
+}
+
+// LockedClockAccuracy ... clockAccuracy of a T-GM locked to the PRTC, T-REC-G.8275.1-202211-I annex A
+func (p TelecomProfile) LockedClockAccuracy() protocol.ClockAccuracy {
+	if p.PRTC == PRTCB {
+		return protocol.ClockAccuracyNanosecond25
+	}
+	return protocol.ClockAccuracyNanosecond100
+}
+
+// LockedOffsetScaledLogVariance ... offsetScaledLogVariance of a T-GM locked to the PRTC, T-REC-G.8275.1-202211-I section 6.3.5
+func (p TelecomProfile) LockedOffsetScaledLogVariance() uint16 {
+	if p.PRTC == PRTCB {
+		return 0x4b32
+	}
+	return 0x4e5d
+}
+
+func (p TelecomProfile) String() string {
+	s := fmt.Sprintf("%s %s", p.Name, p.PRTC)
+	if p.APTS {
+		s += " APTS"
+	}
+	return s
+}
@@ -3,6 +3,7 @@ package protocol
 import (
 	"fmt"
 	"github.com/golang/glog"
+	"math"
 	"strconv"
 	"strings"
 
@@ -14,6 +15,10 @@ const (
 	ClockClassFreerun       protocol.ClockClass = 248
 	ClockClassUninitialized protocol.ClockClass = 0
 	ClockClassOutOfSpec     protocol.ClockClass = 140
+	// ClockClassBCHoldoverInSpec ... T-BC in holdover, within holdover specification
+	ClockClassBCHoldoverInSpec protocol.ClockClass = 135
+	// ClockClassBCHoldoverOutOfSpec ... T-BC in holdover, out of holdover specification
+	ClockClassBCHoldoverOutOfSpec protocol.ClockClass = 165
 )
 
 type GrandmasterSettings struct {
@@ -155,3 +160,19 @@ func stoi32(s string) int32 {
 	}
 	return int32(int64Value)
 }
+
+// OffsetScaledLogVarianceFromVariance ... offsetScaledLogVariance of a PTP variance in s², IEEE 1588-2019 section 7.6.3.3:
+// the base 2 logarithm of the variance scaled by 2^8 and offset by 0x8000, 0xffff when it is too large to be represented
+func OffsetScaledLogVarianceFromVariance(variance float64) uint16 {
+	if variance <= 0 {
+		return 0
+	}
+	v := math.Ceil(math.Log2(variance)*256) + 0x8000
+	switch {
+	case v < 0:
+		return 0
+	case v >= 0xffff:
+		return 0xffff
+	}
+	return uint16(v)
+}
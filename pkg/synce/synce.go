@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/golang/glog"
 	"github.com/openshift/linuxptp-daemon/pkg/event"
@@ -275,7 +276,8 @@ type Config struct {
 
 // Relations ... synce config object relations
 type Relations struct {
-	Devices []*Config
+	sync.Mutex // guards the last clock and quality level states of the devices
+	Devices    []*Config
 }
 
 // AddDeviceConfig .. add device config
@@ -412,6 +414,26 @@ func (c *Config) ClockQuality(qualityInfo QualityLevelInfo) (clock string, ql Qu
 	return
 }
 
+// prcTraceable ... quality levels traceable to a PRC or better, G.8275.1 frequency traceable
+var prcTraceable = map[string]bool{EPRTC.String(): true, PRTC.String(): true, PRC.String(): true, PRS.String(): true}
+
+// FrequencyTraceable ... true when the EEC of the device is locked and one of its interfaces receives a QL
+// traceable to a PRC (PRS in option 2 networks) or better
+func (c *Config) FrequencyTraceable() bool {
+	if c.LastClockState != event.PTP_LOCKED {
+		return false
+	}
+	for _, ql := range c.LastQLState {
+		if ql == nil {
+			continue
+		}
+		if level, _ := c.ClockQuality(*ql); prcTraceable[level] {
+			return true
+		}
+	}
+	return false
+}
+
 // ParseLog .. parse synce4l logs
 func ParseLog(output string) LogEntry {
 	// Regular expressions for extracting data
@@ -2,6 +2,7 @@ package synce_test
 
 import (
 	"fmt"
+	"github.com/openshift/linuxptp-daemon/pkg/event"
 	"github.com/openshift/linuxptp-daemon/pkg/synce"
 	"github.com/stretchr/testify/assert"
 	"k8s.io/utils/pointer"
@@ -208,3 +209,29 @@ func InitLogTestCase() {
 	}
 
 }
+
+func TestFrequencyTraceable(t *testing.T) {
+	device := synce.Config{
+		Name:          "synce1",
+		Ifaces:        []string{"ens7f0", "ens7f1"},
+		NetworkOption: synce.SYNCE_NETWORK_OPT_1,
+		ExtendedTlv:   synce.ExtendedTLV_DISABLED,
+		LastQLState: map[string]*synce.QualityLevelInfo{
+			"ens7f0": {SSM: 0xF, ExtendedSSM: synce.QL_DEFAULT_ENHSSM}, // DNU
+		},
+	}
+	assert.False(t, device.FrequencyTraceable(), "EEC not locked")
+	device.LastClockState = event.PTP_LOCKED
+	assert.False(t, device.FrequencyTraceable(), "DNU")
+	device.LastQLState["ens7f1"] = &synce.QualityLevelInfo{SSM: 0x4, ExtendedSSM: synce.QL_DEFAULT_ENHSSM} // SSU-A
+	assert.False(t, device.FrequencyTraceable(), "SSU-A is worse than PRC")
+	device.LastQLState["ens7f1"] = &synce.QualityLevelInfo{SSM: 0x2, ExtendedSSM: synce.QL_DEFAULT_ENHSSM} // PRC
+	assert.True(t, device.FrequencyTraceable())
+	device.LastClockState = event.PTP_HOLDOVER
+	assert.False(t, device.FrequencyTraceable(), "EEC in holdover")
+
+	device.LastClockState = event.PTP_LOCKED
+	device.NetworkOption = synce.SYNCE_NETWORK_OPT_2
+	device.LastQLState = map[string]*synce.QualityLevelInfo{"ens7f0": {SSM: 0x1}} // PRS
+	assert.True(t, device.FrequencyTraceable())
+}